@@ -6,7 +6,10 @@ require (
 	github.com/gdamore/tcell/v2 v2.7.1
 	github.com/mattn/go-sqlite3 v1.14.28
 	github.com/rivo/tview v0.0.0-20250501113434-0c592cd31026
+	go.starlark.net v0.0.0-20240925182052-1207426daebd
 	golang.design/x/clipboard v0.7.0
+	golang.org/x/crypto v0.19.0
+	golang.org/x/term v0.17.0
 )
 
 require (
@@ -18,6 +21,5 @@ require (
 	golang.org/x/image v0.6.0 // indirect
 	golang.org/x/mobile v0.0.0-20230301163155-e0f57694e12c // indirect
 	golang.org/x/sys v0.17.0 // indirect
-	golang.org/x/term v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
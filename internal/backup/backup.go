@@ -0,0 +1,315 @@
+// Package backup keeps rotating snapshots of the SQLite task database in a
+// backups directory next to it and restores them.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go-todo/internal/storage"
+)
+
+// DirName is the directory, next to the database, that backups are kept in.
+const DirName = "backups"
+
+// Interval is how often a running application takes a snapshot.
+const Interval = time.Hour
+
+// stampLayout is the local time embedded in backup file names.
+const stampLayout = "20060102-150405"
+
+// Source is a database that can write a consistent copy of itself, such as
+// *storage.Store.
+type Source interface {
+	Backup(ctx context.Context, path string) error
+}
+
+// Policy says how many snapshots to keep: the newest one of each of the
+// last Daily days and of each of the last Weekly ISO weeks that have any.
+type Policy struct {
+	Daily  int
+	Weekly int
+}
+
+// WithDefaults fills in unset counts: a week of dailies and four weeklies.
+func (p Policy) WithDefaults() Policy {
+	if p.Daily <= 0 {
+		p.Daily = 7
+	}
+	if p.Weekly <= 0 {
+		p.Weekly = 4
+	}
+	return p
+}
+
+// Backup is one snapshot file.
+type Backup struct {
+	Name string
+	Path string
+	Time time.Time
+	Size int64
+}
+
+// Rotation manages the backups of one database file.
+type Rotation struct {
+	DBPath string
+	Dir    string
+	Policy Policy
+	// now is the clock used to name snapshots; tests replace it.
+	now func() time.Time
+}
+
+// For returns the rotation for the database at dbPath, kept in a backups
+// directory beside it.
+func For(dbPath string, policy Policy) *Rotation {
+	return &Rotation{
+		DBPath: dbPath,
+		Dir:    filepath.Join(filepath.Dir(dbPath), DirName),
+		Policy: policy.WithDefaults(),
+		now:    time.Now,
+	}
+}
+
+// prefix is the start of every backup name, the database name without its
+// extension, e.g. "tasks-".
+func (r *Rotation) prefix() string {
+	base := filepath.Base(r.DBPath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// parse reports whether name is one of this rotation's backups and when it
+// was taken.
+func (r *Rotation) parse(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, r.prefix())
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, ".db")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(stampLayout, stamp, time.Local)
+	return t, err == nil
+}
+
+// List returns the backups, newest first. A missing directory means there
+// are none.
+func (r *Rotation) List() ([]Backup, error) {
+	entries, err := os.ReadDir(r.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading backups: %w", err)
+	}
+	var backups []Backup
+	for _, entry := range entries {
+		taken, ok := r.parse(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("reading backups: %w", err)
+		}
+		backups = append(backups, Backup{
+			Name: entry.Name(),
+			Path: filepath.Join(r.Dir, entry.Name()),
+			Time: taken,
+			Size: info.Size(),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// Find returns the backup called name.
+func (r *Rotation) Find(name string) (Backup, error) {
+	backups, err := r.List()
+	if err != nil {
+		return Backup{}, err
+	}
+	for _, b := range backups {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return Backup{}, fmt.Errorf("no backup called %q in %s", name, r.Dir)
+}
+
+// Create snapshots src into a new backup. The copy is written under a
+// temporary name and only kept if it passes an integrity check, so a
+// damaged database never replaces a good backup.
+func (r *Rotation) Create(ctx context.Context, src Source) (Backup, error) {
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return Backup{}, fmt.Errorf("creating backups directory: %w", err)
+	}
+	// Never overwrite a backup taken within the same second; it may be
+	// the one about to be restored.
+	taken := r.now().Truncate(time.Second)
+	name := r.prefix() + taken.Format(stampLayout) + ".db"
+	path := filepath.Join(r.Dir, name)
+	for fileExists(path) {
+		taken = taken.Add(time.Second)
+		name = r.prefix() + taken.Format(stampLayout) + ".db"
+		path = filepath.Join(r.Dir, name)
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+
+	if err := src.Backup(ctx, tmp); err != nil {
+		return Backup{}, err
+	}
+	if err := storage.CheckIntegrity(ctx, tmp); err != nil {
+		return Backup{}, fmt.Errorf("new backup failed its check: %w", err)
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return Backup{}, fmt.Errorf("reading new backup: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return Backup{}, fmt.Errorf("saving backup: %w", err)
+	}
+	return Backup{Name: name, Path: path, Time: taken, Size: info.Size()}, nil
+}
+
+// Prune deletes the backups the policy does not keep and returns them.
+// The newest backup is always kept.
+func (r *Rotation) Prune() ([]Backup, error) {
+	backups, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]bool)
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for i, b := range backups {
+		day := b.Time.Format("2006-01-02")
+		year, week := b.Time.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%02d", year, week)
+		if i == 0 {
+			keep[b.Name] = true
+		}
+		// Backups are newest first, so the first one seen in a day or week
+		// is the one to keep for it.
+		if !days[day] && len(days) < r.Policy.Daily {
+			days[day] = true
+			keep[b.Name] = true
+		}
+		if !weeks[weekKey] && len(weeks) < r.Policy.Weekly {
+			weeks[weekKey] = true
+			keep[b.Name] = true
+		}
+	}
+
+	var removed []Backup
+	for _, b := range backups {
+		if keep[b.Name] {
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil {
+			return removed, fmt.Errorf("removing old backup: %w", err)
+		}
+		removed = append(removed, b)
+	}
+	return removed, nil
+}
+
+// Snapshot creates a backup of src and then prunes old ones.
+func (r *Rotation) Snapshot(ctx context.Context, src Source) (Backup, error) {
+	b, err := r.Create(ctx, src)
+	if err != nil {
+		return Backup{}, err
+	}
+	if _, err := r.Prune(); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// Run takes a snapshot of src straight away and then every interval until
+// ctx is cancelled. Failures are logged and retried at the next tick.
+func (r *Rotation) Run(ctx context.Context, src Source, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if b, err := r.Snapshot(ctx, src); err != nil {
+			log.Printf("Backup failed: %v", err)
+		} else {
+			log.Printf("Backed up to %s", b.Path)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Restore replaces the database with the backup called name after checking
+// the backup's integrity. Nothing may have the database open: stale WAL
+// files from the replaced database are removed so they are not applied to
+// the restored one.
+func (r *Rotation) Restore(ctx context.Context, name string) error {
+	b, err := r.Find(name)
+	if err != nil {
+		return err
+	}
+	if err := storage.CheckIntegrity(ctx, b.Path); err != nil {
+		return err
+	}
+
+	tmp := r.DBPath + ".restore"
+	if err := copyFile(b.Path, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copying backup: %w", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(r.DBPath + suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			os.Remove(tmp)
+			return fmt.Errorf("removing old journal: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, r.DBPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("replacing database: %w", err)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// copyFile copies src to dst and syncs it to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newRotation opens a fresh database in a temp dir and returns it with its
+// rotation, whose clock starts at start and moves on an hour per snapshot.
+func newRotation(t *testing.T, start time.Time) (*storage.Store, *Rotation) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	store, err := storage.NewStoreAt(path)
+	if err != nil {
+		t.Fatalf("NewStoreAt failed: %v", err)
+	}
+	t.Cleanup(store.Close)
+	r := For(path, Policy{})
+	clock := start
+	r.now = func() time.Time {
+		clock = clock.Add(time.Hour)
+		return clock
+	}
+	return store, r
+}
+
+func names(backups []Backup) []string {
+	var got []string
+	for _, b := range backups {
+		got = append(got, b.Name)
+	}
+	return got
+}
+
+func TestCreateAndList(t *testing.T) {
+	store, r := newRotation(t, time.Date(2026, 10, 18, 8, 0, 0, 0, time.Local))
+	if _, err := store.AddTask(ctx, "a"); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	first, err := r.Create(ctx, store)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if first.Name != "tasks-20261018-090000.db" {
+		t.Errorf("Expected a name with the snapshot time, got %s", first.Name)
+	}
+	if _, err := r.Create(ctx, store); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	// Files that are not backups of this database are ignored.
+	os.WriteFile(filepath.Join(r.Dir, "notes.txt"), nil, 0o644)
+
+	backups, err := r.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if got := names(backups); len(got) != 2 || got[0] != "tasks-20261018-100000.db" {
+		t.Errorf("Expected two backups newest first, got %v", got)
+	}
+	if err := storage.CheckIntegrity(ctx, first.Path); err != nil {
+		t.Errorf("Expected a valid backup, got %v", err)
+	}
+}
+
+func TestPrune_KeepsDailyAndWeekly(t *testing.T) {
+	r := For(filepath.Join(t.TempDir(), "tasks.db"), Policy{Daily: 2, Weekly: 2})
+	os.MkdirAll(r.Dir, 0o755)
+	for _, stamp := range []string{
+		"20261018-120000", // Sun, week 42: newest, kept
+		"20261018-090000", // same day, older
+		"20261017-120000", // Sat: second daily
+		"20261016-120000", // Fri, week 42, beyond the dailies
+		"20261011-120000", // Sun, week 41: second weekly
+		"20261010-120000", // week 41, older
+		"20261004-120000", // week 40, beyond the weeklies
+	} {
+		os.WriteFile(filepath.Join(r.Dir, "tasks-"+stamp+".db"), nil, 0o644)
+	}
+
+	if _, err := r.Prune(); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	backups, _ := r.List()
+	want := []string{"tasks-20261018-120000.db", "tasks-20261017-120000.db", "tasks-20261011-120000.db"}
+	got := names(backups)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store, r := newRotation(t, time.Now())
+	store.AddTask(ctx, "kept")
+	b, err := r.Create(ctx, store)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	store.AddTask(ctx, "lost")
+	store.Close()
+
+	if err := r.Restore(ctx, b.Name); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored, err := storage.NewStoreAt(r.DBPath)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer restored.Close()
+	tasks, _ := restored.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "kept" {
+		t.Errorf("Expected only the backed up task, got %+v", tasks)
+	}
+}
+
+func TestRestore_RejectsCorruptBackup(t *testing.T) {
+	store, r := newRotation(t, time.Now())
+	store.AddTask(ctx, "current")
+	store.Close()
+	os.MkdirAll(r.Dir, 0o755)
+	bad := "tasks-20261018-090000.db"
+	os.WriteFile(filepath.Join(r.Dir, bad), []byte("this is not a database"), 0o644)
+
+	if err := r.Restore(ctx, bad); !errors.Is(err, storage.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+	if err := r.Restore(ctx, "tasks-19990101-000000.db"); err == nil {
+		t.Error("Expected an error for an unknown backup")
+	}
+	if err := storage.CheckIntegrity(ctx, r.DBPath); err != nil {
+		t.Errorf("Expected the database untouched, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed is returned when a resource changed on the server
+// since its ETag was read.
+var ErrPreconditionFailed = errors.New("the task changed on the CalDAV server")
+
+// ErrGone is returned for a resource that is not on the server.
+var ErrGone = errors.New("the task is not on the CalDAV server")
+
+// multistatus is the part of a 207 response the client reads.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ETag         string `xml:"DAV: getetag"`
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// Client talks to one calendar collection on a CalDAV server.
+type Client struct {
+	// URL is the collection's URL, ending in a slash.
+	URL      *url.URL
+	User     string
+	Password string
+	HTTP     *http.Client
+}
+
+// NewClient returns a client for the collection at collectionURL, logging
+// in with user and password if user is set.
+func NewClient(collectionURL, user, password string) (*Client, error) {
+	u, err := url.Parse(collectionURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid CalDAV collection URL %q", collectionURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &Client{URL: u, User: user, Password: password, HTTP: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// resolve turns an href as the server gives it into an absolute URL.
+func (c *Client) resolve(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return href
+	}
+	return c.URL.ResolveReference(u).String()
+}
+
+func (c *Client) do(ctx context.Context, method, target string, body []byte, headers ...string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("contacting CalDAV server: %w", err)
+	}
+	return resp, nil
+}
+
+// unexpected describes a response the client cannot use.
+func unexpected(method string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("CalDAV server refused the login: %s", resp.Status)
+	}
+	return fmt.Errorf("CalDAV %s: unexpected response %s", method, resp.Status)
+}
+
+// propfind asks for the ETags at target and returns them by absolute URL,
+// leaving out collections.
+func (c *Client) propfind(ctx context.Context, target, depth string) (map[string]string, error) {
+	body := []byte(xml.Header + `<d:propfind xmlns:d="DAV:"><d:prop><d:getetag/><d:resourcetype/></d:prop></d:propfind>`)
+	resp, err := c.do(ctx, "PROPFIND", target, body, "Depth", depth, "Content-Type", `application/xml; charset="utf-8"`)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, unexpected("PROPFIND", resp)
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("reading CalDAV listing: %w", err)
+	}
+	etags := make(map[string]string)
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") || ps.Prop.ResourceType.Collection != nil || ps.Prop.ETag == "" {
+				continue
+			}
+			etags[c.resolve(r.Href)] = ps.Prop.ETag
+		}
+	}
+	return etags, nil
+}
+
+// List returns the ETag of every resource in the collection by its URL.
+func (c *Client) List(ctx context.Context) (map[string]string, error) {
+	return c.propfind(ctx, c.URL.String(), "1")
+}
+
+// Get fetches the todo at href along with its ETag.
+func (c *Client) Get(ctx context.Context, href string) (Todo, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return Todo{}, "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return Todo{}, "", ErrGone
+	default:
+		return Todo{}, "", unexpected("GET", resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return Todo{}, "", fmt.Errorf("reading %s: %w", href, err)
+	}
+	todo, err := ParseTodo(data)
+	if err != nil {
+		return Todo{}, "", fmt.Errorf("reading %s: %w", href, err)
+	}
+	todo.Summary = strings.TrimSpace(todo.Summary)
+	return todo, resp.Header.Get("ETag"), nil
+}
+
+// Put writes todo to href and returns its new ETag. With an ETag, the
+// resource is only replaced if it still has it; without one, it is only
+// created if it does not exist yet. Either failing gives
+// ErrPreconditionFailed.
+func (c *Client) Put(ctx context.Context, href string, todo Todo, etag string) (string, error) {
+	condition := []string{"If-None-Match", "*"}
+	if etag != "" {
+		condition = []string{"If-Match", etag}
+	}
+	resp, err := c.do(ctx, http.MethodPut, href, todo.Encode(), append(condition, "Content-Type", "text/calendar; charset=utf-8")...)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusPreconditionFailed:
+		return "", ErrPreconditionFailed
+	default:
+		return "", unexpected("PUT", resp)
+	}
+	if tag := resp.Header.Get("ETag"); tag != "" && !strings.HasPrefix(tag, "W/") {
+		return tag, nil
+	}
+	// The server changed what it stored, so its ETag has to be asked for.
+	etags, err := c.propfind(ctx, href, "0")
+	if err != nil {
+		return "", err
+	}
+	return etags[c.resolve(href)], nil
+}
+
+// Delete removes the resource at href if it still has the given ETag. A
+// resource that is already gone is not an error.
+func (c *Client) Delete(ctx context.Context, href, etag string) error {
+	resp, err := c.do(ctx, http.MethodDelete, href, nil, "If-Match", etag)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusGone:
+		return nil
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	}
+	return unexpected("DELETE", resp)
+}
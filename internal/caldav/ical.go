@@ -0,0 +1,227 @@
+package caldav
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-todo/internal/models"
+)
+
+// taskLayout is the layout of task timestamps, which are in UTC.
+const taskLayout = "2006-01-02 15:04:05"
+
+// icalLayout is a UTC date-time in iCalendar.
+const icalLayout = "20060102T150405Z"
+
+// ErrNoTodo is returned when a calendar object holds no VTODO.
+var ErrNoTodo = errors.New("calendar object holds no VTODO")
+
+// Todo is the part of a VTODO that maps onto a task. Times use the task
+// layout and the due date YYYY-MM-DD, as in models.Task.
+type Todo struct {
+	UID          string
+	Summary      string
+	Done         bool
+	Due          string
+	Completed    string
+	Created      string
+	LastModified string
+}
+
+// todoFor describes a task as a VTODO with the given UID.
+func todoFor(task models.Task, uid string) Todo {
+	return Todo{
+		UID:          uid,
+		Summary:      task.Description,
+		Done:         task.Done,
+		Due:          task.Due,
+		Completed:    task.CompletedAt,
+		Created:      task.CreatedAt,
+		LastModified: task.UpdatedAt,
+	}
+}
+
+// Encode writes the todo as an iCalendar object.
+func (t Todo) Encode() []byte {
+	var b bytes.Buffer
+	line := func(s string) {
+		// Lines longer than 75 octets are folded, without splitting a
+		// character.
+		for len(s) > 75 {
+			cut := 75
+			for !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//go-todo//go-todo//EN")
+	line("BEGIN:VTODO")
+	line("UID:" + escapeText(t.UID))
+	stamp := toICal(t.LastModified)
+	if stamp == "" {
+		stamp = time.Now().UTC().Format(icalLayout)
+	}
+	line("DTSTAMP:" + stamp)
+	if created := toICal(t.Created); created != "" {
+		line("CREATED:" + created)
+	}
+	if modified := toICal(t.LastModified); modified != "" {
+		line("LAST-MODIFIED:" + modified)
+	}
+	line("SUMMARY:" + escapeText(t.Summary))
+	if t.Due != "" {
+		line("DUE;VALUE=DATE:" + strings.ReplaceAll(t.Due, "-", ""))
+	}
+	if t.Done {
+		line("STATUS:COMPLETED")
+		if completed := toICal(t.Completed); completed != "" {
+			line("COMPLETED:" + completed)
+		}
+	} else {
+		line("STATUS:NEEDS-ACTION")
+	}
+	line("END:VTODO")
+	line("END:VCALENDAR")
+	return b.Bytes()
+}
+
+// ParseTodo reads the first VTODO of an iCalendar object. Properties it
+// does not map onto a task are ignored.
+func ParseTodo(data []byte) (Todo, error) {
+	var todo Todo
+	found, inTodo := false, false
+	status := ""
+	for _, l := range unfold(data) {
+		name, _, value := splitProperty(l)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VTODO") && !found:
+			inTodo, found = true, true
+		case name == "END" && strings.EqualFold(value, "VTODO"):
+			inTodo = false
+		case !inTodo:
+		case name == "UID":
+			todo.UID = unescapeText(value)
+		case name == "SUMMARY":
+			todo.Summary = unescapeText(value)
+		case name == "STATUS":
+			status = strings.ToUpper(value)
+		case name == "COMPLETED":
+			todo.Completed = fromICal(value)
+		case name == "CREATED":
+			todo.Created = fromICal(value)
+		case name == "LAST-MODIFIED":
+			todo.LastModified = fromICal(value)
+		case name == "DUE":
+			// A due date-time keeps only its date.
+			if len(value) >= 8 {
+				if due, err := time.Parse("20060102", value[:8]); err == nil {
+					todo.Due = due.Format("2006-01-02")
+				}
+			}
+		}
+	}
+	if !found {
+		return Todo{}, ErrNoTodo
+	}
+	todo.Done = status == "COMPLETED" || (status == "" && todo.Completed != "")
+	if !todo.Done {
+		todo.Completed = ""
+	}
+	return todo, nil
+}
+
+// unfold splits an iCalendar object into its logical lines.
+func unfold(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		l := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// splitProperty splits a content line into its upper-case name, its
+// parameters and its value. Parameter values may be quoted and hold colons.
+func splitProperty(l string) (name, params, value string) {
+	quoted := false
+	for i, r := range l {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ':' && !quoted:
+			head := l[:i]
+			name, params, _ = strings.Cut(head, ";")
+			return strings.ToUpper(name), params, l[i+1:]
+		}
+	}
+	return strings.ToUpper(l), "", ""
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(strings.ReplaceAll(s, "\r\n", "\n"))
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// toICal converts a task timestamp to an iCalendar UTC date-time, or ""
+// if it is empty or malformed.
+func toICal(s string) string {
+	t, err := time.Parse(taskLayout, s)
+	if err != nil {
+		return ""
+	}
+	return t.Format(icalLayout)
+}
+
+// fromICal converts an iCalendar date-time to a task timestamp. Floating
+// times and dates are taken as UTC.
+func fromICal(s string) string {
+	for _, layout := range []string{icalLayout, "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format(taskLayout)
+		}
+	}
+	return ""
+}
+
+// etag derives a task's entity tag from when it was last updated. The
+// version is added because updated_at only counts seconds.
+func etag(task models.Task) string {
+	return fmt.Sprintf(`"%s-%d"`, strings.NewReplacer("-", "", " ", "T", ":", "").Replace(task.UpdatedAt), task.Version)
+}
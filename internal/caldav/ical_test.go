@@ -0,0 +1,58 @@
+package caldav
+
+import (
+	"strings"
+	"testing"
+
+	"go-todo/internal/models"
+)
+
+func TestTodo_RoundTrip(t *testing.T) {
+	task := models.Task{
+		ID:          3,
+		Description: "Buy milk, eggs; and a very long list of other things that needs folding\nsecond line",
+		Done:        true,
+		CreatedAt:   "2026-10-01 09:00:00",
+		UpdatedAt:   "2026-10-02 10:30:00",
+		Due:         "2026-10-05",
+		CompletedAt: "2026-10-02 10:30:00",
+	}
+	data := todoFor(task, "abc@example.com").Encode()
+	for _, l := range strings.Split(string(data), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("Expected lines folded at 75 octets, got %q", l)
+		}
+	}
+	if !strings.Contains(string(data), `SUMMARY:Buy milk\, eggs\; and`) {
+		t.Errorf("Expected escaped text, got %s", data)
+	}
+
+	todo, err := ParseTodo(data)
+	if err != nil {
+		t.Fatalf("ParseTodo failed: %v", err)
+	}
+	want := Todo{UID: "abc@example.com", Summary: task.Description, Done: true, Due: "2026-10-05",
+		Completed: task.CompletedAt, Created: task.CreatedAt, LastModified: task.UpdatedAt}
+	if todo != want {
+		t.Errorf("Expected %+v, got %+v", want, todo)
+	}
+}
+
+func TestParseTodo_ClientObject(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Phone//EN\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VTODO\r\nUID:1234\r\nSUMMARY:Call\r\n  the bank\r\n" +
+		"DUE;TZID=\"Europe/Berlin\":20261003T170000\r\nPERCENT-COMPLETE:0\r\n" +
+		"END:VTODO\r\nEND:VCALENDAR\r\n"
+	todo, err := ParseTodo([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseTodo failed: %v", err)
+	}
+	if todo.Summary != "Call the bank" || todo.Due != "2026-10-03" || todo.Done || todo.UID != "1234" {
+		t.Errorf("Unexpected todo %+v", todo)
+	}
+
+	if _, err := ParseTodo([]byte("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")); err != ErrNoTodo {
+		t.Errorf("Expected ErrNoTodo, got %v", err)
+	}
+}
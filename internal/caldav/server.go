@@ -0,0 +1,567 @@
+// Package caldav exposes tasks to CalDAV clients, such as the task apps of
+// phones, as a calendar collection of VTODO resources, and syncs them with
+// the collection of another CalDAV server.
+package caldav
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-todo/internal/controller"
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// TokenEnv is the environment variable the server's token can be given in.
+const TokenEnv = "GO_TODO_CALDAV_TOKEN"
+
+// collection is the path of the task collection below the server's prefix.
+const collection = "tasks/"
+
+// aliasesMetaKey holds the names and UIDs clients gave their tasks, in
+// stores that keep metadata.
+const aliasesMetaKey = "caldav_aliases"
+
+// maxBodySize bounds request bodies.
+const maxBodySize = 1 << 20
+
+// metaStore is a store that keeps metadata, such as storage.Backend. Other
+// stores work too, but forget the names clients chose when the server
+// restarts.
+type metaStore interface {
+	GetMeta(ctx context.Context, key string) (string, error)
+	SetMeta(ctx context.Context, key, value string) error
+}
+
+// aliases are the resource names and UIDs clients gave the tasks they
+// created, so the tasks stay where the clients put them. Other tasks are
+// called <id>.ics, with UID go-todo-<id>.
+type aliases struct {
+	Names map[string]int `json:"names"`
+	UIDs  map[int]string `json:"uids"`
+}
+
+// Server serves the tasks in a store over CalDAV to clients that present
+// its token, either as a bearer token or as the password of HTTP basic
+// authentication with any user name.
+type Server struct {
+	store  controller.Store
+	token  string
+	prefix string
+
+	// mu serializes requests, so a PUT creating a task and the alias that
+	// names it are seen together.
+	mu      sync.Mutex
+	aliases aliases
+	// names maps a task's ID back to its name in aliases.Names.
+	names map[int]string
+}
+
+// NewServer returns a server for store below the URL path prefix, e.g.
+// "/dav/". The home collection is at the prefix and the tasks are in its
+// tasks/ collection.
+func NewServer(ctx context.Context, store controller.Store, token, prefix string) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("the CalDAV server needs a token")
+	}
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	if prefix == "//" {
+		prefix = "/"
+	}
+	s := &Server{store: store, token: token, prefix: prefix, aliases: aliases{Names: make(map[string]int), UIDs: make(map[int]string)}}
+	if meta, ok := store.(metaStore); ok {
+		value, err := meta.GetMeta(ctx, aliasesMetaKey)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			if err := json.Unmarshal([]byte(value), &s.aliases); err != nil {
+				return nil, fmt.Errorf("reading CalDAV names: %w", err)
+			}
+		}
+	}
+	s.names = make(map[int]string, len(s.aliases.Names))
+	for name, id := range s.aliases.Names {
+		s.names[id] = name
+	}
+	return s, nil
+}
+
+// prune forgets the aliases of tasks that no longer exist, so a new task
+// that gets an old ID is not mistaken for the one a client created. The
+// caller must hold s.mu.
+func (s *Server) prune(tasks []models.Task) {
+	exists := make(map[int]bool, len(tasks))
+	for _, task := range tasks {
+		exists[task.ID] = true
+	}
+	for name, id := range s.aliases.Names {
+		if !exists[id] {
+			delete(s.aliases.Names, name)
+			delete(s.names, id)
+		}
+	}
+	for id := range s.aliases.UIDs {
+		if !exists[id] {
+			delete(s.aliases.UIDs, id)
+		}
+	}
+}
+
+// saveAliases stores the aliases if the store keeps metadata. The caller
+// must hold s.mu.
+func (s *Server) saveAliases(ctx context.Context) error {
+	meta, ok := s.store.(metaStore)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(s.aliases)
+	if err != nil {
+		return fmt.Errorf("saving CalDAV names: %w", err)
+	}
+	return meta.SetMeta(ctx, aliasesMetaKey, string(data))
+}
+
+// name returns the resource name of a task.
+func (s *Server) name(task models.Task) string {
+	if name, ok := s.names[task.ID]; ok {
+		return name
+	}
+	return strconv.Itoa(task.ID) + ".ics"
+}
+
+// setName records the name a client gave a task. The caller must hold s.mu.
+func (s *Server) setName(name string, id int) {
+	s.aliases.Names[name] = id
+	s.names[id] = name
+}
+
+func (s *Server) uid(task models.Task) string {
+	if uid, ok := s.aliases.UIDs[task.ID]; ok {
+		return uid
+	}
+	return "go-todo-" + strconv.Itoa(task.ID)
+}
+
+func (s *Server) href(name string) string {
+	return s.prefix + collection + url.PathEscape(name)
+}
+
+// tasks returns the listed tasks; archived ones are not served.
+func (s *Server) tasks(ctx context.Context) ([]models.Task, error) {
+	return s.store.GetTasks(ctx, models.TaskQuery{})
+}
+
+// find returns the task with the resource name name.
+func (s *Server) find(tasks []models.Task, name string) (models.Task, bool) {
+	id, ok := s.aliases.Names[name]
+	if !ok {
+		n, err := strconv.Atoi(strings.TrimSuffix(name, ".ics"))
+		if err != nil {
+			return models.Task{}, false
+		}
+		id = n
+	}
+	for _, task := range tasks {
+		if task.ID == id {
+			return task, true
+		}
+	}
+	return models.Task{}, false
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/.well-known/caldav" {
+		http.Redirect(w, r, s.prefix, http.StatusMovedPermanently)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="go-todo"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	rel, ok := strings.CutPrefix(r.URL.Path, s.prefix)
+	if r.URL.Path+"/" == s.prefix {
+		rel, ok = "", true
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodOptions {
+		w.Header().Set("DAV", "1, 3, calendar-access")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		return
+	}
+
+	switch name, inCollection := strings.CutPrefix(rel, collection); {
+	case rel == "":
+		s.serveHome(w, r)
+	case rel+"/" == collection || (inCollection && name == ""):
+		s.serveCollection(w, r)
+	case inCollection && !strings.Contains(name, "/") && strings.HasSuffix(name, ".ics"):
+		s.serveTask(w, r, name)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrConflict):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrInvalidInput):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("CalDAV: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// requested reads the properties asked for by a PROPFIND body. all is true
+// for an empty body or allprop.
+func requested(r *http.Request) (names []xml.Name, all bool, err error) {
+	var body propfind
+	ok, err := readXML(r.Body, &body)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok || body.AllProp != nil || body.Prop == nil {
+		return nil, true, nil
+	}
+	return body.Prop.names(), false, nil
+}
+
+// pick answers a request for names, or for all properties but the
+// calendar data, from what a resource has.
+func pick(href string, props map[xml.Name]string, names []xml.Name, all bool) response {
+	resp := response{Href: href, Props: make(map[xml.Name]string)}
+	if all {
+		for name, value := range props {
+			if name != propCalendarData {
+				resp.Props[name] = value
+			}
+		}
+		return resp
+	}
+	for _, name := range names {
+		if value, ok := props[name]; ok {
+			resp.Props[name] = value
+		} else {
+			resp.Missing = append(resp.Missing, name)
+		}
+	}
+	return resp
+}
+
+// commonProps are the properties every resource has.
+func (s *Server) commonProps() map[xml.Name]string {
+	home := "<d:href>" + escape(s.prefix) + "</d:href>"
+	return map[xml.Name]string{
+		propPrincipal:  home,
+		propPrivileges: "<d:privilege><d:read/></d:privilege><d:privilege><d:write/></d:privilege>",
+	}
+}
+
+func (s *Server) homeProps() map[xml.Name]string {
+	props := s.commonProps()
+	home := "<d:href>" + escape(s.prefix) + "</d:href>"
+	props[propResourceType] = "<d:collection/><d:principal/>"
+	props[propDisplayName] = "go-todo"
+	props[propPrincipalURL] = home
+	props[propHomeSet] = home
+	return props
+}
+
+func (s *Server) collectionProps(tasks []models.Task) map[xml.Name]string {
+	props := s.commonProps()
+	props[propResourceType] = "<d:collection/><c:calendar/>"
+	props[propDisplayName] = "Tasks"
+	props[propComponentSet] = `<c:comp name="VTODO"/>`
+	props[propCTag] = escape(s.ctag(tasks))
+	return props
+}
+
+func (s *Server) taskProps(task models.Task) map[xml.Name]string {
+	props := s.commonProps()
+	props[propResourceType] = ""
+	props[propETag] = escape(etag(task))
+	props[propContentType] = "text/calendar; charset=utf-8; component=vtodo"
+	props[propCalendarData] = escape(string(todoFor(task, s.uid(task)).Encode()))
+	return props
+}
+
+// ctag changes whenever any task in the collection does, so clients can
+// tell there is nothing to fetch.
+func (s *Server) ctag(tasks []models.Task) string {
+	tags := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		tags = append(tags, s.name(task)+etag(task))
+	}
+	sort.Strings(tags)
+	sum := sha256.Sum256([]byte(strings.Join(tags, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// depthOne reports whether a PROPFIND asks for the members of a collection
+// too. Infinite depth is served as depth one, which covers everything here.
+func depthOne(r *http.Request) bool {
+	return r.Header.Get("Depth") != "0"
+}
+
+func (s *Server) serveHome(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND")
+		http.Error(w, "use PROPFIND", http.StatusMethodNotAllowed)
+		return
+	}
+	names, all, err := requested(r)
+	if err != nil {
+		http.Error(w, "invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	responses := []response{pick(s.prefix, s.homeProps(), names, all)}
+	if depthOne(r) {
+		tasks, err := s.tasks(r.Context())
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		responses = append(responses, pick(s.prefix+collection, s.collectionProps(tasks), names, all))
+	}
+	writeMultistatus(w, responses)
+}
+
+func (s *Server) serveCollection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PROPFIND" && r.Method != "REPORT" {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		http.Error(w, "use PROPFIND or REPORT", http.StatusMethodNotAllowed)
+		return
+	}
+	tasks, err := s.tasks(r.Context())
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if r.Method == "REPORT" {
+		s.report(w, r, tasks)
+		return
+	}
+	names, all, err := requested(r)
+	if err != nil {
+		http.Error(w, "invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	responses := []response{pick(s.prefix+collection, s.collectionProps(tasks), names, all)}
+	if depthOne(r) {
+		for _, task := range tasks {
+			responses = append(responses, pick(s.href(s.name(task)), s.taskProps(task), names, all))
+		}
+	}
+	writeMultistatus(w, responses)
+}
+
+// report answers a calendar-query with every task, unless the filter rules
+// out VTODOs, and a calendar-multiget with the tasks asked for.
+func (s *Server) report(w http.ResponseWriter, r *http.Request, tasks []models.Task) {
+	var body report
+	if ok, err := readXML(r.Body, &body); err != nil || !ok {
+		http.Error(w, "invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+	names := body.Prop.names()
+	all := len(names) == 0
+	var responses []response
+	switch body.XMLName {
+	case reportCalendarQuery:
+		if body.Filter.wantsTodos() {
+			for _, task := range tasks {
+				responses = append(responses, pick(s.href(s.name(task)), s.taskProps(task), names, all))
+			}
+		}
+	case reportCalendarMultiget:
+		for _, href := range body.Hrefs {
+			u, err := url.Parse(strings.TrimSpace(href))
+			name, ok := "", false
+			if err == nil {
+				name, ok = strings.CutPrefix(u.Path, s.prefix+collection)
+			}
+			task, found := s.find(tasks, name)
+			if !ok || !found {
+				responses = append(responses, response{Href: href, Status: http.StatusNotFound})
+				continue
+			}
+			responses = append(responses, pick(href, s.taskProps(task), names, all))
+		}
+	default:
+		http.Error(w, "unsupported report", http.StatusForbidden)
+		return
+	}
+	writeMultistatus(w, responses)
+}
+
+func (s *Server) serveTask(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, "PROPFIND":
+		tasks, err := s.tasks(r.Context())
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		task, ok := s.find(tasks, name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == "PROPFIND" {
+			names, all, err := requested(r)
+			if err != nil {
+				http.Error(w, "invalid PROPFIND body", http.StatusBadRequest)
+				return
+			}
+			writeMultistatus(w, []response{pick(s.href(name), s.taskProps(task), names, all)})
+			return
+		}
+		data := todoFor(task, s.uid(task)).Encode()
+		w.Header().Set("ETag", etag(task))
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodPut:
+		s.put(w, r, name)
+	case http.MethodDelete:
+		s.delete(w, r, name)
+	default:
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// preconditionFailed checks the If-Match and If-None-Match headers against
+// the task, which exists if ok.
+func preconditionFailed(r *http.Request, task models.Task, ok bool) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if !ok || (match != "*" && match != etag(task)) {
+			return true
+		}
+	}
+	return r.Header.Get("If-None-Match") == "*" && ok
+}
+
+// put creates or updates a task from a VTODO. Only the summary, status and
+// due date are taken; the store keeps its own timestamps.
+func (s *Server) put(w http.ResponseWriter, r *http.Request, name string) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	todo, err := ParseTodo(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	todo.Summary = strings.TrimSpace(todo.Summary)
+	if todo.Summary == "" {
+		http.Error(w, "a task needs a SUMMARY", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	tasks, err := s.tasks(ctx)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.prune(tasks)
+	task, exists := s.find(tasks, name)
+	if preconditionFailed(r, task, exists) {
+		http.Error(w, "the task has changed", http.StatusPreconditionFailed)
+		return
+	}
+	if exists {
+		task, err = updateTodo(ctx, s.store, task, todo)
+	} else {
+		task, err = createTodo(ctx, s.store, todo)
+	}
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if !exists {
+		if name != strconv.Itoa(task.ID)+".ics" {
+			s.setName(name, task.ID)
+		}
+		if todo.UID != "" {
+			s.aliases.UIDs[task.ID] = todo.UID
+		}
+		if err := s.saveAliases(ctx); err != nil {
+			s.fail(w, err)
+			return
+		}
+	}
+	w.Header().Set("ETag", etag(task))
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, name string) {
+	ctx := r.Context()
+	tasks, err := s.tasks(ctx)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	task, ok := s.find(tasks, name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if preconditionFailed(r, task, ok) {
+		http.Error(w, "the task has changed", http.StatusPreconditionFailed)
+		return
+	}
+	if err := s.store.DeleteTask(ctx, task.ID, task.Version); err != nil {
+		s.fail(w, err)
+		return
+	}
+	delete(s.aliases.Names, name)
+	delete(s.names, task.ID)
+	delete(s.aliases.UIDs, task.ID)
+	if err := s.saveAliases(ctx); err != nil {
+		s.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
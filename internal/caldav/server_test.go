@@ -0,0 +1,196 @@
+package caldav
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+const token = "secret-token"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newServer serves a store holding descriptions under /dav/.
+func newServer(t *testing.T, descriptions ...string) (*httptest.Server, storage.Backend) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	for _, d := range descriptions {
+		store.AddTask(ctx, d)
+	}
+	server, err := NewServer(ctx, store, token, "/dav")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return ts, store
+}
+
+// do sends an authenticated request and returns the response and its body.
+func do(t *testing.T, method, url, body string, headers ...string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.SetBasicAuth("phone", token)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func todoBody(uid, summary, status string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VTODO\r\nUID:" + uid + "\r\nSUMMARY:" + summary +
+		"\r\nSTATUS:" + status + "\r\nDUE;VALUE=DATE:20261005\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	ts, _ := newServer(t)
+	resp, err := http.Get(ts.URL + "/dav/tasks/")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected a basic auth challenge, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Discovery(t *testing.T) {
+	ts, _ := newServer(t, "a")
+	body := `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop>` +
+		`<d:current-user-principal/><c:calendar-home-set/><d:resourcetype/><c:supported-calendar-component-set/><d:unknown/>` +
+		`</d:prop></d:propfind>`
+	resp, got := do(t, "PROPFIND", ts.URL+"/dav/", body, "Depth", "1")
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected 207, got %d: %s", resp.StatusCode, got)
+	}
+	for _, want := range []string{"<d:href>/dav/</d:href>", "<d:href>/dav/tasks/</d:href>", "<c:calendar/>", `<c:comp name="VTODO"/>`, "<d:unknown/>", "404 Not Found"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %s in %s", want, got)
+		}
+	}
+}
+
+func TestServer_ListsAndGetsTasks(t *testing.T) {
+	ts, store := newServer(t, "Write report")
+	resp, got := do(t, "PROPFIND", ts.URL+"/dav/tasks/", `<d:propfind xmlns:d="DAV:"><d:prop><d:getetag/></d:prop></d:propfind>`, "Depth", "1")
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if resp.StatusCode != http.StatusMultiStatus || !strings.Contains(got, "/dav/tasks/1.ics") || !strings.Contains(got, escape(etag(tasks[0]))) {
+		t.Errorf("Expected the task with its ETag, got %d: %s", resp.StatusCode, got)
+	}
+
+	resp, got = do(t, http.MethodGet, ts.URL+"/dav/tasks/1.ics", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag(tasks[0]) || !strings.Contains(got, "SUMMARY:Write report") {
+		t.Errorf("Expected the VTODO, got %d %q: %s", resp.StatusCode, resp.Header.Get("ETag"), got)
+	}
+	if resp, _ := do(t, http.MethodGet, ts.URL+"/dav/tasks/9.ics", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing task, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Reports(t *testing.T) {
+	ts, _ := newServer(t, "a", "b")
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+		`<d:prop><d:getetag/><c:calendar-data/></d:prop>` +
+		`<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter></c:filter></c:calendar-query>`
+	resp, got := do(t, "REPORT", ts.URL+"/dav/tasks/", query, "Depth", "1")
+	if resp.StatusCode != http.StatusMultiStatus || strings.Count(got, "BEGIN:VTODO") != 2 {
+		t.Errorf("Expected both tasks, got %d: %s", resp.StatusCode, got)
+	}
+
+	events := strings.Replace(query, `name="VTODO"`, `name="VEVENT"`, 1)
+	if _, got := do(t, "REPORT", ts.URL+"/dav/tasks/", events); strings.Contains(got, "BEGIN:VTODO") {
+		t.Errorf("Expected no tasks for an event query, got %s", got)
+	}
+
+	multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+		`<d:prop><c:calendar-data/></d:prop><d:href>/dav/tasks/2.ics</d:href><d:href>/dav/tasks/7.ics</d:href></c:calendar-multiget>`
+	_, got = do(t, "REPORT", ts.URL+"/dav/tasks/", multiget)
+	if !strings.Contains(got, "SUMMARY:b") || strings.Contains(got, "SUMMARY:a") || !strings.Contains(got, "404 Not Found") {
+		t.Errorf("Expected task 2 and a 404, got %s", got)
+	}
+}
+
+func TestServer_PutCreatesAndUpdates(t *testing.T) {
+	ts, store := newServer(t)
+	url := ts.URL + "/dav/tasks/phone-made.ics"
+	resp, _ := do(t, http.MethodPut, url, todoBody("phone-uid", "Call mum", "NEEDS-ACTION"), "If-None-Match", "*")
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("ETag") == "" {
+		t.Fatalf("Expected 201 with an ETag, got %d", resp.StatusCode)
+	}
+	tag := resp.Header.Get("ETag")
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "Call mum" || tasks[0].Due != "2026-10-05" {
+		t.Fatalf("Expected the new task, got %+v", tasks)
+	}
+	created := tasks[0].Version
+
+	// The task stays at the name and UID the client gave it.
+	_, got := do(t, http.MethodGet, url, "")
+	if !strings.Contains(got, "UID:phone-uid") {
+		t.Errorf("Expected the client's UID, got %s", got)
+	}
+	if resp, _ := do(t, http.MethodPut, url, todoBody("phone-uid", "Again", "NEEDS-ACTION"), "If-None-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 creating over an existing task, got %d", resp.StatusCode)
+	}
+
+	resp, _ = do(t, http.MethodPut, url, todoBody("phone-uid", "Call mum back", "COMPLETED"), "If-Match", tag)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", resp.StatusCode)
+	}
+	tasks, _ = store.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Description != "Call mum back" || !tasks[0].Done || tasks[0].Version != created+1 {
+		t.Errorf("Expected the task renamed and done in one write, got %+v", tasks[0])
+	}
+	if resp, _ := do(t, http.MethodPut, url, todoBody("phone-uid", "Stale", "NEEDS-ACTION"), "If-Match", tag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for a stale ETag, got %d", resp.StatusCode)
+	}
+	if resp, _ := do(t, http.MethodPut, url, todoBody("phone-uid", " ", "NEEDS-ACTION")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a summary, got %d", resp.StatusCode)
+	}
+
+	// Names survive a restart of the server.
+	server, _ := NewServer(ctx, store, token, "/dav/")
+	restarted := httptest.NewServer(server)
+	defer restarted.Close()
+	if resp, _ := do(t, http.MethodGet, restarted.URL+"/dav/tasks/phone-made.ics", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the name kept after a restart, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_Delete(t *testing.T) {
+	ts, store := newServer(t, "a")
+	if resp, _ := do(t, http.MethodDelete, ts.URL+"/dav/tasks/1.ics", "", "If-Match", `"stale"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for a stale ETag, got %d", resp.StatusCode)
+	}
+	if resp, _ := do(t, http.MethodDelete, ts.URL+"/dav/tasks/1.ics", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if tasks, _ := store.GetTasks(ctx, models.TaskQuery{}); len(tasks) != 0 {
+		t.Errorf("Expected the task deleted, got %+v", tasks)
+	}
+	if resp, _ := do(t, http.MethodDelete, ts.URL+"/dav/tasks/1.ics", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+}
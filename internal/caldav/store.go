@@ -0,0 +1,35 @@
+package caldav
+
+import (
+	"context"
+
+	"go-todo/internal/controller"
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// createTodo adds a task with the summary, status and due date of todo in
+// one write and returns it as stored.
+func createTodo(ctx context.Context, store controller.Store, todo Todo) (models.Task, error) {
+	id, err := store.CreateTask(ctx, models.Task{Description: todo.Summary, Done: todo.Done, Due: todo.Due})
+	if err != nil {
+		return models.Task{}, err
+	}
+	return storage.FindTask(ctx, store, int(id))
+}
+
+// updateTodo brings task in line with the summary, status and due date of
+// todo in one write and returns it as stored. The write is checked against
+// task's version, so an edit made since it was read is reported as
+// storage.ErrConflict rather than overwritten.
+func updateTodo(ctx context.Context, store controller.Store, task models.Task, todo Todo) (models.Task, error) {
+	edit := task
+	edit.Description, edit.Done, edit.Due = todo.Summary, todo.Done, todo.Due
+	if edit == task {
+		return task, nil
+	}
+	if err := store.UpdateTask(ctx, task.ID, task.Version, edit); err != nil {
+		return task, err
+	}
+	return storage.FindTask(ctx, store, task.ID)
+}
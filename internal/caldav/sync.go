@@ -0,0 +1,385 @@
+package caldav
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// PasswordEnv is the environment variable the password for a remote
+// CalDAV server can be given in.
+const PasswordEnv = "GO_TODO_CALDAV_PASSWORD"
+
+// syncMetaKey holds the store's state of syncing with a CalDAV server.
+const syncMetaKey = "caldav_sync"
+
+// Interval is how often a running application syncs.
+const Interval = 30 * time.Second
+
+// fields are the parts of a task that are synced.
+type fields struct {
+	Summary string `json:"summary"`
+	Done    bool   `json:"done,omitempty"`
+	Due     string `json:"due,omitempty"`
+}
+
+func taskFields(task models.Task) fields {
+	return fields{Summary: task.Description, Done: task.Done, Due: task.Due}
+}
+
+func todoFields(todo Todo) fields {
+	return fields{Summary: todo.Summary, Done: todo.Done, Due: todo.Due}
+}
+
+// link ties a task to the resource it is synced with.
+type link struct {
+	Href string `json:"href"`
+	ETag string `json:"etag"`
+	UID  string `json:"uid"`
+	// Synced is the task as both sides had it after the last sync; a side
+	// that differs from it has changed.
+	Synced fields `json:"synced"`
+}
+
+// syncState is what a store remembers between syncs.
+type syncState struct {
+	// URL is the collection the state belongs to. Syncing with another
+	// collection starts over.
+	URL   string       `json:"url"`
+	Tasks map[int]link `json:"tasks"`
+}
+
+// remoteName is how conflicts name the other side of a CalDAV sync.
+const remoteName = "the CalDAV server"
+
+// todoTask describes a remote todo as a task, for reporting conflicts.
+func todoTask(todo Todo) models.Task {
+	f := todoFields(todo)
+	return models.Task{Description: f.Summary, Done: f.Done, Due: f.Due, UpdatedAt: todo.LastModified}
+}
+
+// Syncer syncs a store with a collection on a CalDAV server.
+type Syncer struct {
+	Client *Client
+	Store  storage.Backend
+}
+
+// NewSyncer returns a syncer for store and the collection client talks to.
+func NewSyncer(client *Client, store storage.Backend) *Syncer {
+	return &Syncer{Client: client, Store: store}
+}
+
+func (s *Syncer) load(ctx context.Context) (*syncState, error) {
+	value, err := s.Store.GetMeta(ctx, syncMetaKey)
+	if err != nil {
+		return nil, err
+	}
+	st := &syncState{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), st); err != nil {
+			return nil, fmt.Errorf("reading CalDAV sync state: %w", err)
+		}
+	}
+	if st.URL != s.Client.URL.String() || st.Tasks == nil {
+		st = &syncState{URL: s.Client.URL.String(), Tasks: make(map[int]link)}
+	}
+	return st, nil
+}
+
+func (s *Syncer) save(ctx context.Context, st *syncState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("saving CalDAV sync state: %w", err)
+	}
+	return s.Store.SetMeta(ctx, syncMetaKey, string(data))
+}
+
+// skippable reports whether err only means one side changed again while
+// the task was synced. Such a task is left for the next sync.
+func skippable(err error) bool {
+	return errors.Is(err, ErrPreconditionFailed) || errors.Is(err, storage.ErrConflict) || errors.Is(err, storage.ErrNotFound)
+}
+
+// Sync merges the store with the collection task by task. A task changed
+// on one side since the last sync gets the change on the other; one
+// changed on both keeps the later edit, and one deleted on one side and
+// edited on the other is kept. New tasks are created on the other side:
+// on the first sync with a collection, tasks with the same summary on
+// both are taken to be the same task.
+func (s *Syncer) Sync(ctx context.Context) (conflicts []models.Conflict, err error) {
+	if err := storage.RequirePlaintext(ctx, s.Store, "CalDAV sync"); err != nil {
+		return nil, err
+	}
+	st, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := s.Client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[int]models.Task, len(tasks))
+	for _, task := range tasks {
+		local[task.ID] = task
+	}
+	// What was synced so far is kept even if a later task fails.
+	defer func() {
+		if saveErr := s.save(ctx, st); err == nil {
+			err = saveErr
+		}
+	}()
+
+	linked := make(map[string]bool, len(st.Tasks))
+	for _, id := range sortedIDs(st.Tasks) {
+		l := st.Tasks[id]
+		linked[l.Href] = true
+		task, haveLocal := local[id]
+		tag, haveRemote := remote[l.Href]
+		conflict, err := s.syncLinked(ctx, st, id, l, task, haveLocal, tag, haveRemote)
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+		if err != nil && !skippable(err) {
+			return conflicts, err
+		}
+	}
+
+	// Tasks new on the server. Unlinked local tasks with the same summary
+	// are taken to be them, so a first sync does not duplicate tasks that
+	// were already on both sides.
+	unlinked := make(map[string][]int)
+	for _, task := range tasks {
+		if _, ok := st.Tasks[task.ID]; !ok {
+			unlinked[task.Description] = append(unlinked[task.Description], task.ID)
+		}
+	}
+	for _, href := range sortedKeys(remote) {
+		if linked[href] {
+			continue
+		}
+		todo, tag, err := s.Client.Get(ctx, href)
+		if errors.Is(err, ErrGone) {
+			continue
+		} else if err != nil {
+			return conflicts, err
+		}
+		f := todoFields(todo)
+		if f.Summary == "" {
+			continue
+		}
+		if tag == "" {
+			tag = remote[href]
+		}
+		if ids := unlinked[f.Summary]; len(ids) > 0 {
+			id := ids[0]
+			unlinked[f.Summary] = ids[1:]
+			task, err := updateTodo(ctx, s.Store, local[id], todo)
+			if skippable(err) {
+				continue
+			} else if err != nil {
+				return conflicts, err
+			}
+			st.Tasks[id] = link{Href: href, ETag: tag, UID: todo.UID, Synced: taskFields(task)}
+			continue
+		}
+		task, err := createTodo(ctx, s.Store, todo)
+		if err != nil {
+			return conflicts, err
+		}
+		st.Tasks[task.ID] = link{Href: href, ETag: tag, UID: todo.UID, Synced: taskFields(task)}
+	}
+
+	// Tasks new here. Archived ones stay local, as they would be in the
+	// task list of other clients.
+	listed, err := s.Store.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		return conflicts, err
+	}
+	for _, task := range listed {
+		if _, ok := st.Tasks[task.ID]; ok {
+			continue
+		}
+		uid, err := newUID()
+		if err != nil {
+			return conflicts, err
+		}
+		href := s.Client.resolve(uid + ".ics")
+		tag, err := s.Client.Put(ctx, href, todoFor(task, uid), "")
+		if skippable(err) {
+			continue
+		} else if err != nil {
+			return conflicts, err
+		}
+		st.Tasks[task.ID] = link{Href: href, ETag: tag, UID: uid, Synced: taskFields(task)}
+	}
+	return conflicts, nil
+}
+
+// syncLinked syncs a task that was synced before with its resource, given
+// the task and the resource's ETag as they are now, and updates st.
+func (s *Syncer) syncLinked(ctx context.Context, st *syncState, id int, l link, task models.Task, haveLocal bool, tag string, haveRemote bool) (*models.Conflict, error) {
+	localChanged := haveLocal && taskFields(task) != l.Synced
+	switch {
+	case !haveLocal && !haveRemote:
+		delete(st.Tasks, id)
+		return nil, nil
+
+	case !haveRemote:
+		if localChanged {
+			// Deleted there but edited here: put it back.
+			if _, err := s.push(ctx, st, id, l, task, ""); err != nil {
+				return nil, err
+			}
+			return &models.Conflict{Kept: task, Remote: remoteName}, nil
+		}
+		delete(st.Tasks, id)
+		return nil, s.Store.DeleteTask(ctx, id, task.Version)
+	}
+
+	// The ETag says whether the resource was rewritten, but only its
+	// fields say whether it changed: another client may have added
+	// properties of its own.
+	var todo Todo
+	remoteChanged := false
+	if tag != l.ETag {
+		var err error
+		if todo, tag, err = s.Client.Get(ctx, l.Href); err != nil {
+			if errors.Is(err, ErrGone) {
+				return nil, ErrPreconditionFailed
+			}
+			return nil, err
+		}
+		if tag == "" {
+			tag = l.ETag
+		}
+		remoteChanged = todoFields(todo) != l.Synced && todoFields(todo).Summary != ""
+		if !remoteChanged {
+			l.ETag = tag
+			st.Tasks[id] = l
+		}
+	}
+
+	switch {
+	case !haveLocal:
+		if !remoteChanged {
+			delete(st.Tasks, id)
+			return nil, s.Client.Delete(ctx, l.Href, l.ETag)
+		}
+		// Deleted here but edited there: bring it back.
+		delete(st.Tasks, id)
+		restored, err := createTodo(ctx, s.Store, todo)
+		if err != nil {
+			return nil, err
+		}
+		st.Tasks[restored.ID] = link{Href: l.Href, ETag: tag, UID: l.UID, Synced: taskFields(restored)}
+		return &models.Conflict{Kept: restored, Remote: remoteName}, nil
+
+	case !remoteChanged && !localChanged:
+		return nil, nil
+
+	case !remoteChanged:
+		_, err := s.push(ctx, st, id, l, task, l.ETag)
+		return nil, err
+
+	case localChanged && taskFields(task) != todoFields(todo) && task.UpdatedAt > todo.LastModified:
+		// Both changed and the local edit is later.
+		if _, err := s.push(ctx, st, id, l, task, tag); err != nil {
+			return nil, err
+		}
+		return &models.Conflict{Kept: task, Lost: todoTask(todo), Remote: remoteName}, nil
+	}
+
+	// The server's edit wins, and wins ties.
+	updated, err := updateTodo(ctx, s.Store, task, todo)
+	if err != nil {
+		return nil, err
+	}
+	l.ETag, l.Synced = tag, taskFields(updated)
+	st.Tasks[id] = l
+	if localChanged && taskFields(task) != todoFields(todo) {
+		return &models.Conflict{Kept: updated, Lost: task, Remote: remoteName}, nil
+	}
+	return nil, nil
+}
+
+// push writes task to its resource, which must still have the ETag etag,
+// or not exist if etag is empty, and records the new ETag in st.
+func (s *Syncer) push(ctx context.Context, st *syncState, id int, l link, task models.Task, etag string) (string, error) {
+	tag, err := s.Client.Put(ctx, l.Href, todoFor(task, l.UID), etag)
+	if err != nil {
+		return "", err
+	}
+	l.ETag, l.Synced = tag, taskFields(task)
+	st.Tasks[id] = l
+	return tag, nil
+}
+
+// newUID returns a UID, also used as the resource name, for a task new to
+// the server.
+func newUID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("creating task UID: %w", err)
+	}
+	return "go-todo-" + hex.EncodeToString(b), nil
+}
+
+func sortedIDs(m map[int]link) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Run syncs every interval until ctx is cancelled, and once more on the
+// way out so no change stays behind.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the final sync needs its own deadline.
+			final, cancel := context.WithTimeout(context.Background(), interval)
+			s.logSync(final)
+			cancel()
+			return
+		case <-ticker.C:
+			s.logSync(ctx)
+		}
+	}
+}
+
+func (s *Syncer) logSync(ctx context.Context) {
+	conflicts, err := s.Sync(ctx)
+	for _, c := range conflicts {
+		log.Printf("CalDAV sync: %s", c)
+	}
+	if err != nil {
+		log.Printf("CalDAV sync: %v", err)
+	}
+}
@@ -0,0 +1,419 @@
+package caldav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// fakeDAV is a bare CalDAV collection at /cal/ that keeps what clients put
+// as is, as most servers do.
+type fakeDAV struct {
+	mu    sync.Mutex
+	items map[string]fakeItem
+	rev   int
+}
+
+type fakeItem struct {
+	data []byte
+	etag string
+}
+
+func newFakeDAV(t *testing.T) (*fakeDAV, *httptest.Server) {
+	t.Helper()
+	dav := &fakeDAV{items: make(map[string]fakeItem)}
+	ts := httptest.NewServer(dav)
+	t.Cleanup(ts.Close)
+	return dav, ts
+}
+
+// set puts a todo on the server as another client would.
+func (d *fakeDAV) set(path string, todo Todo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rev++
+	d.items[path] = fakeItem{data: todo.Encode(), etag: fmt.Sprintf(`"%d"`, d.rev)}
+}
+
+func (d *fakeDAV) remove(path string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.items, path)
+}
+
+// todos returns the todos on the server by summary.
+func (d *fakeDAV) todos(t *testing.T) map[string]Todo {
+	t.Helper()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	todos := make(map[string]Todo)
+	for path, item := range d.items {
+		todo, err := ParseTodo(item.data)
+		if err != nil {
+			t.Fatalf("Reading %s: %v", path, err)
+		}
+		todos[todo.Summary] = todo
+	}
+	return todos
+}
+
+func (d *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	item, exists := d.items[r.URL.Path]
+	switch r.Method {
+	case "PROPFIND":
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0"?><multistatus xmlns="DAV:">`)
+		entry := func(href, etag string, collection bool) {
+			kind := ""
+			if collection {
+				kind = "<collection/>"
+			}
+			fmt.Fprintf(&b, `<response><href>%s</href><propstat><prop><resourcetype>%s</resourcetype><getetag>%s</getetag></prop><status>HTTP/1.1 200 OK</status></propstat></response>`,
+				href, kind, escape(etag))
+		}
+		switch {
+		case r.URL.Path == "/cal/":
+			entry("/cal/", `"collection"`, true)
+			if r.Header.Get("Depth") == "1" {
+				paths := make([]string, 0, len(d.items))
+				for path := range d.items {
+					paths = append(paths, path)
+				}
+				sort.Strings(paths)
+				for _, path := range paths {
+					entry(path, d.items[path].etag, false)
+				}
+			}
+		case exists:
+			entry(r.URL.Path, item.etag, false)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		b.WriteString(`</multistatus>`)
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, b.String())
+	case http.MethodGet:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", item.etag)
+		w.Write(item.data)
+	case http.MethodPut:
+		if match := r.Header.Get("If-Match"); (match != "" && (!exists || match != item.etag)) || (r.Header.Get("If-None-Match") == "*" && exists) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		d.rev++
+		d.items[r.URL.Path] = fakeItem{data: data, etag: fmt.Sprintf(`"%d"`, d.rev)}
+		// Like some servers, leave the client to ask for the new ETag.
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != item.etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		delete(d.items, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newSyncer(t *testing.T, url string) *Syncer {
+	t.Helper()
+	client, err := NewClient(url, "me", token)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return NewSyncer(client, storage.NewMemoryStore())
+}
+
+func mustSync(t *testing.T, s *Syncer) []models.Conflict {
+	t.Helper()
+	conflicts, err := s.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	return conflicts
+}
+
+// localTasks returns the store's tasks by description.
+func localTasks(t *testing.T, s *Syncer) map[string]models.Task {
+	t.Helper()
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		t.Fatalf("Reading tasks: %v", err)
+	}
+	byDescription := make(map[string]models.Task)
+	for _, task := range tasks {
+		byDescription[task.Description] = task
+	}
+	return byDescription
+}
+
+// edit overwrites a local task, with the given updated_at so tests control
+// which edit is later.
+func edit(t *testing.T, s *Syncer, from, to, updatedAt string) {
+	t.Helper()
+	tasks, _ := storage.ExportTasks(ctx, s.Store)
+	for i := range tasks {
+		if tasks[i].Description == from {
+			tasks[i].Description = to
+			tasks[i].UpdatedAt = updatedAt
+		}
+	}
+	if err := s.Store.ReplaceTasks(ctx, tasks, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+}
+
+// pathOf returns the path on the server of the local task with the given
+// description.
+func pathOf(t *testing.T, s *Syncer, description string) string {
+	t.Helper()
+	st, _ := s.load(ctx)
+	link, ok := st.Tasks[localTasks(t, s)[description].ID]
+	if !ok {
+		t.Fatalf("Task %q is not linked", description)
+	}
+	return strings.TrimPrefix(link.Href, s.Client.URL.Scheme+"://"+s.Client.URL.Host)
+}
+
+func assertSummaries(t *testing.T, got map[string]Todo, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("Expected %v on the server, got %v", want, got)
+		return
+	}
+	for _, summary := range want {
+		if _, ok := got[summary]; !ok {
+			t.Errorf("Expected %v on the server, got %v", want, got)
+			return
+		}
+	}
+}
+
+func assertDescriptions(t *testing.T, got map[string]models.Task, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("Expected %v locally, got %v", want, got)
+		return
+	}
+	for _, description := range want {
+		if _, ok := got[description]; !ok {
+			t.Errorf("Expected %v locally, got %v", want, got)
+			return
+		}
+	}
+}
+
+func TestSync_CreatesTasksOnBothSides(t *testing.T) {
+	dav, ts := newFakeDAV(t)
+	dav.set("/cal/phone-1.ics", Todo{UID: "phone-1", Summary: "From the phone", Due: "2026-11-01"})
+	s := newSyncer(t, ts.URL+"/cal")
+	s.Store.AddTask(ctx, "From go-todo")
+
+	if conflicts := mustSync(t, s); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+	assertDescriptions(t, localTasks(t, s), "From the phone", "From go-todo")
+	if due := localTasks(t, s)["From the phone"].Due; due != "2026-11-01" {
+		t.Errorf("Expected due date 2026-11-01, got %q", due)
+	}
+	assertSummaries(t, dav.todos(t), "From the phone", "From go-todo")
+
+	// A second sync has nothing to do.
+	before := dav.rev
+	mustSync(t, s)
+	if dav.rev != before {
+		t.Error("Expected no writes to the server when nothing changed")
+	}
+	assertDescriptions(t, localTasks(t, s), "From the phone", "From go-todo")
+}
+
+func TestSync_FirstSyncMatchesSummaries(t *testing.T) {
+	dav, ts := newFakeDAV(t)
+	dav.set("/cal/a.ics", Todo{UID: "a", Summary: "Shared", Done: true})
+	s := newSyncer(t, ts.URL+"/cal/")
+	s.Store.AddTask(ctx, "Shared")
+
+	mustSync(t, s)
+	assertDescriptions(t, localTasks(t, s), "Shared")
+	assertSummaries(t, dav.todos(t), "Shared")
+	if !localTasks(t, s)["Shared"].Done {
+		t.Error("Expected the server's status to be taken")
+	}
+}
+
+func TestSync_PropagatesChanges(t *testing.T) {
+	dav, ts := newFakeDAV(t)
+	s := newSyncer(t, ts.URL+"/cal/")
+	for _, d := range []string{"Edit here", "Edit there", "Delete here", "Delete there"} {
+		s.Store.AddTask(ctx, d)
+	}
+	mustSync(t, s)
+
+	edit(t, s, "Edit here", "Edited here", "2026-10-01 10:00:00")
+	s.Store.DeleteTask(ctx, localTasks(t, s)["Delete here"].ID, 0)
+	there := dav.todos(t)["Edit there"]
+	there.Summary, there.Done = "Edited there", true
+	dav.set(pathOf(t, s, "Edit there"), there)
+	dav.remove(pathOf(t, s, "Delete there"))
+	before := localTasks(t, s)["Edit there"].Version
+
+	if conflicts := mustSync(t, s); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+	assertDescriptions(t, localTasks(t, s), "Edited here", "Edited there")
+	assertSummaries(t, dav.todos(t), "Edited here", "Edited there")
+	if got := localTasks(t, s)["Edited there"]; !got.Done || got.Version != before+1 {
+		t.Errorf("Expected the task renamed and completed in one write, got %+v", got)
+	}
+}
+
+func TestSync_LaterEditWins(t *testing.T) {
+	dav, ts := newFakeDAV(t)
+	s := newSyncer(t, ts.URL+"/cal/")
+	s.Store.AddTask(ctx, "Call ACME")
+	s.Store.AddTask(ctx, "Pay rent")
+	mustSync(t, s)
+
+	// The local edit of Call ACME is later, the server's of Pay rent.
+	edit(t, s, "Call ACME", "Call ACME on Tuesday", "2026-10-01 11:00:00")
+	acme := dav.todos(t)["Call ACME"]
+	acme.Summary, acme.LastModified = "Call ACME on Monday", "2026-10-01 10:00:00"
+	dav.set(pathOf(t, s, "Call ACME on Tuesday"), acme)
+	edit(t, s, "Pay rent", "Pay rent today", "2026-10-01 10:00:00")
+	rent := dav.todos(t)["Pay rent"]
+	rent.Summary, rent.LastModified = "Pay rent tomorrow", "2026-10-01 11:00:00"
+	dav.set(pathOf(t, s, "Pay rent today"), rent)
+
+	conflicts := mustSync(t, s)
+	assertDescriptions(t, localTasks(t, s), "Call ACME on Tuesday", "Pay rent tomorrow")
+	assertSummaries(t, dav.todos(t), "Call ACME on Tuesday", "Pay rent tomorrow")
+	lost := make(map[string]bool)
+	for _, c := range conflicts {
+		lost[c.Lost.Description] = true
+	}
+	if len(conflicts) != 2 || !lost["Call ACME on Monday"] || !lost["Pay rent today"] {
+		t.Errorf("Expected conflicts losing Monday and today, got %v", conflicts)
+	}
+}
+
+func TestSync_EditBeatsDelete(t *testing.T) {
+	dav, ts := newFakeDAV(t)
+	s := newSyncer(t, ts.URL+"/cal/")
+	s.Store.AddTask(ctx, "Edited here")
+	s.Store.AddTask(ctx, "Edited there")
+	mustSync(t, s)
+
+	edit(t, s, "Edited here", "Edited here, kept", "2026-10-01 10:00:00")
+	dav.remove(pathOf(t, s, "Edited here, kept"))
+	there := dav.todos(t)["Edited there"]
+	there.Summary = "Edited there, kept"
+	dav.set(pathOf(t, s, "Edited there"), there)
+	s.Store.DeleteTask(ctx, localTasks(t, s)["Edited there"].ID, 0)
+
+	conflicts := mustSync(t, s)
+	assertDescriptions(t, localTasks(t, s), "Edited here, kept", "Edited there, kept")
+	assertSummaries(t, dav.todos(t), "Edited here, kept", "Edited there, kept")
+	if len(conflicts) != 2 || conflicts[0].Lost.Description != "" || conflicts[1].Lost.Description != "" {
+		t.Errorf("Expected two delete/edit conflicts, got %v", conflicts)
+	}
+}
+
+func TestSync_WithGoTodoServer(t *testing.T) {
+	ts, served := newServer(t, "On the server")
+	s := newSyncer(t, ts.URL+"/dav/tasks/")
+	s.Store.AddTask(ctx, "On the client")
+
+	mustSync(t, s)
+	assertDescriptions(t, localTasks(t, s), "On the server", "On the client")
+	tasks, _ := served.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 2 {
+		t.Errorf("Expected both tasks on the server, got %+v", tasks)
+	}
+
+	// A change made on the server comes back, and one made here goes out.
+	for _, task := range tasks {
+		if task.Description == "On the server" {
+			served.ToggleTaskStatus(ctx, task.ID, 0)
+		}
+	}
+	edit(t, s, "On the client", "On the client, edited", "2026-10-01 10:00:00")
+	if conflicts := mustSync(t, s); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+	if !localTasks(t, s)["On the server"].Done {
+		t.Error("Expected the task completed on the server to be done")
+	}
+	tasks, _ = served.GetTasks(ctx, models.TaskQuery{})
+	found := false
+	for _, task := range tasks {
+		found = found || task.Description == "On the client, edited"
+	}
+	if !found {
+		t.Errorf("Expected the edit on the server, got %+v", tasks)
+	}
+}
+
+func TestClient_Put(t *testing.T) {
+	_, ts := newFakeDAV(t)
+	client, _ := NewClient(ts.URL+"/cal/", "", "")
+	href := client.resolve("a.ics")
+	tag, err := client.Put(ctx, href, Todo{UID: "a", Summary: "a"}, "")
+	if err != nil || tag == "" {
+		t.Fatalf("Expected an ETag for a new resource, got %q, %v", tag, err)
+	}
+	if _, err := client.Put(ctx, href, Todo{UID: "a", Summary: "b"}, ""); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed creating an existing resource, got %v", err)
+	}
+	if _, err := client.Put(ctx, href, Todo{UID: "a", Summary: "b"}, `"stale"`); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed for a stale ETag, got %v", err)
+	}
+	if err := client.Delete(ctx, href, `"stale"`); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed deleting with a stale ETag, got %v", err)
+	}
+	if err := client.Delete(ctx, href, tag); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+}
+
+func TestNewClient_RejectsInvalidURL(t *testing.T) {
+	for _, url := range []string{"", "ftp://example.com/cal/", "not a url"} {
+		if _, err := NewClient(url, "", ""); err == nil {
+			t.Errorf("Expected %q to be rejected", url)
+		}
+	}
+}
+
+func TestSync_RejectsEncryptedStore(t *testing.T) {
+	_, ts := newFakeDAV(t)
+	s := newSyncer(t, ts.URL+"/cal/")
+	store, err := storage.EnableEncryption(ctx, s.Store, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	s.Store = store
+	if _, err := s.Sync(ctx); err == nil {
+		t.Error("Expected an encrypted store to be refused")
+	}
+}
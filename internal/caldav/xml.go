@@ -0,0 +1,199 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// XML namespaces of WebDAV, CalDAV and the Apple calendar server extensions
+// clients look for.
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// prefixes are the namespace prefixes used in responses.
+var prefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+// Property names.
+var (
+	propResourceType       = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName        = xml.Name{Space: nsDAV, Local: "displayname"}
+	propETag               = xml.Name{Space: nsDAV, Local: "getetag"}
+	propContentType        = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propPrincipal          = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL       = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propPrivileges         = xml.Name{Space: nsDAV, Local: "current-user-privilege-set"}
+	propHomeSet            = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propComponentSet       = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCalendarData       = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propCTag               = xml.Name{Space: nsCS, Local: "getctag"}
+	reportCalendarQuery    = xml.Name{Space: nsCalDAV, Local: "calendar-query"}
+	reportCalendarMultiget = xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}
+)
+
+// propNames is a DAV:prop element listing the properties asked for.
+type propNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (p *propNames) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, len(p.Names))
+	for i, n := range p.Names {
+		names[i] = n.XMLName
+	}
+	return names
+}
+
+// propfind is the body of a PROPFIND request. An empty body asks for all
+// properties.
+type propfind struct {
+	XMLName xml.Name   `xml:"DAV: propfind"`
+	AllProp *struct{}  `xml:"DAV: allprop"`
+	Prop    *propNames `xml:"DAV: prop"`
+}
+
+// compFilter is a CalDAV comp-filter with the ones nested in it.
+type compFilter struct {
+	Name  string       `xml:"name,attr"`
+	Comps []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// report is the body of a calendar-query or calendar-multiget REPORT.
+type report struct {
+	XMLName xml.Name
+	Prop    *propNames  `xml:"DAV: prop"`
+	Filter  *compFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+	Hrefs   []string    `xml:"DAV: href"`
+}
+
+// wantsTodos reports whether a calendar-query filter can match VTODOs.
+// Filters below the component level, such as time ranges, are not
+// evaluated, so all tasks match them.
+func (f *compFilter) wantsTodos() bool {
+	if f == nil {
+		return true
+	}
+	if !strings.EqualFold(f.Name, "VCALENDAR") {
+		return false
+	}
+	if len(f.Comps) == 0 {
+		return true
+	}
+	for _, c := range f.Comps {
+		if strings.EqualFold(c.Name, "VTODO") {
+			return true
+		}
+	}
+	return false
+}
+
+// readXML decodes a request body into v. It reports false, leaving v
+// alone, for an empty body.
+func readXML(r io.Reader, v any) (bool, error) {
+	err := xml.NewDecoder(io.LimitReader(r, 1<<20)).Decode(v)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// response is one resource in a multistatus response. Props holds the inner
+// XML of each property found, and Missing the properties asked for that
+// the resource does not have. A resource that does not exist at all has
+// Status set instead.
+type response struct {
+	Href    string
+	Props   map[xml.Name]string
+	Missing []xml.Name
+	Status  int
+}
+
+// element writes an XML element with the given inner XML, declaring its
+// namespace if it has no prefix of its own.
+func element(b *strings.Builder, name xml.Name, inner string) {
+	tag := name.Local
+	decl := ""
+	if prefix, ok := prefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		tag = "x:" + name.Local
+		var ns strings.Builder
+		xml.EscapeText(&ns, []byte(name.Space))
+		decl = ` xmlns:x="` + ns.String() + `"`
+	}
+	if inner == "" {
+		fmt.Fprintf(b, "<%s%s/>", tag, decl)
+		return
+	}
+	fmt.Fprintf(b, "<%s%s>%s</%s>", tag, decl, inner, tag)
+}
+
+// escape returns s escaped for use as XML text.
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// writeMultistatus sends a 207 Multi-Status response.
+func writeMultistatus(w http.ResponseWriter, responses []response) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, r := range responses {
+		b.WriteString("<d:response><d:href>" + escape(r.Href) + "</d:href>")
+		if r.Status != 0 {
+			b.WriteString("<d:status>" + statusLine(r.Status) + "</d:status></d:response>")
+			continue
+		}
+		if len(r.Props) > 0 {
+			var props strings.Builder
+			for _, name := range sortedNames(r.Props) {
+				element(&props, name, r.Props[name])
+			}
+			b.WriteString("<d:propstat><d:prop>" + props.String() + "</d:prop><d:status>" + statusLine(http.StatusOK) + "</d:status></d:propstat>")
+		}
+		if len(r.Missing) > 0 {
+			var props strings.Builder
+			for _, name := range r.Missing {
+				element(&props, name, "")
+			}
+			b.WriteString("<d:propstat><d:prop>" + props.String() + "</d:prop><d:status>" + statusLine(http.StatusNotFound) + "</d:status></d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	io.WriteString(w, b.String())
+}
+
+// sortedNames orders properties so responses are stable.
+func sortedNames(props map[xml.Name]string) []xml.Name {
+	names := make([]xml.Name, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+	return names
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"go-todo/internal/backup"
+	"go-todo/internal/config"
+	"go-todo/internal/storage"
+)
+
+const backupUsage = "usage: go-todo backup create|list|restore <name> [-db sqlite://path] [-y]"
+
+// Backup manages the rotating snapshots of a SQLite database: "create" takes
+// one now, "list" shows them and "restore <name>" puts one back after
+// checking its integrity.
+func Backup(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(backupUsage)
+	}
+	action, args := args[0], args[1:]
+	flags := flag.NewFlagSet("backup "+action, flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", storage.DefaultDSN, "database to back up, must be sqlite://")
+	configPath := flags.String("config", "", "path to the config file with the backup_daily and backup_weekly counts")
+	yes := flags.Bool("y", false, "restore without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	path, err := storage.SQLitePath(*dsn)
+	if err != nil {
+		return err
+	}
+	rotation := backup.For(path, loadConfig(*configPath).BackupPolicy())
+	ctx := context.Background()
+
+	switch action {
+	case "create":
+		store, err := storage.NewStoreAt(path)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		b, err := rotation.Snapshot(ctx, store)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Backed up to %s.\n", b.Path)
+		return nil
+	case "list":
+		return listBackups(rotation, stdout)
+	case "restore":
+		if flags.NArg() != 1 {
+			return errors.New(backupUsage)
+		}
+		return restoreBackup(ctx, rotation, flags.Arg(0), *yes, stdin, stdout)
+	default:
+		return fmt.Errorf("unknown backup command %q, %s", action, backupUsage)
+	}
+}
+
+func listBackups(rotation *backup.Rotation, stdout io.Writer) error {
+	backups, err := rotation.List()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Fprintf(stdout, "No backups in %s.\n", rotation.Dir)
+		return nil
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTAKEN\tSIZE")
+	for _, b := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%d KB\n", b.Name, b.Time.Format("2006-01-02 15:04"), (b.Size+1023)/1024)
+	}
+	return w.Flush()
+}
+
+// restoreBackup replaces the database with a backup. The current database
+// is snapshotted first, when it can be, so the restore can be undone.
+func restoreBackup(ctx context.Context, rotation *backup.Rotation, name string, yes bool, stdin io.Reader, stdout io.Writer) error {
+	b, err := rotation.Find(name)
+	if err != nil {
+		return err
+	}
+	if err := storage.CheckIntegrity(ctx, b.Path); err != nil {
+		return err
+	}
+	question := fmt.Sprintf("Replace %s with the backup taken %s? Quit go-todo first.", rotation.DBPath, b.Time.Format("2006-01-02 15:04"))
+	if !yes && !confirm(stdin, stdout, question) {
+		return errors.New("restore cancelled")
+	}
+
+	if _, err := os.Stat(rotation.DBPath); err == nil {
+		if saved, err := snapshotCurrent(ctx, rotation); err != nil {
+			fmt.Fprintf(stdout, "Could not back up the current database: %v\n", err)
+		} else {
+			fmt.Fprintf(stdout, "Saved the current database as %s.\n", saved.Name)
+		}
+	}
+
+	if err := rotation.Restore(ctx, name); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Restored %s from %s.\n", rotation.DBPath, name)
+	return nil
+}
+
+// snapshotCurrent backs up the database without pruning, so the backup
+// about to be restored cannot be rotated away.
+func snapshotCurrent(ctx context.Context, rotation *backup.Rotation) (backup.Backup, error) {
+	store, err := storage.NewStoreAt(rotation.DBPath)
+	if err != nil {
+		return backup.Backup{}, err
+	}
+	defer store.Close()
+	return rotation.Create(ctx, store)
+}
+
+// loadConfig reads the preferences at path, or the default location when
+// path is empty, falling back to the defaults if they cannot be read.
+func loadConfig(path string) *config.Config {
+	if path == "" {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			return &config.Config{}
+		}
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return &config.Config{}
+	}
+	return cfg
+}
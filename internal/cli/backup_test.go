@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-todo/internal/backup"
+	"go-todo/internal/storage"
+)
+
+func TestBackup_CreateListRestore(t *testing.T) {
+	source := newSource(t, "a")
+	config := filepath.Join(t.TempDir(), "config.json")
+	flags := []string{"-db", source, "-config", config}
+
+	var stdout bytes.Buffer
+	if err := Backup(append([]string{"list"}, flags...), strings.NewReader(""), &stdout); err != nil {
+		t.Fatalf("backup list failed: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "No backups") {
+		t.Errorf("Expected no backups yet, got %q", stdout.String())
+	}
+
+	if err := Backup(append([]string{"create"}, flags...), strings.NewReader(""), io.Discard); err != nil {
+		t.Fatalf("backup create failed: %v", err)
+	}
+	path, _ := storage.SQLitePath(source)
+	backups, _ := backup.For(path, backup.Policy{}).List()
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %d", len(backups))
+	}
+	name := backups[0].Name
+
+	stdout.Reset()
+	Backup(append([]string{"list"}, flags...), strings.NewReader(""), &stdout)
+	if !strings.Contains(stdout.String(), name) {
+		t.Errorf("Expected %s in the listing, got %q", name, stdout.String())
+	}
+
+	store, _ := storage.NewStoreAt(path)
+	store.AddTask(ctx, "b")
+	store.Close()
+
+	restore := append(append([]string{"restore"}, flags...), name)
+	if err := Backup(restore, strings.NewReader("n\n"), io.Discard); err == nil {
+		t.Error("Expected the restore to be cancelled")
+	}
+	if got := listTasks(t, source); len(got) != 2 {
+		t.Errorf("Expected tasks untouched after cancelling, got %v", got)
+	}
+	if err := Backup(restore, strings.NewReader("y\n"), io.Discard); err != nil {
+		t.Fatalf("backup restore failed: %v", err)
+	}
+	if got := listTasks(t, source); len(got) != 1 || got[0] != "a" {
+		t.Errorf("Expected [a] after restoring, got %v", got)
+	}
+}
+
+func TestBackup_RejectsBadArguments(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"prune"},
+		{"list", "-db", "memory://"},
+		{"restore", "-db", newSource(t)},
+	} {
+		if err := Backup(args, strings.NewReader(""), io.Discard); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"go-todo/internal/caldav"
+	"go-todo/internal/storage"
+)
+
+// CalDAV serves the tasks of a database to CalDAV clients, such as the task
+// apps of phones, until it is interrupted.
+func CalDAV(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("caldav", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", storage.DefaultDSN, "database to serve")
+	addr := flags.String("addr", ":8643", "address to listen on")
+	prefix := flags.String("prefix", "/dav/", "URL path the CalDAV home is served at")
+	token := flags.String("token", "", "password clients must present (default: $"+caldav.TokenEnv+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" {
+		*token = os.Getenv(caldav.TokenEnv)
+	}
+	if *token == "" {
+		return errors.New("no token, pass -token or set " + caldav.TokenEnv)
+	}
+
+	store, err := storage.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := storage.RequirePlaintext(ctx, store, "the CalDAV server"); err != nil {
+		return err
+	}
+	server, err := caldav.NewServer(ctx, store, *token, *prefix)
+	if err != nil {
+		return err
+	}
+	return serve(*addr, server, stdout, "Serving "+*dsn+" over CalDAV at "+*prefix)
+}
@@ -0,0 +1,16 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"go-todo/internal/caldav"
+)
+
+func TestCalDAV_RequiresToken(t *testing.T) {
+	t.Setenv(caldav.TokenEnv, "")
+	if err := CalDAV([]string{"-db", newSource(t, "a"), "-addr", "127.0.0.1:0"}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error without a token")
+	}
+}
@@ -0,0 +1,96 @@
+// Package cli implements the go-todo subcommands that run without the TUI,
+// such as restore, backup, rekey, sync, sync-server, caldav and webhooks.
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Command runs a subcommand with its arguments (not including the command
+// name). stdin is used for confirmations and stdout for progress.
+type Command func(args []string, stdin io.Reader, stdout io.Writer) error
+
+var commands = map[string]Command{
+	"backup":      Backup,
+	"caldav":      CalDAV,
+	"rekey":       Rekey,
+	"restore":     Restore,
+	"sync":        Sync,
+	"sync-server": SyncServer,
+	"webhooks":    Webhooks,
+}
+
+// Lookup returns the subcommand called name, if there is one.
+func Lookup(name string) (Command, bool) {
+	cmd, ok := commands[name]
+	return cmd, ok
+}
+
+// Names lists the subcommands in alphabetical order.
+func Names() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// timeLayouts are the accepted formats for times given on the command line,
+// most specific first.
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime reads a time given on the command line, in local time unless it
+// carries a zone.
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time %q, use YYYY-MM-DD HH:MM", s)
+}
+
+// confirm asks a yes/no question and reports whether the answer was yes.
+func confirm(stdin io.Reader, stdout io.Writer, question string) bool {
+	fmt.Fprintf(stdout, "%s [y/N] ", question)
+	var answer string
+	fmt.Fscanln(stdin, &answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// serve runs handler on addr until the process is interrupted, and then
+// lets the requests in flight finish. banner is printed with the address
+// once it listens.
+func serve(addr string, handler http.Handler, stdout io.Writer, banner string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	fmt.Fprintf(stdout, "%s on %s.\n", banner, listener.Addr())
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
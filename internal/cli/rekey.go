@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go-todo/internal/storage"
+
+	"golang.org/x/term"
+)
+
+// Rekey changes the passphrase of an encrypted database, or encrypts a plain
+// one, asking for the passphrases on stdin.
+func Rekey(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", storage.DefaultDSN, "database to encrypt or rekey")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	store, err := storage.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	encrypted, err := storage.IsEncrypted(ctx, store)
+	if err != nil {
+		return err
+	}
+
+	var current string
+	if encrypted {
+		if current, err = readPassphrase(stdin, stdout, "Current passphrase: "); err != nil {
+			return err
+		}
+		if _, err := storage.Unlock(ctx, store, current); err != nil {
+			return err
+		}
+	}
+	next, err := readPassphrase(stdin, stdout, "New passphrase: ")
+	if err != nil {
+		return err
+	}
+	repeated, err := readPassphrase(stdin, stdout, "Repeat new passphrase: ")
+	if err != nil {
+		return err
+	}
+	if next != repeated {
+		return errors.New("passphrases do not match")
+	}
+
+	if encrypted {
+		if err := storage.Rekey(ctx, store, current, next); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "Passphrase changed. Backups taken before now still open with the old one.")
+		return nil
+	}
+	if _, err := storage.EnableEncryption(ctx, store, next); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Encrypted %s, including its history. Earlier backups are still in plaintext.\n", *dsn)
+	return nil
+}
+
+// readPassphrase prompts for a passphrase, without echo when stdin is a
+// terminal.
+func readPassphrase(stdin io.Reader, stdout io.Writer, prompt string) (string, error) {
+	fmt.Fprint(stdout, prompt)
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		line, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(stdout)
+		return string(line), err
+	}
+	line, err := readLine(stdin)
+	return strings.TrimRight(line, "\r"), err
+}
+
+// readLine reads up to the next newline one byte at a time, so nothing
+// meant for a later prompt is consumed.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// unlockTasks opens an encrypted database and lists its tasks.
+func unlockTasks(t *testing.T, dsn, passphrase string) ([]models.Task, error) {
+	t.Helper()
+	store, err := storage.Open(dsn)
+	if err != nil {
+		t.Fatalf("Opening %s: %v", dsn, err)
+	}
+	defer store.Close()
+	unlocked, err := storage.Unlock(ctx, store, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return unlocked.GetTasks(ctx, models.TaskQuery{})
+}
+
+func TestRekey(t *testing.T) {
+	source := newSource(t, "Call ACME")
+	args := []string{"-db", source}
+
+	if err := Rekey(args, strings.NewReader("first\nsecond\n"), io.Discard); err == nil {
+		t.Error("Expected an error for mismatched passphrases")
+	}
+	if err := Rekey(args, strings.NewReader("first\nfirst\n"), io.Discard); err != nil {
+		t.Fatalf("Encrypting failed: %v", err)
+	}
+	if got := listTasks(t, source); len(got) != 1 || !strings.HasPrefix(got[0], "enc:") {
+		t.Errorf("Expected the description stored encrypted, got %v", got)
+	}
+
+	if err := Rekey(args, strings.NewReader("wrong\nnew\nnew\n"), io.Discard); !errors.Is(err, storage.ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := Rekey(args, strings.NewReader("first\nnew passphrase\nnew passphrase\n"), io.Discard); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if _, err := unlockTasks(t, source, "first"); !errors.Is(err, storage.ErrWrongPassphrase) {
+		t.Errorf("Expected the old passphrase rejected, got %v", err)
+	}
+	tasks, err := unlockTasks(t, source, "new passphrase")
+	if err != nil || len(tasks) != 1 || tasks[0].Description != "Call ACME" {
+		t.Errorf("Expected the task readable with the new passphrase, got %+v, %v", tasks, err)
+	}
+}
+
+func TestRestore_CopiesEncryptionKey(t *testing.T) {
+	source := newSource(t, "Call ACME")
+	if err := Rekey([]string{"-db", source}, strings.NewReader("secret\nsecret\n"), io.Discard); err != nil {
+		t.Fatalf("Encrypting failed: %v", err)
+	}
+	out := "sqlite://" + filepath.Join(t.TempDir(), "restored.db")
+	if err := Restore([]string{"-db", source, "-at", stamp(time.Hour), "-o", out}, strings.NewReader(""), io.Discard); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	tasks, err := unlockTasks(t, out, "secret")
+	if err != nil || len(tasks) != 1 || tasks[0].Description != "Call ACME" {
+		t.Errorf("Expected the restored task readable, got %+v, %v", tasks, err)
+	}
+}
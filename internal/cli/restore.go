@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"go-todo/internal/storage"
+)
+
+// Restore rebuilds the task set as it was at a given time from the change
+// log, either into a new database (-o) or in place after confirmation.
+func Restore(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", storage.DefaultDSN, "database to read the change log from")
+	at := flags.String("at", "", `point in time to restore, e.g. "2026-10-01 09:00" (local time)`)
+	out := flags.String("o", "", "write the restored tasks to this new database instead of replacing the current ones")
+	yes := flags.Bool("y", false, "replace in place without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *at == "" {
+		return errors.New("-at is required")
+	}
+	when, err := parseTime(*at)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	source, err := storage.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	tasks, err := source.TasksAt(ctx, when)
+	if err != nil {
+		return fmt.Errorf("replaying change log: %w", err)
+	}
+	stamp := when.Format("2006-01-02 15:04:05 MST")
+
+	target := source
+	if *out != "" {
+		if target, err = storage.Open(*out); err != nil {
+			return err
+		}
+		defer target.Close()
+		if n, err := countTasks(ctx, target); err != nil {
+			return err
+		} else if n > 0 {
+			return fmt.Errorf("%s already has %d tasks, restore into a new database", *out, n)
+		}
+		// Encrypted descriptions are copied as they are, so the new
+		// database needs the same key.
+		if err := storage.ShareKey(ctx, source, target); err != nil {
+			return err
+		}
+	} else {
+		current, err := countTasks(ctx, source)
+		if err != nil {
+			return err
+		}
+		question := fmt.Sprintf("Replace the %d current tasks in %s with the %d tasks as of %s?", current, *dsn, len(tasks), stamp)
+		if !*yes && !confirm(stdin, stdout, question) {
+			return errors.New("restore cancelled")
+		}
+	}
+
+	if err := target.ReplaceTasks(ctx, tasks, nil); err != nil {
+		return fmt.Errorf("writing restored tasks: %w", err)
+	}
+	fmt.Fprintf(stdout, "Restored %d tasks as of %s.\n", len(tasks), stamp)
+	return nil
+}
+
+// countTasks counts every task in a backend, archived ones included.
+func countTasks(ctx context.Context, b storage.Backend) (int, error) {
+	tasks, err := storage.ExportTasks(ctx, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(tasks), nil
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newSource creates a SQLite database holding the given tasks and returns
+// its DSN.
+func newSource(t *testing.T, descriptions ...string) string {
+	t.Helper()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "tasks.db")
+	store, err := storage.Open(dsn)
+	if err != nil {
+		t.Fatalf("Opening source: %v", err)
+	}
+	defer store.Close()
+	for _, description := range descriptions {
+		if _, err := store.AddTask(ctx, description); err != nil {
+			t.Fatalf("AddTask failed: %v", err)
+		}
+	}
+	return dsn
+}
+
+func listTasks(t *testing.T, dsn string) []string {
+	t.Helper()
+	store, err := storage.Open(dsn)
+	if err != nil {
+		t.Fatalf("Opening %s: %v", dsn, err)
+	}
+	defer store.Close()
+	tasks, err := store.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Description)
+	}
+	return got
+}
+
+func stamp(d time.Duration) string {
+	return time.Now().Add(d).Format(time.RFC3339)
+}
+
+func TestRestore_IntoNewDatabase(t *testing.T) {
+	source := newSource(t, "a", "b")
+	out := "sqlite://" + filepath.Join(t.TempDir(), "restored.db")
+
+	var stdout bytes.Buffer
+	if err := Restore([]string{"-db", source, "-at", stamp(time.Hour), "-o", out}, strings.NewReader(""), &stdout); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got := listTasks(t, out); len(got) != 2 || got[0] != "b" || got[1] != "a" {
+		t.Errorf("Expected [b a] in the new database, got %v", got)
+	}
+	if !strings.Contains(stdout.String(), "Restored 2 tasks") {
+		t.Errorf("Expected a summary, got %q", stdout.String())
+	}
+
+	// Restoring into a database that already has tasks is refused.
+	if err := Restore([]string{"-db", source, "-at", stamp(time.Hour), "-o", out}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error restoring into a non-empty database")
+	}
+}
+
+func TestRestore_InPlaceAsksFirst(t *testing.T) {
+	source := newSource(t, "a")
+	args := []string{"-db", source, "-at", stamp(-time.Hour)}
+
+	var stdout bytes.Buffer
+	if err := Restore(args, strings.NewReader("n\n"), &stdout); err == nil {
+		t.Error("Expected the restore to be cancelled")
+	}
+	if !strings.Contains(stdout.String(), "Replace the 1 current tasks") {
+		t.Errorf("Expected a confirmation prompt, got %q", stdout.String())
+	}
+	if got := listTasks(t, source); len(got) != 1 {
+		t.Errorf("Expected tasks untouched after cancelling, got %v", got)
+	}
+
+	// An hour ago there were no tasks yet.
+	if err := Restore(args, strings.NewReader("y\n"), io.Discard); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got := listTasks(t, source); len(got) != 0 {
+		t.Errorf("Expected no tasks as of an hour ago, got %v", got)
+	}
+}
+
+func TestRestore_RejectsBadArguments(t *testing.T) {
+	source := newSource(t)
+	for _, args := range [][]string{
+		{"-db", source},
+		{"-db", source, "-at", "last tuesday"},
+		{"-db", "nosuchscheme://x", "-at", "2026-10-01"},
+	} {
+		if err := Restore(args, strings.NewReader(""), io.Discard); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for _, s := range []string{"2026-10-01 09:00", "2026-10-01 09:00:00", "2026-10-01T09:00:00+02:00", "2026-10-01"} {
+		if _, err := parseTime(s); err != nil {
+			t.Errorf("parseTime(%q) failed: %v", s, err)
+		}
+	}
+	got, _ := parseTime("2026-10-01 09:00")
+	if want := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
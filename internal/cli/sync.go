@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go-todo/internal/caldav"
+	"go-todo/internal/config"
+	"go-todo/internal/crdt"
+	"go-todo/internal/gitsync"
+	"go-todo/internal/storage"
+	"go-todo/internal/syncserver"
+)
+
+// Sync merges the tasks with the git working copy set as sync_repo in the
+// config, or given with -repo, and pushes the result. With a shared folder
+// set as sync_folder or given with -folder instead, it exchanges changes
+// through the folder, and with a sync server set as sync_server or given
+// with -server, it pulls and pushes changes from and to the server. With a
+// CalDAV task collection set as caldav_url or given with -caldav, it syncs
+// the tasks with the collection.
+func Sync(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", storage.DefaultDSN, "database to sync")
+	configPath := flags.String("config", "", "path to the config file with sync_repo, sync_folder, sync_server or caldav_url")
+	repo := flags.String("repo", "", "git working copy to sync through (default: sync_repo from the config)")
+	folder := flags.String("folder", "", "shared folder to sync through (default: sync_folder from the config)")
+	server := flags.String("server", "", "URL of a sync server to sync with (default: sync_server from the config)")
+	collection := flags.String("caldav", "", "URL of a CalDAV task collection to sync with (default: caldav_url from the config)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		*configPath, _ = config.DefaultPath()
+	}
+	cfg := loadConfig(*configPath)
+	if *repo == "" && *folder == "" && *server == "" && *collection == "" {
+		*repo, *folder, *server, *collection = cfg.SyncRepo, cfg.SyncFolder, cfg.SyncServer, cfg.CalDAVURL
+	}
+	switch (&config.Config{SyncRepo: *repo, SyncFolder: *folder, SyncServer: *server, CalDAVURL: *collection}).SyncTargets() {
+	case 0:
+		return errors.New("nothing to sync with, set sync_repo, sync_folder, sync_server or caldav_url in the config or pass -repo, -folder, -server or -caldav")
+	case 1:
+	default:
+		return errors.New("sync through only one of a repository, a folder, a server and a CalDAV collection")
+	}
+
+	store, err := storage.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	switch {
+	case *folder != "":
+		return syncFolder(store, *folder, *configPath, stdout)
+	case *server != "":
+		token := cfg.SyncToken
+		if token == "" {
+			token = os.Getenv(syncserver.TokenEnv)
+		}
+		return syncServer(store, *server, token, stdout)
+	case *collection != "":
+		password := cfg.CalDAVPassword
+		if password == "" {
+			password = os.Getenv(caldav.PasswordEnv)
+		}
+		return syncCalDAV(store, *collection, cfg.CalDAVUser, password, stdout)
+	}
+	syncer, err := gitsync.New(*repo, store)
+	if err != nil {
+		return err
+	}
+	conflicts, err := syncer.Sync(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, c := range conflicts {
+		fmt.Fprintln(stdout, c)
+	}
+	fmt.Fprintf(stdout, "Synced with %s.\n", syncer.Dir)
+	return nil
+}
+
+// syncFolder merges the tasks with the changes in a shared folder, as the
+// replica whose ID is kept beside the config file.
+func syncFolder(store storage.Backend, folder, configPath string, stdout io.Writer) error {
+	if configPath == "" {
+		return errors.New("no config directory to keep the replica ID in, pass -config")
+	}
+	replica, err := crdt.ReplicaID(filepath.Join(filepath.Dir(configPath), crdt.ReplicaFile))
+	if err != nil {
+		return err
+	}
+	syncer, err := crdt.New(folder, store, replica)
+	if err != nil {
+		return err
+	}
+	if err := syncer.Sync(context.Background()); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Synced with %s as replica %s.\n", syncer.Dir, replica)
+	return nil
+}
+
+// syncServer pulls and pushes changes from and to the sync server at url.
+func syncServer(store storage.Backend, url, token string, stdout io.Writer) error {
+	client, err := syncserver.NewClient(url, token)
+	if err != nil {
+		return err
+	}
+	conflicts, err := syncserver.NewSyncer(client, store).Sync(context.Background())
+	for _, c := range conflicts {
+		fmt.Fprintln(stdout, c)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Synced with %s.\n", client.URL)
+	return nil
+}
+
+// syncCalDAV syncs the tasks with the CalDAV task collection at url.
+func syncCalDAV(store storage.Backend, url, user, password string, stdout io.Writer) error {
+	client, err := caldav.NewClient(url, user, password)
+	if err != nil {
+		return err
+	}
+	conflicts, err := caldav.NewSyncer(client, store).Sync(context.Background())
+	for _, c := range conflicts {
+		fmt.Fprintln(stdout, c)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Synced with %s.\n", client.URL)
+	return nil
+}
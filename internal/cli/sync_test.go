@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-todo/internal/caldav"
+	"go-todo/internal/gitsync"
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+	"go-todo/internal/syncserver"
+)
+
+func TestSync(t *testing.T) {
+	t.Setenv("GIT_AUTHOR_NAME", "go-todo tests")
+	t.Setenv("GIT_COMMITTER_NAME", "go-todo tests")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	repo := filepath.Join(t.TempDir(), "repo")
+	if out, err := exec.Command("git", "init", "--quiet", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	source := newSource(t, "a")
+	config := filepath.Join(t.TempDir(), "config.json")
+
+	if err := Sync([]string{"-db", source, "-config", config}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error without a repository")
+	}
+	if err := Sync([]string{"-db", source, "-config", config, "-repo", repo}, strings.NewReader(""), io.Discard); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(repo, gitsync.FileName))
+	if err != nil || !strings.Contains(string(data), `"description":"a"`) {
+		t.Errorf("Expected the task written to the repository, got %q, %v", data, err)
+	}
+}
+
+func TestSync_Folder(t *testing.T) {
+	folder := t.TempDir()
+	laptop, desktop := newSource(t, "from laptop"), newSource(t, "from desktop")
+	// Each database is synced as its own install, with its own config
+	// directory and so its own replica ID.
+	laptopConfig := filepath.Join(t.TempDir(), "config.json")
+	desktopConfig := filepath.Join(t.TempDir(), "config.json")
+
+	if err := Sync([]string{"-db", laptop, "-config", laptopConfig, "-repo", folder, "-folder", folder}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error with both a repository and a folder")
+	}
+	for _, args := range [][]string{
+		{"-db", laptop, "-config", laptopConfig, "-folder", folder},
+		{"-db", desktop, "-config", desktopConfig, "-folder", folder},
+		{"-db", laptop, "-config", laptopConfig, "-folder", folder},
+	} {
+		if err := Sync(args, strings.NewReader(""), io.Discard); err != nil {
+			t.Fatalf("Sync %v failed: %v", args, err)
+		}
+	}
+	for _, dsn := range []string{laptop, desktop} {
+		if got := listTasks(t, dsn); len(got) != 2 {
+			t.Errorf("Expected both tasks in %s, got %v", dsn, got)
+		}
+	}
+}
+
+func TestSync_Server(t *testing.T) {
+	serverStore := storage.NewMemoryStore()
+	server, err := syncserver.NewServer(context.Background(), serverStore, "token")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	source := newSource(t, "a")
+	config := filepath.Join(t.TempDir(), "config.json")
+
+	t.Setenv(syncserver.TokenEnv, "wrong")
+	if err := Sync([]string{"-db", source, "-config", config, "-server", ts.URL}, strings.NewReader(""), io.Discard); !errors.Is(err, syncserver.ErrUnauthorized) {
+		t.Errorf("Expected the wrong token to be rejected, got %v", err)
+	}
+	t.Setenv(syncserver.TokenEnv, "token")
+	if err := Sync([]string{"-db", source, "-config", config, "-server", ts.URL}, strings.NewReader(""), io.Discard); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	tasks, _ := serverStore.GetTasks(context.Background(), models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "a" {
+		t.Errorf("Expected the task pushed to the server, got %+v", tasks)
+	}
+}
+
+func TestSync_CalDAV(t *testing.T) {
+	serverStore := storage.NewMemoryStore()
+	server, err := caldav.NewServer(context.Background(), serverStore, "token", "/dav/")
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	source := newSource(t, "a")
+	config := filepath.Join(t.TempDir(), "config.json")
+	data := `{"caldav_url": "` + ts.URL + `/dav/tasks/", "caldav_user": "me"}`
+	if err := os.WriteFile(config, []byte(data), 0o644); err != nil {
+		t.Fatalf("Writing config: %v", err)
+	}
+
+	t.Setenv(caldav.PasswordEnv, "wrong")
+	if err := Sync([]string{"-db", source, "-config", config}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected the wrong password to be rejected")
+	}
+	t.Setenv(caldav.PasswordEnv, "token")
+	if err := Sync([]string{"-db", source, "-config", config}, strings.NewReader(""), io.Discard); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	tasks, _ := serverStore.GetTasks(context.Background(), models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "a" {
+		t.Errorf("Expected the task pushed to the CalDAV server, got %+v", tasks)
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"go-todo/internal/storage"
+	"go-todo/internal/syncserver"
+)
+
+// serverDSN is the database a sync server keeps the canonical tasks in by
+// default. It is separate from the user's own tasks.db.
+const serverDSN = "sqlite://sync-server.db"
+
+// SyncServer serves the tasks in a database to sync clients over HTTP until
+// it is interrupted.
+func SyncServer(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sync-server", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", serverDSN, "database holding the canonical tasks")
+	addr := flags.String("addr", ":8642", "address to listen on")
+	token := flags.String("token", "", "token clients must present (default: $"+syncserver.TokenEnv+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *token == "" {
+		*token = os.Getenv(syncserver.TokenEnv)
+	}
+	if *token == "" {
+		return errors.New("no token, pass -token or set " + syncserver.TokenEnv)
+	}
+
+	store, err := storage.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	server, err := syncserver.NewServer(context.Background(), store, *token)
+	if err != nil {
+		return err
+	}
+	return serve(*addr, server, stdout, "Serving "+*dsn)
+}
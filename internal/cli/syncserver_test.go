@@ -0,0 +1,18 @@
+package cli
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-todo/internal/syncserver"
+)
+
+func TestSyncServer_RequiresToken(t *testing.T) {
+	t.Setenv(syncserver.TokenEnv, "")
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "server.db")
+	if err := SyncServer([]string{"-db", dsn, "-addr", "127.0.0.1:0"}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error without a token")
+	}
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"go-todo/internal/storage"
+	"go-todo/internal/webhook"
+)
+
+// Webhooks prints the latest entries of the webhook delivery log, and how
+// many calls are still waiting in the outbox.
+func Webhooks(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("webhooks", flag.ContinueOnError)
+	flags.SetOutput(stdout)
+	dsn := flags.String("db", storage.DefaultDSN, "database whose delivery log to show")
+	limit := flags.Int("n", 20, "number of deliveries to show")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := storage.Open(*dsn)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	outbox, ok := store.(webhook.Outbox)
+	if !ok {
+		return errors.New("only sqlite:// databases keep a webhook delivery log")
+	}
+	ctx := context.Background()
+	deliveries, err := outbox.WebhookDeliveries(ctx, *limit)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		fmt.Fprintln(stdout, "No webhook deliveries yet.")
+	}
+	for _, d := range deliveries {
+		outcome := fmt.Sprintf("delivered (%d)", d.Status)
+		if !d.Delivered() {
+			outcome = "failed: " + d.Error
+		}
+		fmt.Fprintf(stdout, "%s  %-15s %s  attempt %d  %s\n", d.At, d.Event, d.URL, d.Attempt, outcome)
+	}
+	waiting, err := outbox.DueWebhooks(ctx, time.Now().Add(webhook.MaxDelay), 1000)
+	if err != nil {
+		return err
+	}
+	if len(waiting) > 0 {
+		fmt.Fprintf(stdout, "%d call(s) waiting in the outbox.\n", len(waiting))
+	}
+	return nil
+}
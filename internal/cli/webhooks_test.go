@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+func TestWebhooks_ShowsDeliveryLog(t *testing.T) {
+	dsn := newSource(t)
+	store, err := storage.Open(dsn)
+	if err != nil {
+		t.Fatalf("Opening store: %v", err)
+	}
+	outbox := store.(*storage.Store)
+	id, _ := outbox.EnqueueWebhook(ctx, models.WebhookMessage{URL: "https://chat.example.com/hook", Event: "task.completed", Payload: "{}"})
+	outbox.RecordWebhookDelivery(ctx, models.WebhookDelivery{MessageID: id, URL: "https://chat.example.com/hook", Event: "task.completed", Attempt: 1, Status: 502, Error: "502 Bad Gateway"}, time.Now().Add(time.Minute))
+	store.Close()
+
+	var out strings.Builder
+	if err := Webhooks([]string{"-db", dsn}, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("Webhooks failed: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "task.completed") || !strings.Contains(got, "failed: 502 Bad Gateway") || !strings.Contains(got, "1 call(s) waiting") {
+		t.Errorf("Expected the failed delivery and the waiting call, got %q", got)
+	}
+}
+
+func TestWebhooks_RequiresSQLite(t *testing.T) {
+	if err := Webhooks([]string{"-db", "memory://"}, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error for a store without a delivery log")
+	}
+}
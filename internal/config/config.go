@@ -0,0 +1,126 @@
+// Package config loads and saves user preferences that persist between
+// runs, such as how the task list is sorted and grouped.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"go-todo/internal/backup"
+	"go-todo/internal/models"
+	"go-todo/internal/webhook"
+)
+
+// fileName is the name of the config file inside the user config directory.
+const fileName = "config.json"
+
+// Config holds the user's preferences. Unset fields fall back to defaults.
+type Config struct {
+	Sort  models.SortMode  `json:"sort,omitempty"`
+	Group models.GroupMode `json:"group,omitempty"`
+	// HideDone hides completed tasks from the list.
+	HideDone bool `json:"hide_done,omitempty"`
+	// BackupDaily and BackupWeekly are how many daily and weekly database
+	// snapshots to keep.
+	BackupDaily  int `json:"backup_daily,omitempty"`
+	BackupWeekly int `json:"backup_weekly,omitempty"`
+	// SyncRepo is a git working copy to sync tasks through, if any.
+	SyncRepo string `json:"sync_repo,omitempty"`
+	// SyncFolder is a shared folder to sync tasks through, if any.
+	SyncFolder string `json:"sync_folder,omitempty"`
+	// SyncServer is the URL of a sync server to sync tasks with, if any,
+	// and SyncToken the token it expects.
+	SyncServer string `json:"sync_server,omitempty"`
+	SyncToken  string `json:"sync_token,omitempty"`
+	// CalDAVURL is a task collection on a CalDAV server to sync tasks
+	// with, if any, logged in to as CalDAVUser with CalDAVPassword.
+	CalDAVURL      string `json:"caldav_url,omitempty"`
+	CalDAVUser     string `json:"caldav_user,omitempty"`
+	CalDAVPassword string `json:"caldav_password,omitempty"`
+	// Webhooks are called when tasks are added, completed, reopened or
+	// deleted.
+	Webhooks []webhook.Hook `json:"webhooks,omitempty"`
+	// Keys rebinds actions, by name, to key sequences such as "Ctrl+D" or
+	// "dd". Actions left out keep their default keys.
+	Keys map[string][]string `json:"keys,omitempty"`
+}
+
+// DefaultPath returns the config file location under the user's config
+// directory, e.g. ~/.config/go-todo/config.json on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("finding user config directory: %w", err)
+	}
+	return filepath.Join(dir, "go-todo", fileName), nil
+}
+
+// Load reads the config at path. A missing file yields the defaults.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Save writes the config to path, creating its directory if needed. The
+// file is replaced atomically so a crash never leaves it half written.
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), fileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing config file: %w", err)
+	}
+	return nil
+}
+
+// Query returns the task list view described by the config.
+func (c *Config) Query() models.TaskQuery {
+	return models.TaskQuery{Sort: c.Sort, Group: c.Group, HideDone: c.HideDone}.WithDefaults()
+}
+
+// BackupPolicy returns how many database snapshots to keep.
+func (c *Config) BackupPolicy() backup.Policy {
+	return backup.Policy{Daily: c.BackupDaily, Weekly: c.BackupWeekly}.WithDefaults()
+}
+
+// SyncTargets counts how many of sync_repo, sync_folder, sync_server and
+// caldav_url are set. Tasks can only be synced through one of them.
+func (c *Config) SyncTargets() int {
+	n := 0
+	for _, target := range []string{c.SyncRepo, c.SyncFolder, c.SyncServer, c.CalDAVURL} {
+		if target != "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-todo/internal/models"
+	"go-todo/internal/webhook"
+)
+
+func TestLoad_MissingFileGivesDefaults(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := cfg.Query(); got.Sort != models.SortManual || got.Group != models.GroupStatus {
+		t.Errorf("Expected default query, got %+v", got)
+	}
+	if got := cfg.BackupPolicy(); got.Daily != 7 || got.Weekly != 4 {
+		t.Errorf("Expected default backup policy, got %+v", got)
+	}
+	if got := cfg.SyncTargets(); got != 0 {
+		t.Errorf("Expected no sync targets, got %d", got)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.json")
+	cfg := &Config{Sort: models.SortDue, Group: models.GroupCreatedDay, HideDone: true,
+		Webhooks: []webhook.Hook{{URL: "https://chat.example.com/hook", Secret: "shh", Events: []string{"task.completed"}}},
+		Keys:     map[string][]string{"delete": {"dd"}, "quit": {"Ctrl+Q", "ZZ"}}}
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Expected %+v, got %+v", cfg, loaded)
+	}
+}
+
+func TestLoad_RejectsMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Expected an error for a malformed config file")
+	}
+}
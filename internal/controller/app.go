@@ -1,23 +1,86 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"go-todo/internal/config"
 	"go-todo/internal/models"
+	"go-todo/internal/storage"
 )
 
+// refreshInterval is how often the store is polled for changes made by
+// other processes.
+const refreshInterval = time.Second
+
 type AppController struct {
 	store Store
 	ui    UI
+
+	// dataVersion is the store data version the shown list was loaded at.
+	// Only touched on the UI goroutine.
+	dataVersion int64
+	// polledVersion is the last data version the watcher saw. Only touched
+	// by the watcher.
+	polledVersion int64
+	// tasks is the list as last loaded from the store, used to look up the
+	// version of the selected task for optimistic concurrency checks.
+	tasks []models.Task
+	// archived is the archive as last shown, for the same purpose.
+	archived []models.Task
+
+	// spawn starts background work. Tests replace it to run synchronously.
+	spawn func(func())
+	// pending holds the cancel functions of in-flight store calls, keyed by
+	// an operation number. Only touched on the UI goroutine.
+	pending map[int]context.CancelFunc
+	nextOp  int
+
+	// config holds the list view preferences, saved to configPath when the
+	// user changes them.
+	config     *config.Config
+	configPath string
+
+	// historyTask is the task whose history is shown, or 0 for none.
+	historyTask int
+	// selections counts HandleSelectTask calls, so a reload can tell
+	// whether the UI already loaded the history.
+	selections int
+
+	// notices are shown once the UI starts.
+	notices []string
+
+	// listeners are told about changes the user makes, and hooks check
+	// them before they are saved.
+	listeners []Listener
+	hooks     Hooks
+	// commands are the custom commands offered in the command palette.
+	commands Commands
+
+	// now tells the time. Tests replace it.
+	now func() time.Time
 }
 
 type Store interface {
-	GetTasks() ([]models.Task, error)
-	AddTask(description string) (int64, error)
-	ToggleTaskStatus(id int) error
-	DeleteTask(id int) error
+	GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error)
+	AddTask(ctx context.Context, description string) (int64, error)
+	CreateTask(ctx context.Context, task models.Task) (int64, error)
+	ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error
+	DeleteTask(ctx context.Context, id int, expectedVersion int) error
+	RenameTask(ctx context.Context, id int, expectedVersion int, description string) error
+	SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error
+	UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error
+	SetTasksDone(ctx context.Context, versions map[int]int, done bool) error
+	ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error)
+	GetArchivedTasks(ctx context.Context) ([]models.Task, error)
+	GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error)
+	DeleteTasks(ctx context.Context, versions map[int]int) error
+	MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error
+	DataVersion(ctx context.Context) (int64, error)
 	Close()
 }
 
@@ -30,15 +93,29 @@ type UI interface {
 	FocusList()
 	FocusInput()
 	GetSelectedTaskID() (int, bool)
-	GetSelectedTaskText() (string, bool)
+	GetMarkedTaskIDs() []int
+	ClearMarks()
 	GetItemCount() int
 	ShowError(message string)
 	ShowConfirmation(message string, onConfirm func())
+	ShowInfo(message string)
+	ShowArchive(tasks []models.Task)
+	ShowTaskHistory(task models.Task, events []models.TaskEvent)
+	ShowMenu(title string, options []string, current int, onSelect func(index int))
+	PromptInput(title, initial string, onSubmit func(text string))
+	SetView(query models.TaskQuery)
+	ShowBusy(message string)
+	HideBusy()
+	QueueUpdate(f func())
 }
 
 func NewAppController(store Store) *AppController {
 	return &AppController{
-		store: store,
+		store:   timedStore{store},
+		spawn:   func(f func()) { go f() },
+		pending: make(map[int]context.CancelFunc),
+		config:  &config.Config{},
+		now:     time.Now,
 	}
 }
 
@@ -46,27 +123,154 @@ func (c *AppController) SetUI(ui UI) {
 	c.ui = ui
 }
 
+// Notify queues a message to show when the UI starts, for things that
+// happened before it, such as conflicts resolved by a sync.
+func (c *AppController) Notify(message string) {
+	c.notices = append(c.notices, message)
+}
+
 func (c *AppController) Start() error {
 	if c.ui == nil {
 		return fmt.Errorf("UI not initialised for controller")
 	}
 	log.Println("Loading and displaying tasks...")
+	c.ui.SetView(c.query())
 	c.loadAndDisplayTasks()
+	if len(c.notices) > 0 {
+		c.ui.ShowInfo(strings.Join(c.notices, "\n\n"))
+		c.notices = nil
+	}
+
+	if version, err := c.store.DataVersion(context.Background()); err == nil {
+		c.polledVersion = version
+	} else {
+		log.Printf("Error reading data version: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.watchExternalChanges(stop)
+
 	log.Println("Starting UI...")
 	return c.ui.Run()
 }
 
-func (c *AppController) loadAndDisplayTasks() error {
-	log.Println("Getting tasks from store...")
-	tasks, err := c.store.GetTasks()
+// watchExternalChanges polls the store until stop is closed and reloads the
+// list whenever another process has modified the database.
+func (c *AppController) watchExternalChanges(stop <-chan struct{}) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.checkExternalChanges()
+		}
+	}
+}
+
+// checkExternalChanges compares the store's data version with the last one
+// polled and, if it moved, queues a reload on the UI goroutine. The reload is
+// skipped if the list was already loaded at that version, as it is after the
+// user's own changes.
+func (c *AppController) checkExternalChanges() {
+	version, err := c.store.DataVersion(context.Background())
 	if err != nil {
-		log.Printf("Error loading tasks: %v", err)
-		c.ui.ShowError(fmt.Sprintf("Failed to load tasks: %v", err))
+		log.Printf("Error polling data version: %v", err)
+		return
+	}
+	if version == c.polledVersion {
+		return
+	}
+	c.polledVersion = version
+	c.ui.QueueUpdate(func() {
+		if version == c.dataVersion {
+			return
+		}
+		log.Printf("Data version changed (%d -> %d), reloading tasks...", c.dataVersion, version)
+		c.loadAndDisplayTasks()
+	})
+}
+
+func (c *AppController) loadAndDisplayTasks() {
+	c.loadAndDisplayTasksThen(nil)
+}
+
+// loadAndDisplayTasksThen reloads the list and, once it is displayed, calls
+// after (if non-nil) on the UI goroutine.
+func (c *AppController) loadAndDisplayTasksThen(after func()) {
+	log.Println("Getting tasks from store...")
+	var tasks []models.Task
+	var version int64
+	query := c.query()
+	c.runAsync("Loading tasks", func(ctx context.Context) error {
+		// Read the version first: a change made while loading then shows
+		// up as a newer version and triggers another reload.
+		var err error
+		if version, err = c.store.DataVersion(ctx); err != nil {
+			log.Printf("Error reading data version: %v", err)
+		}
+		tasks, err = c.store.GetTasks(ctx, query)
 		return err
+	}, func(err error) {
+		if err != nil {
+			log.Printf("Error loading tasks: %v", err)
+			if !errors.Is(err, context.Canceled) {
+				c.ui.ShowError(fmt.Sprintf("Failed to load tasks: %v", err))
+			}
+			return
+		}
+		log.Printf("Retrieved %d tasks, refreshing UI list...", len(tasks))
+		c.tasks = tasks
+		c.dataVersion = version
+		selections := c.selections
+		c.ui.RefreshList(tasks)
+		c.refreshHistory(selections)
+		if after != nil {
+			after()
+		}
+	})
+}
+
+// taskVersion returns the version of the task as last loaded, or 0 (meaning
+// "don't check") if the task is not in the loaded list.
+func (c *AppController) taskVersion(id int) int {
+	task, _ := c.loadedTask(id)
+	return task.Version
+}
+
+// handleStoreError tells the user about a failed store call, choosing the
+// message and recovery from the kind of storage error. fallback is shown for
+// errors that need no special treatment.
+func (c *AppController) handleStoreError(err error, fallback string) {
+	var taskErr *storage.TaskError
+	var rejected *models.RejectedError
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The user cancelled the operation; nothing to report.
+	case errors.As(err, &rejected):
+		c.ui.ShowError(rejected.Message)
+	case errors.Is(err, context.DeadlineExceeded):
+		c.ui.ShowError("The task database took too long to respond, please try again")
+	case errors.Is(err, storage.ErrConflict):
+		c.ui.ShowConfirmation("Task was modified elsewhere, reload?", func() {
+			c.loadAndDisplayTasks()
+		})
+	case errors.Is(err, storage.ErrNotFound):
+		message := "Task no longer exists, it may have been deleted elsewhere"
+		if errors.As(err, &taskErr) {
+			message = fmt.Sprintf("Task ID %d no longer exists, it may have been deleted elsewhere", taskErr.ID)
+		}
+		c.ui.ShowError(message)
+		c.loadAndDisplayTasks()
+	case errors.Is(err, storage.ErrInvalidInput):
+		c.ui.ShowError(fallback)
+		c.ui.FocusInput()
+	case errors.Is(err, storage.ErrStorageUnavailable):
+		c.ui.ShowError("The task database is busy or unavailable, please try again")
+	default:
+		c.ui.ShowError(fallback)
 	}
-	log.Printf("Retrieved %d tasks, refreshing UI list...", len(tasks))
-	c.ui.RefreshList(tasks)
-	return nil
 }
 
 func (c *AppController) HandleAddTask() {
@@ -76,35 +280,71 @@ func (c *AppController) HandleAddTask() {
 		return
 	}
 
-	_, err := c.store.AddTask(description)
-	if err != nil {
-		log.Printf("Error adding tasks: %v", err)
-		c.ui.ShowError(fmt.Sprintf("Failed to add task: %v", err))
-		return
-	}
+	c.runAsync("Adding task", func(ctx context.Context) error {
+		task, err := c.beforeAdd(ctx, models.Task{Description: description})
+		if err != nil {
+			return err
+		}
+		var id int64
+		if task.Due == "" && !task.Done {
+			id, err = c.store.AddTask(ctx, task.Description)
+		} else {
+			// The hook also set a due date or completed the task.
+			id, err = c.store.CreateTask(ctx, task)
+		}
+		if err != nil {
+			return err
+		}
+		c.announceStored(ctx, []int{int(id)}, always(models.EventCreated))
+		return nil
+	}, func(err error) {
+		if err != nil {
+			log.Printf("Error adding tasks: %v", err)
+			c.handleStoreError(err, fmt.Sprintf("Failed to add task: %v", err))
+			return
+		}
 
-	c.ui.ClearInput()
-	c.loadAndDisplayTasks()
-	c.ui.FocusList()
+		c.ui.ClearInput()
+		c.loadAndDisplayTasks()
+		c.ui.FocusList()
+	})
 }
 
 func (c *AppController) HandleToggleTask() {
+	if marked := c.ui.GetMarkedTaskIDs(); len(marked) > 0 {
+		c.toggleMarked(marked)
+		return
+	}
+
 	taskID, selected := c.ui.GetSelectedTaskID()
 	if !selected {
 		log.Println("Toggle attempted on invalid or no selection.")
 		return
 	}
 
-	err := c.store.ToggleTaskStatus(taskID)
-	if err != nil {
-		log.Printf("Error toggling task %d: %v", taskID, err)
-		c.ui.ShowError(fmt.Sprintf("Failed to toggle task ID %d: %v", taskID, err))
-		return
-	}
-	c.loadAndDisplayTasks()
+	version := c.taskVersion(taskID)
+	c.runAsync("Updating task", func(ctx context.Context) error {
+		if err := c.store.ToggleTaskStatus(ctx, taskID, version); err != nil {
+			return err
+		}
+		c.announceStored(ctx, []int{taskID}, statusEvent)
+		return nil
+	}, func(err error) {
+		if err != nil {
+			log.Printf("Error toggling task %d: %v", taskID, err)
+			c.handleStoreError(err, fmt.Sprintf("Failed to toggle task ID %d: %v", taskID, err))
+			return
+		}
+		c.loadAndDisplayTasks()
+	})
 }
 
 func (c *AppController) HandleDeleteTask() {
+	if marked := c.ui.GetMarkedTaskIDs(); len(marked) > 0 {
+		c.deleteMarked(marked)
+		return
+	}
+
 	taskID, selected := c.ui.GetSelectedTaskID()
 	if !selected {
 		log.Println("Delete attempted on invalid or no selection.")
@@ -114,27 +354,45 @@ func (c *AppController) HandleDeleteTask() {
 	confirmMsg := fmt.Sprintf("Are you sure you want to delete task ID %d?", taskID)
 
 	c.ui.ShowConfirmation(confirmMsg, func() {
-		err := c.store.DeleteTask(taskID)
-		if err != nil {
-			log.Printf("Error deleting task %d: %v", taskID, err)
-			c.ui.ShowError(fmt.Sprintf("Failed to delete task ID %d: %v", taskID, err))
-			return
-		}
-		c.loadAndDisplayTasks()
-		if c.ui.GetItemCount() == 0 {
-			c.ui.FocusInput()
-		}
+		version := c.taskVersion(taskID)
+		deleted := c.loadedTasks([]int{taskID})
+		c.runAsync("Deleting task", func(ctx context.Context) error {
+			if err := c.store.DeleteTask(ctx, taskID, version); err != nil {
+				return err
+			}
+			for _, task := range deleted {
+				c.announce(ctx, models.EventDeleted, task)
+			}
+			return nil
+		}, func(err error) {
+			if err != nil {
+				log.Printf("Error deleting task %d: %v", taskID, err)
+				c.handleStoreError(err, fmt.Sprintf("Failed to delete task ID %d: %v", taskID, err))
+				return
+			}
+			c.loadAndDisplayTasksThen(func() {
+				if c.ui.GetItemCount() == 0 {
+					c.ui.FocusInput()
+				}
+			})
+		})
 	})
 }
 
 func (c *AppController) HandleCopyText() {
-	text, selected := c.ui.GetSelectedTaskText()
+	// Copy the description as loaded: the row text carries markers and
+	// extras such as the due date.
+	taskID, selected := c.ui.GetSelectedTaskID()
 	if !selected {
 		log.Println("Copy attempted on invalid or no selection.")
 		return
 	}
-	description := strings.SplitAfter(text, "] ")[1]
-	err := copyToClipboard(description)
+	task, ok := c.loadedTask(taskID)
+	if !ok {
+		log.Printf("Copy attempted on task %d, which is not loaded.", taskID)
+		return
+	}
+	err := copyToClipboard(task.Description)
 	if err != nil {
 		log.Printf("Error copying to clipboard: %v", err)
 		return
@@ -142,5 +400,6 @@ func (c *AppController) HandleCopyText() {
 }
 
 func (c *AppController) HandleQuit() {
+	c.HandleCancel()
 	c.ui.Stop()
 }
@@ -1,13 +1,19 @@
 package controller
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"go-todo/internal/config"
 	"go-todo/internal/models"
+	"go-todo/internal/storage"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestMain disables logging for all tests
@@ -27,6 +33,16 @@ type MockStore struct {
 	ToggleTaskStatusCalls int
 	DeleteTaskCalls       int
 	GetTasksCalls         int
+	DataVersionCalls      int
+	SetTasksDoneCalls     int
+	DeleteTasksCalls      int
+	MoveTasksCalls        int
+	SetTaskDueCalls       int
+	CreateTaskCalls       int
+	UpdateTaskCalls       int
+	ArchiveCalls          int
+	RenameTaskCalls       int
+	GetTaskHistoryCalls   int
 	CloseCalls            int
 
 	// Control behavior
@@ -34,18 +50,39 @@ type MockStore struct {
 	AddTaskError    error
 	ToggleTaskError error
 	DeleteTaskError error
+	DataVersionErr  error
+	BulkError       error
 	TasksToReturn   []models.Task
+	ArchivedTasks   []models.Task
+	History         []models.TaskEvent
+	Version         int64
+
+	// Recorded arguments
+	LastExpectedVersion int
+	LastCtx             context.Context
+	LastVersions        map[int]int
+	LastDone            bool
+	LastMoved           []int
+	LastPrevID          int
+	LastNextID          int
+	LastQuery           models.TaskQuery
+	LastDue             string
+	LastCutoff          time.Time
+	LastDescription     string
+	LastTask            models.Task
+	LastHistoryID       int
 }
 
-func (ms *MockStore) GetTasks() ([]models.Task, error) {
+func (ms *MockStore) GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
 	ms.GetTasksCalls++
+	ms.LastQuery = query
 	if ms.GetTasksError != nil {
 		return nil, ms.GetTasksError
 	}
 	return ms.TasksToReturn, nil
 }
 
-func (ms *MockStore) AddTask(description string) (int64, error) {
+func (ms *MockStore) AddTask(ctx context.Context, description string) (int64, error) {
 	ms.AddTaskCalls++
 	if ms.AddTaskError != nil {
 		return 0, ms.AddTaskError
@@ -53,37 +90,125 @@ func (ms *MockStore) AddTask(description string) (int64, error) {
 	return ms.AddTaskCalls, nil
 }
 
-func (ms *MockStore) ToggleTaskStatus(id int) error {
+func (ms *MockStore) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	ms.CreateTaskCalls++
+	ms.LastTask = task
+	if ms.AddTaskError != nil {
+		return 0, ms.AddTaskError
+	}
+	return ms.AddTaskCalls + int64(ms.CreateTaskCalls), nil
+}
+
+func (ms *MockStore) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
 	ms.ToggleTaskStatusCalls++
+	ms.LastExpectedVersion = expectedVersion
+	ms.LastCtx = ctx
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return ms.ToggleTaskError
 }
 
-func (ms *MockStore) DeleteTask(id int) error {
+func (ms *MockStore) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
 	ms.DeleteTaskCalls++
+	ms.LastExpectedVersion = expectedVersion
 	return ms.DeleteTaskError
 }
 
+func (ms *MockStore) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	ms.RenameTaskCalls++
+	ms.LastExpectedVersion = expectedVersion
+	ms.LastDescription = description
+	return ms.ToggleTaskError
+}
+
+func (ms *MockStore) GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error) {
+	ms.GetTaskHistoryCalls++
+	ms.LastHistoryID = id
+	return ms.History, nil
+}
+
+func (ms *MockStore) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	ms.SetTaskDueCalls++
+	ms.LastExpectedVersion = expectedVersion
+	ms.LastDue = due
+	return ms.ToggleTaskError
+}
+
+func (ms *MockStore) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	ms.UpdateTaskCalls++
+	ms.LastExpectedVersion = expectedVersion
+	ms.LastTask = edit
+	return ms.ToggleTaskError
+}
+
+func (ms *MockStore) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	ms.ArchiveCalls++
+	ms.LastCutoff = cutoff
+	return len(ms.ArchivedTasks), ms.BulkError
+}
+
+func (ms *MockStore) GetArchivedTasks(ctx context.Context) ([]models.Task, error) {
+	return ms.ArchivedTasks, ms.GetTasksError
+}
+
+func (ms *MockStore) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	ms.SetTasksDoneCalls++
+	ms.LastVersions = versions
+	ms.LastDone = done
+	return ms.BulkError
+}
+
+func (ms *MockStore) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	ms.DeleteTasksCalls++
+	ms.LastVersions = versions
+	return ms.BulkError
+}
+
+func (ms *MockStore) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	ms.MoveTasksCalls++
+	ms.LastMoved = ids
+	ms.LastVersions = versions
+	ms.LastPrevID = prevID
+	ms.LastNextID = nextID
+	return ms.BulkError
+}
+
+func (ms *MockStore) DataVersion(ctx context.Context) (int64, error) {
+	ms.DataVersionCalls++
+	return ms.Version, ms.DataVersionErr
+}
+
 func (ms *MockStore) Close() {
 	ms.CloseCalls++
 }
 
 type MockUI struct {
-	GetInputTextCalls        int
-	ClearInputCalls          int
-	FocusListCalls           int
-	FocusInputCalls          int
-	GetSelectedTaskIDCalls   int
-	GetSelectedTaskTextCalls int
-	GetItemCountCalls        int
-	ShowErrorCalls           int
-	ShowConfirmationCalls    int
-	RefreshListCalls         int
-	StopCalls                int
-	RunCalls                 int
+	// OnRefresh, if set, runs at the end of RefreshList, as the real UI
+	// reports a changed selection.
+	OnRefresh func()
+
+	GetInputTextCalls      int
+	ClearInputCalls        int
+	FocusListCalls         int
+	FocusInputCalls        int
+	GetSelectedTaskIDCalls int
+	GetItemCountCalls      int
+	ShowErrorCalls         int
+	ShowConfirmationCalls  int
+	RefreshListCalls       int
+	StopCalls              int
+	RunCalls               int
+	QueueUpdateCalls       int
+	ShowBusyCalls          int
+	HideBusyCalls          int
+	ClearMarksCalls        int
+	ShowMenuCalls          int
+	PromptInputCalls       int
+	ShowInfoCalls          int
 
 	// Control behavior
 	SelectedTaskID       int
-	SelectedTaskText     string
 	TaskSelected         bool
 	ItemCount            int
 	ShowErrorMsg         string
@@ -92,6 +217,19 @@ type MockUI struct {
 	RunError             error
 	ConfirmationCallback func()
 	TasksReceived        []models.Task
+	MarkedTaskIDs        []int
+	MenuTitle            string
+	MenuOptions          []string
+	MenuCurrent          int
+	MenuCallback         func(index int)
+	PromptInitial        string
+	PromptCallback       func(text string)
+	View                 models.TaskQuery
+	ShowInfoMsg          string
+	ArchiveShown         []models.Task
+	HistoryTask          models.Task
+	HistoryShown         []models.TaskEvent
+	ShowTaskHistoryCalls int
 }
 
 func (mu *MockUI) Run() error {
@@ -106,6 +244,9 @@ func (mu *MockUI) Stop() {
 func (mu *MockUI) RefreshList(tasks []models.Task) {
 	mu.RefreshListCalls++
 	mu.TasksReceived = tasks
+	if mu.OnRefresh != nil {
+		mu.OnRefresh()
+	}
 }
 
 func (mu *MockUI) GetInputText() string {
@@ -130,9 +271,13 @@ func (mu *MockUI) GetSelectedTaskID() (int, bool) {
 	return mu.SelectedTaskID, mu.TaskSelected
 }
 
-func (mu *MockUI) GetSelectedTaskText() (string, bool) {
-	mu.GetSelectedTaskTextCalls++
-	return mu.SelectedTaskText, mu.TaskSelected
+func (mu *MockUI) GetMarkedTaskIDs() []int {
+	return mu.MarkedTaskIDs
+}
+
+func (mu *MockUI) ClearMarks() {
+	mu.ClearMarksCalls++
+	mu.MarkedTaskIDs = nil
 }
 
 func (mu *MockUI) GetItemCount() int {
@@ -151,6 +296,52 @@ func (mu *MockUI) ShowConfirmation(message string, onConfirm func()) {
 	mu.ConfirmationCallback = onConfirm
 }
 
+func (mu *MockUI) ShowMenu(title string, options []string, current int, onSelect func(index int)) {
+	mu.ShowMenuCalls++
+	mu.MenuTitle = title
+	mu.MenuOptions = options
+	mu.MenuCurrent = current
+	mu.MenuCallback = onSelect
+}
+
+func (mu *MockUI) PromptInput(title, initial string, onSubmit func(text string)) {
+	mu.PromptInputCalls++
+	mu.PromptInitial = initial
+	mu.PromptCallback = onSubmit
+}
+
+func (mu *MockUI) SetView(query models.TaskQuery) {
+	mu.View = query
+}
+
+func (mu *MockUI) ShowInfo(message string) {
+	mu.ShowInfoCalls++
+	mu.ShowInfoMsg = message
+}
+
+func (mu *MockUI) ShowArchive(tasks []models.Task) {
+	mu.ArchiveShown = tasks
+}
+
+func (mu *MockUI) ShowTaskHistory(task models.Task, events []models.TaskEvent) {
+	mu.ShowTaskHistoryCalls++
+	mu.HistoryTask = task
+	mu.HistoryShown = events
+}
+
+func (mu *MockUI) ShowBusy(message string) {
+	mu.ShowBusyCalls++
+}
+
+func (mu *MockUI) HideBusy() {
+	mu.HideBusyCalls++
+}
+
+func (mu *MockUI) QueueUpdate(f func()) {
+	mu.QueueUpdateCalls++
+	f()
+}
+
 func setupTest(inputText string, selectedTaskID int, taskSelected bool) (*MockStore, *MockUI, *AppController) {
 	mockStore := &MockStore{}
 	mockUI := &MockUI{
@@ -161,6 +352,8 @@ func setupTest(inputText string, selectedTaskID int, taskSelected bool) (*MockSt
 	}
 	controller := NewAppController(mockStore)
 	controller.SetUI(mockUI)
+	// Run store calls synchronously so tests can assert on their effects.
+	controller.spawn = func(f func()) { f() }
 	return mockStore, mockUI, controller
 }
 
@@ -169,7 +362,7 @@ func TestNewAppController(t *testing.T) {
 	mockStore := &MockStore{}
 	controller := NewAppController(mockStore)
 
-	if controller.store != mockStore {
+	if controller.store != Store(timedStore{mockStore}) {
 		t.Error("Controller store not set correctly")
 	}
 
@@ -207,6 +400,18 @@ func TestStart_NoUI(t *testing.T) {
 	}
 }
 
+func TestStart_ShowsNotices(t *testing.T) {
+	_, mockUI, controller := setupTest("", 0, false)
+	controller.Notify("first")
+	controller.Notify("second")
+
+	controller.Start()
+
+	if mockUI.ShowInfoMsg != "first\n\nsecond" {
+		t.Errorf("Expected the notices shown on start, got %q", mockUI.ShowInfoMsg)
+	}
+}
+
 func TestStart_Success(t *testing.T) {
 	mockStore, mockUI, controller := setupTest("", 0, false)
 	mockStore.TasksToReturn = []models.Task{
@@ -431,6 +636,132 @@ func TestHandleToggleTask_StoreError(t *testing.T) {
 	}
 }
 
+func TestHandleToggleTask_PassesLoadedVersion(t *testing.T) {
+	mockStore, _, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{
+		{ID: 1, Description: "Test task", Done: false, Version: 7},
+	}
+	controller.loadAndDisplayTasks()
+
+	controller.HandleToggleTask()
+
+	if mockStore.LastExpectedVersion != 7 {
+		t.Errorf("Expected toggle to check version 7, got=%d", mockStore.LastExpectedVersion)
+	}
+}
+
+func TestHandleToggleTask_Conflict(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.ToggleTaskError = &storage.TaskError{Op: "toggle", ID: 1, Err: storage.ErrConflict}
+
+	controller.HandleToggleTask()
+
+	if mockUI.ShowErrorCalls != 0 {
+		t.Errorf("ShowError should not be called on conflict, got=%d", mockUI.ShowErrorCalls)
+	}
+
+	if mockUI.ShowConfirmationCalls != 1 {
+		t.Fatalf("ShowConfirmation should be called once on conflict, got=%d", mockUI.ShowConfirmationCalls)
+	}
+
+	if mockUI.ShowConfirmationMsg != "Task was modified elsewhere, reload?" {
+		t.Errorf("Expected reload prompt, got='%s'", mockUI.ShowConfirmationMsg)
+	}
+
+	// Simulate user accepting the reload
+	mockUI.ConfirmationCallback()
+
+	if mockStore.GetTasksCalls != 1 {
+		t.Errorf("GetTasks should be called after accepting reload, got=%d", mockStore.GetTasksCalls)
+	}
+}
+
+func TestHandleToggleTask_StoreErrorKinds(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectedMsg     string
+		expectReload    bool
+		expectFocusIn   bool
+		expectConfirmed bool
+	}{
+		{
+			name:         "not found",
+			err:          &storage.TaskError{Op: "toggle", ID: 1, Err: storage.ErrNotFound},
+			expectedMsg:  "Task ID 1 no longer exists, it may have been deleted elsewhere",
+			expectReload: true,
+		},
+		{
+			name:            "conflict",
+			err:             &storage.TaskError{Op: "toggle", ID: 1, Err: storage.ErrConflict},
+			expectConfirmed: true,
+		},
+		{
+			name:          "invalid input",
+			err:           fmt.Errorf("%w: bad", storage.ErrInvalidInput),
+			expectedMsg:   "Failed to toggle task ID 1: invalid input: bad",
+			expectFocusIn: true,
+		},
+		{
+			name:        "storage unavailable",
+			err:         fmt.Errorf("%w: database is locked", storage.ErrStorageUnavailable),
+			expectedMsg: "The task database is busy or unavailable, please try again",
+		},
+		{
+			name:        "unknown",
+			err:         errors.New("boom"),
+			expectedMsg: "Failed to toggle task ID 1: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore, mockUI, controller := setupTest("", 1, true)
+			mockStore.ToggleTaskError = tt.err
+
+			controller.HandleToggleTask()
+
+			if mockUI.ShowErrorMsg != tt.expectedMsg {
+				t.Errorf("Expected error message '%s', got '%s'", tt.expectedMsg, mockUI.ShowErrorMsg)
+			}
+
+			reloaded := mockStore.GetTasksCalls > 0
+			if reloaded != tt.expectReload {
+				t.Errorf("Expected reload=%v, got GetTasks calls=%d", tt.expectReload, mockStore.GetTasksCalls)
+			}
+
+			focusedInput := mockUI.FocusInputCalls > 0
+			if focusedInput != tt.expectFocusIn {
+				t.Errorf("Expected input focus=%v, got FocusInput calls=%d", tt.expectFocusIn, mockUI.FocusInputCalls)
+			}
+
+			confirmed := mockUI.ShowConfirmationCalls > 0
+			if confirmed != tt.expectConfirmed {
+				t.Errorf("Expected reload prompt=%v, got ShowConfirmation calls=%d", tt.expectConfirmed, mockUI.ShowConfirmationCalls)
+			}
+		})
+	}
+}
+
+func TestHandleAddTask_InvalidInputKeepsText(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("   ", 1, true)
+	mockStore.AddTaskError = fmt.Errorf("%w: task description cannot be empty", storage.ErrInvalidInput)
+
+	controller.HandleAddTask()
+
+	if mockUI.ClearInputCalls != 0 {
+		t.Errorf("ClearInput should not be called on invalid input, got=%d", mockUI.ClearInputCalls)
+	}
+
+	if mockUI.FocusInputCalls != 1 {
+		t.Errorf("FocusInput should be called so the user can fix the input, got=%d", mockUI.FocusInputCalls)
+	}
+
+	if !strings.Contains(mockUI.ShowErrorMsg, "task description cannot be empty") {
+		t.Errorf("Expected invalid input message, got='%s'", mockUI.ShowErrorMsg)
+	}
+}
+
 // Test HandleDeleteTask
 func TestHandleDeleteTask_NoSelection(t *testing.T) {
 	mockStore, mockUI, controller := setupTest("", 0, false)
@@ -543,7 +874,353 @@ func TestHandleDeleteTask_StoreError(t *testing.T) {
 	}
 }
 
+func TestHandleDeleteTask_Conflict(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.DeleteTaskError = &storage.TaskError{Op: "delete", ID: 1, Err: storage.ErrConflict}
+
+	controller.HandleDeleteTask()
+
+	// Simulate user confirming deletion
+	mockUI.ConfirmationCallback()
+
+	if mockUI.ShowErrorCalls != 0 {
+		t.Errorf("ShowError should not be called on conflict, got=%d", mockUI.ShowErrorCalls)
+	}
+
+	if mockUI.ShowConfirmationCalls != 2 {
+		t.Errorf("A reload prompt should follow the delete confirmation, got=%d confirmations", mockUI.ShowConfirmationCalls)
+	}
+
+	if mockUI.ShowConfirmationMsg != "Task was modified elsewhere, reload?" {
+		t.Errorf("Expected reload prompt, got='%s'", mockUI.ShowConfirmationMsg)
+	}
+}
+
+// Test bulk operations on marked tasks
+func TestHandleToggleTask_Marked(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{
+		{ID: 1, Description: "Open", Done: false, Version: 3},
+		{ID: 2, Description: "Done", Done: true, Version: 5},
+	}
+	controller.loadAndDisplayTasks()
+	mockUI.MarkedTaskIDs = []int{1, 2}
+
+	controller.HandleToggleTask()
+
+	if mockStore.ToggleTaskStatusCalls != 0 {
+		t.Errorf("Single toggle should not be used with marked tasks, got=%d", mockStore.ToggleTaskStatusCalls)
+	}
+
+	if mockUI.ShowConfirmationMsg != "Mark 2 tasks as done?" {
+		t.Errorf("Expected one confirmation for all marked tasks, got='%s'", mockUI.ShowConfirmationMsg)
+	}
+
+	mockUI.ConfirmationCallback()
+
+	if mockStore.SetTasksDoneCalls != 1 {
+		t.Fatalf("SetTasksDone should be called once, got=%d", mockStore.SetTasksDoneCalls)
+	}
+
+	if !mockStore.LastDone {
+		t.Error("A mixed selection should be marked done")
+	}
+
+	if mockStore.LastVersions[1] != 3 || mockStore.LastVersions[2] != 5 {
+		t.Errorf("Expected loaded versions to be checked, got %v", mockStore.LastVersions)
+	}
+
+	if mockUI.ClearMarksCalls != 1 {
+		t.Errorf("Marks should be cleared after a successful bulk update, got=%d", mockUI.ClearMarksCalls)
+	}
+}
+
+func TestHandleToggleTask_MarkedAllDoneReopens(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{
+		{ID: 1, Description: "Done", Done: true, Version: 2},
+	}
+	controller.loadAndDisplayTasks()
+	mockUI.MarkedTaskIDs = []int{1}
+
+	controller.HandleToggleTask()
+
+	if mockUI.ShowConfirmationMsg != "Reopen 1 task?" {
+		t.Errorf("Expected reopen confirmation, got='%s'", mockUI.ShowConfirmationMsg)
+	}
+
+	mockUI.ConfirmationCallback()
+
+	if mockStore.LastDone {
+		t.Error("An all-done selection should be reopened")
+	}
+}
+
+func TestHandleDeleteTask_Marked(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockUI.MarkedTaskIDs = []int{4, 5, 6}
+
+	controller.HandleDeleteTask()
+
+	if mockUI.ShowConfirmationCalls != 1 {
+		t.Errorf("Expected a single confirmation, got=%d", mockUI.ShowConfirmationCalls)
+	}
+
+	if mockUI.ShowConfirmationMsg != "Are you sure you want to delete 3 tasks?" {
+		t.Errorf("Expected count in confirmation, got='%s'", mockUI.ShowConfirmationMsg)
+	}
+
+	mockUI.ConfirmationCallback()
+
+	if mockStore.DeleteTasksCalls != 1 || mockStore.DeleteTaskCalls != 0 {
+		t.Errorf("Expected one bulk delete, got bulk=%d single=%d", mockStore.DeleteTasksCalls, mockStore.DeleteTaskCalls)
+	}
+
+	if len(mockStore.LastVersions) != 3 {
+		t.Errorf("Expected all marked tasks to be deleted, got %v", mockStore.LastVersions)
+	}
+}
+
+func TestHandleDeleteTask_MarkedStoreError(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.BulkError = errors.New("bulk error")
+	mockUI.MarkedTaskIDs = []int{4, 5}
+
+	controller.HandleDeleteTask()
+	mockUI.ConfirmationCallback()
+
+	if mockUI.ShowErrorMsg != "Failed to delete 2 tasks: bulk error" {
+		t.Errorf("Expected bulk delete error, got='%s'", mockUI.ShowErrorMsg)
+	}
+
+	if mockUI.ClearMarksCalls != 0 {
+		t.Errorf("Marks should be kept when the bulk delete fails, got=%d", mockUI.ClearMarksCalls)
+	}
+}
+
+// Test moving tasks
+func setupMoveTest(selectedTaskID int) (*MockStore, *MockUI, *AppController) {
+	mockStore, mockUI, controller := setupTest("", selectedTaskID, true)
+	mockStore.TasksToReturn = []models.Task{
+		{ID: 1, Description: "a", Version: 1},
+		{ID: 2, Description: "b", Version: 1},
+		{ID: 3, Description: "c", Version: 4},
+		{ID: 4, Description: "d", Version: 1},
+		{ID: 5, Description: "done", Done: true, Version: 1},
+	}
+	controller.loadAndDisplayTasks()
+	return mockStore, mockUI, controller
+}
+
+func TestHandleMove_Neighbours(t *testing.T) {
+	tests := []struct {
+		name           string
+		selected       int
+		marked         []int
+		down           bool
+		expectMove     bool
+		expectedPrevID int
+		expectedNextID int
+	}{
+		{name: "down in the middle", selected: 2, down: true, expectMove: true, expectedPrevID: 3, expectedNextID: 4},
+		{name: "down to the end of the group", selected: 3, down: true, expectMove: true, expectedPrevID: 4, expectedNextID: 0},
+		{name: "up to the top", selected: 2, down: false, expectMove: true, expectedPrevID: 0, expectedNextID: 1},
+		{name: "up in the middle", selected: 4, down: false, expectMove: true, expectedPrevID: 2, expectedNextID: 3},
+		{name: "already at the top", selected: 1, down: false, expectMove: false},
+		{name: "never below the open group", selected: 4, down: true, expectMove: false},
+		{name: "marked block down", selected: 1, marked: []int{1, 2}, down: true, expectMove: true, expectedPrevID: 3, expectedNextID: 4},
+		{name: "marked block with gap up", selected: 1, marked: []int{2, 4}, down: false, expectMove: true, expectedPrevID: 0, expectedNextID: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore, mockUI, controller := setupMoveTest(tt.selected)
+			mockUI.MarkedTaskIDs = tt.marked
+
+			if tt.down {
+				controller.HandleMoveDown()
+			} else {
+				controller.HandleMoveUp()
+			}
+
+			if !tt.expectMove {
+				if mockStore.MoveTasksCalls != 0 {
+					t.Errorf("MoveTasks should not be called, got=%d", mockStore.MoveTasksCalls)
+				}
+				return
+			}
+			if mockStore.MoveTasksCalls != 1 {
+				t.Fatalf("MoveTasks should be called once, got=%d", mockStore.MoveTasksCalls)
+			}
+			if mockStore.LastPrevID != tt.expectedPrevID || mockStore.LastNextID != tt.expectedNextID {
+				t.Errorf("Expected move between %d and %d, got %d and %d",
+					tt.expectedPrevID, tt.expectedNextID, mockStore.LastPrevID, mockStore.LastNextID)
+			}
+		})
+	}
+}
+
+func TestHandleMove_PassesVersionsAndReloads(t *testing.T) {
+	mockStore, _, controller := setupMoveTest(3)
+	mockStore.GetTasksCalls = 0
+
+	controller.HandleMoveUp()
+
+	if len(mockStore.LastMoved) != 1 || mockStore.LastMoved[0] != 3 || mockStore.LastVersions[3] != 4 {
+		t.Errorf("Expected task 3 at version 4 to be moved, got ids=%v versions=%v", mockStore.LastMoved, mockStore.LastVersions)
+	}
+
+	if mockStore.GetTasksCalls != 1 {
+		t.Errorf("Tasks should be reloaded after a move, got=%d", mockStore.GetTasksCalls)
+	}
+}
+
+func TestHandleMove_MixedGroups(t *testing.T) {
+	mockStore, mockUI, controller := setupMoveTest(1)
+	mockUI.MarkedTaskIDs = []int{4, 5}
+
+	controller.HandleMoveUp()
+
+	if mockStore.MoveTasksCalls != 0 {
+		t.Errorf("MoveTasks should not be called for mixed groups, got=%d", mockStore.MoveTasksCalls)
+	}
+
+	if mockUI.ShowErrorMsg != "Open and done tasks cannot be moved together" {
+		t.Errorf("Expected mixed group error, got='%s'", mockUI.ShowErrorMsg)
+	}
+}
+
+func TestHandleMoveTaskTo(t *testing.T) {
+	tests := []struct {
+		name           string
+		taskID         int
+		targetID       int
+		expectMove     bool
+		expectedPrevID int
+		expectedNextID int
+	}{
+		{name: "drag down", taskID: 1, targetID: 3, expectMove: true, expectedPrevID: 3, expectedNextID: 4},
+		{name: "drag up", taskID: 4, targetID: 2, expectMove: true, expectedPrevID: 1, expectedNextID: 2},
+		{name: "drop on itself", taskID: 2, targetID: 2, expectMove: false},
+		{name: "drop in another group", taskID: 2, targetID: 5, expectMove: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore, _, controller := setupMoveTest(1)
+
+			controller.HandleMoveTaskTo(tt.taskID, tt.targetID)
+
+			if !tt.expectMove {
+				if mockStore.MoveTasksCalls != 0 {
+					t.Errorf("MoveTasks should not be called, got=%d", mockStore.MoveTasksCalls)
+				}
+				return
+			}
+			if mockStore.LastPrevID != tt.expectedPrevID || mockStore.LastNextID != tt.expectedNextID {
+				t.Errorf("Expected move between %d and %d, got %d and %d",
+					tt.expectedPrevID, tt.expectedNextID, mockStore.LastPrevID, mockStore.LastNextID)
+			}
+		})
+	}
+}
+
+// Test asynchronous store calls
+func TestStoreCalls_ShowBusyIndicator(t *testing.T) {
+	_, mockUI, controller := setupTest("", 1, true)
+
+	controller.HandleToggleTask()
+
+	// One indicator for the toggle and one for the reload that follows
+	if mockUI.ShowBusyCalls != 2 {
+		t.Errorf("ShowBusy should be called for each store call, got=%d", mockUI.ShowBusyCalls)
+	}
+
+	if mockUI.HideBusyCalls != 2 {
+		t.Errorf("HideBusy should be called once each store call finishes, got=%d", mockUI.HideBusyCalls)
+	}
+
+	if len(controller.pending) != 0 {
+		t.Errorf("No operations should remain pending, got=%d", len(controller.pending))
+	}
+}
+
+func TestStoreCalls_OverlappingCallsHideBusy(t *testing.T) {
+	_, mockUI, controller := setupTest("", 1, true)
+	var background []func()
+	controller.spawn = func(f func()) { background = append(background, f) }
+
+	controller.loadAndDisplayTasks()
+	controller.loadAndDisplayTasks()
+	if len(background) != 2 {
+		t.Fatalf("Expected two overlapping operations, got=%d", len(background))
+	}
+	for len(background) > 0 {
+		f := background[0]
+		background = background[1:]
+		f()
+	}
+
+	if mockUI.ShowBusyCalls != mockUI.HideBusyCalls {
+		t.Errorf("Expected every ShowBusy to be matched by HideBusy, got %d and %d", mockUI.ShowBusyCalls, mockUI.HideBusyCalls)
+	}
+}
+
+func TestHandleCancel_CancelsPendingCall(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	var background func()
+	controller.spawn = func(f func()) { background = f }
+
+	controller.HandleToggleTask()
+
+	if len(controller.pending) != 1 {
+		t.Fatalf("Expected one pending operation, got=%d", len(controller.pending))
+	}
+
+	controller.HandleCancel()
+	background()
+
+	if mockStore.LastCtx == nil || !errors.Is(mockStore.LastCtx.Err(), context.Canceled) {
+		t.Error("Store call should receive a cancelled context")
+	}
+
+	if mockUI.ShowErrorCalls != 0 {
+		t.Errorf("Cancelling should not show an error, got='%s'", mockUI.ShowErrorMsg)
+	}
+
+	if mockStore.GetTasksCalls != 0 {
+		t.Errorf("Tasks should not be reloaded after a cancelled toggle, got=%d", mockStore.GetTasksCalls)
+	}
+
+	if len(controller.pending) != 0 {
+		t.Errorf("Cancelled operation should no longer be pending, got=%d", len(controller.pending))
+	}
+}
+
+func TestHandleToggleTask_Timeout(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.ToggleTaskError = context.DeadlineExceeded
+
+	controller.HandleToggleTask()
+
+	if mockUI.ShowErrorMsg != "The task database took too long to respond, please try again" {
+		t.Errorf("Expected timeout message, got='%s'", mockUI.ShowErrorMsg)
+	}
+}
+
 // Test HandleQuit
+func TestHandleCopyText_TaskNotLoaded(t *testing.T) {
+	_, mockUI, controller := setupTest("", 0, true)
+	mockUI.SelectedTaskID = 42
+
+	// Must not panic or reach for the row text when the task is unknown.
+	controller.HandleCopyText()
+
+	if mockUI.ShowErrorCalls != 0 {
+		t.Errorf("Expected no error to be shown, got=%d", mockUI.ShowErrorCalls)
+	}
+}
+
 func TestHandleQuit(t *testing.T) {
 	_, mockUI, controller := setupTest("", 0, false)
 
@@ -554,6 +1231,87 @@ func TestHandleQuit(t *testing.T) {
 	}
 }
 
+// Test external change detection
+func TestCheckExternalChanges_Unchanged(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.Version = 3
+	controller.polledVersion = 3
+
+	controller.checkExternalChanges()
+
+	if mockUI.QueueUpdateCalls != 0 {
+		t.Errorf("QueueUpdate should not be called when version is unchanged, got=%d", mockUI.QueueUpdateCalls)
+	}
+
+	if mockStore.GetTasksCalls != 0 {
+		t.Errorf("GetTasks should not be called when version is unchanged, got=%d", mockStore.GetTasksCalls)
+	}
+}
+
+func TestCheckExternalChanges_Changed(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.Version = 4
+	controller.polledVersion = 3
+	mockStore.TasksToReturn = []models.Task{
+		{ID: 1, Description: "Added elsewhere", Done: false},
+	}
+
+	controller.checkExternalChanges()
+
+	if mockUI.QueueUpdateCalls == 0 {
+		t.Error("Reload should be queued on the UI goroutine")
+	}
+
+	if mockUI.RefreshListCalls != 1 {
+		t.Errorf("RefreshList should be called to show external changes, got=%d", mockUI.RefreshListCalls)
+	}
+
+	if controller.dataVersion != 4 {
+		t.Errorf("Expected data version to be updated to 4, got=%d", controller.dataVersion)
+	}
+
+	// A second poll with no further changes should not reload again
+	controller.checkExternalChanges()
+
+	if mockStore.GetTasksCalls != 1 {
+		t.Errorf("GetTasks should only be called once, got=%d", mockStore.GetTasksCalls)
+	}
+}
+
+func TestCheckExternalChanges_AlreadyLoaded(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.Version = 3
+	controller.polledVersion = 3
+
+	// Our own change bumps the version and reloads the list at the new one.
+	mockStore.Version = 4
+	controller.loadAndDisplayTasks()
+	queued := mockUI.QueueUpdateCalls
+	controller.checkExternalChanges()
+
+	if mockUI.QueueUpdateCalls != queued+1 {
+		t.Errorf("Expected the changed version to be noticed, got=%d", mockUI.QueueUpdateCalls-queued)
+	}
+	if mockStore.GetTasksCalls != 1 {
+		t.Errorf("List loaded at the current version should not reload again, got=%d", mockStore.GetTasksCalls)
+	}
+}
+
+func TestCheckExternalChanges_Error(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.DataVersionErr = errors.New("poll error")
+
+	controller.checkExternalChanges()
+
+	if mockUI.QueueUpdateCalls != 0 {
+		t.Errorf("QueueUpdate should not be called on poll error, got=%d", mockUI.QueueUpdateCalls)
+	}
+
+	if mockUI.ShowErrorCalls != 0 {
+		t.Errorf("Poll errors should not be shown to the user, got=%d", mockUI.ShowErrorCalls)
+	}
+}
+
 // Test loadAndDisplayTasks (private method, tested through public methods)
 func TestLoadAndDisplayTasks_Success(t *testing.T) {
 	mockStore, mockUI, controller := setupTest("", 0, false)
@@ -633,3 +1391,380 @@ func TestAddTaskWorkflow_CompleteFlow(t *testing.T) {
 		t.Errorf("Expected 1 task in UI, got %d", len(mockUI.TasksReceived))
 	}
 }
+
+func TestHandleChooseSort(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	path := filepath.Join(t.TempDir(), "config.json")
+	controller.SetConfig(&config.Config{}, path)
+
+	controller.HandleChooseSort()
+
+	if mockUI.ShowMenuCalls != 1 || len(mockUI.MenuOptions) != len(models.SortModes) {
+		t.Fatalf("Expected a menu with every sort mode, got calls=%d options=%v", mockUI.ShowMenuCalls, mockUI.MenuOptions)
+	}
+	if mockUI.MenuCurrent != 0 {
+		t.Errorf("Expected manual sort to be preselected, got=%d", mockUI.MenuCurrent)
+	}
+
+	mockUI.MenuCallback(indexOfSort(models.SortDue))
+
+	if mockStore.LastQuery.Sort != models.SortDue || mockStore.LastQuery.Group != models.GroupStatus {
+		t.Errorf("Expected tasks reloaded sorted by due date, got query %+v", mockStore.LastQuery)
+	}
+	if mockUI.View.Sort != models.SortDue {
+		t.Errorf("Expected UI view to be updated, got %+v", mockUI.View)
+	}
+	saved, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Loading saved config failed: %v", err)
+	}
+	if saved.Sort != models.SortDue {
+		t.Errorf("Expected sort mode to be saved, got %+v", saved)
+	}
+}
+
+func TestHandleChooseGroup(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+
+	controller.HandleChooseGroup()
+	for i, mode := range models.GroupModes {
+		if mode == models.GroupCreatedDay {
+			mockUI.MenuCallback(i)
+		}
+	}
+
+	if mockStore.LastQuery.Group != models.GroupCreatedDay {
+		t.Errorf("Expected tasks reloaded grouped by day, got query %+v", mockStore.LastQuery)
+	}
+	if mockUI.ShowErrorCalls != 0 {
+		t.Errorf("No error expected without a config path, got='%s'", mockUI.ShowErrorMsg)
+	}
+}
+
+func TestHandleMove_RequiresManualSort(t *testing.T) {
+	mockStore, mockUI, controller := setupMoveTest(2)
+	controller.SetConfig(&config.Config{Sort: models.SortAlphabetical}, "")
+
+	controller.HandleMoveUp()
+	controller.HandleMoveTaskTo(2, 1)
+
+	if mockStore.MoveTasksCalls != 0 {
+		t.Errorf("MoveTasks should not be called outside manual sort, got=%d", mockStore.MoveTasksCalls)
+	}
+	if mockUI.ShowErrorMsg != "Switch to manual sort to reorder tasks" {
+		t.Errorf("Expected manual sort error, got='%s'", mockUI.ShowErrorMsg)
+	}
+}
+
+func TestHandleMove_WithinCreatedDay(t *testing.T) {
+	mockStore, _, controller := setupTest("", 2, true)
+	controller.SetConfig(&config.Config{Group: models.GroupCreatedDay}, "")
+	mockStore.TasksToReturn = []models.Task{
+		{ID: 1, Description: "a", CreatedAt: "2026-10-02 09:00:00"},
+		{ID: 2, Description: "b", CreatedAt: "2026-10-02 10:00:00", Done: true},
+		{ID: 3, Description: "c", CreatedAt: "2026-10-01 09:00:00"},
+	}
+	controller.loadAndDisplayTasks()
+
+	// Open and done tasks share a day section, but sections never mix.
+	controller.HandleMoveUp()
+	if mockStore.MoveTasksCalls != 1 || mockStore.LastPrevID != 0 || mockStore.LastNextID != 1 {
+		t.Errorf("Expected move before task 1, got calls=%d prev=%d next=%d",
+			mockStore.MoveTasksCalls, mockStore.LastPrevID, mockStore.LastNextID)
+	}
+
+	controller.HandleMoveTaskTo(2, 3)
+	if mockStore.MoveTasksCalls != 1 {
+		t.Errorf("MoveTasks should not be called across days, got=%d", mockStore.MoveTasksCalls)
+	}
+}
+
+func TestHandleSetDue(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{{ID: 1, Description: "a", Version: 3, Due: "2026-11-01"}}
+	controller.loadAndDisplayTasks()
+
+	controller.HandleSetDue()
+	if mockUI.PromptInputCalls != 1 || mockUI.PromptInitial != "2026-11-01" {
+		t.Fatalf("Expected prompt prefilled with the current due date, got calls=%d initial=%q", mockUI.PromptInputCalls, mockUI.PromptInitial)
+	}
+
+	mockUI.PromptCallback("2026-12-24")
+
+	if mockStore.SetTaskDueCalls != 1 || mockStore.LastDue != "2026-12-24" || mockStore.LastExpectedVersion != 3 {
+		t.Errorf("Expected SetTaskDue(2026-12-24) at version 3, got calls=%d due=%q version=%d",
+			mockStore.SetTaskDueCalls, mockStore.LastDue, mockStore.LastExpectedVersion)
+	}
+}
+
+func TestHandleSetDue_InvalidDate(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.ToggleTaskError = fmt.Errorf("%w: bad date", storage.ErrInvalidInput)
+
+	controller.HandleSetDue()
+	mockUI.PromptCallback("tomorrow")
+
+	if mockUI.ShowErrorCalls != 1 || !strings.Contains(mockUI.ShowErrorMsg, "Failed to set due date of task ID 1") {
+		t.Errorf("Expected due date error, got calls=%d msg='%s'", mockUI.ShowErrorCalls, mockUI.ShowErrorMsg)
+	}
+}
+
+func indexOfSort(mode models.SortMode) int {
+	for i, m := range models.SortModes {
+		if m == mode {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestHandleToggleHideDone(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+
+	controller.HandleToggleHideDone()
+	if !mockStore.LastQuery.HideDone || !mockUI.View.HideDone {
+		t.Errorf("Expected done tasks hidden, got query %+v view %+v", mockStore.LastQuery, mockUI.View)
+	}
+
+	controller.HandleToggleHideDone()
+	if mockStore.LastQuery.HideDone {
+		t.Errorf("Expected done tasks shown again, got query %+v", mockStore.LastQuery)
+	}
+}
+
+func TestHandleArchiveCompleted(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	controller.now = func() time.Time { return now }
+	mockStore.ArchivedTasks = []models.Task{{ID: 1}, {ID: 2}}
+
+	controller.HandleArchiveCompleted()
+	if mockUI.PromptInitial != "30" {
+		t.Errorf("Expected 30 days to be offered, got %q", mockUI.PromptInitial)
+	}
+	mockUI.PromptCallback("7")
+
+	if want := now.AddDate(0, 0, -7); !mockStore.LastCutoff.Equal(want) {
+		t.Errorf("Expected cutoff %v, got %v", want, mockStore.LastCutoff)
+	}
+	if mockUI.ShowInfoMsg != "Archived 2 tasks" {
+		t.Errorf("Expected archive count message, got='%s'", mockUI.ShowInfoMsg)
+	}
+	if mockStore.GetTasksCalls != 1 {
+		t.Errorf("Tasks should be reloaded after archiving, got=%d", mockStore.GetTasksCalls)
+	}
+}
+
+func TestHandleArchiveCompleted_InvalidDays(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+
+	controller.HandleArchiveCompleted()
+	mockUI.PromptCallback("a week")
+
+	if mockStore.ArchiveCalls != 0 {
+		t.Errorf("ArchiveCompleted should not be called, got=%d", mockStore.ArchiveCalls)
+	}
+	if mockUI.ShowErrorCalls != 1 {
+		t.Errorf("Expected an error for a non-numeric age, got=%d", mockUI.ShowErrorCalls)
+	}
+}
+
+func TestHandleShowArchive(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.ArchivedTasks = []models.Task{{ID: 3, Description: "old", Done: true}}
+
+	controller.HandleShowArchive()
+
+	if len(mockUI.ArchiveShown) != 1 || mockUI.ArchiveShown[0].ID != 3 {
+		t.Errorf("Expected archive page with task 3, got %+v", mockUI.ArchiveShown)
+	}
+}
+
+func TestHandleReopenArchived(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.ArchivedTasks = []models.Task{{ID: 3, Description: "old", Done: true, Version: 4}}
+	controller.HandleShowArchive()
+
+	mockStore.ArchivedTasks = []models.Task{}
+	controller.HandleReopenArchived(3)
+
+	if mockStore.ToggleTaskStatusCalls != 1 || mockStore.LastExpectedVersion != 4 {
+		t.Errorf("Expected task 3 reopened at version 4, got calls=%d version=%d", mockStore.ToggleTaskStatusCalls, mockStore.LastExpectedVersion)
+	}
+	if mockUI.ArchiveShown == nil || len(mockUI.ArchiveShown) != 0 {
+		t.Errorf("Expected the archive page reloaded without the task, got %+v", mockUI.ArchiveShown)
+	}
+	if mockStore.GetTasksCalls == 0 {
+		t.Error("Expected the task list reloaded")
+	}
+}
+
+func TestHandleReopenArchived_Conflict(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 0, false)
+	mockStore.ToggleTaskError = storage.ErrConflict
+
+	controller.HandleReopenArchived(3)
+	if mockUI.ConfirmationCallback == nil {
+		t.Fatal("Expected a reload prompt for a conflicting reopen")
+	}
+
+	mockStore.ArchivedTasks = []models.Task{{ID: 3, Done: true, Version: 5}}
+	mockUI.ConfirmationCallback()
+	if len(mockUI.ArchiveShown) != 1 || mockUI.ArchiveShown[0].Version != 5 {
+		t.Errorf("Expected the archive reloaded, got %+v", mockUI.ArchiveShown)
+	}
+}
+
+func TestHandleSelectTask_ShowsHistory(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{{ID: 1, Description: "a"}}
+	mockStore.History = []models.TaskEvent{{TaskID: 1, Kind: models.EventCreated, Detail: "a"}}
+	controller.loadAndDisplayTasks()
+
+	controller.HandleSelectTask(1)
+
+	if mockStore.LastHistoryID != 1 || len(mockUI.HistoryShown) != 1 || mockUI.HistoryTask.Description != "a" {
+		t.Errorf("Expected history of task 1 to be shown, got task %+v events %+v", mockUI.HistoryTask, mockUI.HistoryShown)
+	}
+
+	// Reloading the list refreshes the history, which may have grown.
+	controller.loadAndDisplayTasks()
+	if mockStore.GetTaskHistoryCalls != 2 {
+		t.Errorf("Expected history to be reloaded with the list, got=%d", mockStore.GetTaskHistoryCalls)
+	}
+
+	controller.HandleSelectTask(0)
+	if mockUI.HistoryShown != nil || mockStore.GetTaskHistoryCalls != 2 {
+		t.Errorf("Expected history to be cleared without a store call, got %+v", mockUI.HistoryShown)
+	}
+}
+
+func TestLoadAndDisplayTasks_LoadsHistoryOncePerReload(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{{ID: 1}, {ID: 2}}
+	controller.HandleSelectTask(1)
+
+	// The reload moves the cursor, so the UI reports the new selection.
+	mockUI.OnRefresh = func() { controller.HandleSelectTask(2) }
+	before := mockStore.GetTaskHistoryCalls
+	controller.loadAndDisplayTasks()
+	if got := mockStore.GetTaskHistoryCalls - before; got != 1 || mockStore.LastHistoryID != 2 {
+		t.Errorf("Expected one history load for task 2, got %d for task %d", got, mockStore.LastHistoryID)
+	}
+
+	// The cursor stays put, so the controller reloads the history itself.
+	mockUI.OnRefresh = nil
+	before = mockStore.GetTaskHistoryCalls
+	controller.loadAndDisplayTasks()
+	if got := mockStore.GetTaskHistoryCalls - before; got != 1 {
+		t.Errorf("Expected one history load, got %d", got)
+	}
+}
+
+func TestHandleSelectTask_IgnoresStaleHistory(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	var queued []func()
+	controller.spawn = func(f func()) { queued = append(queued, f) }
+
+	controller.HandleSelectTask(1)
+	controller.HandleSelectTask(2)
+	mockStore.History = []models.TaskEvent{{TaskID: 1, Kind: models.EventCreated}}
+	queued[0]()
+
+	if mockUI.ShowTaskHistoryCalls != 0 {
+		t.Errorf("History of a task no longer selected should not be shown, got=%d", mockUI.ShowTaskHistoryCalls)
+	}
+}
+
+func TestHandleRenameTask(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{{ID: 1, Description: "Buy mlik", Version: 2}}
+	controller.loadAndDisplayTasks()
+
+	controller.HandleRenameTask()
+	if mockUI.PromptInitial != "Buy mlik" {
+		t.Fatalf("Expected prompt prefilled with the description, got %q", mockUI.PromptInitial)
+	}
+	mockUI.PromptCallback("Buy milk")
+
+	if mockStore.RenameTaskCalls != 1 || mockStore.LastDescription != "Buy milk" || mockStore.LastExpectedVersion != 2 {
+		t.Errorf("Expected RenameTask(Buy milk) at version 2, got calls=%d description=%q version=%d",
+			mockStore.RenameTaskCalls, mockStore.LastDescription, mockStore.LastExpectedVersion)
+	}
+}
+
+func TestHandleRenameTask_Unchanged(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	mockStore.TasksToReturn = []models.Task{{ID: 1, Description: "same"}}
+	controller.loadAndDisplayTasks()
+
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("same")
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("")
+
+	if mockStore.RenameTaskCalls != 0 {
+		t.Errorf("RenameTask should not be called, got=%d", mockStore.RenameTaskCalls)
+	}
+	if mockUI.ShowErrorMsg != "Task description cannot be empty" {
+		t.Errorf("Expected empty description error, got='%s'", mockUI.ShowErrorMsg)
+	}
+}
+
+// rewritingHooks completes tasks and sets a due date on them, and records
+// whether its context had a deadline.
+type rewritingHooks struct {
+	deadline bool
+}
+
+func (h *rewritingHooks) BeforeAdd(ctx context.Context, task models.Task) (models.Task, error) {
+	return h.BeforeModify(ctx, task)
+}
+
+func (h *rewritingHooks) BeforeModify(ctx context.Context, task models.Task) (models.Task, error) {
+	_, h.deadline = ctx.Deadline()
+	task.Due, task.Done = "2026-10-19", true
+	return task, nil
+}
+
+func TestHooks_RewrittenChangesSavedInOneCall(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("Buy milk", 1, true)
+	controller.SetHooks(&rewritingHooks{})
+
+	controller.HandleAddTask()
+	if mockStore.AddTaskCalls != 0 || mockStore.CreateTaskCalls != 1 || mockStore.SetTaskDueCalls != 0 || mockStore.ToggleTaskStatusCalls != 0 {
+		t.Errorf("Expected a single CreateTask call, got add=%d create=%d due=%d toggle=%d",
+			mockStore.AddTaskCalls, mockStore.CreateTaskCalls, mockStore.SetTaskDueCalls, mockStore.ToggleTaskStatusCalls)
+	}
+	if got := mockStore.LastTask; got.Description != "Buy milk" || got.Due != "2026-10-19" || !got.Done {
+		t.Errorf("Expected the task as the hook left it, got %+v", got)
+	}
+
+	mockStore.TasksToReturn = []models.Task{{ID: 1, Description: "Buy mlik", Version: 2}}
+	controller.loadAndDisplayTasks()
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("Buy milk")
+	if mockStore.UpdateTaskCalls != 1 || mockStore.RenameTaskCalls != 0 || mockStore.LastExpectedVersion != 2 {
+		t.Errorf("Expected a single UpdateTask call at version 2, got update=%d rename=%d version=%d",
+			mockStore.UpdateTaskCalls, mockStore.RenameTaskCalls, mockStore.LastExpectedVersion)
+	}
+}
+
+func TestHooks_RunWithoutTheStoreTimeout(t *testing.T) {
+	mockStore, mockUI, controller := setupTest("", 1, true)
+	hooks := &rewritingHooks{}
+	controller.SetHooks(hooks)
+	mockStore.TasksToReturn = []models.Task{{ID: 1, Description: "Buy mlik"}}
+	controller.loadAndDisplayTasks()
+
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("Buy milk")
+	if hooks.deadline {
+		t.Error("Expected the hook not to be bounded by the store timeout")
+	}
+
+	controller.HandleToggleTask()
+	if _, ok := mockStore.LastCtx.Deadline(); !ok {
+		t.Error("Expected the store call to be bounded by the store timeout")
+	}
+}
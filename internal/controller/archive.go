@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// defaultArchiveDays is offered when asking how old completed tasks must be
+// to be archived.
+const defaultArchiveDays = 30
+
+// HandleToggleHideDone hides completed tasks from the list, or shows them
+// again.
+func (c *AppController) HandleToggleHideDone() {
+	c.config.HideDone = !c.config.HideDone
+	c.applyView()
+}
+
+// HandleArchiveCompleted asks for an age in days and archives every task
+// completed longer ago than that.
+func (c *AppController) HandleArchiveCompleted() {
+	c.ui.PromptInput("Archive tasks completed more than N days ago", strconv.Itoa(defaultArchiveDays), func(text string) {
+		days, err := strconv.Atoi(text)
+		if err != nil || days < 0 {
+			c.ui.ShowError(fmt.Sprintf("%q is not a number of days", text))
+			return
+		}
+		cutoff := c.now().Add(-time.Duration(days) * 24 * time.Hour)
+
+		var archived int
+		c.runAsync("Archiving tasks", func(ctx context.Context) error {
+			var err error
+			archived, err = c.archiveCompleted(ctx, cutoff)
+			return err
+		}, func(err error) {
+			if err != nil {
+				log.Printf("Error archiving tasks: %v", err)
+				c.handleStoreError(err, fmt.Sprintf("Failed to archive tasks: %v", err))
+				return
+			}
+			log.Printf("Archived %d tasks completed before %s.", archived, cutoff.Format(time.RFC3339))
+			c.ui.ShowInfo(fmt.Sprintf("Archived %s", pluralTasks(archived)))
+			c.loadAndDisplayTasks()
+		})
+	})
+}
+
+// archiveCompleted archives the tasks completed before cutoff and
+// announces each.
+func (c *AppController) archiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	// Archived tasks leave the list, so it is read first.
+	var listed map[int]bool
+	if len(c.listeners) > 0 {
+		tasks, err := c.store.GetTasks(ctx, models.TaskQuery{})
+		if err != nil {
+			return 0, err
+		}
+		listed = make(map[int]bool, len(tasks))
+		for _, task := range tasks {
+			listed[task.ID] = true
+		}
+	}
+	archived, err := c.store.ArchiveCompleted(ctx, cutoff)
+	if err != nil || archived == 0 || len(c.listeners) == 0 {
+		return archived, err
+	}
+	tasks, err := c.store.GetArchivedTasks(ctx)
+	if err != nil {
+		log.Printf("Error reading archived tasks for listeners: %v", err)
+		return archived, nil
+	}
+	for _, task := range tasks {
+		if listed[task.ID] {
+			c.announce(ctx, models.EventArchived, task)
+		}
+	}
+	return archived, nil
+}
+
+// HandleShowArchive opens the archive of completed tasks.
+func (c *AppController) HandleShowArchive() {
+	var tasks []models.Task
+	c.runAsync("Loading archive", func(ctx context.Context) error {
+		var err error
+		tasks, err = c.store.GetArchivedTasks(ctx)
+		return err
+	}, func(err error) {
+		if err != nil {
+			log.Printf("Error loading archive: %v", err)
+			c.handleStoreError(err, fmt.Sprintf("Failed to load archive: %v", err))
+			return
+		}
+		c.archived = tasks
+		c.ui.ShowArchive(tasks)
+	})
+}
+
+// HandleReopenArchived reopens a task on the archive page, which takes it
+// out of the archive and back into the list.
+func (c *AppController) HandleReopenArchived(taskID int) {
+	version := 0
+	for _, task := range c.archived {
+		if task.ID == taskID {
+			version = task.Version
+		}
+	}
+	c.runAsync("Reopening task", func(ctx context.Context) error {
+		if err := c.store.ToggleTaskStatus(ctx, taskID, version); err != nil {
+			return err
+		}
+		c.announceStored(ctx, []int{taskID}, statusEvent)
+		return nil
+	}, func(err error) {
+		if err != nil {
+			log.Printf("Error reopening archived task %d: %v", taskID, err)
+			if errors.Is(err, storage.ErrConflict) {
+				// Reload the archive too, or reopening again would fail
+				// the same way.
+				c.ui.ShowConfirmation("Task was modified elsewhere, reload?", func() {
+					c.loadAndDisplayTasks()
+					c.HandleShowArchive()
+				})
+				return
+			}
+			c.handleStoreError(err, fmt.Sprintf("Failed to reopen task ID %d: %v", taskID, err))
+			return
+		}
+		c.loadAndDisplayTasks()
+		c.HandleShowArchive()
+	})
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// storeTimeout bounds every store call so a stuck database cannot leave an
+// operation pending forever. It applies to each call on its own, so hooks
+// and listeners running between the calls of an operation, which have
+// limits of their own, don't use it up.
+const storeTimeout = 10 * time.Second
+
+// runAsync runs op off the UI goroutine while the UI shows a busy
+// indicator, then calls done with the result back on the UI goroutine.
+// runAsync itself must be called on the UI goroutine. Pending operations can
+// be cancelled with HandleCancel.
+func (c *AppController) runAsync(label string, op func(ctx context.Context) error, done func(err error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.nextOp++
+	id := c.nextOp
+	c.pending[id] = cancel
+	c.ui.ShowBusy(label)
+
+	c.spawn(func() {
+		err := op(ctx)
+		c.ui.QueueUpdate(func() {
+			cancel()
+			delete(c.pending, id)
+			// Every ShowBusy is matched, so the UI can tell when nothing
+			// is left running.
+			c.ui.HideBusy()
+			done(err)
+		})
+	})
+}
+
+// HandleCancel cancels every store call that is still in flight.
+func (c *AppController) HandleCancel() {
+	if len(c.pending) == 0 {
+		return
+	}
+	log.Printf("Cancelling %d pending operation(s)...", len(c.pending))
+	for _, cancel := range c.pending {
+		cancel()
+	}
+}
+
+// timedStore bounds each call to Store with storeTimeout.
+type timedStore struct {
+	Store
+}
+
+func (s timedStore) GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.GetTasks(ctx, query)
+}
+
+func (s timedStore) AddTask(ctx context.Context, description string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.AddTask(ctx, description)
+}
+
+func (s timedStore) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.CreateTask(ctx, task)
+}
+
+func (s timedStore) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.ToggleTaskStatus(ctx, id, expectedVersion)
+}
+
+func (s timedStore) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.DeleteTask(ctx, id, expectedVersion)
+}
+
+func (s timedStore) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.RenameTask(ctx, id, expectedVersion, description)
+}
+
+func (s timedStore) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.SetTaskDue(ctx, id, expectedVersion, due)
+}
+
+func (s timedStore) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.UpdateTask(ctx, id, expectedVersion, edit)
+}
+
+func (s timedStore) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.SetTasksDone(ctx, versions, done)
+}
+
+func (s timedStore) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.ArchiveCompleted(ctx, cutoff)
+}
+
+func (s timedStore) GetArchivedTasks(ctx context.Context) ([]models.Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.GetArchivedTasks(ctx)
+}
+
+func (s timedStore) GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.GetTaskHistory(ctx, id)
+}
+
+func (s timedStore) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.DeleteTasks(ctx, versions)
+}
+
+func (s timedStore) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.MoveTasks(ctx, ids, versions, prevID, nextID)
+}
+
+func (s timedStore) DataVersion(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return s.Store.DataVersion(ctx)
+}
@@ -0,0 +1,454 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// Behaviour-level tests run the controller against a real in-memory store,
+// so they check what ends up in the list rather than which calls were made.
+
+func setupMemoryTest() (*storage.MemoryStore, *MockUI, *AppController) {
+	store := storage.NewMemoryStore()
+	mockUI := &MockUI{}
+	controller := NewAppController(store)
+	controller.SetUI(mockUI)
+	controller.spawn = func(f func()) { f() }
+	return store, mockUI, controller
+}
+
+func addTasks(t *testing.T, controller *AppController, mockUI *MockUI, descriptions ...string) {
+	t.Helper()
+	for _, description := range descriptions {
+		mockUI.inputText = description
+		controller.HandleAddTask()
+		if mockUI.ShowErrorMsg != "" {
+			t.Fatalf("Adding %q failed: %s", description, mockUI.ShowErrorMsg)
+		}
+	}
+}
+
+func listed(mockUI *MockUI) []string {
+	var result []string
+	for _, task := range mockUI.TasksReceived {
+		result = append(result, task.Description)
+	}
+	return result
+}
+
+func findTask(t *testing.T, tasks []models.Task, description string) models.Task {
+	t.Helper()
+	for _, task := range tasks {
+		if task.Description == description {
+			return task
+		}
+	}
+	t.Fatalf("Task %q not in list %+v", description, tasks)
+	return models.Task{}
+}
+
+func TestBehaviour_AddThenList(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+
+	addTasks(t, controller, mockUI, "Buy milk", "Walk dog")
+
+	got := listed(mockUI)
+	if len(got) != 2 || got[0] != "Walk dog" || got[1] != "Buy milk" {
+		t.Errorf("Expected newest task first, got %v", got)
+	}
+}
+
+func TestBehaviour_ToggleKeepsOtherTasksInPlace(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "Buy milk", "Walk dog")
+
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "Walk dog").ID
+	mockUI.TaskSelected = true
+	controller.HandleToggleTask()
+
+	got := listed(mockUI)
+	if len(got) != 2 || got[0] != "Buy milk" || got[1] != "Walk dog" {
+		t.Errorf("Expected done task last, got %v", got)
+	}
+	if !findTask(t, mockUI.TasksReceived, "Walk dog").Done {
+		t.Error("Expected toggled task to be done")
+	}
+}
+
+func TestBehaviour_DeleteRemovesTask(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "Buy milk", "Walk dog")
+
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "Buy milk").ID
+	mockUI.TaskSelected = true
+	controller.HandleDeleteTask()
+	mockUI.ConfirmationCallback()
+
+	got := listed(mockUI)
+	if len(got) != 1 || got[0] != "Walk dog" {
+		t.Errorf("Expected only 'Walk dog' to remain, got %v", got)
+	}
+}
+
+func TestBehaviour_ConcurrentModificationPromptsReload(t *testing.T) {
+	store, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "Shared task")
+	task := findTask(t, mockUI.TasksReceived, "Shared task")
+
+	// Another client toggles the task after our list was loaded.
+	if err := store.ToggleTaskStatus(context.Background(), task.ID, 0); err != nil {
+		t.Fatalf("External toggle failed: %v", err)
+	}
+
+	mockUI.SelectedTaskID = task.ID
+	mockUI.TaskSelected = true
+	controller.HandleToggleTask()
+
+	if mockUI.ShowConfirmationMsg != "Task was modified elsewhere, reload?" {
+		t.Fatalf("Expected reload prompt, got='%s'", mockUI.ShowConfirmationMsg)
+	}
+
+	mockUI.ConfirmationCallback()
+	if !findTask(t, mockUI.TasksReceived, "Shared task").Done {
+		t.Error("Expected reloaded list to show the external change")
+	}
+}
+
+func TestBehaviour_DeletedElsewhere(t *testing.T) {
+	store, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "Doomed task")
+	task := findTask(t, mockUI.TasksReceived, "Doomed task")
+
+	if err := store.DeleteTask(context.Background(), task.ID, 0); err != nil {
+		t.Fatalf("External delete failed: %v", err)
+	}
+
+	mockUI.SelectedTaskID = task.ID
+	mockUI.TaskSelected = true
+	controller.HandleToggleTask()
+
+	if mockUI.ShowErrorCalls != 1 {
+		t.Errorf("Expected a not-found error, got %d errors", mockUI.ShowErrorCalls)
+	}
+	if len(mockUI.TasksReceived) != 0 {
+		t.Errorf("Expected list to be reloaded without the deleted task, got %v", listed(mockUI))
+	}
+}
+
+func TestBehaviour_BulkCompleteAndDelete(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "one", "two", "three")
+
+	mockUI.MarkedTaskIDs = []int{
+		findTask(t, mockUI.TasksReceived, "one").ID,
+		findTask(t, mockUI.TasksReceived, "three").ID,
+	}
+	controller.HandleToggleTask()
+	mockUI.ConfirmationCallback()
+
+	got := listed(mockUI)
+	if len(got) != 3 || got[0] != "two" {
+		t.Errorf("Expected the unmarked task first, got %v", got)
+	}
+	if !findTask(t, mockUI.TasksReceived, "one").Done || !findTask(t, mockUI.TasksReceived, "three").Done {
+		t.Error("Expected both marked tasks to be done")
+	}
+
+	mockUI.MarkedTaskIDs = []int{
+		findTask(t, mockUI.TasksReceived, "one").ID,
+		findTask(t, mockUI.TasksReceived, "two").ID,
+	}
+	controller.HandleDeleteTask()
+	mockUI.ConfirmationCallback()
+
+	got = listed(mockUI)
+	if len(got) != 1 || got[0] != "three" {
+		t.Errorf("Expected only 'three' to remain, got %v", got)
+	}
+}
+
+func TestBehaviour_MoveTasks(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "c", "b", "a")
+
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "a").ID
+	mockUI.TaskSelected = true
+	controller.HandleMoveDown()
+	controller.HandleMoveDown()
+
+	got := listed(mockUI)
+	if len(got) != 3 || got[0] != "b" || got[1] != "c" || got[2] != "a" {
+		t.Errorf("Expected 'a' moved to the bottom, got %v", got)
+	}
+
+	// Toggling a task must not reshuffle the others.
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "b").ID
+	controller.HandleToggleTask()
+	controller.HandleToggleTask()
+
+	got = listed(mockUI)
+	if len(got) != 3 || got[0] != "b" || got[1] != "c" || got[2] != "a" {
+		t.Errorf("Expected order to survive toggling, got %v", got)
+	}
+
+	mockUI.MarkedTaskIDs = []int{
+		findTask(t, mockUI.TasksReceived, "c").ID,
+		findTask(t, mockUI.TasksReceived, "a").ID,
+	}
+	controller.HandleMoveUp()
+
+	got = listed(mockUI)
+	if len(got) != 3 || got[0] != "c" || got[1] != "a" || got[2] != "b" {
+		t.Errorf("Expected marked tasks moved above 'b', got %v", got)
+	}
+}
+
+func TestBehaviour_SortAndGroup(t *testing.T) {
+	store, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "banana", "apple", "cherry")
+	tasks, _ := store.GetTasks(context.Background(), models.TaskQuery{})
+	store.ToggleTaskStatus(context.Background(), findTask(t, tasks, "apple").ID, 0)
+
+	controller.HandleChooseSort()
+	mockUI.MenuCallback(indexOfSort(models.SortAlphabetical))
+
+	// Alphabetical within each group, done tasks still last.
+	got := listed(mockUI)
+	if len(got) != 3 || got[0] != "banana" || got[1] != "cherry" || got[2] != "apple" {
+		t.Errorf("Expected [banana cherry apple], got %v", got)
+	}
+}
+
+func TestBehaviour_HistoryFollowsChanges(t *testing.T) {
+	store, mockUI, controller := setupMemoryTest()
+	addTasks(t, controller, mockUI, "Buy mlik")
+	task := findTask(t, mockUI.TasksReceived, "Buy mlik")
+	mockUI.SelectedTaskID, mockUI.TaskSelected = task.ID, true
+	controller.HandleSelectTask(task.ID)
+
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("Buy milk")
+	controller.HandleToggleTask()
+
+	var kinds []models.EventKind
+	for _, e := range mockUI.HistoryShown {
+		kinds = append(kinds, e.Kind)
+	}
+	if len(kinds) != 3 || kinds[0] != models.EventCreated || kinds[1] != models.EventRenamed || kinds[2] != models.EventCompleted {
+		t.Errorf("Expected created, renamed, completed, got %v", kinds)
+	}
+	if events, _ := store.GetTaskHistory(context.Background(), task.ID); len(events) != 3 {
+		t.Errorf("Expected 3 stored events, got %+v", events)
+	}
+}
+
+// recorder is a Listener that keeps what it was told.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) TaskChanged(ctx context.Context, kind models.EventKind, task models.Task) {
+	r.events = append(r.events, string(kind)+" "+task.Description)
+}
+
+func TestBehaviour_ListenersHearChanges(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	rec := &recorder{}
+	controller.AddListener(rec)
+	addTasks(t, controller, mockUI, "Buy milk", "Walk dog")
+
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "Walk dog").ID
+	mockUI.TaskSelected = true
+	controller.HandleToggleTask()
+	controller.HandleToggleTask()
+	controller.HandleDeleteTask()
+	mockUI.ConfirmationCallback()
+
+	want := []string{"created Buy milk", "created Walk dog", "completed Walk dog", "reopened Walk dog", "deleted Walk dog"}
+	if strings.Join(rec.events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Expected %v, got %v", want, rec.events)
+	}
+
+	// Marked tasks are announced one by one.
+	rec.events = nil
+	id := findTask(t, mockUI.TasksReceived, "Buy milk").ID
+	mockUI.MarkedTaskIDs = []int{id}
+	controller.HandleToggleTask()
+	mockUI.ConfirmationCallback()
+	mockUI.MarkedTaskIDs = []int{id}
+	controller.HandleDeleteTask()
+	mockUI.ConfirmationCallback()
+	want = []string{"completed Buy milk", "deleted Buy milk"}
+	if strings.Join(rec.events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Expected %v, got %v", want, rec.events)
+	}
+}
+
+// fakeHooks rejects descriptions containing "secret" and tags others.
+type fakeHooks struct{}
+
+func (fakeHooks) check(task models.Task) (models.Task, error) {
+	if strings.Contains(task.Description, "secret") {
+		return task, &models.RejectedError{Message: "no secrets in tasks"}
+	}
+	if strings.HasSuffix(task.Description, " today") {
+		task.Due = "2026-10-18"
+	}
+	return task, nil
+}
+
+func (h fakeHooks) BeforeAdd(ctx context.Context, task models.Task) (models.Task, error) {
+	return h.check(task)
+}
+
+func (h fakeHooks) BeforeModify(ctx context.Context, task models.Task) (models.Task, error) {
+	return h.check(task)
+}
+
+func TestBehaviour_HooksCheckAndChangeTasks(t *testing.T) {
+	store, mockUI, controller := setupMemoryTest()
+	controller.SetHooks(fakeHooks{})
+
+	addTasks(t, controller, mockUI, "Call ACME today")
+	if due := findTask(t, mockUI.TasksReceived, "Call ACME today").Due; due != "2026-10-18" {
+		t.Errorf("Expected the hook to set the due date, got %q", due)
+	}
+
+	mockUI.inputText = "Share the secret"
+	controller.HandleAddTask()
+	if mockUI.ShowErrorMsg != "no secrets in tasks" {
+		t.Errorf("Expected the hook's message, got %q", mockUI.ShowErrorMsg)
+	}
+	if tasks, _ := store.GetTasks(context.Background(), models.TaskQuery{}); len(tasks) != 1 {
+		t.Errorf("Expected the rejected task not to be added, got %+v", tasks)
+	}
+
+	// Edits go through the hook too.
+	mockUI.ShowErrorMsg = ""
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "Call ACME today").ID
+	mockUI.TaskSelected = true
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("Tell ACME the secret")
+	if mockUI.ShowErrorMsg != "no secrets in tasks" {
+		t.Errorf("Expected the rename to be rejected, got %q", mockUI.ShowErrorMsg)
+	}
+	controller.HandleRenameTask()
+	mockUI.PromptCallback("Email ACME")
+	if listed := listed(mockUI); len(listed) != 1 || listed[0] != "Email ACME" {
+		t.Errorf("Expected the rename to be saved, got %v", listed)
+	}
+}
+
+// fakeCommands completes the marked tasks and adds a checklist item.
+type fakeCommands struct{}
+
+func (fakeCommands) Names() []string { return []string{"Wrap up"} }
+
+func (fakeCommands) Run(ctx context.Context, name string, env CommandEnv) error {
+	versions := make(map[int]int)
+	for _, id := range env.Marked {
+		versions[id] = 0
+	}
+	if err := env.Store.SetTasksDone(ctx, versions, true); err != nil {
+		return err
+	}
+	if _, err := env.Store.AddTask(ctx, "Write summary"); err != nil {
+		return err
+	}
+	env.Info("Wrapped up")
+	return env.Store.DeleteTask(ctx, 999, 0)
+}
+
+func TestBehaviour_CommandsRunAgainstTheStore(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	rec := &recorder{}
+	controller.AddListener(rec)
+
+	controller.HandleRunCommand()
+	if mockUI.ShowMenuCalls != 0 || mockUI.ShowInfoMsg == "" {
+		t.Errorf("Expected a hint that no commands are set up, got %q", mockUI.ShowInfoMsg)
+	}
+
+	controller.SetCommands(fakeCommands{})
+	addTasks(t, controller, mockUI, "Buy milk")
+	rec.events = nil
+	mockUI.MarkedTaskIDs = []int{findTask(t, mockUI.TasksReceived, "Buy milk").ID}
+	controller.HandleRunCommand()
+	if len(mockUI.MenuOptions) != 1 || mockUI.MenuOptions[0] != "Wrap up" {
+		t.Fatalf("Expected the command in the menu, got %v", mockUI.MenuOptions)
+	}
+	mockUI.MenuCallback(0)
+
+	if !findTask(t, mockUI.TasksReceived, "Buy milk").Done {
+		t.Error("Expected the marked task done")
+	}
+	findTask(t, mockUI.TasksReceived, "Write summary")
+	if !strings.Contains(mockUI.ShowErrorMsg, "Task ID 999 no longer exists") {
+		t.Errorf("Expected the failing delete reported, got %q", mockUI.ShowErrorMsg)
+	}
+	want := []string{"completed Buy milk", "created Write summary"}
+	if strings.Join(rec.events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Expected %v, got %v", want, rec.events)
+	}
+	// The command palette lists and runs commands by name.
+	if names := controller.CommandNames(); len(names) != 1 || names[0] != "Wrap up" {
+		t.Errorf("Expected the command listed for the palette, got %v", names)
+	}
+	mockUI.ShowErrorMsg = ""
+	addTasks(t, controller, mockUI, "Water plants")
+	mockUI.MarkedTaskIDs = []int{findTask(t, mockUI.TasksReceived, "Water plants").ID}
+	controller.HandleRunNamedCommand("Wrap up")
+	if !findTask(t, mockUI.TasksReceived, "Water plants").Done {
+		t.Error("Expected the command run from the palette to complete the marked task")
+	}
+}
+
+// editingCommands edits the selected task the ways a script can.
+type editingCommands struct{}
+
+func (editingCommands) Names() []string { return []string{"Follow up"} }
+
+func (editingCommands) Run(ctx context.Context, name string, env CommandEnv) error {
+	if _, err := env.Store.AddTask(ctx, "Call ACME today"); err != nil {
+		return err
+	}
+	if err := env.Store.RenameTask(ctx, env.Selected, 0, "Email ACME"); err != nil {
+		return err
+	}
+	if err := env.Store.SetTaskDue(ctx, env.Selected, 0, "2026-10-20"); err != nil {
+		return err
+	}
+	return env.Store.RenameTask(ctx, env.Selected, 0, "Share the secret")
+}
+
+func TestBehaviour_CommandsGoThroughHooks(t *testing.T) {
+	_, mockUI, controller := setupMemoryTest()
+	controller.SetHooks(fakeHooks{})
+	controller.SetCommands(editingCommands{})
+	rec := &recorder{}
+	controller.AddListener(rec)
+	addTasks(t, controller, mockUI, "Call ACME")
+	rec.events = nil
+
+	mockUI.SelectedTaskID = findTask(t, mockUI.TasksReceived, "Call ACME").ID
+	mockUI.TaskSelected = true
+	controller.HandleRunNamedCommand("Follow up")
+
+	if due := findTask(t, mockUI.TasksReceived, "Call ACME today").Due; due != "2026-10-18" {
+		t.Errorf("Expected the add hook to set the due date, got %q", due)
+	}
+	if mockUI.ShowErrorMsg != "no secrets in tasks" {
+		t.Errorf("Expected the modify hook to reject the last rename, got %q", mockUI.ShowErrorMsg)
+	}
+	if due := findTask(t, mockUI.TasksReceived, "Email ACME").Due; due != "2026-10-20" {
+		t.Errorf("Expected the renamed task due 2026-10-20, got %q", due)
+	}
+	want := []string{"created Call ACME today", "renamed Email ACME", "due_changed Email ACME"}
+	if strings.Join(rec.events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Expected %v, got %v", want, rec.events)
+	}
+}
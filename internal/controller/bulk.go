@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go-todo/internal/models"
+)
+
+// markedVersions maps each marked task to its version as last loaded.
+func (c *AppController) markedVersions(ids []int) map[int]int {
+	versions := make(map[int]int, len(ids))
+	for _, id := range ids {
+		versions[id] = c.taskVersion(id)
+	}
+	return versions
+}
+
+// toggleMarked completes all marked tasks, or reopens them if they are all
+// already done, after a single confirmation.
+func (c *AppController) toggleMarked(ids []int) {
+	done := false
+	for _, id := range ids {
+		if !c.taskDone(id) {
+			done = true
+			break
+		}
+	}
+
+	confirmMsg := fmt.Sprintf("Mark %s as done?", pluralTasks(len(ids)))
+	if !done {
+		confirmMsg = fmt.Sprintf("Reopen %s?", pluralTasks(len(ids)))
+	}
+
+	c.ui.ShowConfirmation(confirmMsg, func() {
+		versions := c.markedVersions(ids)
+		c.runAsync("Updating tasks", func(ctx context.Context) error {
+			if err := c.store.SetTasksDone(ctx, versions, done); err != nil {
+				return err
+			}
+			c.announceStored(ctx, ids, statusEvent)
+			return nil
+		}, func(err error) {
+			if err != nil {
+				log.Printf("Error updating %d tasks: %v", len(ids), err)
+				c.handleStoreError(err, fmt.Sprintf("Failed to update %s: %v", pluralTasks(len(ids)), err))
+				return
+			}
+			c.ui.ClearMarks()
+			c.loadAndDisplayTasks()
+		})
+	})
+}
+
+// deleteMarked deletes all marked tasks after a single confirmation.
+func (c *AppController) deleteMarked(ids []int) {
+	confirmMsg := fmt.Sprintf("Are you sure you want to delete %s?", pluralTasks(len(ids)))
+
+	c.ui.ShowConfirmation(confirmMsg, func() {
+		versions := c.markedVersions(ids)
+		deleted := c.loadedTasks(ids)
+		c.runAsync("Deleting tasks", func(ctx context.Context) error {
+			if err := c.store.DeleteTasks(ctx, versions); err != nil {
+				return err
+			}
+			for _, task := range deleted {
+				c.announce(ctx, models.EventDeleted, task)
+			}
+			return nil
+		}, func(err error) {
+			if err != nil {
+				log.Printf("Error deleting %d tasks: %v", len(ids), err)
+				c.handleStoreError(err, fmt.Sprintf("Failed to delete %s: %v", pluralTasks(len(ids)), err))
+				return
+			}
+			c.ui.ClearMarks()
+			c.loadAndDisplayTasksThen(func() {
+				if c.ui.GetItemCount() == 0 {
+					c.ui.FocusInput()
+				}
+			})
+		})
+	})
+}
+
+// taskDone reports whether the task was done when the list was last loaded.
+func (c *AppController) taskDone(id int) bool {
+	task, _ := c.loadedTask(id)
+	return task.Done
+}
+
+func pluralTasks(n int) string {
+	if n == 1 {
+		return "1 task"
+	}
+	return fmt.Sprintf("%d tasks", n)
+}
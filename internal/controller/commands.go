@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// Commands are custom commands the user can run from the command palette,
+// such as those defined by scripts.
+type Commands interface {
+	// Names lists the commands in the order they are offered.
+	Names() []string
+	// Run runs the command called name. It is called off the UI goroutine.
+	Run(ctx context.Context, name string, env CommandEnv) error
+}
+
+// CommandEnv is what a command works with.
+type CommandEnv struct {
+	// Store is the task store. Changes made through it go through the
+	// hooks and are announced to the controller's listeners, as the
+	// user's own are.
+	Store Store
+	// Selected is the ID of the selected task, or 0 if there is none.
+	Selected int
+	// Marked holds the IDs of the tasks marked for a bulk operation.
+	Marked []int
+	// Info and Error queue messages to show once the command is done.
+	Info  func(message string)
+	Error func(message string)
+}
+
+// SetCommands makes cmds available from the command palette. It must be
+// called before Start.
+func (c *AppController) SetCommands(cmds Commands) {
+	c.commands = cmds
+}
+
+// CommandNames lists the custom commands, for the command palette to offer
+// alongside the built-in actions.
+func (c *AppController) CommandNames() []string {
+	if c.commands == nil {
+		return nil
+	}
+	return c.commands.Names()
+}
+
+// HandleRunCommand lets the user pick a custom command and runs it.
+func (c *AppController) HandleRunCommand() {
+	names := c.CommandNames()
+	if len(names) == 0 {
+		c.ui.ShowInfo("No commands are set up. Add scripts to the scripts directory beside the config file.")
+		return
+	}
+	c.ui.ShowMenu("Run command", names, 0, func(index int) {
+		c.runCommand(names[index])
+	})
+}
+
+// HandleRunNamedCommand runs the custom command called name, as picked in
+// the command palette.
+func (c *AppController) HandleRunNamedCommand(name string) {
+	c.runCommand(name)
+}
+
+// runCommand runs the command called name on the selected and marked
+// tasks, then shows what it had to say and reloads the list.
+func (c *AppController) runCommand(name string) {
+	selected, _ := c.ui.GetSelectedTaskID()
+	var infos, errs []string
+	env := CommandEnv{
+		Store:    &commandStore{Store: c.store, c: c},
+		Selected: selected,
+		Marked:   c.ui.GetMarkedTaskIDs(),
+		// Only the command's goroutine appends, and done reads them after
+		// it returned.
+		Info:  func(message string) { infos = append(infos, message) },
+		Error: func(message string) { errs = append(errs, message) },
+	}
+
+	c.runAsync("Running "+name, func(ctx context.Context) error {
+		return c.commands.Run(ctx, name, env)
+	}, func(err error) {
+		c.ui.ClearMarks()
+		c.loadAndDisplayTasks()
+		if err != nil {
+			log.Printf("Error running command %q: %v", name, err)
+			c.handleStoreError(err, fmt.Sprintf("Command %q failed: %v", name, err))
+			return
+		}
+		if len(errs) > 0 {
+			c.ui.ShowError(strings.Join(errs, "\n"))
+		} else if len(infos) > 0 {
+			c.ui.ShowInfo(strings.Join(infos, "\n"))
+		}
+	})
+}
+
+// commandStore is the store a command works through. Its writes go
+// through the hooks and are announced to the controller's listeners, as if
+// the user had made them.
+type commandStore struct {
+	Store
+	c *AppController
+}
+
+func (s *commandStore) AddTask(ctx context.Context, description string) (int64, error) {
+	return s.CreateTask(ctx, models.Task{Description: description})
+}
+
+func (s *commandStore) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	task, err := s.c.beforeAdd(ctx, task)
+	if err != nil {
+		return 0, err
+	}
+	id, err := s.Store.CreateTask(ctx, task)
+	if err == nil {
+		s.c.announceStored(ctx, []int{int(id)}, always(models.EventCreated))
+	}
+	return id, err
+}
+
+func (s *commandStore) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
+	err := s.Store.ToggleTaskStatus(ctx, id, expectedVersion)
+	if err == nil {
+		s.c.announceStored(ctx, []int{id}, statusEvent)
+	}
+	return err
+}
+
+func (s *commandStore) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	err := s.Store.SetTasksDone(ctx, versions, done)
+	if err == nil {
+		s.c.announceStored(ctx, versionIDs(versions), statusEvent)
+	}
+	return err
+}
+
+func (s *commandStore) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	return s.modify(ctx, "rename", id, expectedVersion, func(task *models.Task) { task.Description = description })
+}
+
+func (s *commandStore) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	return s.modify(ctx, "set due date of", id, expectedVersion, func(task *models.Task) { task.Due = due })
+}
+
+func (s *commandStore) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	return s.modify(ctx, "update", id, expectedVersion, func(task *models.Task) {
+		task.Description, task.Due, task.Done = edit.Description, edit.Due, edit.Done
+	})
+}
+
+// modify applies an edit to a task the way the user's edits are: the
+// modify hook sees a renamed or redated task as it will be, and what it
+// returns is saved and announced by saveEdits.
+func (s *commandStore) modify(ctx context.Context, op string, id, expectedVersion int, edit func(task *models.Task)) error {
+	stored, err := storage.FindTask(ctx, s.Store, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return &storage.TaskError{Op: op, ID: id, Err: storage.ErrNotFound}
+	} else if err != nil {
+		return err
+	}
+	edited := stored
+	edit(&edited)
+	if edited.Description != stored.Description || edited.Due != stored.Due {
+		if edited, err = s.c.beforeModify(ctx, edited); err != nil {
+			return err
+		}
+	}
+	return s.c.saveEdits(ctx, stored, edited, expectedVersion)
+}
+
+func (s *commandStore) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	return s.c.saveMove(ctx, ids, versions, prevID, nextID)
+}
+
+func (s *commandStore) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	return s.c.archiveCompleted(ctx, cutoff)
+}
+
+func (s *commandStore) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
+	return s.DeleteTasks(ctx, map[int]int{id: expectedVersion})
+}
+
+func (s *commandStore) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	// Deleted tasks can't be read back, so they are read first.
+	var deleted []models.Task
+	if len(s.c.listeners) > 0 {
+		tasks, err := s.Store.GetTasks(ctx, models.TaskQuery{})
+		if err != nil {
+			return err
+		}
+		for _, task := range tasks {
+			if _, ok := versions[task.ID]; ok {
+				deleted = append(deleted, task)
+			}
+		}
+	}
+	var err error
+	if len(versions) == 1 {
+		for id, version := range versions {
+			err = s.Store.DeleteTask(ctx, id, version)
+		}
+	} else {
+		err = s.Store.DeleteTasks(ctx, versions)
+	}
+	if err == nil {
+		for _, task := range deleted {
+			s.c.announce(ctx, models.EventDeleted, task)
+		}
+	}
+	return err
+}
+
+// versionIDs returns the task IDs in a version map.
+func versionIDs(versions map[int]int) []int {
+	ids := make([]int, 0, len(versions))
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	return ids
+}
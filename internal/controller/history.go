@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go-todo/internal/models"
+)
+
+// HandleSelectTask shows the history of the task the cursor moved to, or
+// clears it if taskID is 0.
+func (c *AppController) HandleSelectTask(taskID int) {
+	c.historyTask = taskID
+	c.selections++
+	if taskID == 0 {
+		c.ui.ShowTaskHistory(models.Task{}, nil)
+		return
+	}
+
+	var events []models.TaskEvent
+	c.runAsync("Loading history", func(ctx context.Context) error {
+		var err error
+		events, err = c.store.GetTaskHistory(ctx, taskID)
+		return err
+	}, func(err error) {
+		if c.historyTask != taskID {
+			return // the cursor has moved on
+		}
+		if err != nil {
+			log.Printf("Error loading history of task %d: %v", taskID, err)
+			if !errors.Is(err, context.Canceled) {
+				c.ui.ShowError(fmt.Sprintf("Failed to load history of task ID %d: %v", taskID, err))
+			}
+			return
+		}
+		task, _ := c.loadedTask(taskID)
+		c.ui.ShowTaskHistory(task, events)
+	})
+}
+
+// refreshHistory reloads the history shown after the list was reloaded,
+// since the change that caused the reload may have added to it. selections
+// is the count of selections before the reload: if the reload moved the
+// cursor, the UI has already asked for the new task's history.
+func (c *AppController) refreshHistory(selections int) {
+	if c.historyTask != 0 && c.selections == selections {
+		c.HandleSelectTask(c.historyTask)
+	}
+}
+
+// HandleRenameTask asks for a new description for the selected task.
+func (c *AppController) HandleRenameTask() {
+	taskID, selected := c.ui.GetSelectedTaskID()
+	if !selected {
+		log.Println("Rename attempted on invalid or no selection.")
+		return
+	}
+	task, _ := c.loadedTask(taskID)
+
+	c.ui.PromptInput("Rename task", task.Description, func(description string) {
+		if description == "" {
+			c.ui.ShowError("Task description cannot be empty")
+			return
+		}
+		if description == task.Description {
+			return
+		}
+		version := c.taskVersion(taskID)
+		c.runAsync("Renaming task", func(ctx context.Context) error {
+			stored := task
+			stored.ID = taskID
+			edited := stored
+			edited.Description = description
+			edited, err := c.beforeModify(ctx, edited)
+			if err != nil {
+				return err
+			}
+			return c.saveEdits(ctx, stored, edited, version)
+		}, func(err error) {
+			if err != nil {
+				log.Printf("Error renaming task %d: %v", taskID, err)
+				c.handleStoreError(err, fmt.Sprintf("Failed to rename task ID %d: %v", taskID, err))
+				return
+			}
+			c.loadAndDisplayTasks()
+		})
+	})
+}
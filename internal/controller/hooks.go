@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+
+	"go-todo/internal/models"
+)
+
+// Hooks check, and may change, tasks before the additions and edits of
+// the user and of commands are saved, and refuse a change with a
+// *models.RejectedError. They
+// are called off the UI goroutine and limit their own run time, as the
+// store's timeout only applies to store calls.
+type Hooks interface {
+	// BeforeAdd is given a new task, with only its description set, or a
+	// due date too when a command adds it, and returns the task to add.
+	BeforeAdd(ctx context.Context, task models.Task) (models.Task, error)
+	// BeforeModify is given a task as it will be after an edit and
+	// returns the task to save.
+	BeforeModify(ctx context.Context, task models.Task) (models.Task, error)
+}
+
+// SetHooks makes the controller run h before saving changes. It must be
+// called before Start.
+func (c *AppController) SetHooks(h Hooks) {
+	c.hooks = h
+}
+
+// beforeAdd runs the add hook, if any, on a new task.
+func (c *AppController) beforeAdd(ctx context.Context, task models.Task) (models.Task, error) {
+	if c.hooks == nil {
+		return task, nil
+	}
+	return c.hooks.BeforeAdd(ctx, task)
+}
+
+// beforeModify runs the modify hook, if any, on an edited task.
+func (c *AppController) beforeModify(ctx context.Context, task models.Task) (models.Task, error) {
+	if c.hooks == nil {
+		return task, nil
+	}
+	return c.hooks.BeforeModify(ctx, task)
+}
+
+// saveEdits writes the description, due date and status of to over those
+// of from, the task as stored, checked against version, and announces each
+// change. A single change is saved with the call for it; a hook may have
+// made more, which are saved together so that they apply all or not at
+// all.
+func (c *AppController) saveEdits(ctx context.Context, from, to models.Task, version int) error {
+	renamed, redated, toggled := to.Description != from.Description, to.Due != from.Due, to.Done != from.Done
+	var err error
+	switch {
+	case !renamed && !redated && !toggled:
+		return nil
+	case renamed && !redated && !toggled:
+		err = c.store.RenameTask(ctx, from.ID, version, to.Description)
+	case redated && !renamed && !toggled:
+		err = c.store.SetTaskDue(ctx, from.ID, version, to.Due)
+	case toggled && !renamed && !redated:
+		err = c.store.ToggleTaskStatus(ctx, from.ID, version)
+	default:
+		err = c.store.UpdateTask(ctx, from.ID, version, to)
+	}
+	if err != nil {
+		return err
+	}
+	if renamed {
+		c.announceStored(ctx, []int{from.ID}, always(models.EventRenamed))
+	}
+	if redated {
+		c.announceStored(ctx, []int{from.ID}, always(models.EventDueChanged))
+	}
+	if toggled {
+		c.announceStored(ctx, []int{from.ID}, statusEvent)
+	}
+	return nil
+}
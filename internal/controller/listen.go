@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"log"
+
+	"go-todo/internal/models"
+)
+
+// Listener is told about every change the user, or a command, makes to a
+// task once it is saved, e.g. to send webhooks, and ignores the kinds it
+// has no use for. It is called off the UI goroutine, with the task as
+// stored, or as it was last listed for a deleted one, and should return
+// quickly.
+type Listener interface {
+	TaskChanged(ctx context.Context, kind models.EventKind, task models.Task)
+}
+
+// AddListener registers l to be told about changes. It must be called
+// before Start.
+func (c *AppController) AddListener(l Listener) {
+	c.listeners = append(c.listeners, l)
+}
+
+// announce tells every listener about a change.
+func (c *AppController) announce(ctx context.Context, kind models.EventKind, task models.Task) {
+	for _, l := range c.listeners {
+		l.TaskChanged(ctx, kind, task)
+	}
+}
+
+// announceStored reads the tasks with the given IDs back from the store and
+// announces each with the event kind returns for it. Failing to read them
+// is only logged, as the change itself was saved.
+func (c *AppController) announceStored(ctx context.Context, ids []int, kind func(models.Task) models.EventKind) {
+	if len(c.listeners) == 0 {
+		return
+	}
+	tasks, err := c.store.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		log.Printf("Error reading changed tasks for listeners: %v", err)
+		return
+	}
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	for _, task := range tasks {
+		if wanted[task.ID] {
+			c.announce(ctx, kind(task), task)
+		}
+	}
+}
+
+// always returns an event kind func that ignores the task.
+func always(kind models.EventKind) func(models.Task) models.EventKind {
+	return func(models.Task) models.EventKind { return kind }
+}
+
+// statusEvent tells a completed task from a reopened one.
+func statusEvent(task models.Task) models.EventKind {
+	if task.Done {
+		return models.EventCompleted
+	}
+	return models.EventReopened
+}
+
+// loadedTasks returns the tasks with the given IDs as last loaded, falling
+// back to just the ID for any not in the list.
+func (c *AppController) loadedTasks(ids []int) []models.Task {
+	tasks := make([]models.Task, 0, len(ids))
+	for _, id := range ids {
+		task, ok := c.loadedTask(id)
+		if !ok {
+			task = models.Task{ID: id}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
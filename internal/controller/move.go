@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go-todo/internal/models"
+)
+
+// HandleMoveUp moves the marked tasks, or the selected task if none are
+// marked, one place up within their group.
+func (c *AppController) HandleMoveUp() {
+	c.moveSelection(false)
+}
+
+// HandleMoveDown moves the marked tasks, or the selected task if none are
+// marked, one place down within their group.
+func (c *AppController) HandleMoveDown() {
+	c.moveSelection(true)
+}
+
+// HandleMoveTaskTo moves a task to where targetID currently is, as when
+// dragging it there with the mouse.
+func (c *AppController) HandleMoveTaskTo(taskID, targetID int) {
+	if taskID == targetID || !c.canMove() {
+		return
+	}
+	task, ok := c.loadedTask(taskID)
+	if !ok {
+		return
+	}
+	query := c.query()
+	target, ok := c.loadedTask(targetID)
+	if !ok || query.Section(target) != query.Section(task) {
+		log.Printf("Cannot move task %d next to task %d in another group.", taskID, targetID)
+		return
+	}
+
+	group := c.section(query.Section(task))
+	moved := map[int]bool{taskID: true}
+	// Dropping onto a task further down places the task after it, dropping
+	// onto one further up places it before.
+	after := indexOf(group, targetID) > indexOf(group, taskID)
+	prevID, nextID := neighbours(group, moved, targetID, after)
+	c.moveTasks([]int{taskID}, prevID, nextID)
+}
+
+// moveSelection moves the marked or selected tasks past the next task in
+// the given direction.
+func (c *AppController) moveSelection(down bool) {
+	if !c.canMove() {
+		return
+	}
+	ids := c.ui.GetMarkedTaskIDs()
+	if len(ids) == 0 {
+		taskID, selected := c.ui.GetSelectedTaskID()
+		if !selected {
+			log.Println("Move attempted on invalid or no selection.")
+			return
+		}
+		ids = []int{taskID}
+	}
+
+	first, ok := c.loadedTask(ids[0])
+	if !ok {
+		return
+	}
+	query := c.query()
+	moved := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		task, ok := c.loadedTask(id)
+		if !ok {
+			return
+		}
+		if query.Section(task) != query.Section(first) {
+			if query.Group == models.GroupStatus {
+				c.ui.ShowError("Open and done tasks cannot be moved together")
+			} else {
+				c.ui.ShowError("Tasks in different groups cannot be moved together")
+			}
+			return
+		}
+		moved[id] = true
+	}
+
+	// The anchor is the first unmoved task past the moved block; the block
+	// is placed on its far side.
+	group := c.section(query.Section(first))
+	anchorID := 0
+	if down {
+		for i := indexOf(group, ids[len(ids)-1]) + 1; i < len(group); i++ {
+			if !moved[group[i].ID] {
+				anchorID = group[i].ID
+				break
+			}
+		}
+	} else {
+		for i := indexOf(group, ids[0]) - 1; i >= 0; i-- {
+			if !moved[group[i].ID] {
+				anchorID = group[i].ID
+				break
+			}
+		}
+	}
+	if anchorID == 0 {
+		return // already at the edge of the group
+	}
+
+	prevID, nextID := neighbours(group, moved, anchorID, down)
+	c.moveTasks(ids, prevID, nextID)
+}
+
+// moveTasks persists a move and reloads the list.
+func (c *AppController) moveTasks(ids []int, prevID, nextID int) {
+	versions := c.markedVersions(ids)
+	c.runAsync("Moving tasks", func(ctx context.Context) error {
+		return c.saveMove(ctx, ids, versions, prevID, nextID)
+	}, func(err error) {
+		if err != nil {
+			log.Printf("Error moving %d tasks: %v", len(ids), err)
+			c.handleStoreError(err, fmt.Sprintf("Failed to move %s: %v", pluralTasks(len(ids)), err))
+			return
+		}
+		c.loadAndDisplayTasks()
+	})
+}
+
+// saveMove moves tasks in the store and announces each.
+func (c *AppController) saveMove(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	if err := c.store.MoveTasks(ctx, ids, versions, prevID, nextID); err != nil {
+		return err
+	}
+	c.announceStored(ctx, ids, always(models.EventMoved))
+	return nil
+}
+
+// loadedTask finds a task in the list as last loaded.
+func (c *AppController) loadedTask(id int) (models.Task, bool) {
+	for _, task := range c.tasks {
+		if task.ID == id {
+			return task, true
+		}
+	}
+	return models.Task{}, false
+}
+
+// canMove reports whether tasks can be reordered by hand, which is only the
+// case when the list is in manual order.
+func (c *AppController) canMove() bool {
+	if c.query().Sort != models.SortManual {
+		c.ui.ShowError("Switch to manual sort to reorder tasks")
+		return false
+	}
+	return true
+}
+
+// section returns the loaded tasks in the given section of the current view,
+// in display order. Moves never cross between sections.
+func (c *AppController) section(key string) []models.Task {
+	query := c.query()
+	var group []models.Task
+	for _, task := range c.tasks {
+		if query.Section(task) == key {
+			group = append(group, task)
+		}
+	}
+	return group
+}
+
+func indexOf(tasks []models.Task, id int) int {
+	for i, task := range tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// neighbours returns the tasks that will surround the moved tasks once they
+// are placed before (or after) anchorID. 0 stands for the edge of the group.
+func neighbours(group []models.Task, moved map[int]bool, anchorID int, after bool) (prevID, nextID int) {
+	var remaining []models.Task
+	for _, task := range group {
+		if !moved[task.ID] {
+			remaining = append(remaining, task)
+		}
+	}
+	k := indexOf(remaining, anchorID)
+	if after {
+		prevID = anchorID
+		if k+1 < len(remaining) {
+			nextID = remaining[k+1].ID
+		}
+	} else {
+		nextID = anchorID
+		if k > 0 {
+			prevID = remaining[k-1].ID
+		}
+	}
+	return prevID, nextID
+}
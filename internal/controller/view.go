@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go-todo/internal/config"
+	"go-todo/internal/models"
+)
+
+// sortLabels and groupLabels name the view modes in menus.
+var sortLabels = map[models.SortMode]string{
+	models.SortManual:       "Manual",
+	models.SortCreated:      "Newest first",
+	models.SortUpdated:      "Recently updated",
+	models.SortAlphabetical: "Alphabetical",
+	models.SortDue:          "Due date",
+}
+
+var groupLabels = map[models.GroupMode]string{
+	models.GroupStatus:     "Open / Done",
+	models.GroupCreatedDay: "Day created",
+	models.GroupNone:       "No grouping",
+}
+
+// SetConfig sets the user preferences the list view starts with. Changes
+// made through the sort and group menus are saved back to path, unless path
+// is empty.
+func (c *AppController) SetConfig(cfg *config.Config, path string) {
+	c.config = cfg
+	c.configPath = path
+}
+
+// query returns the current list view.
+func (c *AppController) query() models.TaskQuery {
+	return c.config.Query()
+}
+
+// HandleChooseSort lets the user pick how tasks are ordered within a group.
+func (c *AppController) HandleChooseSort() {
+	options := make([]string, len(models.SortModes))
+	current := 0
+	for i, mode := range models.SortModes {
+		options[i] = sortLabels[mode]
+		if mode == c.query().Sort {
+			current = i
+		}
+	}
+	c.ui.ShowMenu("Sort by", options, current, func(index int) {
+		c.config.Sort = models.SortModes[index]
+		c.applyView()
+	})
+}
+
+// HandleChooseGroup lets the user pick how tasks are split into sections.
+func (c *AppController) HandleChooseGroup() {
+	options := make([]string, len(models.GroupModes))
+	current := 0
+	for i, mode := range models.GroupModes {
+		options[i] = groupLabels[mode]
+		if mode == c.query().Group {
+			current = i
+		}
+	}
+	c.ui.ShowMenu("Group by", options, current, func(index int) {
+		c.config.Group = models.GroupModes[index]
+		c.applyView()
+	})
+}
+
+// applyView saves the chosen view and reloads the list with it.
+func (c *AppController) applyView() {
+	if c.configPath != "" {
+		if err := c.config.Save(c.configPath); err != nil {
+			log.Printf("Error saving config: %v", err)
+			c.ui.ShowError(fmt.Sprintf("Failed to save view settings: %v", err))
+		}
+	}
+	c.ui.SetView(c.query())
+	c.loadAndDisplayTasks()
+}
+
+// HandleSetDue asks for a due date for the selected task. An empty answer
+// clears it.
+func (c *AppController) HandleSetDue() {
+	taskID, selected := c.ui.GetSelectedTaskID()
+	if !selected {
+		log.Println("Set due date attempted on invalid or no selection.")
+		return
+	}
+	task, _ := c.loadedTask(taskID)
+
+	c.ui.PromptInput("Due date (YYYY-MM-DD, empty to clear)", task.Due, func(due string) {
+		version := c.taskVersion(taskID)
+		c.runAsync("Updating task", func(ctx context.Context) error {
+			stored := task
+			stored.ID = taskID
+			edited := stored
+			edited.Due = due
+			edited, err := c.beforeModify(ctx, edited)
+			if err != nil {
+				return err
+			}
+			return c.saveEdits(ctx, stored, edited, version)
+		}, func(err error) {
+			if err != nil {
+				log.Printf("Error setting due date of task %d: %v", taskID, err)
+				c.handleStoreError(err, fmt.Sprintf("Failed to set due date of task ID %d: %v", taskID, err))
+				return
+			}
+			c.loadAndDisplayTasks()
+		})
+	})
+}
@@ -0,0 +1,315 @@
+// Package crdt syncs the tasks of a database through a shared folder, such
+// as one kept in step by Syncthing or Dropbox, without a server or a
+// common history. Each install is a replica that records its changes as
+// operations on a conflict-free replicated set of tasks: the set itself is
+// an OR-set, and every task field a last-writer-wins register. Replicas only
+// ever append to a file of their own, and reading all the files in any order
+// gives every replica the same tasks.
+package crdt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// stateMetaKey holds the store's sync state.
+const stateMetaKey = "crdt_sync"
+
+// timestampLayout is the layout of task timestamps, which are in UTC.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// Interval is how often a running application records its changes.
+const Interval = 30 * time.Second
+
+// ReplicaFile is the name of the file, beside the config file, that holds
+// the replica ID of an install.
+const ReplicaFile = "replica-id"
+
+// ReplicaID returns the ID of this install, kept in the file at path, and
+// creates one if there is none. The ID lives outside the database so that
+// two copies of one database still count as different replicas.
+func ReplicaID(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("reading replica ID: %w", err)
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("creating replica ID: %w", err)
+	}
+	id := hex.EncodeToString(b)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("saving replica ID: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("saving replica ID: %w", err)
+	}
+	return id, nil
+}
+
+// syncState is what a store remembers between syncs.
+type syncState struct {
+	// IDs maps the replicated ID of each task to its ID in this store.
+	IDs map[string]int `json:"ids"`
+	// Synced holds the fields of each task as the store last had them
+	// after a sync; anything different since is a local change.
+	Synced map[string]map[string]string `json:"synced"`
+	// Clock is the latest op time the store has seen applied. Changes made
+	// since are dated no earlier, so they win over everything they saw.
+	Clock int64 `json:"clock"`
+}
+
+// Syncer syncs a store with the op files in Dir.
+type Syncer struct {
+	Dir     string
+	Store   storage.Backend
+	Replica string
+	// now is the wall clock for op times; tests replace it.
+	now func() time.Time
+}
+
+// New returns a syncer for the shared folder dir, writing as replica.
+func New(dir string, store storage.Backend, replica string) (*Syncer, error) {
+	if replica == "" || strings.ContainsAny(replica, `/\:`) {
+		return nil, fmt.Errorf("invalid replica ID %q", replica)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", dir, err)
+	}
+	return &Syncer{Dir: abs, Store: store, Replica: replica, now: time.Now}, nil
+}
+
+// load reads the store's sync state. A store that was never synced gets
+// replicated IDs derived from its tasks, so that copies of one database made
+// before their first sync agree on those still unchanged and do not
+// duplicate them. Such copies cannot tell deletions apart from tasks the
+// other never had, though, so a database should be synced before copying.
+func (s *Syncer) load(ctx context.Context, tasks []models.Task) (*syncState, error) {
+	value, err := s.Store.GetMeta(ctx, stateMetaKey)
+	if err != nil {
+		return nil, err
+	}
+	st := &syncState{IDs: make(map[string]int), Synced: make(map[string]map[string]string)}
+	if value == "" {
+		for _, task := range tasks {
+			sum := sha256.Sum256([]byte(strconv.Itoa(task.ID) + "\x00" + task.CreatedAt + "\x00" + task.Description))
+			st.IDs["init:"+hex.EncodeToString(sum[:8])] = task.ID
+		}
+		return st, nil
+	}
+	if err := json.Unmarshal([]byte(value), st); err != nil {
+		return nil, fmt.Errorf("reading sync state: %w", err)
+	}
+	return st, nil
+}
+
+func (s *Syncer) save(ctx context.Context, st *syncState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("saving sync state: %w", err)
+	}
+	return s.Store.SetMeta(ctx, stateMetaKey, string(data))
+}
+
+// Sync records the store's changes since the last sync as ops, then applies
+// the ops of every replica to the store, so it holds the merged tasks.
+func (s *Syncer) Sync(ctx context.Context) error {
+	return s.sync(ctx, true)
+}
+
+// Record only writes the store's changes as ops, without applying those of
+// other replicas. It is for use while the application runs, when replacing
+// the tasks under it would undo edits made in the meantime.
+func (s *Syncer) Record(ctx context.Context) error {
+	return s.sync(ctx, false)
+}
+
+func (s *Syncer) sync(ctx context.Context, apply bool) error {
+	if err := storage.RequirePlaintext(ctx, s.Store, "folder sync"); err != nil {
+		return err
+	}
+	ops, err := readOps(s.Dir)
+	if err != nil {
+		return err
+	}
+	shared := newState()
+	for _, op := range ops {
+		shared.apply(op)
+	}
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		return err
+	}
+	st, err := s.load(ctx, tasks)
+	if err != nil {
+		return err
+	}
+
+	ours := s.diff(shared, st, tasks)
+	if err := appendOps(s.Dir, s.Replica, ours); err != nil {
+		return err
+	}
+	for _, op := range ours {
+		shared.apply(op)
+		st.Clock = max(st.Clock, op.At)
+	}
+	if !apply {
+		return s.save(ctx, st)
+	}
+
+	merged := s.materialize(shared, st, tasks)
+	if err := s.Store.ReplaceTasks(ctx, merged, nil); err != nil {
+		return fmt.Errorf("saving merged tasks: %w", err)
+	}
+	return s.save(ctx, st)
+}
+
+// diff returns ops for what changed in tasks since the last sync, and
+// updates st to match tasks.
+func (s *Syncer) diff(shared *state, st *syncState, tasks []models.Task) []Op {
+	var ops []Op
+	op := func(kind, task string, edited time.Time) Op {
+		// A hybrid logical clock: when the change was made, but later than
+		// anything the store had seen, so it overrides what it saw even if
+		// this machine's clock is slow. Concurrent changes are ordered by
+		// when they were made, not when they were synced.
+		at := max(edited.UnixMilli(), st.Clock+1)
+		shared.seq[s.Replica]++
+		return Op{Replica: s.Replica, Seq: shared.seq[s.Replica], At: at, Kind: kind, Task: task}
+	}
+
+	uids := make(map[int]string, len(st.IDs))
+	for uid, id := range st.IDs {
+		uids[id] = uid
+	}
+	seen := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		fields := fieldsOf(task)
+		uid, known := uids[task.ID]
+		synced := st.Synced[uid]
+		var changed []string
+		for _, name := range sortedKeys(fields) {
+			if old, ok := synced[name]; !ok || old != fields[name] {
+				changed = append(changed, name)
+			}
+		}
+		if len(changed) == 0 {
+			seen[uid] = true
+			continue
+		}
+		edited, err := time.ParseInLocation(timestampLayout, task.UpdatedAt, time.UTC)
+		if err != nil {
+			edited = s.now()
+		}
+		add := op(opAdd, uid, edited)
+		if !known {
+			// A new task is named after the op that adds it.
+			uid = add.tag()
+			add.Task = uid
+			st.IDs[uid] = task.ID
+		}
+		seen[uid] = true
+		ops = append(ops, add)
+		for _, name := range changed {
+			set := op(opSet, uid, edited)
+			set.Field, set.Value = name, fields[name]
+			ops = append(ops, set)
+		}
+		st.Synced[uid] = fields
+	}
+	for _, uid := range sortedKeys(st.IDs) {
+		if seen[uid] {
+			continue
+		}
+		// Deleted here: remove the adds seen so far. Adds made elsewhere
+		// since then are not removed, so a concurrent edit keeps the task.
+		remove := op(opRemove, uid, s.now())
+		remove.Tags = shared.tags(uid)
+		ops = append(ops, remove)
+		delete(st.IDs, uid)
+		delete(st.Synced, uid)
+	}
+	return ops
+}
+
+// materialize returns the replicated tasks with their IDs in this store, and
+// updates st to match them. Tasks new to the store get IDs after the highest
+// it has used.
+func (s *Syncer) materialize(shared *state, st *syncState, tasks []models.Task) []models.Task {
+	next := 0
+	for _, task := range tasks {
+		next = max(next, task.ID)
+	}
+	for _, id := range st.IDs {
+		next = max(next, id)
+	}
+
+	var merged []models.Task
+	ids := make(map[string]int)
+	synced := make(map[string]map[string]string)
+	for _, uid := range sortedKeys(shared.tasks) {
+		if !shared.present(uid) {
+			continue
+		}
+		fields := shared.fields(uid)
+		// The rest of its ops may still be on their way to this folder.
+		if _, ok := fields["description"]; !ok {
+			continue
+		}
+		task := taskFrom(fields)
+		id, ok := st.IDs[uid]
+		if !ok {
+			next++
+			id = next
+		}
+		task.ID = id
+		ids[uid] = id
+		synced[uid] = fieldsOf(task)
+		merged = append(merged, task)
+	}
+	st.IDs, st.Synced = ids, synced
+	st.Clock = max(st.Clock, shared.clock)
+	return merged
+}
+
+// Run records the store's changes every interval until ctx is cancelled,
+// and once more on the way out.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the final record needs its own deadline.
+			final, cancel := context.WithTimeout(context.Background(), interval)
+			if err := s.Record(final); err != nil {
+				log.Printf("Folder sync: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := s.Record(ctx); err != nil {
+				log.Printf("Folder sync: %v", err)
+			}
+		}
+	}
+}
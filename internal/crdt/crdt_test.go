@@ -0,0 +1,274 @@
+package crdt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newReplica returns a syncer for dir with an empty store of its own.
+func newReplica(t *testing.T, dir, replica string) *Syncer {
+	t.Helper()
+	s, err := New(dir, storage.NewMemoryStore(), replica)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+// copyStore gives to the tasks and sync state of from, as if the database
+// had been copied.
+func copyStore(t *testing.T, from, to *Syncer) {
+	t.Helper()
+	tasks, err := storage.ExportTasks(ctx, from.Store)
+	if err != nil {
+		t.Fatalf("Reading tasks: %v", err)
+	}
+	if err := to.Store.ReplaceTasks(ctx, tasks, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+	value, _ := from.Store.GetMeta(ctx, stateMetaKey)
+	if err := to.Store.SetMeta(ctx, stateMetaKey, value); err != nil {
+		t.Fatalf("SetMeta failed: %v", err)
+	}
+}
+
+// edit overwrites a task with the given description and updated_at, so
+// tests control which edit is later.
+func edit(t *testing.T, s *Syncer, id int, description, updatedAt string) {
+	t.Helper()
+	tasks, _ := storage.ExportTasks(ctx, s.Store)
+	for i := range tasks {
+		if tasks[i].ID == id {
+			tasks[i].Description = description
+			tasks[i].UpdatedAt = updatedAt
+		}
+	}
+	if err := s.Store.ReplaceTasks(ctx, tasks, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+}
+
+func mustSync(t *testing.T, s *Syncer) {
+	t.Helper()
+	if err := s.Sync(ctx); err != nil {
+		t.Fatalf("Sync on %s failed: %v", s.Replica, err)
+	}
+}
+
+// summary lists the tasks of s by description and status, leaving out the
+// IDs, which differ between stores.
+func summary(t *testing.T, s *Syncer) []string {
+	t.Helper()
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		t.Fatalf("Reading tasks: %v", err)
+	}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, fmt.Sprintf("%s done=%v", task.Description, task.Done))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func findID(t *testing.T, s *Syncer, description string) int {
+	t.Helper()
+	tasks, _ := storage.ExportTasks(ctx, s.Store)
+	for _, task := range tasks {
+		if task.Description == description {
+			return task.ID
+		}
+	}
+	t.Fatalf("Task %q not in %s", description, s.Replica)
+	return 0
+}
+
+func TestSync_CopiesConverge(t *testing.T) {
+	dir := t.TempDir()
+	laptop := newReplica(t, dir, "laptop")
+	desktop := newReplica(t, dir, "desktop")
+	laptop.Store.AddTask(ctx, "Write report")
+	laptop.Store.AddTask(ctx, "Buy milk")
+	mustSync(t, laptop)
+	copyStore(t, laptop, desktop)
+
+	// Both copies are edited offline, including a new task on each with
+	// the same local ID.
+	laptop.Store.RenameTask(ctx, findID(t, laptop, "Write report"), 0, "Write the report")
+	laptop.Store.AddTask(ctx, "New on laptop")
+	desktop.Store.ToggleTaskStatus(ctx, findID(t, desktop, "Write report"), 0)
+	desktop.Store.DeleteTask(ctx, findID(t, desktop, "Buy milk"), 0)
+	desktop.Store.AddTask(ctx, "New on desktop")
+
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+
+	want := []string{"New on desktop done=false", "New on laptop done=false", "Write the report done=true"}
+	if got := summary(t, laptop); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v on laptop, got %v", want, got)
+	}
+	if got := summary(t, desktop); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v on desktop, got %v", want, got)
+	}
+}
+
+func TestSync_LaterWriteWins(t *testing.T) {
+	dir := t.TempDir()
+	laptop := newReplica(t, dir, "laptop")
+	desktop := newReplica(t, dir, "desktop")
+	laptop.Store.AddTask(ctx, "Call ACME")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	// The desktop's edit is the later one, though it syncs first.
+	edit(t, desktop, findID(t, desktop, "Call ACME"), "Call ACME on Tuesday", "2099-10-01 11:00:00")
+	edit(t, laptop, findID(t, laptop, "Call ACME"), "Call ACME on Monday", "2099-10-01 10:00:00")
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	want := []string{"Call ACME on Tuesday done=false"}
+	for _, s := range []*Syncer{laptop, desktop} {
+		if got := summary(t, s); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v on %s, got %v", want, s.Replica, got)
+		}
+	}
+}
+
+func TestSync_EditBeatsDelete(t *testing.T) {
+	dir := t.TempDir()
+	laptop := newReplica(t, dir, "laptop")
+	desktop := newReplica(t, dir, "desktop")
+	laptop.Store.AddTask(ctx, "Keep me")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	laptop.Store.DeleteTask(ctx, findID(t, laptop, "Keep me"), 0)
+	desktop.Store.RenameTask(ctx, findID(t, desktop, "Keep me"), 0, "Keep me, edited")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+
+	want := []string{"Keep me, edited done=false"}
+	for _, s := range []*Syncer{laptop, desktop} {
+		if got := summary(t, s); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %v on %s, got %v", want, s.Replica, got)
+		}
+	}
+
+	// A delete that saw every edit removes the task everywhere.
+	desktop.Store.DeleteTask(ctx, findID(t, desktop, "Keep me, edited"), 0)
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+	if got := summary(t, laptop); len(got) != 0 {
+		t.Errorf("Expected the task deleted on laptop, got %v", got)
+	}
+}
+
+func TestSync_WritesNothingWithoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	laptop := newReplica(t, dir, "laptop")
+	laptop.Store.AddTask(ctx, "a")
+	mustSync(t, laptop)
+	path := filepath.Join(dir, "laptop"+fileSuffix)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading op file: %v", err)
+	}
+
+	mustSync(t, laptop)
+	if err := laptop.Record(ctx); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("Expected no new ops, got %q", after[len(before):])
+	}
+}
+
+func TestRecord_LeavesStoreAlone(t *testing.T) {
+	dir := t.TempDir()
+	laptop := newReplica(t, dir, "laptop")
+	desktop := newReplica(t, dir, "desktop")
+	laptop.Store.AddTask(ctx, "From laptop")
+	mustSync(t, laptop)
+
+	desktop.Store.AddTask(ctx, "From desktop")
+	if err := desktop.Record(ctx); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if got := summary(t, desktop); len(got) != 1 {
+		t.Errorf("Expected Record not to apply other ops, got %v", got)
+	}
+	mustSync(t, laptop)
+	if got := summary(t, laptop); len(got) != 2 {
+		t.Errorf("Expected the recorded task on laptop, got %v", got)
+	}
+}
+
+func TestState_OrderDoesNotMatter(t *testing.T) {
+	ops := []Op{
+		{Replica: "a", Seq: 1, At: 1, Kind: opAdd, Task: "a:1"},
+		{Replica: "a", Seq: 2, At: 2, Kind: opSet, Task: "a:1", Field: "description", Value: "first"},
+		{Replica: "b", Seq: 1, At: 2, Kind: opSet, Task: "a:1", Field: "description", Value: "tie"},
+		{Replica: "b", Seq: 2, At: 3, Kind: opRemove, Task: "a:1", Tags: []string{"a:1"}},
+		{Replica: "a", Seq: 3, At: 4, Kind: opAdd, Task: "a:1"},
+	}
+	forward, backward := newState(), newState()
+	for i := range ops {
+		forward.apply(ops[i])
+		backward.apply(ops[len(ops)-1-i])
+	}
+	// Replaying an op changes nothing either.
+	backward.apply(ops[2])
+	for _, s := range []*state{forward, backward} {
+		if !s.present("a:1") {
+			t.Error("Expected the later add to survive the remove")
+		}
+		if got := s.fields("a:1")["description"]; got != "tie" {
+			t.Errorf("Expected the tie to go to the higher replica, got %q", got)
+		}
+	}
+}
+
+func TestReplicaID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "go-todo", "replica-id")
+	id, err := ReplicaID(path)
+	if err != nil {
+		t.Fatalf("ReplicaID failed: %v", err)
+	}
+	if len(id) != 16 {
+		t.Errorf("Expected a 16 character ID, got %q", id)
+	}
+	if again, _ := ReplicaID(path); again != id {
+		t.Errorf("Expected the same ID again, got %q and %q", id, again)
+	}
+}
+
+func TestSync_RejectsEncryptedStore(t *testing.T) {
+	laptop := newReplica(t, t.TempDir(), "laptop")
+	store, err := storage.EnableEncryption(ctx, laptop.Store, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	laptop.Store = store
+	if err := laptop.Sync(ctx); err == nil {
+		t.Error("Expected an encrypted store to be refused")
+	}
+}
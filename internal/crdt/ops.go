@@ -0,0 +1,168 @@
+package crdt
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-todo/internal/models"
+)
+
+// Op kinds.
+const (
+	// opAdd adds a tag to a task's OR-set entry, making it present. It is
+	// sent when a task is created and again with every edit, so an edit
+	// survives a concurrent delete that never saw it.
+	opAdd = "add"
+	// opRemove removes the tags its replica had seen for a task.
+	opRemove = "remove"
+	// opSet writes one field of a task, a last-writer-wins register.
+	opSet = "set"
+)
+
+// Op is one change to the replicated task set. Each replica appends its ops
+// to a file of its own, so files never conflict in a shared folder.
+type Op struct {
+	Replica string `json:"replica"`
+	// Seq numbers the ops of one replica; replica and seq together are the
+	// tag of an add.
+	Seq int64 `json:"seq"`
+	// At is the hybrid logical clock reading when the op was made. Later
+	// writes win, with the replica ID breaking ties.
+	At    int64    `json:"at"`
+	Kind  string   `json:"kind"`
+	Task  string   `json:"task"`
+	Tags  []string `json:"tags,omitempty"`
+	Field string   `json:"field,omitempty"`
+	Value string   `json:"value,omitempty"`
+}
+
+// tag identifies an add op.
+func (op Op) tag() string {
+	return op.Replica + ":" + strconv.FormatInt(op.Seq, 10)
+}
+
+// fileSuffix ends the name of every op file.
+const fileSuffix = ".jsonl"
+
+// readOps reads the op files of every replica in dir. A line that does not
+// parse is skipped: it may be a write still being copied by whatever keeps
+// the folder in sync, and will be read in full next time.
+func readOps(dir string) ([]Op, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, err)
+	}
+	var ops []Op
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileSuffix) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading ops: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var op Op
+			if err := json.Unmarshal(scanner.Bytes(), &op); err != nil || op.Replica == "" {
+				log.Printf("Folder sync: skipping unreadable op in %s", entry.Name())
+				continue
+			}
+			ops = append(ops, op)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", entry.Name(), err)
+		}
+	}
+	return ops, nil
+}
+
+// appendOps adds ops to the file of replica in dir and syncs it to disk.
+func appendOps(dir, replica string, ops []Op) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, replica+fileSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening op file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, op := range ops {
+		data, err := json.Marshal(op)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encoding op: %w", err)
+		}
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing ops: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing ops: %w", err)
+	}
+	return f.Close()
+}
+
+// fieldsOf returns the replicated fields of a task as strings. The ID and
+// version are local to each database and not replicated.
+func fieldsOf(t models.Task) map[string]string {
+	return map[string]string{
+		"description":  t.Description,
+		"done":         strconv.FormatBool(t.Done),
+		"created_at":   t.CreatedAt,
+		"updated_at":   t.UpdatedAt,
+		"position":     strconv.FormatFloat(t.Position, 'g', -1, 64),
+		"due":          t.Due,
+		"completed_at": t.CompletedAt,
+		"archived_at":  t.ArchivedAt,
+	}
+}
+
+// taskFrom builds a task from replicated fields.
+func taskFrom(fields map[string]string) models.Task {
+	done, _ := strconv.ParseBool(fields["done"])
+	position, _ := strconv.ParseFloat(fields["position"], 64)
+	return models.Task{
+		Description: fields["description"],
+		Done:        done,
+		CreatedAt:   fields["created_at"],
+		UpdatedAt:   fields["updated_at"],
+		Position:    position,
+		Due:         fields["due"],
+		CompletedAt: fields["completed_at"],
+		ArchivedAt:  fields["archived_at"],
+	}
+}
+
+// sortedKeys returns the keys of m in order, so ops are made
+// deterministically.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
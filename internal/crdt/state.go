@@ -0,0 +1,96 @@
+package crdt
+
+// register is a last-writer-wins value.
+type register struct {
+	value   string
+	at      int64
+	replica string
+}
+
+// newer reports whether a write at (at, replica) beats r.
+func (r register) newer(at int64, replica string) bool {
+	return at > r.at || (at == r.at && replica > r.replica)
+}
+
+// element is one task in the OR-set.
+type element struct {
+	tags   map[string]bool
+	fields map[string]register
+}
+
+// state is the replicated task set folded from ops. Applying the same ops
+// in any order, any number of times, gives the same state.
+type state struct {
+	tasks map[string]*element
+	// removed holds every tag some replica removed.
+	removed map[string]bool
+	// clock is the latest op time seen, and seq the latest seq of each
+	// replica.
+	clock int64
+	seq   map[string]int64
+}
+
+func newState() *state {
+	return &state{tasks: make(map[string]*element), removed: make(map[string]bool), seq: make(map[string]int64)}
+}
+
+func (s *state) element(task string) *element {
+	e, ok := s.tasks[task]
+	if !ok {
+		e = &element{tags: make(map[string]bool), fields: make(map[string]register)}
+		s.tasks[task] = e
+	}
+	return e
+}
+
+func (s *state) apply(op Op) {
+	s.clock = max(s.clock, op.At)
+	s.seq[op.Replica] = max(s.seq[op.Replica], op.Seq)
+	e := s.element(op.Task)
+	switch op.Kind {
+	case opAdd:
+		e.tags[op.tag()] = true
+	case opRemove:
+		for _, tag := range op.Tags {
+			s.removed[tag] = true
+		}
+	case opSet:
+		if r, ok := e.fields[op.Field]; !ok || r.newer(op.At, op.Replica) {
+			e.fields[op.Field] = register{value: op.Value, at: op.At, replica: op.Replica}
+		}
+	}
+}
+
+// present reports whether a task has an add that was never removed.
+func (s *state) present(task string) bool {
+	e, ok := s.tasks[task]
+	if !ok {
+		return false
+	}
+	for tag := range e.tags {
+		if !s.removed[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+// tags returns the tags seen for a task, for a remove op to cancel.
+func (s *state) tags(task string) []string {
+	e, ok := s.tasks[task]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(e.tags)
+}
+
+// fields returns the current field values of a task.
+func (s *state) fields(task string) map[string]string {
+	fields := make(map[string]string)
+	if e, ok := s.tasks[task]; ok {
+		for name, r := range e.fields {
+			fields[name] = r.value
+		}
+	}
+	return fields
+}
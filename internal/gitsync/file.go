@@ -0,0 +1,76 @@
+package gitsync
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-todo/internal/models"
+)
+
+// FileName is the file in the repository that holds the tasks.
+const FileName = "tasks.jsonl"
+
+// line is how one task is written to the file. The local version counter is
+// left out: it only guards against concurrent writers of one database.
+type line struct {
+	ID          int     `json:"id"`
+	Description string  `json:"description"`
+	Done        bool    `json:"done"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+	Position    float64 `json:"position"`
+	Due         string  `json:"due,omitempty"`
+	CompletedAt string  `json:"completed_at,omitempty"`
+	ArchivedAt  string  `json:"archived_at,omitempty"`
+}
+
+// Encode writes tasks one JSON object per line, ordered by ID, so the file
+// is the same for the same tasks and a change to a task touches one line.
+func Encode(tasks []models.Task) ([]byte, error) {
+	sorted := append([]models.Task(nil), tasks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	var buf bytes.Buffer
+	for _, t := range sorted {
+		data, err := json.Marshal(line{
+			ID: t.ID, Description: t.Description, Done: t.Done,
+			CreatedAt: t.CreatedAt, UpdatedAt: t.UpdatedAt, Position: t.Position,
+			Due: t.Due, CompletedAt: t.CompletedAt, ArchivedAt: t.ArchivedAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("encoding task %d: %w", t.ID, err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads a file written by Encode. Blank lines are ignored.
+func Decode(data []byte) ([]models.Task, error) {
+	var tasks []models.Task
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var l line
+		if err := json.Unmarshal([]byte(text), &l); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", FileName, n, err)
+		}
+		tasks = append(tasks, models.Task{
+			ID: l.ID, Description: l.Description, Done: l.Done,
+			CreatedAt: l.CreatedAt, UpdatedAt: l.UpdatedAt, Position: l.Position,
+			Due: l.Due, CompletedAt: l.CompletedAt, ArchivedAt: l.ArchivedAt,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", FileName, err)
+	}
+	return tasks, nil
+}
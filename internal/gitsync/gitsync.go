@@ -0,0 +1,275 @@
+// Package gitsync keeps the tasks of a database in step with a git
+// repository, so several machines can share them through any git remote
+// without a server of their own.
+package gitsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// syncedMetaKey records which repository a database was last synced with.
+// Until it is set, nothing in the repository counts as deleted by us.
+const syncedMetaKey = "git_sync"
+
+// Interval is how often a running application syncs.
+const Interval = 30 * time.Second
+
+// Syncer syncs a store with the git working copy in Dir.
+type Syncer struct {
+	Dir   string
+	Store storage.Backend
+	// Host names this machine in commit messages.
+	Host string
+}
+
+// New returns a syncer for the working copy at dir.
+func New(dir string, store storage.Backend) (*Syncer, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", dir, err)
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "unknown host"
+	}
+	return &Syncer{Dir: abs, Store: store, Host: host}, nil
+}
+
+// git runs a git command in the working copy and returns its output.
+func (s *Syncer) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", s.Dir}, args...)...)
+	// Commits are made as the user if git knows who they are, and as
+	// go-todo otherwise.
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"EMAIL=go-todo@"+s.Host)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// ok runs a git command used as a test, reporting whether it succeeded.
+func (s *Syncer) ok(ctx context.Context, args ...string) bool {
+	_, err := s.git(ctx, args...)
+	return err == nil
+}
+
+// read returns the tasks in the file at commit, or none if the file does
+// not exist there.
+func (s *Syncer) read(ctx context.Context, commit string) ([]models.Task, error) {
+	if !s.ok(ctx, "cat-file", "-e", commit+":"+FileName) {
+		return nil, nil
+	}
+	data, err := s.git(ctx, "show", commit+":"+FileName)
+	if err != nil {
+		return nil, err
+	}
+	return Decode([]byte(data))
+}
+
+// remote returns the remote and branch to sync with. The remote is empty
+// when the working copy has none, in which case changes are only committed.
+func (s *Syncer) remote(ctx context.Context) (remote, branch string, err error) {
+	branch, err = s.git(ctx, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("%s is not on a branch: %w", s.Dir, err)
+	}
+	if remote, err = s.git(ctx, "config", "branch."+branch+".remote"); err == nil {
+		return remote, branch, nil
+	}
+	if s.ok(ctx, "remote", "get-url", "origin") {
+		return "origin", branch, nil
+	}
+	return "", branch, nil
+}
+
+// synced reports whether the store was synced with this repository before.
+func (s *Syncer) synced(ctx context.Context) (bool, error) {
+	value, err := s.Store.GetMeta(ctx, syncedMetaKey)
+	return value == s.Dir, err
+}
+
+// Sync pulls the tasks from the remote, merges them with the store, writes
+// the result to both and pushes it. A remote that cannot be reached is
+// logged and skipped, so syncing works offline. The conflicts returned were
+// resolved by keeping the later edit.
+func (s *Syncer) Sync(ctx context.Context) ([]models.Conflict, error) {
+	if !s.ok(ctx, "rev-parse", "--is-inside-work-tree") {
+		return nil, fmt.Errorf("%s is not a git working copy", s.Dir)
+	}
+	if err := storage.RequirePlaintext(ctx, s.Store, "git sync"); err != nil {
+		return nil, err
+	}
+	remote, branch, err := s.remote(ctx)
+	if err != nil {
+		return nil, err
+	}
+	theirsRef := ""
+	if remote != "" {
+		if _, err := s.git(ctx, "fetch", "--quiet", remote); err != nil {
+			log.Printf("Sync: working offline: %v", err)
+		}
+		if ref := "refs/remotes/" + remote + "/" + branch; s.ok(ctx, "rev-parse", "--verify", "--quiet", ref) {
+			theirsRef = ref
+		}
+	}
+	hasHead := s.ok(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	if theirsRef == "" && hasHead {
+		theirsRef = "HEAD"
+	}
+
+	synced, err := s.synced(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The base is the last state both sides agreed on. A store new to this
+	// repository has none, so everything in either is kept.
+	var base []models.Task
+	if synced && hasHead {
+		if mergeBase, err := s.git(ctx, "merge-base", "HEAD", theirsRef); err == nil {
+			if base, err = s.read(ctx, mergeBase); err != nil {
+				return nil, err
+			}
+		}
+	}
+	ours, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	var theirs []models.Task
+	if theirsRef != "" {
+		if theirs, err = s.read(ctx, theirsRef); err != nil {
+			return nil, err
+		}
+	}
+	merged, conflicts := merge(base, ours, theirs)
+
+	// Write to the store first: if committing fails, the next sync still
+	// finds these changes as ours.
+	if err := s.Store.ReplaceTasks(ctx, merged, nil); err != nil {
+		return nil, fmt.Errorf("saving merged tasks: %w", err)
+	}
+	if err := s.Store.SetMeta(ctx, syncedMetaKey, s.Dir); err != nil {
+		return nil, err
+	}
+	// Commit what the store now holds, so the file matches it exactly.
+	if merged, err = storage.ExportTasks(ctx, s.Store); err != nil {
+		return conflicts, err
+	}
+
+	// The file is rewritten from the store below, so a merge or a copy left
+	// behind by an earlier failed sync can be thrown away.
+	if s.ok(ctx, "rev-parse", "--verify", "--quiet", "MERGE_HEAD") {
+		if _, err := s.git(ctx, "merge", "--abort"); err != nil {
+			return conflicts, err
+		}
+	}
+	if hasHead && s.ok(ctx, "cat-file", "-e", "HEAD:"+FileName) {
+		if _, err := s.git(ctx, "checkout", "HEAD", "--", FileName); err != nil {
+			return conflicts, err
+		}
+	} else if err := os.Remove(filepath.Join(s.Dir, FileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return conflicts, err
+	}
+
+	merging := false
+	if theirsRef != "" && theirsRef != "HEAD" {
+		switch {
+		case !hasHead || s.ok(ctx, "merge-base", "--is-ancestor", "HEAD", theirsRef):
+			if _, err := s.git(ctx, "merge", "--quiet", "--ff-only", theirsRef); err != nil {
+				return conflicts, err
+			}
+		case !s.ok(ctx, "merge-base", "--is-ancestor", theirsRef, "HEAD"):
+			// Record the merge, but with our own merged file rather than
+			// git's line-based one.
+			if _, err := s.git(ctx, "merge", "--quiet", "--no-commit", "--strategy=ours", theirsRef); err != nil {
+				return conflicts, err
+			}
+			merging = true
+		}
+	}
+	message := "Sync tasks from " + s.Host
+	if merging {
+		message = "Merge tasks from " + remote + " on " + s.Host
+	}
+	if err := s.commit(ctx, merged, message, merging); err != nil {
+		return conflicts, err
+	}
+	s.push(ctx, remote, branch)
+	return conflicts, nil
+}
+
+// commit writes tasks to the file and commits it if it changed, or always
+// when a merge is in progress.
+func (s *Syncer) commit(ctx context.Context, tasks []models.Task, message string, merging bool) error {
+	data, err := Encode(tasks)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.Dir, FileName), data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", FileName, err)
+	}
+	if _, err := s.git(ctx, "add", FileName); err != nil {
+		return err
+	}
+	if !merging && s.ok(ctx, "diff", "--cached", "--quiet") {
+		return nil
+	}
+	_, err = s.git(ctx, "commit", "--quiet", "--no-verify", "-m", message)
+	return err
+}
+
+// push sends the branch to the remote, if there is one. A failed push is
+// only logged: the commits are kept and go out with the next sync.
+func (s *Syncer) push(ctx context.Context, remote, branch string) {
+	if remote == "" || !s.ok(ctx, "rev-parse", "--verify", "--quiet", "HEAD") {
+		return
+	}
+	if _, err := s.git(ctx, "push", "--quiet", "--set-upstream", remote, "HEAD:refs/heads/"+branch); err != nil {
+		log.Printf("Sync: push failed, will retry: %v", err)
+	}
+}
+
+// Run syncs every interval until ctx is cancelled, and once more on the
+// way out so no change stays behind.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the final sync needs its own deadline.
+			final, cancel := context.WithTimeout(context.Background(), interval)
+			s.logSync(final)
+			cancel()
+			return
+		case <-ticker.C:
+			s.logSync(ctx)
+		}
+	}
+}
+
+func (s *Syncer) logSync(ctx context.Context) {
+	conflicts, err := s.Sync(ctx)
+	for _, c := range conflicts {
+		log.Printf("Sync: %s", c)
+	}
+	if err != nil {
+		log.Printf("Sync: %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package gitsync
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		os.Setenv(key, "go-todo tests")
+	}
+	os.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	os.Exit(m.Run())
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// newRemote creates a bare repository standing in for the shared remote.
+func newRemote(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "remote.git")
+	run(t, t.TempDir(), "init", "--quiet", "--bare", dir)
+	return dir
+}
+
+// newMachine clones remote and returns a syncer for the clone with an
+// empty store of its own.
+func newMachine(t *testing.T, remote, host string) *Syncer {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), host)
+	run(t, t.TempDir(), "clone", "--quiet", remote, dir)
+	s, err := New(dir, storage.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	s.Host = host
+	return s
+}
+
+func mustSync(t *testing.T, s *Syncer) []models.Conflict {
+	t.Helper()
+	conflicts, err := s.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync on %s failed: %v", s.Host, err)
+	}
+	return conflicts
+}
+
+func descriptions(t *testing.T, s *Syncer) []string {
+	t.Helper()
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		t.Fatalf("Reading tasks: %v", err)
+	}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Description)
+	}
+	return got
+}
+
+func assertTasks(t *testing.T, s *Syncer, want ...string) {
+	t.Helper()
+	got := descriptions(t, s)
+	have := make(map[string]bool)
+	for _, d := range got {
+		have[d] = true
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %v on %s, got %v", want, s.Host, got)
+		return
+	}
+	for _, d := range want {
+		if !have[d] {
+			t.Errorf("Expected %v on %s, got %v", want, s.Host, got)
+			return
+		}
+	}
+}
+
+// edit overwrites a task with the given description and updated_at, so
+// tests control which edit is later.
+func edit(t *testing.T, s *Syncer, id int, description, updatedAt string) {
+	t.Helper()
+	tasks, _ := storage.ExportTasks(ctx, s.Store)
+	for i := range tasks {
+		if tasks[i].ID == id {
+			tasks[i].Description = description
+			tasks[i].UpdatedAt = updatedAt
+		}
+	}
+	if err := s.Store.ReplaceTasks(ctx, tasks, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+}
+
+func TestSync_SharesTasks(t *testing.T) {
+	remote := newRemote(t)
+	laptop, desktop := newMachine(t, remote, "laptop"), newMachine(t, remote, "desktop")
+
+	laptop.Store.AddTask(ctx, "Write report")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	assertTasks(t, desktop, "Write report")
+
+	// A store joining with tasks of its own keeps them and the shared ones.
+	newcomer := newMachine(t, remote, "newcomer")
+	newcomer.Store.AddTask(ctx, "Local idea")
+	mustSync(t, newcomer)
+	assertTasks(t, newcomer, "Write report", "Local idea")
+
+	data, err := os.ReadFile(filepath.Join(newcomer.Dir, FileName))
+	if err != nil {
+		t.Fatalf("Reading %s: %v", FileName, err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("Expected one line per task, got %q", data)
+	}
+}
+
+func TestSync_MergesConcurrentChanges(t *testing.T) {
+	remote := newRemote(t)
+	laptop, desktop := newMachine(t, remote, "laptop"), newMachine(t, remote, "desktop")
+	a, _ := laptop.Store.AddTask(ctx, "a")
+	b, _ := laptop.Store.AddTask(ctx, "b")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	// Edits to different tasks on both machines, and a new task on each
+	// that gets the same ID.
+	edit(t, laptop, int(a), "a from laptop", "2026-10-01 10:00:00")
+	laptop.Store.AddTask(ctx, "new on laptop")
+	edit(t, desktop, int(b), "b from desktop", "2026-10-01 10:00:00")
+	desktop.Store.AddTask(ctx, "new on desktop")
+
+	// The laptop pushes while the desktop is offline and only commits, so
+	// the desktop's next sync has to merge.
+	mustSync(t, laptop)
+	run(t, desktop.Dir, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "gone.git"))
+	mustSync(t, desktop)
+	run(t, desktop.Dir, "remote", "set-url", "origin", remote)
+	if conflicts := mustSync(t, desktop); len(conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", conflicts)
+	}
+	mustSync(t, laptop)
+
+	want := []string{"a from laptop", "b from desktop", "new on laptop", "new on desktop"}
+	assertTasks(t, laptop, want...)
+	assertTasks(t, desktop, want...)
+	if log := run(t, desktop.Dir, "log", "--format=%s"); !strings.Contains(log, "Merge tasks from origin on desktop") {
+		t.Errorf("Expected a merge commit, got log %q", log)
+	}
+}
+
+func TestSync_LaterEditWins(t *testing.T) {
+	remote := newRemote(t)
+	laptop, desktop := newMachine(t, remote, "laptop"), newMachine(t, remote, "desktop")
+	id, _ := laptop.Store.AddTask(ctx, "Call ACME")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	edit(t, laptop, int(id), "Call ACME on Monday", "2026-10-01 10:00:00")
+	edit(t, desktop, int(id), "Call ACME on Tuesday", "2026-10-01 11:00:00")
+	mustSync(t, laptop)
+	conflicts := mustSync(t, desktop)
+	mustSync(t, laptop)
+
+	assertTasks(t, laptop, "Call ACME on Tuesday")
+	assertTasks(t, desktop, "Call ACME on Tuesday")
+	if len(conflicts) != 1 || conflicts[0].Lost.Description != "Call ACME on Monday" {
+		t.Errorf("Expected one conflict losing Monday, got %+v", conflicts)
+	}
+}
+
+func TestSync_EditBeatsDelete(t *testing.T) {
+	remote := newRemote(t)
+	laptop, desktop := newMachine(t, remote, "laptop"), newMachine(t, remote, "desktop")
+	id, _ := laptop.Store.AddTask(ctx, "Keep me")
+	laptop.Store.AddTask(ctx, "Delete me")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	laptop.Store.DeleteTask(ctx, int(id), 0)
+	edit(t, desktop, int(id), "Keep me, edited", "2026-10-01 10:00:00")
+	tasks, _ := storage.ExportTasks(ctx, desktop.Store)
+	desktop.Store.DeleteTask(ctx, findID(t, tasks, "Delete me"), 0)
+
+	mustSync(t, laptop)
+	conflicts := mustSync(t, desktop)
+	mustSync(t, laptop)
+
+	assertTasks(t, laptop, "Keep me, edited")
+	if len(conflicts) != 1 || conflicts[0].Lost.ID != 0 {
+		t.Errorf("Expected a delete/edit conflict, got %+v", conflicts)
+	}
+}
+
+func findID(t *testing.T, tasks []models.Task, description string) int {
+	t.Helper()
+	for _, task := range tasks {
+		if task.Description == description {
+			return task.ID
+		}
+	}
+	t.Fatalf("Task %q not in %+v", description, tasks)
+	return 0
+}
+
+func TestSync_NoCommitWhenUnchanged(t *testing.T) {
+	remote := newRemote(t)
+	laptop := newMachine(t, remote, "laptop")
+	laptop.Store.AddTask(ctx, "a")
+	mustSync(t, laptop)
+
+	before := run(t, remote, "rev-parse", "main")
+	mustSync(t, laptop)
+	if after := run(t, remote, "rev-parse", "main"); after != before {
+		t.Error("Expected no new commit when nothing changed")
+	}
+}
+
+func TestRun_PullsChanges(t *testing.T) {
+	remote := newRemote(t)
+	laptop, desktop := newMachine(t, remote, "laptop"), newMachine(t, remote, "desktop")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	laptop.Store.AddTask(ctx, "from laptop")
+	mustSync(t, laptop)
+	desktop.Store.AddTask(ctx, "from desktop")
+
+	// A cancelled context makes Run sync once on the way out.
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+	desktop.Run(stopped, time.Minute)
+
+	assertTasks(t, desktop, "from laptop", "from desktop")
+	mustSync(t, laptop)
+	assertTasks(t, laptop, "from laptop", "from desktop")
+}
+
+func TestSync_WorksOffline(t *testing.T) {
+	remote := newRemote(t)
+	laptop := newMachine(t, remote, "laptop")
+	run(t, laptop.Dir, "remote", "set-url", "origin", filepath.Join(t.TempDir(), "gone.git"))
+
+	laptop.Store.AddTask(ctx, "a")
+	mustSync(t, laptop)
+	if log := run(t, laptop.Dir, "log", "--format=%s"); log != "Sync tasks from laptop" {
+		t.Errorf("Expected a local commit, got log %q", log)
+	}
+}
+
+func TestSync_RejectsNonRepository(t *testing.T) {
+	s, _ := New(t.TempDir(), storage.NewMemoryStore())
+	if _, err := s.Sync(ctx); err == nil {
+		t.Error("Expected an error outside a git working copy")
+	}
+}
+
+func TestSync_RejectsEncryptedStore(t *testing.T) {
+	laptop := newMachine(t, newRemote(t), "laptop")
+	store, err := storage.EnableEncryption(ctx, laptop.Store, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	laptop.Store = store
+	if _, err := laptop.Sync(ctx); err == nil {
+		t.Error("Expected an encrypted store to be refused")
+	}
+}
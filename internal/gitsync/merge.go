@@ -0,0 +1,97 @@
+package gitsync
+
+import (
+	"sort"
+
+	"go-todo/internal/models"
+)
+
+// remoteName is how conflicts name the other side of a git sync.
+const remoteName = "another machine"
+
+// same reports whether two tasks have the same synced content.
+func same(a, b models.Task) bool {
+	a.Version, b.Version = 0, 0
+	return a == b
+}
+
+func byID(tasks []models.Task) map[int]models.Task {
+	m := make(map[int]models.Task, len(tasks))
+	for _, t := range tasks {
+		m[t.ID] = t
+	}
+	return m
+}
+
+// merge combines ours and theirs, two task sets that both started from
+// base. A task changed on one side only takes that change. A task changed
+// on both sides keeps the edit with the later updated_at, theirs on a tie,
+// and is reported as a conflict. A deletion loses against an edit, so no
+// edit is ever lost.
+//
+// Tasks added on both sides under the same ID are different tasks: theirs
+// is already shared, so it keeps the ID and ours is given a new one.
+func merge(base, ours, theirs []models.Task) ([]models.Task, []models.Conflict) {
+	b, o, th := byID(base), byID(ours), byID(theirs)
+	ids := make(map[int]bool)
+	maxID := 0
+	for _, set := range []map[int]models.Task{b, o, th} {
+		for id := range set {
+			ids[id] = true
+			maxID = max(maxID, id)
+		}
+	}
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	var merged, renumber []models.Task
+	var conflicts []models.Conflict
+	for _, id := range sorted {
+		baseTask, inBase := b[id]
+		ourTask, inOurs := o[id]
+		theirTask, inTheirs := th[id]
+		switch {
+		case inOurs && inTheirs:
+			switch {
+			case same(ourTask, theirTask):
+				merged = append(merged, ourTask)
+			case !inBase:
+				merged = append(merged, theirTask)
+				renumber = append(renumber, ourTask)
+			case same(ourTask, baseTask):
+				merged = append(merged, theirTask)
+			case same(theirTask, baseTask):
+				merged = append(merged, ourTask)
+			case ourTask.UpdatedAt > theirTask.UpdatedAt:
+				merged = append(merged, ourTask)
+				conflicts = append(conflicts, models.Conflict{Kept: ourTask, Lost: theirTask, Remote: remoteName})
+			default:
+				merged = append(merged, theirTask)
+				conflicts = append(conflicts, models.Conflict{Kept: theirTask, Lost: ourTask, Remote: remoteName})
+			}
+		case inOurs:
+			if !inBase {
+				merged = append(merged, ourTask)
+			} else if !same(ourTask, baseTask) {
+				merged = append(merged, ourTask)
+				conflicts = append(conflicts, models.Conflict{Kept: ourTask, Remote: remoteName})
+			}
+		case inTheirs:
+			if !inBase {
+				merged = append(merged, theirTask)
+			} else if !same(theirTask, baseTask) {
+				merged = append(merged, theirTask)
+				conflicts = append(conflicts, models.Conflict{Kept: theirTask, Remote: remoteName})
+			}
+		}
+	}
+	for _, t := range renumber {
+		maxID++
+		t.ID = maxID
+		merged = append(merged, t)
+	}
+	return merged, conflicts
+}
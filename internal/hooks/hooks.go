@@ -0,0 +1,201 @@
+// Package hooks runs the user's hook scripts when tasks change. A hook is
+// an executable in the hooks directory named after the event it handles:
+//
+//	on-add       before a task is added
+//	on-modify    before a task is renamed or given a due date
+//	on-complete  after a task is completed
+//	on-delete    after a task is deleted
+//
+// Each gets the task as JSON on stdin. on-add and on-modify may print the
+// task, changed, on stdout to have it saved that way, or exit non-zero to
+// reject the change, with what they print on stderr shown to the user.
+// The others only hear about changes already saved, and run one at a time
+// on a worker of their own, so they never hold up the change.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// DirName is the name of the hooks directory, beside the config file.
+const DirName = "hooks"
+
+// Hook names.
+const (
+	OnAdd      = "on-add"
+	OnModify   = "on-modify"
+	OnComplete = "on-complete"
+	OnDelete   = "on-delete"
+)
+
+// Timeout bounds a single hook run.
+const Timeout = 5 * time.Second
+
+// queueSize is how many changes can wait for their on-complete or
+// on-delete hook before further ones are dropped.
+const queueSize = 100
+
+// change is a saved change waiting for its hook.
+type change struct {
+	name string
+	task models.Task
+}
+
+// Runner runs the hooks in Dir. It is both the controller's Hooks and one
+// of its Listeners; the hooks it is told about as a listener run in Run.
+type Runner struct {
+	Dir   string
+	queue chan change
+}
+
+// New returns a runner for the hooks in dir.
+func New(dir string) *Runner {
+	return &Runner{Dir: dir, queue: make(chan change, queueSize)}
+}
+
+// path returns the executable for the hook called name, or "" if there is
+// none.
+func (r *Runner) path(name string) string {
+	path := filepath.Join(r.Dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Hooks: %v", err)
+		}
+		return ""
+	}
+	if info.IsDir() || info.Mode()&0o111 == 0 {
+		log.Printf("Hooks: %s is not executable, skipping it", path)
+		return ""
+	}
+	return path
+}
+
+// run runs the hook called name, if there is one, with task on stdin and
+// returns what it printed on stdout. A hook that exits non-zero gives a
+// models.RejectedError.
+func (r *Runner) run(ctx context.Context, name string, task models.Task) ([]byte, error) {
+	path := r.path(name)
+	if path == "" {
+		return nil, nil
+	}
+	input, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("encoding task for %s hook: %w", name, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), "GO_TODO_HOOK="+name)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, &models.RejectedError{Message: fmt.Sprintf("The %s hook took longer than %v", name, Timeout)}
+	case ctx.Err() != nil:
+		return nil, ctx.Err()
+	case errors.As(err, &exit):
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = fmt.Sprintf("The %s hook rejected the change (%v)", name, err)
+		}
+		return nil, &models.RejectedError{Message: message}
+	case err != nil:
+		return nil, fmt.Errorf("running %s hook: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// check runs a hook that may change or reject task.
+func (r *Runner) check(ctx context.Context, name string, task models.Task) (models.Task, error) {
+	out, err := r.run(ctx, name, task)
+	if err != nil || len(bytes.TrimSpace(out)) == 0 {
+		return task, err
+	}
+	// Fields the hook leaves out keep their values.
+	changed := task
+	if err := json.Unmarshal(out, &changed); err != nil {
+		return task, &models.RejectedError{Message: fmt.Sprintf("The %s hook printed something other than a task: %v", name, err)}
+	}
+	if strings.TrimSpace(changed.Description) == "" {
+		return task, &models.RejectedError{Message: fmt.Sprintf("The %s hook left the task without a description", name)}
+	}
+	// Only what the user could have edited is taken.
+	task.Description, task.Done, task.Due = changed.Description, changed.Done, changed.Due
+	return task, nil
+}
+
+// BeforeAdd runs the on-add hook.
+func (r *Runner) BeforeAdd(ctx context.Context, task models.Task) (models.Task, error) {
+	return r.check(ctx, OnAdd, task)
+}
+
+// BeforeModify runs the on-modify hook.
+func (r *Runner) BeforeModify(ctx context.Context, task models.Task) (models.Task, error) {
+	return r.check(ctx, OnModify, task)
+}
+
+// TaskChanged queues the on-complete or on-delete hook for Run, so the
+// operation that made the change does not wait for it. ctx is not used:
+// the hook outlives the operation.
+func (r *Runner) TaskChanged(ctx context.Context, kind models.EventKind, task models.Task) {
+	var name string
+	switch kind {
+	case models.EventCompleted:
+		name = OnComplete
+	case models.EventDeleted:
+		name = OnDelete
+	default:
+		return
+	}
+	select {
+	case r.queue <- change{name: name, task: task}:
+	default:
+		log.Printf("Hooks: too many changes waiting, skipping %s for task %d", name, task.ID)
+	}
+}
+
+// Run runs the queued on-complete and on-delete hooks until ctx is
+// cancelled, and then those still queued, so none is lost on the way out.
+// The change is already saved, so a failing hook is only logged.
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case c := <-r.queue:
+					r.notify(c)
+				default:
+					return
+				}
+			}
+		case c := <-r.queue:
+			r.notify(c)
+		}
+	}
+}
+
+// notify runs the hook for a saved change, with Timeout as its only limit.
+func (r *Runner) notify(c change) {
+	if _, err := r.run(context.Background(), c.name, c.task); err != nil {
+		log.Printf("Hooks: %s for task %d: %v", c.name, c.task.ID, err)
+	}
+}
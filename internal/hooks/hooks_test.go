@@ -0,0 +1,111 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-todo/internal/models"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// writeHook writes a shell script hook called name into dir.
+func writeHook(t *testing.T, dir, name, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatalf("Writing hook: %v", err)
+	}
+}
+
+func TestBeforeAdd_NoHookKeepsTask(t *testing.T) {
+	r := New(filepath.Join(t.TempDir(), "missing"))
+	task, err := r.BeforeAdd(ctx, models.Task{Description: "a"})
+	if err != nil || task.Description != "a" {
+		t.Errorf("Expected the task unchanged, got %+v, %v", task, err)
+	}
+}
+
+func TestBeforeAdd_ChangesTask(t *testing.T) {
+	dir := t.TempDir()
+	// Reads the task and prints it with a due date added.
+	writeHook(t, dir, OnAdd, `sed 's/}$/,"due":"2026-10-20"}/'`)
+	task, err := New(dir).BeforeAdd(ctx, models.Task{Description: "Call ACME"})
+	if err != nil {
+		t.Fatalf("BeforeAdd failed: %v", err)
+	}
+	if task.Description != "Call ACME" || task.Due != "2026-10-20" {
+		t.Errorf("Expected the due date added, got %+v", task)
+	}
+}
+
+func TestBeforeModify_Rejects(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, OnModify, `echo "Tasks need a ticket number" >&2; exit 1`)
+	_, err := New(dir).BeforeModify(ctx, models.Task{ID: 1, Description: "a"})
+	var rejected *models.RejectedError
+	if !errors.As(err, &rejected) || rejected.Message != "Tasks need a ticket number" {
+		t.Errorf("Expected the hook's stderr as the rejection, got %v", err)
+	}
+}
+
+func TestBeforeAdd_RejectsInvalidOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeHook(t, dir, OnAdd, `echo not json`)
+	var rejected *models.RejectedError
+	if _, err := New(dir).BeforeAdd(ctx, models.Task{Description: "a"}); !errors.As(err, &rejected) {
+		t.Errorf("Expected invalid output to reject the change, got %v", err)
+	}
+	writeHook(t, dir, OnAdd, `echo '{"description": ""}'`)
+	if _, err := New(dir).BeforeAdd(ctx, models.Task{Description: "a"}); !errors.As(err, &rejected) {
+		t.Errorf("Expected an empty description to reject the change, got %v", err)
+	}
+}
+
+func TestBeforeAdd_SkipsNonExecutable(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, OnAdd), []byte("#!/bin/sh\nexit 1\n"), 0o644); err != nil {
+		t.Fatalf("Writing hook: %v", err)
+	}
+	if _, err := New(dir).BeforeAdd(ctx, models.Task{Description: "a"}); err != nil {
+		t.Errorf("Expected a non-executable hook to be skipped, got %v", err)
+	}
+}
+
+func TestTaskChanged_RunsNotificationHooks(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	writeHook(t, dir, OnComplete, `cat >> "`+out+`"`)
+	writeHook(t, dir, OnDelete, `echo "$GO_TODO_HOOK" >> "`+out+`"; exit 1`)
+	r := New(dir)
+
+	// The hooks wait for Run, which runs those still queued when stopped.
+	r.TaskChanged(ctx, models.EventCompleted, models.Task{ID: 3, Description: "Ship it", Done: true})
+	r.TaskChanged(ctx, models.EventReopened, models.Task{ID: 3, Description: "Ship it"})
+	r.TaskChanged(ctx, models.EventDeleted, models.Task{ID: 3, Description: "Ship it"})
+	if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no hook to run inside TaskChanged, got %v", err)
+	}
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+	r.Run(stopped)
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Reading hook output: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"description":"Ship it"`) || lines[1] != OnDelete {
+		t.Errorf("Expected the completed task and the delete hook's name, got %q", data)
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "fmt"
+
+// Conflict is a task that was changed on both sides of a sync. It was
+// resolved automatically; the conflict is kept to tell the user.
+type Conflict struct {
+	// Kept is the version of the task that won.
+	Kept Task
+	// Lost is the version that was dropped. It is the zero Task when the
+	// other side deleted the task, in which case the edit was kept.
+	Lost Task
+	// Remote names the other side of the sync, such as "the sync server".
+	Remote string
+}
+
+func (c Conflict) String() string {
+	if c.Lost == (Task{}) {
+		return fmt.Sprintf("%q was deleted on one side and edited on the other; it was kept.", c.Kept.Description)
+	}
+	if c.Kept.Description != c.Lost.Description {
+		return fmt.Sprintf("A task was changed here and on %s; kept the later edit %q over %q.", c.Remote, c.Kept.Description, c.Lost.Description)
+	}
+	return fmt.Sprintf("%q was changed here and on %s; kept the later edit.", c.Kept.Description, c.Remote)
+}
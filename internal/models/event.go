@@ -0,0 +1,61 @@
+package models
+
+import "fmt"
+
+// EventKind names a change made to a task.
+type EventKind string
+
+const (
+	EventCreated    EventKind = "created"
+	EventRenamed    EventKind = "renamed"
+	EventCompleted  EventKind = "completed"
+	EventReopened   EventKind = "reopened"
+	EventDueChanged EventKind = "due_changed"
+	EventMoved      EventKind = "moved"
+	EventArchived   EventKind = "archived"
+	EventDeleted    EventKind = "deleted"
+	EventRestored   EventKind = "restored"
+)
+
+// TaskEvent is one entry in a task's history.
+type TaskEvent struct {
+	ID     int64     `json:"id"`
+	TaskID int       `json:"task_id"`
+	Kind   EventKind `json:"kind"`
+	// Detail is the new value for events that carry one: the description
+	// for created and renamed, the due date for due_changed.
+	Detail string `json:"detail,omitempty"`
+	At     string `json:"at"`
+	// State is the task as it was right after the change, or nil once it
+	// was deleted.
+	State *Task `json:"state,omitempty"`
+}
+
+// Summary describes the event in a few words, e.g. `Renamed to "Buy milk"`.
+func (e TaskEvent) Summary() string {
+	switch e.Kind {
+	case EventCreated:
+		return fmt.Sprintf("Created as %q", e.Detail)
+	case EventRenamed:
+		return fmt.Sprintf("Renamed to %q", e.Detail)
+	case EventCompleted:
+		return "Completed"
+	case EventReopened:
+		return "Reopened"
+	case EventDueChanged:
+		if e.Detail == "" {
+			return "Due date cleared"
+		}
+		return fmt.Sprintf("Due date set to %s", e.Detail)
+	case EventMoved:
+		return "Moved"
+	case EventArchived:
+		return "Archived"
+	case EventDeleted:
+		return "Deleted"
+	case EventRestored:
+		return "Overwritten by a restore or sync"
+	default:
+		return string(e.Kind)
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+// SortMode selects the order of tasks within a group.
+type SortMode string
+
+const (
+	SortManual       SortMode = "manual"
+	SortCreated      SortMode = "created"
+	SortUpdated      SortMode = "updated"
+	SortAlphabetical SortMode = "alphabetical"
+	SortDue          SortMode = "due"
+)
+
+// SortModes lists the sort modes in the order they are offered to the user.
+var SortModes = []SortMode{SortManual, SortCreated, SortUpdated, SortAlphabetical, SortDue}
+
+// GroupMode selects how tasks are split into sections.
+type GroupMode string
+
+const (
+	GroupNone       GroupMode = "none"
+	GroupStatus     GroupMode = "status"
+	GroupCreatedDay GroupMode = "created_day"
+)
+
+// GroupModes lists the group modes in the order they are offered to the user.
+var GroupModes = []GroupMode{GroupStatus, GroupCreatedDay, GroupNone}
+
+// TaskQuery describes which tasks to list and how to order them. The zero
+// value lists tasks in manual order, open tasks before done ones.
+type TaskQuery struct {
+	Sort  SortMode
+	Group GroupMode
+	// HideDone leaves completed tasks out of the list.
+	HideDone bool
+}
+
+// WithDefaults fills in unset fields with the default view.
+func (q TaskQuery) WithDefaults() TaskQuery {
+	if q.Sort == "" {
+		q.Sort = SortManual
+	}
+	if q.Group == "" {
+		q.Group = GroupStatus
+	}
+	return q
+}
+
+// Section returns the key of the group a task belongs to under this query's
+// group mode. Tasks in the same section are listed together.
+func (q TaskQuery) Section(t Task) string {
+	switch q.WithDefaults().Group {
+	case GroupStatus:
+		if t.Done {
+			return "Done"
+		}
+		return "Open"
+	case GroupCreatedDay:
+		if len(t.CreatedAt) >= len("2006-01-02") {
+			return t.CreatedAt[:len("2006-01-02")]
+		}
+		return t.CreatedAt
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+// RejectedError refuses a change before it is saved, such as a hook script
+// rejecting a new task. Its message, such as what the script printed, is
+// shown to the user.
+type RejectedError struct {
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return e.Message
+}
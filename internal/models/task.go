@@ -1,11 +1,21 @@
 package models
 
 type Task struct {
-	ID          int
-	Description string
-	Done        bool
-	CreatedAt   string
-	UpdatedAt   string
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Done        bool   `json:"done"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	Version     int    `json:"version"`
+	// Position orders tasks in the manual sort mode; lower comes first.
+	Position float64 `json:"position"`
+	// Due is the due date as YYYY-MM-DD, or empty if the task has none.
+	Due string `json:"due,omitempty"`
+	// CompletedAt is when the task was last marked done, or empty if open.
+	CompletedAt string `json:"completed_at,omitempty"`
+	// ArchivedAt is when the task was archived, or empty if it is listed.
+	// Archived tasks are left out of GetTasks.
+	ArchivedAt string `json:"archived_at,omitempty"`
 }
 
 func NewTask(text string, nextID int) Task {
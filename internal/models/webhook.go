@@ -0,0 +1,39 @@
+package models
+
+// WebhookMessage is a webhook call waiting in the outbox until it is
+// delivered or given up on.
+type WebhookMessage struct {
+	ID    int64  `json:"id"`
+	URL   string `json:"url"`
+	Event string `json:"event"`
+	// DeliveryID identifies the change in the delivery header, and is the
+	// ID in the payload.
+	DeliveryID string `json:"delivery_id"`
+	// Payload is the JSON body to send.
+	Payload string `json:"payload"`
+	// Attempts counts the deliveries tried so far.
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is when the message is due to be tried again.
+	NextAttemptAt string `json:"next_attempt_at"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// WebhookDelivery is one attempt to deliver a webhook message, kept in the
+// delivery log.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	MessageID int64  `json:"message_id"`
+	URL       string `json:"url"`
+	Event     string `json:"event"`
+	Attempt   int    `json:"attempt"`
+	// Status is the HTTP status of the response, or 0 if there was none.
+	Status int `json:"status"`
+	// Error says why the attempt failed, and is empty if it succeeded.
+	Error string `json:"error,omitempty"`
+	At    string `json:"at"`
+}
+
+// Delivered reports whether the attempt succeeded.
+func (d WebhookDelivery) Delivered() bool {
+	return d.Error == ""
+}
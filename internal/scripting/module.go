@@ -0,0 +1,187 @@
+package scripting
+
+import (
+	"context"
+	"fmt"
+
+	"go-todo/internal/controller"
+	"go-todo/internal/models"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Module returns the todo module a command is called with. It offers:
+//
+//	tasks()                   the listed tasks
+//	archived()                the archived tasks
+//	selected()                the ID of the selected task, or None
+//	marked()                  the IDs of the marked tasks
+//	add(description, due="")  adds a task and returns its ID
+//	toggle(id)                completes or reopens a task
+//	set_done(ids, done=True)  completes or reopens several tasks
+//	rename(id, description)   changes a task's description
+//	set_due(id, due="")       sets a due date as YYYY-MM-DD, or clears it
+//	delete(id)                deletes a task
+//	info(message)             shows a message once the command is done
+//	error(message)            shows an error once the command is done
+//
+// Tasks are structs with the fields id, description, done, due,
+// created_at, updated_at, completed_at and version. Changes are saved
+// whatever was changed elsewhere meanwhile, as a command acts on the
+// tasks as it finds them.
+func Module(ctx context.Context, env controller.CommandEnv) *starlarkstruct.Module {
+	store := env.Store
+	members := starlark.StringDict{}
+	def := func(name string, fn func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)) {
+		members[name] = starlark.NewBuiltin(name, func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return fn(args, kwargs)
+		})
+	}
+
+	def("tasks", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs("tasks", args, kwargs); err != nil {
+			return nil, err
+		}
+		tasks, err := store.GetTasks(ctx, models.TaskQuery{})
+		if err != nil {
+			return nil, err
+		}
+		return taskList(tasks), nil
+	})
+	def("archived", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs("archived", args, kwargs); err != nil {
+			return nil, err
+		}
+		tasks, err := store.GetArchivedTasks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return taskList(tasks), nil
+	})
+	def("selected", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs("selected", args, kwargs); err != nil {
+			return nil, err
+		}
+		if env.Selected == 0 {
+			return starlark.None, nil
+		}
+		return starlark.MakeInt(env.Selected), nil
+	})
+	def("marked", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if err := starlark.UnpackArgs("marked", args, kwargs); err != nil {
+			return nil, err
+		}
+		ids := make([]starlark.Value, len(env.Marked))
+		for i, id := range env.Marked {
+			ids[i] = starlark.MakeInt(id)
+		}
+		return starlark.NewList(ids), nil
+	})
+	def("add", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var description, due string
+		if err := starlark.UnpackArgs("add", args, kwargs, "description", &description, "due?", &due); err != nil {
+			return nil, err
+		}
+		id, err := store.CreateTask(ctx, models.Task{Description: description, Due: due})
+		if err != nil {
+			return nil, err
+		}
+		return starlark.MakeInt64(id), nil
+	})
+	def("toggle", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var id int
+		if err := starlark.UnpackArgs("toggle", args, kwargs, "id", &id); err != nil {
+			return nil, err
+		}
+		return starlark.None, store.ToggleTaskStatus(ctx, id, 0)
+	})
+	def("set_done", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var ids starlark.Iterable
+		done := true
+		if err := starlark.UnpackArgs("set_done", args, kwargs, "ids", &ids, "done?", &done); err != nil {
+			return nil, err
+		}
+		versions, err := idVersions(ids)
+		if err != nil || len(versions) == 0 {
+			return starlark.None, err
+		}
+		return starlark.None, store.SetTasksDone(ctx, versions, done)
+	})
+	def("rename", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var id int
+		var description string
+		if err := starlark.UnpackArgs("rename", args, kwargs, "id", &id, "description", &description); err != nil {
+			return nil, err
+		}
+		return starlark.None, store.RenameTask(ctx, id, 0, description)
+	})
+	def("set_due", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var id int
+		var due string
+		if err := starlark.UnpackArgs("set_due", args, kwargs, "id", &id, "due?", &due); err != nil {
+			return nil, err
+		}
+		return starlark.None, store.SetTaskDue(ctx, id, 0, due)
+	})
+	def("delete", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var id int
+		if err := starlark.UnpackArgs("delete", args, kwargs, "id", &id); err != nil {
+			return nil, err
+		}
+		return starlark.None, store.DeleteTask(ctx, id, 0)
+	})
+	def("info", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var message string
+		if err := starlark.UnpackArgs("info", args, kwargs, "message", &message); err != nil {
+			return nil, err
+		}
+		env.Info(message)
+		return starlark.None, nil
+	})
+	def("error", func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var message string
+		if err := starlark.UnpackArgs("error", args, kwargs, "message", &message); err != nil {
+			return nil, err
+		}
+		env.Error(message)
+		return starlark.None, nil
+	})
+
+	return &starlarkstruct.Module{Name: "todo", Members: members}
+}
+
+// taskList converts tasks to a list of structs.
+func taskList(tasks []models.Task) *starlark.List {
+	values := make([]starlark.Value, len(tasks))
+	for i, task := range tasks {
+		values[i] = starlarkstruct.FromStringDict(starlark.String("task"), starlark.StringDict{
+			"id":           starlark.MakeInt(task.ID),
+			"description":  starlark.String(task.Description),
+			"done":         starlark.Bool(task.Done),
+			"due":          starlark.String(task.Due),
+			"created_at":   starlark.String(task.CreatedAt),
+			"updated_at":   starlark.String(task.UpdatedAt),
+			"completed_at": starlark.String(task.CompletedAt),
+			"version":      starlark.MakeInt(task.Version),
+		})
+	}
+	return starlark.NewList(values)
+}
+
+// idVersions turns a sequence of task IDs into a version map that saves
+// whatever the tasks' versions are.
+func idVersions(ids starlark.Iterable) (map[int]int, error) {
+	versions := make(map[int]int)
+	iter := ids.Iterate()
+	defer iter.Done()
+	var v starlark.Value
+	for iter.Next(&v) {
+		var id int
+		if err := starlark.AsInt(v, &id); err != nil {
+			return nil, fmt.Errorf("task ID %s: %w", v, err)
+		}
+		versions[id] = 0
+	}
+	return versions, nil
+}
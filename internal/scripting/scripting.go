@@ -0,0 +1,186 @@
+// Package scripting runs custom commands written in Starlark, a dialect of
+// Python, so teams can add their own commands without changing the
+// application. Every *.star file in the scripts directory is loaded at
+// startup, and registers commands with command():
+//
+//	def finish_release(todo):
+//	    ids = [t.id for t in todo.tasks() if "#release" in t.description and not t.done]
+//	    todo.set_done(ids)
+//	    todo.info("Finished %d release tasks" % len(ids))
+//
+//	command("Finish release tasks", finish_release)
+//
+// A command is called with the todo module, which reads and changes tasks
+// through the controller's store and queues messages for the user. See
+// Module for what it offers.
+package scripting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go-todo/internal/controller"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// DirName is the name of the scripts directory, beside the config file.
+const DirName = "scripts"
+
+// MaxSteps bounds the work a single command may do, so a runaway loop
+// cannot hang the application. Commands are also stopped when their
+// context is cancelled.
+const MaxSteps = 10_000_000
+
+// Timeout bounds a single command run, including the store calls it makes
+// and the hooks they trigger.
+const Timeout = 10 * time.Second
+
+// fileOptions allow the statements users expect from Python at the top
+// level of a script.
+var fileOptions = &syntax.FileOptions{
+	Set:             true,
+	While:           true,
+	TopLevelControl: true,
+	GlobalReassign:  true,
+}
+
+// command is a command registered by a script.
+type command struct {
+	name string
+	fn   starlark.Callable
+	file string
+}
+
+// Scripts are the commands loaded from a scripts directory. They are the
+// controller's Commands.
+type Scripts struct {
+	commands []command
+}
+
+// Load runs every *.star file in dir, in name order, and collects the
+// commands they register. A missing directory has no commands.
+func Load(dir string) (*Scripts, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	s := &Scripts{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.load(file, src); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// load runs one script.
+func (s *Scripts) load(file string, src []byte) error {
+	thread := newThread(file)
+	register := starlark.NewBuiltin("command", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var name string
+		var fn starlark.Callable
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "fn", &fn); err != nil {
+			return nil, err
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%s: name must not be empty", b.Name())
+		}
+		for _, cmd := range s.commands {
+			if cmd.name == name {
+				return nil, fmt.Errorf("%s: %q is already defined in %s", b.Name(), name, cmd.file)
+			}
+		}
+		s.commands = append(s.commands, command{name: name, fn: fn, file: file})
+		return starlark.None, nil
+	})
+	predeclared := starlark.StringDict{"command": register}
+	if _, err := starlark.ExecFileOptions(fileOptions, thread, file, src, predeclared); err != nil {
+		return fmt.Errorf("loading script %s: %w", file, describe(err))
+	}
+	return nil
+}
+
+// Names returns the names of the loaded commands.
+func (s *Scripts) Names() []string {
+	names := make([]string, len(s.commands))
+	for i, cmd := range s.commands {
+		names[i] = cmd.name
+	}
+	return names
+}
+
+// Run calls the command called name with the todo module for env.
+func (s *Scripts) Run(ctx context.Context, name string, env controller.CommandEnv) error {
+	var cmd *command
+	for i := range s.commands {
+		if s.commands[i].name == name {
+			cmd = &s.commands[i]
+		}
+	}
+	if cmd == nil {
+		return fmt.Errorf("no command %q", name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	thread := newThread(name)
+	thread.SetMaxExecutionSteps(MaxSteps)
+	stop := context.AfterFunc(ctx, func() { thread.Cancel(ctx.Err().Error()) })
+	defer stop()
+
+	_, err := starlark.Call(thread, cmd.fn, starlark.Tuple{Module(ctx, env)}, nil)
+	if ctx.Err() != nil {
+		// Cancelled or timed out: report it as such, not as a script error.
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("running %s: %w", cmd.file, describe(err))
+	}
+	return nil
+}
+
+// newThread returns a thread whose print goes to the log.
+func newThread(name string) *starlark.Thread {
+	return &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			log.Printf("Script %s: %s", thread.Name, msg)
+		},
+	}
+}
+
+// describe adds the Starlark backtrace to evaluation errors, keeping what
+// they wrap so storage errors can still be told apart.
+func describe(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return &scriptError{text: evalErr.Backtrace(), err: err}
+	}
+	return err
+}
+
+// scriptError is a script failure described with its backtrace.
+type scriptError struct {
+	text string
+	err  error
+}
+
+func (e *scriptError) Error() string { return e.text }
+func (e *scriptError) Unwrap() error { return e.err }
@@ -0,0 +1,222 @@
+package scripting
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-todo/internal/controller"
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// writeScripts writes the given scripts, by file name, to a new directory.
+func writeScripts(t *testing.T, scripts map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatalf("Writing %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func load(t *testing.T, scripts map[string]string) *Scripts {
+	t.Helper()
+	s, err := Load(writeScripts(t, scripts))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return s
+}
+
+// run runs a command against store and returns the messages it queued.
+func run(s *Scripts, name string, store controller.Store, selected int) (infos, errs []string, err error) {
+	env := controller.CommandEnv{
+		Store:    store,
+		Selected: selected,
+		Info:     func(message string) { infos = append(infos, message) },
+		Error:    func(message string) { errs = append(errs, message) },
+	}
+	err = s.Run(ctx, name, env)
+	return infos, errs, err
+}
+
+func TestLoad_CollectsCommandsInFileOrder(t *testing.T) {
+	s := load(t, map[string]string{
+		"b.star":   `command("Second", lambda todo: None)`,
+		"a.star":   "def first(todo):\n    pass\n\ncommand(\"First\", first)\n",
+		"notes.md": "not a script",
+	})
+	got := s.Names()
+	if len(got) != 2 || got[0] != "First" || got[1] != "Second" {
+		t.Errorf("Expected [First Second], got %v", got)
+	}
+}
+
+func TestLoad_MissingDirectory(t *testing.T) {
+	s, err := Load(filepath.Join(t.TempDir(), "scripts"))
+	if err != nil || len(s.Names()) != 0 {
+		t.Errorf("Expected no commands and no error, got %v, %v", s, err)
+	}
+}
+
+func TestLoad_RejectsBadScripts(t *testing.T) {
+	for name, src := range map[string]string{
+		"syntax":         "def broken(:\n",
+		"duplicate":      "command(\"Same\", lambda todo: None)\ncommand(\"Same\", lambda todo: None)\n",
+		"not a function": `command("Odd", 42)`,
+	} {
+		if _, err := Load(writeScripts(t, map[string]string{"x.star": src})); err == nil {
+			t.Errorf("Expected the %s script to be rejected", name)
+		}
+	}
+}
+
+// writeCounter counts the store calls that add a task or set its due date.
+type writeCounter struct {
+	controller.Store
+	calls int
+}
+
+func (w *writeCounter) AddTask(ctx context.Context, description string) (int64, error) {
+	w.calls++
+	return w.Store.AddTask(ctx, description)
+}
+
+func (w *writeCounter) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	w.calls++
+	return w.Store.CreateTask(ctx, task)
+}
+
+func (w *writeCounter) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	w.calls++
+	return w.Store.SetTaskDue(ctx, id, expectedVersion, due)
+}
+
+func TestRun_ChangesTasks(t *testing.T) {
+	store := storage.NewMemoryStore()
+	store.AddTask(ctx, "Tag the release #release")
+	store.AddTask(ctx, "Write notes #release")
+	store.AddTask(ctx, "Water plants")
+	s := load(t, map[string]string{"team.star": `
+def finish_release(todo):
+    ids = [t.id for t in todo.tasks() if "#release" in t.description and not t.done]
+    todo.set_done(ids)
+    todo.info("Finished %d release tasks" % len(ids))
+
+def standup(todo):
+    for item in ["Yesterday", "Today", "Blockers"]:
+        todo.add("Standup: " + item, due="2026-10-19")
+
+command("Finish release tasks", finish_release)
+command("Standup checklist", standup)
+`})
+
+	infos, errs, err := run(s, "Finish release tasks", store, 0)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("Command failed: %v %v", err, errs)
+	}
+	if len(infos) != 1 || infos[0] != "Finished 2 release tasks" {
+		t.Errorf("Expected a message about two tasks, got %v", infos)
+	}
+	counter := &writeCounter{Store: store}
+	if _, _, err := run(s, "Standup checklist", counter, 0); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if counter.calls != 3 {
+		t.Errorf("Expected each task added with its due date in one call, got %d calls", counter.calls)
+	}
+
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	done, standup := 0, 0
+	for _, task := range tasks {
+		if task.Done {
+			done++
+			if !strings.Contains(task.Description, "#release") {
+				t.Errorf("Expected only release tasks done, got %q", task.Description)
+			}
+		}
+		if strings.HasPrefix(task.Description, "Standup: ") {
+			standup++
+			if task.Due != "2026-10-19" {
+				t.Errorf("Expected standup items due 2026-10-19, got %q", task.Due)
+			}
+		}
+	}
+	if done != 2 || standup != 3 {
+		t.Errorf("Expected 2 done and 3 standup tasks, got %d and %d", done, standup)
+	}
+}
+
+func TestRun_SelectedTask(t *testing.T) {
+	store := storage.NewMemoryStore()
+	id, _ := store.AddTask(ctx, "Review PR")
+	s := load(t, map[string]string{"x.star": `
+def urgent(todo):
+    id = todo.selected()
+    if id == None:
+        todo.error("Select a task first")
+        return
+    task = [t for t in todo.tasks() if t.id == id][0]
+    todo.rename(id, "URGENT: " + task.description)
+
+command("Make urgent", urgent)
+`})
+
+	if _, errs, _ := run(s, "Make urgent", store, 0); len(errs) != 1 {
+		t.Errorf("Expected an error without a selection, got %v", errs)
+	}
+	if _, _, err := run(s, "Make urgent", store, int(id)); err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Description != "URGENT: Review PR" {
+		t.Errorf("Expected the task renamed, got %q", tasks[0].Description)
+	}
+}
+
+func TestRun_StoreErrorsKeepTheirKind(t *testing.T) {
+	store := storage.NewMemoryStore()
+	s := load(t, map[string]string{"x.star": `command("Delete 99", lambda todo: todo.delete(99))`})
+
+	_, _, err := run(s, "Delete 99", store, 0)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRun_StopsRunawayScripts(t *testing.T) {
+	s := load(t, map[string]string{"x.star": `
+def spin(todo):
+    while True:
+        pass
+
+command("Spin", spin)
+`})
+
+	_, _, err := run(s, "Spin", storage.NewMemoryStore(), 0)
+	if err == nil || !strings.Contains(err.Error(), "too many steps") {
+		t.Errorf("Expected the step limit to stop the script, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = s.Run(cancelled, "Spin", controller.CommandEnv{Store: storage.NewMemoryStore()})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelling to stop the script, got %v", err)
+	}
+}
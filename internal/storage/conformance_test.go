@@ -0,0 +1,741 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// conformanceDSNs returns a fresh DSN for each registered backend. Every
+// backend registered with Register must have an entry here so that it runs
+// the conformance suite.
+func conformanceDSNs(t *testing.T) map[string]string {
+	dir := t.TempDir()
+	return map[string]string{
+		"sqlite": "sqlite://" + filepath.Join(dir, "tasks.db"),
+		"json":   "json://" + filepath.Join(dir, "tasks.json"),
+		"memory": "memory://",
+	}
+}
+
+func TestConformance_AllBackendsCovered(t *testing.T) {
+	dsns := conformanceDSNs(t)
+	for _, scheme := range Schemes() {
+		if _, ok := dsns[scheme]; !ok {
+			t.Errorf("Backend %q is registered but not covered by the conformance suite", scheme)
+		}
+	}
+}
+
+// TestConformance runs the shared behaviour checks against every backend.
+func TestConformance(t *testing.T) {
+	checks := []struct {
+		name string
+		run  func(t *testing.T, b Backend)
+	}{
+		{"AddAndGet", checkAddAndGet},
+		{"RejectsEmptyDescription", checkRejectsEmptyDescription},
+		{"Toggle", checkToggle},
+		{"Delete", checkDelete},
+		{"OpenBeforeDone", checkOpenBeforeDone},
+		{"MissingTask", checkMissingTask},
+		{"VersionConflict", checkVersionConflict},
+		{"BulkUpdates", checkBulkUpdates},
+		{"BulkAllOrNothing", checkBulkAllOrNothing},
+		{"Move", checkMove},
+		{"MoveRepeatedlyIntoSameSlot", checkMoveRepeatedlyIntoSameSlot},
+		{"RenumberKeepsDoneTasksInPlace", checkRenumberKeepsDoneTasksInPlace},
+		{"MoveNextToMissingTask", checkMoveNextToMissingTask},
+		{"SortModes", checkSortModes},
+		{"DueDate", checkDueDate},
+		{"RejectsUnknownQuery", checkRejectsUnknownQuery},
+		{"CompletedAt", checkCompletedAt},
+		{"HideDone", checkHideDone},
+		{"ArchiveCompleted", checkArchiveCompleted},
+		{"Rename", checkRename},
+		{"CreateTask", checkCreateTask},
+		{"UpdateTask", checkUpdateTask},
+		{"History", checkHistory},
+		{"HistoryOnlyForAppliedChanges", checkHistoryOnlyForAppliedChanges},
+		{"TasksAt", checkTasksAt},
+		{"ReplaceTasks", checkReplaceTasks},
+		{"CancelledContext", checkCancelledContext},
+		{"ConcurrentUse", checkConcurrentUse},
+	}
+
+	for _, scheme := range Schemes() {
+		t.Run(scheme, func(t *testing.T) {
+			for _, check := range checks {
+				t.Run(check.name, func(t *testing.T) {
+					backend, err := Open(conformanceDSNs(t)[scheme])
+					if err != nil {
+						t.Fatalf("Opening %s backend: %v", scheme, err)
+					}
+					defer backend.Close()
+					check.run(t, backend)
+				})
+			}
+		})
+	}
+
+	// The encrypting decorator must behave exactly like the backend it wraps.
+	t.Run("encrypted", func(t *testing.T) {
+		for _, check := range checks {
+			t.Run(check.name, func(t *testing.T) {
+				inner, err := Open(conformanceDSNs(t)["sqlite"])
+				if err != nil {
+					t.Fatalf("Opening sqlite backend: %v", err)
+				}
+				backend, err := EnableEncryption(ctx, inner, "correct horse")
+				if err != nil {
+					t.Fatalf("EnableEncryption failed: %v", err)
+				}
+				defer backend.Close()
+				check.run(t, backend)
+			})
+		}
+	})
+}
+
+func checkAddAndGet(t *testing.T, b Backend) {
+	id, err := b.AddTask(ctx, "Write tests")
+	if err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	tasks, err := b.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("Expected 1 task, got %d", len(tasks))
+	}
+	task := tasks[0]
+	if int64(task.ID) != id || task.Description != "Write tests" || task.Done || task.Version != 1 {
+		t.Errorf("Unexpected task %+v", task)
+	}
+	if task.CreatedAt == "" || task.UpdatedAt == "" {
+		t.Errorf("Expected timestamps to be set, got %+v", task)
+	}
+}
+
+func checkRejectsEmptyDescription(t *testing.T, b Backend) {
+	if _, err := b.AddTask(ctx, "  "); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func checkToggle(t *testing.T, b Backend) {
+	id, _ := b.AddTask(ctx, "Toggle me")
+
+	if err := b.ToggleTaskStatus(ctx, int(id), 1); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if !tasks[0].Done || tasks[0].Version != 2 {
+		t.Errorf("Expected done task at version 2, got %+v", tasks[0])
+	}
+}
+
+func checkDelete(t *testing.T, b Backend) {
+	keep, _ := b.AddTask(ctx, "Keep")
+	drop, _ := b.AddTask(ctx, "Drop")
+
+	if err := b.DeleteTask(ctx, int(drop), 0); err != nil {
+		t.Fatalf("DeleteTask failed: %v", err)
+	}
+
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || int64(tasks[0].ID) != keep {
+		t.Errorf("Expected only task %d to remain, got %+v", keep, tasks)
+	}
+}
+
+func checkOpenBeforeDone(t *testing.T, b Backend) {
+	done, _ := b.AddTask(ctx, "done")
+	b.AddTask(ctx, "open")
+	if err := b.ToggleTaskStatus(ctx, int(done), 0); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+
+	// The done task was updated last but must still sort after open tasks.
+	assertOrder(t, descriptions(t, b), []string{"open", "done"})
+}
+
+func checkMissingTask(t *testing.T, b Backend) {
+	var taskErr *TaskError
+	err := b.ToggleTaskStatus(ctx, 42, 0)
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &taskErr) || taskErr.ID != 42 {
+		t.Errorf("Expected ErrNotFound for task 42 on toggle, got %v", err)
+	}
+	if err := b.DeleteTask(ctx, 42, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on delete, got %v", err)
+	}
+}
+
+func checkVersionConflict(t *testing.T, b Backend) {
+	id, _ := b.AddTask(ctx, "Contended")
+	if err := b.ToggleTaskStatus(ctx, int(id), 1); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+
+	if err := b.ToggleTaskStatus(ctx, int(id), 1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict on stale toggle, got %v", err)
+	}
+	if err := b.DeleteTask(ctx, int(id), 1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict on stale delete, got %v", err)
+	}
+}
+
+func checkBulkUpdates(t *testing.T, b Backend) {
+	first, _ := b.AddTask(ctx, "first")
+	second, _ := b.AddTask(ctx, "second")
+	b.AddTask(ctx, "third")
+
+	if err := b.SetTasksDone(ctx, map[int]int{int(first): 1, int(second): 1}, true); err != nil {
+		t.Fatalf("SetTasksDone failed: %v", err)
+	}
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	doneCount := 0
+	for _, task := range tasks {
+		if task.Done {
+			doneCount++
+			if task.Version != 2 {
+				t.Errorf("Expected bulk-updated task to be at version 2, got %+v", task)
+			}
+		}
+	}
+	if doneCount != 2 {
+		t.Errorf("Expected 2 done tasks, got %d", doneCount)
+	}
+
+	if err := b.DeleteTasks(ctx, map[int]int{int(first): 0, int(second): 0}); err != nil {
+		t.Fatalf("DeleteTasks failed: %v", err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"third"})
+}
+
+func checkBulkAllOrNothing(t *testing.T, b Backend) {
+	first, _ := b.AddTask(ctx, "first")
+	second, _ := b.AddTask(ctx, "second")
+
+	err := b.SetTasksDone(ctx, map[int]int{int(first): 1, int(second): 99}, true)
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict for stale version, got %v", err)
+	}
+	err = b.DeleteTasks(ctx, map[int]int{int(first): 0, 42: 0})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for missing task, got %v", err)
+	}
+
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 2 {
+		t.Fatalf("Expected both tasks to survive failed bulk delete, got %+v", tasks)
+	}
+	for _, task := range tasks {
+		if task.Done || task.Version != 1 {
+			t.Errorf("Expected task untouched by failed bulk update, got %+v", task)
+		}
+	}
+}
+
+func addInOrder(t *testing.T, b Backend, order ...string) map[string]int {
+	t.Helper()
+	ids := make(map[string]int)
+	// Tasks are added to the top, so add in reverse to list them in order.
+	for i := len(order) - 1; i >= 0; i-- {
+		id, err := b.AddTask(ctx, order[i])
+		if err != nil {
+			t.Fatalf("AddTask failed: %v", err)
+		}
+		ids[order[i]] = int(id)
+	}
+	assertOrder(t, descriptions(t, b), order)
+	return ids
+}
+
+func checkMove(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "a", "b", "c", "d")
+
+	// Move "d" up between "a" and "b".
+	if err := b.MoveTasks(ctx, []int{ids["d"]}, map[int]int{ids["d"]: 1}, ids["a"], ids["b"]); err != nil {
+		t.Fatalf("MoveTasks failed: %v", err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"a", "d", "b", "c"})
+
+	// Move "a" and "b" together to the end.
+	if err := b.MoveTasks(ctx, []int{ids["a"], ids["b"]}, nil, ids["c"], 0); err != nil {
+		t.Fatalf("MoveTasks failed: %v", err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"d", "c", "a", "b"})
+
+	// Move "b" to the start.
+	if err := b.MoveTasks(ctx, []int{ids["b"]}, nil, 0, ids["d"]); err != nil {
+		t.Fatalf("MoveTasks failed: %v", err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"b", "d", "c", "a"})
+
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	for _, task := range tasks {
+		if task.Description == "d" && task.Version != 2 {
+			t.Errorf("Expected moved task to be at version 2, got %+v", task)
+		}
+	}
+
+	if err := b.MoveTasks(ctx, []int{ids["d"]}, map[int]int{ids["d"]: 1}, 0, ids["b"]); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict moving with a stale version, got %v", err)
+	}
+}
+
+func checkMoveRepeatedlyIntoSameSlot(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "a", "b", "c")
+
+	// Alternately moving "b" and "c" between "a" and the other one halves
+	// the gap every time, which eventually forces a renumbering.
+	for i := 0; i < 100; i++ {
+		mover, other := ids["b"], ids["c"]
+		if i%2 == 1 {
+			mover, other = other, mover
+		}
+		if err := b.MoveTasks(ctx, []int{mover}, nil, ids["a"], other); err != nil {
+			t.Fatalf("Move %d failed: %v", i, err)
+		}
+	}
+	// The last move put "c" between "a" and "b".
+	assertOrder(t, descriptions(t, b), []string{"a", "c", "b"})
+}
+
+func checkRenumberKeepsDoneTasksInPlace(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "a", "x", "b", "c")
+	if err := b.ToggleTaskStatus(ctx, ids["x"], 0); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+
+	// Force a renumbering right after the done task. In a view that doesn't
+	// group by status it must stay where the user put it.
+	for i := 0; i < 100; i++ {
+		mover, other := ids["b"], ids["c"]
+		if i%2 == 1 {
+			mover, other = other, mover
+		}
+		if err := b.MoveTasks(ctx, []int{mover}, nil, ids["x"], other); err != nil {
+			t.Fatalf("Move %d failed: %v", i, err)
+		}
+	}
+	assertOrder(t, queryDescriptions(t, b, models.TaskQuery{Group: models.GroupNone}), []string{"a", "x", "c", "b"})
+}
+
+func checkMoveNextToMissingTask(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "a", "b")
+
+	if err := b.MoveTasks(ctx, []int{ids["a"]}, nil, ids["b"], 42); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict moving next to a missing task, got %v", err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"a", "b"})
+}
+
+func checkSortModes(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "banana", "Cherry", "apple")
+	if err := b.SetTaskDue(ctx, ids["apple"], 0, "2026-11-02"); err != nil {
+		t.Fatalf("SetTaskDue failed: %v", err)
+	}
+	if err := b.SetTaskDue(ctx, ids["Cherry"], 0, "2026-11-01"); err != nil {
+		t.Fatalf("SetTaskDue failed: %v", err)
+	}
+	if err := b.ToggleTaskStatus(ctx, ids["Cherry"], 0); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+
+	tests := []struct {
+		query models.TaskQuery
+		want  []string
+	}{
+		{models.TaskQuery{}, []string{"banana", "apple", "Cherry"}},
+		{models.TaskQuery{Group: models.GroupNone}, []string{"banana", "Cherry", "apple"}},
+		{models.TaskQuery{Sort: models.SortCreated, Group: models.GroupNone}, []string{"banana", "Cherry", "apple"}},
+		{models.TaskQuery{Sort: models.SortAlphabetical, Group: models.GroupNone}, []string{"apple", "banana", "Cherry"}},
+		{models.TaskQuery{Sort: models.SortAlphabetical}, []string{"apple", "banana", "Cherry"}},
+		{models.TaskQuery{Sort: models.SortDue, Group: models.GroupNone}, []string{"Cherry", "apple", "banana"}},
+		{models.TaskQuery{Sort: models.SortDue}, []string{"apple", "banana", "Cherry"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.query.Sort, tt.query.Group), func(t *testing.T) {
+			assertOrder(t, queryDescriptions(t, b, tt.query), tt.want)
+		})
+	}
+}
+
+func checkDueDate(t *testing.T, b Backend) {
+	id, _ := b.AddTask(ctx, "File taxes")
+
+	if err := b.SetTaskDue(ctx, int(id), 1, "2026-12-31"); err != nil {
+		t.Fatalf("SetTaskDue failed: %v", err)
+	}
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Due != "2026-12-31" || tasks[0].Version != 2 {
+		t.Errorf("Expected due date at version 2, got %+v", tasks[0])
+	}
+
+	if err := b.SetTaskDue(ctx, int(id), 1, ""); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict on stale due date, got %v", err)
+	}
+	if err := b.SetTaskDue(ctx, int(id), 0, "31/12/2026"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a malformed date, got %v", err)
+	}
+	if err := b.SetTaskDue(ctx, 42, 0, "2026-12-31"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing task, got %v", err)
+	}
+
+	if err := b.SetTaskDue(ctx, int(id), 0, ""); err != nil {
+		t.Fatalf("Clearing due date failed: %v", err)
+	}
+	tasks, _ = b.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Due != "" {
+		t.Errorf("Expected due date to be cleared, got %+v", tasks[0])
+	}
+}
+
+func checkRejectsUnknownQuery(t *testing.T, b Backend) {
+	if _, err := b.GetTasks(ctx, models.TaskQuery{Sort: "random"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown sort mode, got %v", err)
+	}
+	if _, err := b.GetTasks(ctx, models.TaskQuery{Group: "weekday"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown group mode, got %v", err)
+	}
+}
+
+func checkCompletedAt(t *testing.T, b Backend) {
+	id, _ := b.AddTask(ctx, "Finish me")
+
+	b.ToggleTaskStatus(ctx, int(id), 0)
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].CompletedAt == "" {
+		t.Errorf("Expected completion time to be set, got %+v", tasks[0])
+	}
+
+	b.SetTasksDone(ctx, map[int]int{int(id): 0}, false)
+	tasks, _ = b.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].CompletedAt != "" {
+		t.Errorf("Expected completion time to be cleared on reopen, got %+v", tasks[0])
+	}
+}
+
+func checkHideDone(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "open", "done")
+	b.ToggleTaskStatus(ctx, ids["done"], 0)
+
+	assertOrder(t, queryDescriptions(t, b, models.TaskQuery{HideDone: true}), []string{"open"})
+}
+
+func checkArchiveCompleted(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "open", "old", "older")
+	b.SetTasksDone(ctx, map[int]int{ids["old"]: 0, ids["older"]: 0}, true)
+
+	// Nothing was completed more than an hour ago.
+	if n, err := b.ArchiveCompleted(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("Expected nothing archived, got n=%d err=%v", n, err)
+	}
+	n, err := b.ArchiveCompleted(ctx, time.Now().Add(time.Hour))
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 tasks archived, got n=%d err=%v", n, err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"open"})
+
+	archived, err := b.GetArchivedTasks(ctx)
+	if err != nil {
+		t.Fatalf("GetArchivedTasks failed: %v", err)
+	}
+	if len(archived) != 2 || archived[0].ArchivedAt == "" || archived[0].CompletedAt == "" {
+		t.Fatalf("Expected 2 archived tasks with timestamps, got %+v", archived)
+	}
+
+	// Reopening an archived task brings it back to the list, unless it
+	// changed since the archive was read.
+	old := archived[0]
+	if old.ID != ids["old"] {
+		old = archived[1]
+	}
+	if err := b.ToggleTaskStatus(ctx, old.ID, old.Version-1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict on a stale reopen, got %v", err)
+	}
+	if err := b.ToggleTaskStatus(ctx, old.ID, old.Version); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+	assertOrder(t, descriptions(t, b), []string{"open", "old"})
+	if archived, _ := b.GetArchivedTasks(ctx); len(archived) != 1 || archived[0].Description != "older" {
+		t.Errorf("Expected only 'older' to stay archived, got %+v", archived)
+	}
+}
+
+func checkRename(t *testing.T, b Backend) {
+	id, _ := b.AddTask(ctx, "Buy mlik")
+
+	if err := b.RenameTask(ctx, int(id), 1, "Buy milk"); err != nil {
+		t.Fatalf("RenameTask failed: %v", err)
+	}
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Description != "Buy milk" || tasks[0].Version != 2 {
+		t.Errorf("Expected renamed task at version 2, got %+v", tasks[0])
+	}
+
+	if err := b.RenameTask(ctx, int(id), 1, "Buy oat milk"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict on stale rename, got %v", err)
+	}
+	if err := b.RenameTask(ctx, int(id), 0, " "); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an empty description, got %v", err)
+	}
+}
+
+func checkCreateTask(t *testing.T, b Backend) {
+	id, err := b.CreateTask(ctx, models.Task{Description: "Pay rent", Due: "2026-11-01", Done: true})
+	if err != nil {
+		t.Fatalf("CreateTask failed: %v", err)
+	}
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Due != "2026-11-01" || !tasks[0].Done || tasks[0].CompletedAt == "" {
+		t.Fatalf("Expected a done task due 2026-11-01, got %+v", tasks)
+	}
+	assertOrder(t, historyKinds(t, b, int(id)), []string{"created", "due_changed", "completed"})
+
+	// A bad due date adds nothing.
+	if _, err := b.CreateTask(ctx, models.Task{Description: "x", Due: "soon"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a bad due date, got %v", err)
+	}
+	if tasks, _ := b.GetTasks(ctx, models.TaskQuery{}); len(tasks) != 1 {
+		t.Errorf("Expected no task added, got %+v", tasks)
+	}
+}
+
+func checkUpdateTask(t *testing.T, b Backend) {
+	id, _ := b.AddTask(ctx, "Buy mlik")
+
+	edit := models.Task{Description: "Buy milk", Due: "2026-12-01", Done: true}
+	if err := b.UpdateTask(ctx, int(id), 1, edit); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	got := tasks[0]
+	if got.Description != "Buy milk" || got.Due != "2026-12-01" || !got.Done || got.Version != 2 {
+		t.Errorf("Expected the edit saved as one change at version 2, got %+v", got)
+	}
+	assertOrder(t, historyKinds(t, b, int(id)), []string{"created", "renamed", "due_changed", "completed"})
+
+	if err := b.UpdateTask(ctx, int(id), 1, edit); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict on a stale update, got %v", err)
+	}
+	if err := b.UpdateTask(ctx, 999, 0, edit); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing task, got %v", err)
+	}
+	// Nothing is saved if any field is invalid.
+	if err := b.UpdateTask(ctx, int(id), 0, models.Task{Description: "Buy oat milk", Due: "soon"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a bad due date, got %v", err)
+	}
+	if tasks, _ := b.GetTasks(ctx, models.TaskQuery{}); tasks[0].Description != "Buy milk" {
+		t.Errorf("Expected the invalid edit not saved, got %+v", tasks[0])
+	}
+
+	// Reopening clears the completion time.
+	edit.Done = false
+	if err := b.UpdateTask(ctx, int(id), 0, edit); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	if tasks, _ := b.GetTasks(ctx, models.TaskQuery{}); tasks[0].Done || tasks[0].CompletedAt != "" {
+		t.Errorf("Expected the task reopened, got %+v", tasks[0])
+	}
+}
+
+// historyKinds returns the kinds of the events recorded for a task.
+func historyKinds(t *testing.T, b Backend, id int) []string {
+	t.Helper()
+	events, err := b.GetTaskHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("GetTaskHistory failed: %v", err)
+	}
+	var kinds []string
+	for _, e := range events {
+		if e.TaskID != id || e.At == "" {
+			t.Errorf("Unexpected event %+v for task %d", e, id)
+		}
+		kinds = append(kinds, string(e.Kind))
+	}
+	return kinds
+}
+
+func checkHistory(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "a", "b")
+	a := ids["a"]
+	b.RenameTask(ctx, a, 0, "renamed")
+	b.ToggleTaskStatus(ctx, a, 0)
+	b.ToggleTaskStatus(ctx, a, 0)
+	b.SetTaskDue(ctx, a, 0, "2026-12-01")
+	b.MoveTasks(ctx, []int{a}, nil, ids["b"], 0)
+	b.SetTasksDone(ctx, map[int]int{a: 0}, true)
+	b.ArchiveCompleted(ctx, time.Now().Add(time.Hour))
+	b.DeleteTask(ctx, a, 0)
+
+	// The history outlives the task.
+	assertOrder(t, historyKinds(t, b, a), []string{
+		"created", "renamed", "completed", "reopened", "due_changed", "moved", "completed", "archived", "deleted",
+	})
+	events, _ := b.GetTaskHistory(ctx, a)
+	if events[0].Detail != "a" || events[1].Detail != "renamed" || events[4].Detail != "2026-12-01" {
+		t.Errorf("Expected event details to carry the new values, got %+v", events)
+	}
+	assertOrder(t, historyKinds(t, b, ids["b"]), []string{"created"})
+}
+
+func checkHistoryOnlyForAppliedChanges(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "open", "done")
+	b.ToggleTaskStatus(ctx, ids["done"], 0)
+
+	// Completing an already completed task is not a change.
+	b.SetTasksDone(ctx, map[int]int{ids["done"]: 0}, true)
+	assertOrder(t, historyKinds(t, b, ids["done"]), []string{"created", "completed"})
+
+	// A rejected bulk update leaves no trace.
+	err := b.SetTasksDone(ctx, map[int]int{ids["open"]: 0, ids["done"]: 1}, false)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected ErrConflict, got %v", err)
+	}
+	assertOrder(t, historyKinds(t, b, ids["open"]), []string{"created"})
+	assertOrder(t, historyKinds(t, b, ids["done"]), []string{"created", "completed"})
+}
+
+func checkTasksAt(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "kept", "deleted")
+	b.ToggleTaskStatus(ctx, ids["kept"], 0)
+	b.DeleteTask(ctx, ids["deleted"], 0)
+
+	before, err := b.TasksAt(ctx, time.Now().Add(-time.Hour))
+	if err != nil || len(before) != 0 {
+		t.Errorf("Expected no tasks before any were added, got %+v (err %v)", before, err)
+	}
+
+	after, err := b.TasksAt(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("TasksAt failed: %v", err)
+	}
+	if len(after) != 1 || after[0].ID != ids["kept"] || !after[0].Done || after[0].Version != 2 {
+		t.Errorf("Expected the current state of 'kept' only, got %+v", after)
+	}
+}
+
+func checkReplaceTasks(t *testing.T, b Backend) {
+	ids := addInOrder(t, b, "a", "b")
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	snapshot := findByDescription(t, tasks, "a")
+	b.RenameTask(ctx, ids["a"], 0, "a renamed")
+	b.DeleteTask(ctx, ids["b"], 0)
+	c, _ := b.AddTask(ctx, "c")
+
+	// Put back "a" as it was, drop "c" and bring back "b" under its old ID.
+	restoredB := models.Task{ID: ids["b"], Description: "b", Version: 1, Position: 5000, CreatedAt: "2026-01-01 09:00:00", UpdatedAt: "2026-01-01 09:00:00"}
+	if err := b.ReplaceTasks(ctx, []models.Task{snapshot, restoredB}, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+
+	assertOrder(t, descriptions(t, b), []string{"a", "b"})
+	tasks, _ = b.GetTasks(ctx, models.TaskQuery{})
+	a := findByDescription(t, tasks, "a")
+	if a.ID != ids["a"] || a.Version != 3 || a.UpdatedAt != snapshot.UpdatedAt {
+		t.Errorf("Expected 'a' overwritten with a newer version, got %+v", a)
+	}
+	if got := findByDescription(t, tasks, "b"); got.ID != ids["b"] || got.CreatedAt != "2026-01-01 09:00:00" {
+		t.Errorf("Expected 'b' restored as given, got %+v", got)
+	}
+	assertOrder(t, historyKinds(t, b, int(c)), []string{"created", "deleted"})
+
+	// Replacing with what is already stored changes and logs nothing.
+	tasks, _ = b.GetTasks(ctx, models.TaskQuery{})
+	before := len(historyKinds(t, b, ids["a"]))
+	if err := b.ReplaceTasks(ctx, tasks, map[string]string{"replaced": "yes"}); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+	if value, _ := b.GetMeta(ctx, "replaced"); value != "yes" {
+		t.Errorf("Expected the setting saved with the tasks, got %q", value)
+	}
+	again, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if got := findByDescription(t, again, "a"); got.Version != a.Version {
+		t.Errorf("Expected an unchanged task to keep version %d, got %d", a.Version, got.Version)
+	}
+	if after := len(historyKinds(t, b, ids["a"])); after != before {
+		t.Errorf("Expected no new events for an unchanged task, got %d after %d", after, before)
+	}
+
+	// New tasks must not reuse restored IDs.
+	d, _ := b.AddTask(ctx, "d")
+	if int(d) == ids["a"] || int(d) == ids["b"] {
+		t.Errorf("New task reused ID %d", d)
+	}
+
+	if err := b.ReplaceTasks(ctx, []models.Task{restoredB, restoredB}, map[string]string{"replaced": "no"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for duplicate IDs, got %v", err)
+	}
+	if value, _ := b.GetMeta(ctx, "replaced"); value != "yes" {
+		t.Errorf("Expected a failed replace to save no settings, got %q", value)
+	}
+}
+
+func findByDescription(t *testing.T, tasks []models.Task, description string) models.Task {
+	t.Helper()
+	for _, task := range tasks {
+		if task.Description == description {
+			return task
+		}
+	}
+	t.Fatalf("Task %q not in %+v", description, tasks)
+	return models.Task{}
+}
+
+func checkCancelledContext(t *testing.T, b Backend) {
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := b.AddTask(cancelled, "Never stored"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	tasks, _ := b.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 0 {
+		t.Errorf("Expected no tasks after cancelled add, got %+v", tasks)
+	}
+}
+
+func checkConcurrentUse(t *testing.T, b Backend) {
+	const workers = 8
+	const perWorker = 10
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id, err := b.AddTask(ctx, fmt.Sprintf("task %d-%d", worker, i))
+				if err != nil {
+					t.Errorf("AddTask failed: %v", err)
+					continue
+				}
+				if err := b.ToggleTaskStatus(ctx, int(id), 0); err != nil {
+					t.Errorf("ToggleTaskStatus failed: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	tasks, err := b.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if len(tasks) != workers*perWorker {
+		t.Errorf("Expected %d tasks, got %d", workers*perWorker, len(tasks))
+	}
+}
@@ -0,0 +1,492 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go-todo/internal/models"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// encryptionMetaKey is the setting holding the wrapped data key of an
+// encrypted database.
+const encryptionMetaKey = "encryption"
+
+// sealedPrefix marks an encrypted value. Values without it were stored
+// before encryption was turned on and are read as they are.
+const sealedPrefix = "enc:v1:"
+
+// keySize is the AES-256 key length, for both the data key and the key
+// derived from the passphrase.
+const keySize = 32
+
+// keyParams is the stored form of an encryption key. Task text is sealed
+// with a random data key, which is itself sealed with a key derived from
+// the passphrase. Changing the passphrase only rewraps the data key, so the
+// append-only change log never has to be rewritten.
+type keyParams struct {
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory_kib"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	// Key is the sealed data key, nonce first.
+	Key []byte `json:"key"`
+}
+
+// defaultKDF is the Argon2id cost used for new passphrases. The cost is
+// stored with the key, so raising it later does not lock anyone out.
+var defaultKDF = keyParams{KDF: "argon2id", Time: 1, Memory: 64 * 1024, Threads: 4}
+
+// newAEAD returns AES-GCM for key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrap seals dataKey with a key derived from passphrase under a fresh salt.
+func wrap(dataKey []byte, passphrase string) (keyParams, error) {
+	if passphrase == "" {
+		return keyParams{}, fmt.Errorf("%w: passphrase cannot be empty", ErrInvalidInput)
+	}
+	p := defaultKDF
+	p.Salt = make([]byte, 16)
+	if _, err := rand.Read(p.Salt); err != nil {
+		return keyParams{}, fmt.Errorf("generating salt: %w", err)
+	}
+	aead, err := newAEAD(argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, keySize))
+	if err != nil {
+		return keyParams{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return keyParams{}, fmt.Errorf("generating nonce: %w", err)
+	}
+	p.Key = aead.Seal(nonce, nonce, dataKey, nil)
+	return p, nil
+}
+
+// unwrap recovers the data key, failing with ErrWrongPassphrase if the
+// passphrase does not open it.
+func (p keyParams) unwrap(passphrase string) ([]byte, error) {
+	if p.KDF != "argon2id" {
+		return nil, fmt.Errorf("%w: unknown key derivation %q", ErrCorrupt, p.KDF)
+	}
+	aead, err := newAEAD(argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, keySize))
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Key) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: stored key is truncated", ErrCorrupt)
+	}
+	nonce, sealed := p.Key[:aead.NonceSize()], p.Key[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return dataKey, nil
+}
+
+func loadKey(ctx context.Context, b Backend) (keyParams, bool, error) {
+	value, err := b.GetMeta(ctx, encryptionMetaKey)
+	if err != nil || value == "" {
+		return keyParams{}, false, err
+	}
+	var p keyParams
+	if err := json.Unmarshal([]byte(value), &p); err != nil {
+		return keyParams{}, false, fmt.Errorf("%w: reading encryption key: %w", ErrCorrupt, err)
+	}
+	return p, true, nil
+}
+
+func saveKey(ctx context.Context, b Backend, p keyParams) error {
+	value, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encoding encryption key: %w", err)
+	}
+	return b.SetMeta(ctx, encryptionMetaKey, string(value))
+}
+
+// IsEncrypted reports whether b holds encrypted tasks and must be opened
+// with Unlock.
+func IsEncrypted(ctx context.Context, b Backend) (bool, error) {
+	_, ok, err := loadKey(ctx, b)
+	return ok, err
+}
+
+// RequirePlaintext returns an error if b is encrypted, naming the feature
+// that cannot work with it. Features that copy the tasks out of the
+// database, to a sync target, a server's clients or a webhook, would hand
+// over the descriptions in plain text and so defeat the encryption.
+func RequirePlaintext(ctx context.Context, b Backend, feature string) error {
+	encrypted, err := IsEncrypted(ctx, b)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return fmt.Errorf("%s cannot be used with an encrypted database", feature)
+	}
+	return nil
+}
+
+// Unlock opens an encrypted backend with passphrase.
+func Unlock(ctx context.Context, b Backend, passphrase string) (*EncryptedStore, error) {
+	p, ok, err := loadKey(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: database is not encrypted", ErrInvalidInput)
+	}
+	dataKey, err := p.unwrap(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return newEncryptedStore(b, dataKey)
+}
+
+// EnableEncryption turns on encryption for a plain backend and encrypts the
+// tasks it already holds, together with the descriptions in their history,
+// in one transaction: if any of it fails the database stays unencrypted.
+// Copies and backups made earlier keep the plain text.
+func EnableEncryption(ctx context.Context, b Backend, passphrase string) (*EncryptedStore, error) {
+	if encrypted, err := IsEncrypted(ctx, b); err != nil {
+		return nil, err
+	} else if encrypted {
+		return nil, fmt.Errorf("%w: database is already encrypted", ErrInvalidInput)
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+	p, err := wrap(dataKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEncryptedStore(b, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("encoding encryption key: %w", err)
+	}
+	if err := b.RewriteDescriptions(ctx, e.seal, map[string]string{encryptionMetaKey: string(key)}); err != nil {
+		return nil, fmt.Errorf("encrypting existing tasks: %w", err)
+	}
+	return e, nil
+}
+
+// Rekey changes the passphrase of an encrypted backend. The data itself is
+// not re-encrypted, so copies of the database made earlier still open with
+// the old passphrase.
+func Rekey(ctx context.Context, b Backend, oldPassphrase, newPassphrase string) error {
+	p, ok, err := loadKey(ctx, b)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: database is not encrypted", ErrInvalidInput)
+	}
+	dataKey, err := p.unwrap(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	rewrapped, err := wrap(dataKey, newPassphrase)
+	if err != nil {
+		return err
+	}
+	return saveKey(ctx, b, rewrapped)
+}
+
+// ShareKey copies the encryption key of from, if it has one, to the
+// backend to, so that encrypted tasks copied between them stay readable.
+func ShareKey(ctx context.Context, from, to Backend) error {
+	value, err := from.GetMeta(ctx, encryptionMetaKey)
+	if err != nil || value == "" {
+		return err
+	}
+	existing, err := to.GetMeta(ctx, encryptionMetaKey)
+	if err != nil {
+		return err
+	}
+	if existing != "" && existing != value {
+		return fmt.Errorf("%w: target database has a different encryption key", ErrInvalidInput)
+	}
+	return to.SetMeta(ctx, encryptionMetaKey, value)
+}
+
+// EncryptedStore wraps a backend so that task descriptions are stored
+// encrypted with AES-GCM and decrypted on the way out. Everything else is
+// passed through unchanged.
+type EncryptedStore struct {
+	inner Backend
+	aead  cipher.AEAD
+}
+
+func newEncryptedStore(inner Backend, dataKey []byte) (*EncryptedStore, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedStore{inner: inner, aead: aead}, nil
+}
+
+func (e *EncryptedStore) seal(plaintext string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := e.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *EncryptedStore) open(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < e.aead.NonceSize() {
+		return "", fmt.Errorf("%w: malformed encrypted value", ErrCorrupt)
+	}
+	nonce, sealed := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: encrypted value does not decrypt", ErrCorrupt)
+	}
+	return string(plaintext), nil
+}
+
+func (e *EncryptedStore) openTasks(tasks []models.Task) error {
+	for i := range tasks {
+		description, err := e.open(tasks[i].Description)
+		if err != nil {
+			return err
+		}
+		tasks[i].Description = description
+	}
+	return nil
+}
+
+// GetTasks decrypts the listed tasks. Alphabetical order is restored here,
+// since the backend can only have sorted the ciphertext.
+func (e *EncryptedStore) GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
+	tasks, err := e.inner.GetTasks(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.openTasks(tasks); err != nil {
+		return nil, err
+	}
+	if query = query.WithDefaults(); query.Sort == models.SortAlphabetical {
+		sort.SliceStable(tasks, func(i, j int) bool { return compareTasks(query, tasks[i], tasks[j]) < 0 })
+	}
+	return tasks, nil
+}
+
+func (e *EncryptedStore) AddTask(ctx context.Context, description string) (int64, error) {
+	if strings.TrimSpace(description) == "" {
+		return 0, fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	sealed, err := e.seal(description)
+	if err != nil {
+		return 0, err
+	}
+	return e.inner.AddTask(ctx, sealed)
+}
+
+func (e *EncryptedStore) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	if strings.TrimSpace(task.Description) == "" {
+		return 0, fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	sealed, err := e.seal(task.Description)
+	if err != nil {
+		return 0, err
+	}
+	task.Description = sealed
+	return e.inner.CreateTask(ctx, task)
+}
+
+func (e *EncryptedStore) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
+	return e.inner.ToggleTaskStatus(ctx, id, expectedVersion)
+}
+
+func (e *EncryptedStore) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
+	return e.inner.DeleteTask(ctx, id, expectedVersion)
+}
+
+func (e *EncryptedStore) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	if strings.TrimSpace(description) == "" {
+		return fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	sealed, err := e.seal(description)
+	if err != nil {
+		return err
+	}
+	return e.inner.RenameTask(ctx, id, expectedVersion, sealed)
+}
+
+func (e *EncryptedStore) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	return e.inner.SetTaskDue(ctx, id, expectedVersion, due)
+}
+
+func (e *EncryptedStore) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	if strings.TrimSpace(edit.Description) == "" {
+		return fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	// Sealing the description again would store a new ciphertext, which
+	// the backend records as a rename, so an unchanged one is kept as is.
+	stored, err := FindTask(ctx, e.inner, id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	sealed := ""
+	if err == nil {
+		if description, err := e.open(stored.Description); err == nil && description == edit.Description {
+			sealed = stored.Description
+			if expectedVersion == 0 {
+				// Don't put back a description renamed meanwhile.
+				expectedVersion = stored.Version
+			}
+		}
+	}
+	if sealed == "" {
+		if sealed, err = e.seal(edit.Description); err != nil {
+			return err
+		}
+	}
+	edit.Description = sealed
+	return e.inner.UpdateTask(ctx, id, expectedVersion, edit)
+}
+
+func (e *EncryptedStore) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	return e.inner.SetTasksDone(ctx, versions, done)
+}
+
+func (e *EncryptedStore) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	return e.inner.ArchiveCompleted(ctx, cutoff)
+}
+
+func (e *EncryptedStore) GetArchivedTasks(ctx context.Context) ([]models.Task, error) {
+	tasks, err := e.inner.GetArchivedTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, e.openTasks(tasks)
+}
+
+// GetTaskHistory decrypts the descriptions carried by events: the detail of
+// creations and renames, and every recorded state.
+func (e *EncryptedStore) GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error) {
+	events, err := e.inner.GetTaskHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range events {
+		if events[i].Detail, err = e.open(events[i].Detail); err != nil {
+			return nil, err
+		}
+		if state := events[i].State; state != nil {
+			opened := *state
+			if opened.Description, err = e.open(state.Description); err != nil {
+				return nil, err
+			}
+			events[i].State = &opened
+		}
+	}
+	return events, nil
+}
+
+func (e *EncryptedStore) TasksAt(ctx context.Context, at time.Time) ([]models.Task, error) {
+	tasks, err := e.inner.TasksAt(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, e.openTasks(tasks)
+}
+
+// ReplaceTasks seals the descriptions of the new task set. A description
+// that is already stored keeps its ciphertext, since sealing it again would
+// make an unchanged task look changed.
+func (e *EncryptedStore) ReplaceTasks(ctx context.Context, tasks []models.Task, meta map[string]string) error {
+	stored, err := ExportTasks(ctx, e.inner)
+	if err != nil {
+		return err
+	}
+	current := make(map[int]string, len(stored))
+	for _, t := range stored {
+		current[t.ID] = t.Description
+	}
+
+	sealed := make([]models.Task, len(tasks))
+	for i, t := range tasks {
+		if existing, ok := current[t.ID]; ok {
+			if plaintext, err := e.open(existing); err == nil && plaintext == t.Description && existing != plaintext {
+				t.Description = existing
+				sealed[i] = t
+				continue
+			}
+		}
+		description, err := e.seal(t.Description)
+		if err != nil {
+			return err
+		}
+		t.Description = description
+		sealed[i] = t
+	}
+	return e.inner.ReplaceTasks(ctx, sealed, meta)
+}
+
+func (e *EncryptedStore) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	return e.inner.DeleteTasks(ctx, versions)
+}
+
+func (e *EncryptedStore) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	return e.inner.MoveTasks(ctx, ids, versions, prevID, nextID)
+}
+
+func (e *EncryptedStore) GetMeta(ctx context.Context, key string) (string, error) {
+	return e.inner.GetMeta(ctx, key)
+}
+
+func (e *EncryptedStore) SetMeta(ctx context.Context, key, value string) error {
+	return e.inner.SetMeta(ctx, key, value)
+}
+
+// RewriteDescriptions hands rewrite the plain text and seals what it
+// returns.
+func (e *EncryptedStore) RewriteDescriptions(ctx context.Context, rewrite func(string) (string, error), meta map[string]string) error {
+	return e.inner.RewriteDescriptions(ctx, func(value string) (string, error) {
+		plaintext, err := e.open(value)
+		if err != nil {
+			return "", err
+		}
+		rewritten, err := rewrite(plaintext)
+		if err != nil {
+			return "", err
+		}
+		return e.seal(rewritten)
+	}, meta)
+}
+
+func (e *EncryptedStore) DataVersion(ctx context.Context) (int64, error) {
+	return e.inner.DataVersion(ctx)
+}
+
+func (e *EncryptedStore) Close() {
+	e.inner.Close()
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+func TestEncryptedStore_StoresCiphertext(t *testing.T) {
+	inner := NewMemoryStore()
+	enc, err := EnableEncryption(ctx, inner, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	id, err := enc.AddTask(ctx, "Call ACME Corp")
+	if err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	if err := enc.RenameTask(ctx, int(id), 0, "Call Globex"); err != nil {
+		t.Fatalf("RenameTask failed: %v", err)
+	}
+
+	raw, _ := inner.GetTasks(ctx, models.TaskQuery{})
+	if len(raw) != 1 || !strings.HasPrefix(raw[0].Description, sealedPrefix) {
+		t.Fatalf("Expected an encrypted description, got %+v", raw)
+	}
+	rawEvents, _ := inner.GetTaskHistory(ctx, int(id))
+	for _, e := range rawEvents {
+		if strings.Contains(e.Detail, "ACME") || strings.Contains(e.Detail, "Globex") ||
+			(e.State != nil && strings.Contains(e.State.Description, "Globex")) {
+			t.Errorf("Expected no plaintext in the change log, got %+v", e)
+		}
+	}
+
+	events, err := enc.GetTaskHistory(ctx, int(id))
+	if err != nil {
+		t.Fatalf("GetTaskHistory failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Detail != "Call ACME Corp" || events[1].State.Description != "Call Globex" {
+		t.Errorf("Expected decrypted history, got %+v", events)
+	}
+}
+
+func TestEncryptedStore_UnlockAndRekey(t *testing.T) {
+	inner := NewMemoryStore()
+	enc, err := EnableEncryption(ctx, inner, "old")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	enc.AddTask(ctx, "a")
+
+	if encrypted, _ := IsEncrypted(ctx, inner); !encrypted {
+		t.Error("Expected the backend to report encryption")
+	}
+	if _, err := Unlock(ctx, inner, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := Rekey(ctx, inner, "wrong", "new"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected ErrWrongPassphrase rekeying with a wrong passphrase, got %v", err)
+	}
+	if err := Rekey(ctx, inner, "old", "new"); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if _, err := Unlock(ctx, inner, "old"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Expected the old passphrase to stop working, got %v", err)
+	}
+	unlocked, err := Unlock(ctx, inner, "new")
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if tasks, _ := unlocked.GetTasks(ctx, models.TaskQuery{}); len(tasks) != 1 || tasks[0].Description != "a" {
+		t.Errorf("Expected the task readable after rekeying, got %+v", tasks)
+	}
+}
+
+func TestEncryptedStore_UpdateTaskKeepsUnchangedDescription(t *testing.T) {
+	enc, err := EnableEncryption(ctx, NewMemoryStore(), "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	id, _ := enc.CreateTask(ctx, models.Task{Description: "Call ACME Corp", Due: "2026-11-01"})
+
+	if err := enc.UpdateTask(ctx, int(id), 0, models.Task{Description: "Call ACME Corp", Done: true}); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	events, _ := enc.GetTaskHistory(ctx, int(id))
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, string(e.Kind))
+	}
+	if strings.Join(kinds, " ") != "created due_changed due_changed completed" {
+		t.Errorf("Expected no rename recorded, got %v", kinds)
+	}
+	if tasks, _ := enc.GetTasks(ctx, models.TaskQuery{}); tasks[0].Description != "Call ACME Corp" || !tasks[0].Done {
+		t.Errorf("Expected the task done with its description, got %+v", tasks[0])
+	}
+}
+
+func TestEncryptedStore_UpdateArchivedTask(t *testing.T) {
+	enc, err := EnableEncryption(ctx, NewMemoryStore(), "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	id, _ := enc.CreateTask(ctx, models.Task{Description: "Call ACME Corp", Done: true})
+	if n, err := enc.ArchiveCompleted(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Expected the task archived, got %d, %v", n, err)
+	}
+
+	if err := enc.UpdateTask(ctx, int(id), 0, models.Task{Description: "Call ACME Corp", Due: "2026-11-01", Done: true}); err != nil {
+		t.Fatalf("UpdateTask failed: %v", err)
+	}
+	events, _ := enc.GetTaskHistory(ctx, int(id))
+	for _, e := range events {
+		if e.Kind == models.EventRenamed {
+			t.Errorf("Expected no rename recorded for an archived task, got %+v", events)
+		}
+	}
+}
+
+func TestRequirePlaintext(t *testing.T) {
+	inner := NewMemoryStore()
+	if err := RequirePlaintext(ctx, inner, "git sync"); err != nil {
+		t.Errorf("Expected a plain backend to pass, got %v", err)
+	}
+	enc, err := EnableEncryption(ctx, inner, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	for _, b := range []Backend{inner, enc} {
+		err := RequirePlaintext(ctx, b, "git sync")
+		if err == nil || err.Error() != "git sync cannot be used with an encrypted database" {
+			t.Errorf("Expected git sync to be refused, got %v", err)
+		}
+	}
+}
+
+func TestEnableEncryption_EncryptsExistingTasks(t *testing.T) {
+	inner := NewMemoryStore()
+	inner.AddTask(ctx, "plain")
+	if _, err := EnableEncryption(ctx, inner, ""); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an empty passphrase, got %v", err)
+	}
+
+	enc, err := EnableEncryption(ctx, inner, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	raw, _ := inner.GetTasks(ctx, models.TaskQuery{})
+	if len(raw) != 1 || !strings.HasPrefix(raw[0].Description, sealedPrefix) {
+		t.Errorf("Expected the existing task encrypted, got %+v", raw)
+	}
+	if tasks, _ := enc.GetTasks(ctx, models.TaskQuery{}); len(tasks) != 1 || tasks[0].Description != "plain" {
+		t.Errorf("Expected the task readable, got %+v", tasks)
+	}
+	if _, err := EnableEncryption(ctx, inner, "again"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput enabling encryption twice, got %v", err)
+	}
+}
+
+func TestShareKey(t *testing.T) {
+	source := NewMemoryStore()
+	enc, _ := EnableEncryption(ctx, source, "secret")
+	enc.AddTask(ctx, "a")
+	tasks, _ := source.TasksAt(ctx, time.Now().Add(time.Hour))
+
+	target := NewMemoryStore()
+	if err := ShareKey(ctx, source, target); err != nil {
+		t.Fatalf("ShareKey failed: %v", err)
+	}
+	target.ReplaceTasks(ctx, tasks, nil)
+	copied, err := Unlock(ctx, target, "secret")
+	if err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if got, _ := copied.GetTasks(ctx, models.TaskQuery{}); len(got) != 1 || got[0].Description != "a" {
+		t.Errorf("Expected the copied task readable, got %+v", got)
+	}
+
+	other := NewMemoryStore()
+	EnableEncryption(ctx, other, "other")
+	if err := ShareKey(ctx, source, other); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput sharing into a differently keyed backend, got %v", err)
+	}
+}
+
+func TestEnableEncryption_SealsHistoryOnDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	store, err := NewStoreAt(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	id, _ := store.AddTask(ctx, "Renew the Zanzibar passport")
+	if err := store.RenameTask(ctx, int(id), 0, "Renew the Tristan passport"); err != nil {
+		t.Fatalf("RenameTask failed: %v", err)
+	}
+	before := time.Now()
+
+	enc, err := EnableEncryption(ctx, store, "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	events, err := enc.GetTaskHistory(ctx, int(id))
+	if err != nil || len(events) != 2 || events[0].Detail != "Renew the Zanzibar passport" {
+		t.Errorf("Expected the history readable with the key, got %+v, %v", events, err)
+	}
+	if tasks, err := enc.TasksAt(ctx, before); err != nil || len(tasks) != 1 || tasks[0].Description != "Renew the Tristan passport" {
+		t.Errorf("Expected the past task set readable with the key, got %+v, %v", tasks, err)
+	}
+	enc.Close()
+
+	files, _ := filepath.Glob(path + "*")
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Reading %s: %v", file, err)
+		}
+		for _, word := range []string{"Zanzibar", "Tristan"} {
+			if bytes.Contains(data, []byte(word)) {
+				t.Errorf("Expected no plaintext %q left in %s", word, filepath.Base(file))
+			}
+		}
+	}
+}
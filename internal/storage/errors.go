@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when the task an operation refers to does not
+	// exist, for example because it was deleted by another process.
+	ErrNotFound = errors.New("task not found")
+
+	// ErrConflict is returned by update methods when the task's stored version
+	// no longer matches the version the caller expected, meaning it was
+	// modified by someone else in the meantime.
+	ErrConflict = errors.New("task was modified elsewhere")
+
+	// ErrInvalidInput is returned when the caller passes data the store
+	// refuses to persist, such as an empty description.
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrStorageUnavailable is returned when the database cannot be reached
+	// or stays locked by another process after all retries.
+	ErrStorageUnavailable = errors.New("storage unavailable")
+
+	// ErrCorrupt is returned when a database file fails SQLite's integrity
+	// check.
+	ErrCorrupt = errors.New("database is corrupt")
+
+	// ErrWrongPassphrase is returned when a passphrase does not unlock an
+	// encrypted database.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+// TaskError describes a failed operation on a specific task. Err is one of
+// the sentinel errors above, so callers can use errors.Is to pick a recovery
+// and errors.As to find out which task was affected.
+type TaskError struct {
+	Op  string
+	ID  int
+	Err error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("%s task %d: %v", e.Op, e.ID, e.Err)
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
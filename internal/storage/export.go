@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+
+	"go-todo/internal/models"
+)
+
+// TaskLister is the part of a backend that ExportTasks and FindTask need.
+type TaskLister interface {
+	GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error)
+	GetArchivedTasks(ctx context.Context) ([]models.Task, error)
+}
+
+// ExportTasks reads every task in b, archived ones included, as the syncs
+// do to copy the whole task set elsewhere.
+func ExportTasks(ctx context.Context, b TaskLister) ([]models.Task, error) {
+	tasks, err := b.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		return nil, err
+	}
+	archived, err := b.GetArchivedTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(tasks, archived...), nil
+}
+
+// FindTask returns task id as stored in b, whether it is listed or
+// archived, or ErrNotFound.
+func FindTask(ctx context.Context, b TaskLister, id int) (models.Task, error) {
+	tasks, err := ExportTasks(ctx, b)
+	if err != nil {
+		return models.Task{}, err
+	}
+	for _, task := range tasks {
+		if task.ID == id {
+			return task, nil
+		}
+	}
+	return models.Task{}, ErrNotFound
+}
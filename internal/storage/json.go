@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+func init() {
+	Register("json", func(location string) (Backend, error) {
+		return NewJSONStore(location)
+	})
+}
+
+// JSONStore keeps tasks in a single JSON file. Every mutation rewrites the
+// file atomically, and the file is re-read whenever it changes on disk, so
+// edits made by other processes or by hand are picked up. Writers take an
+// exclusive lock on a ".lock" file beside it so processes sharing the file
+// don't overwrite each other's changes; on systems without flock the file
+// must only be written by one process at a time.
+type JSONStore struct {
+	mu   sync.Mutex
+	path string
+	mem  *MemoryStore
+
+	// modTime and size describe the file as last read or written by us.
+	modTime time.Time
+	size    int64
+	// version is bumped each time the tasks change, whether we wrote the
+	// file or reloaded it because someone else did.
+	version int64
+}
+
+// jsonFile is the on-disk format of a JSONStore.
+type jsonFile struct {
+	NextID int                `json:"next_id"`
+	Seq    int64              `json:"seq"`
+	Tasks  []jsonTask         `json:"tasks"`
+	Events []models.TaskEvent `json:"events,omitempty"`
+	Meta   map[string]string  `json:"meta,omitempty"`
+}
+
+type jsonTask struct {
+	models.Task
+	Seq int64 `json:"seq"`
+}
+
+func NewJSONStore(path string) (*JSONStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: json backend needs a file path", ErrInvalidInput)
+	}
+	s := &JSONStore{path: path, mem: NewMemoryStore()}
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *JSONStore) Close() {}
+
+// refresh reloads the file if it changed since we last read or wrote it. A
+// missing file is treated as an empty store; it is created on first write.
+// The caller must hold s.mu.
+func (s *JSONStore) refresh() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("%w: reading %s: %w", ErrStorageUnavailable, s.path, err)
+	}
+	var file jsonFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%w: parsing %s: %w", ErrStorageUnavailable, s.path, err)
+	}
+
+	mem := NewMemoryStore()
+	mem.nextID = max(file.NextID, 1)
+	mem.seq = file.Seq
+	for _, t := range file.Tasks {
+		mem.tasks[t.ID] = &memoryTask{task: t.Task, seq: t.Seq}
+		mem.nextID = max(mem.nextID, t.ID+1)
+	}
+	mem.events = file.Events
+	mem.meta = file.Meta
+	s.mem = mem
+	s.modTime, s.size = info.ModTime(), info.Size()
+	s.version++
+	return nil
+}
+
+// save writes mem to a temporary file and renames it into place so readers
+// never see a half-written file. The caller must hold s.mu.
+func (s *JSONStore) save(mem *MemoryStore) error {
+	mem.mu.Lock()
+	file := jsonFile{NextID: mem.nextID, Seq: mem.seq, Tasks: []jsonTask{}, Events: mem.events, Meta: mem.meta}
+	for _, t := range mem.tasks {
+		file.Tasks = append(file.Tasks, jsonTask{Task: t.task, Seq: t.seq})
+	}
+	mem.mu.Unlock()
+	// Order by ID so the file is stable and diffable.
+	sort.Slice(file.Tasks, func(i, j int) bool { return file.Tasks[i].ID < file.Tasks[j].ID })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding tasks: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%w: creating temporary file: %w", ErrStorageUnavailable, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("%w: writing tasks: %w", ErrStorageUnavailable, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w: writing tasks: %w", ErrStorageUnavailable, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("%w: replacing %s: %w", ErrStorageUnavailable, s.path, err)
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// mutate applies op to a copy of the tasks and, once the copy is saved, makes
+// it the current one, so a failed op or save leaves the store as it was. The
+// file lock is held from reading the file to replacing it.
+func (s *JSONStore) mutate(op func(mem *MemoryStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("%w: locking %s: %w", ErrStorageUnavailable, s.path, err)
+	}
+	defer unlock()
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	mem := s.mem.clone()
+	if err := op(mem); err != nil {
+		return err
+	}
+	if err := s.save(mem); err != nil {
+		return err
+	}
+	s.mem = mem
+	s.version++
+	return nil
+}
+
+func (s *JSONStore) GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s.mem.GetTasks(ctx, query)
+}
+
+func (s *JSONStore) AddTask(ctx context.Context, description string) (int64, error) {
+	var id int64
+	err := s.mutate(func(mem *MemoryStore) error {
+		var err error
+		id, err = mem.AddTask(ctx, description)
+		return err
+	})
+	return id, err
+}
+
+func (s *JSONStore) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	var id int64
+	err := s.mutate(func(mem *MemoryStore) error {
+		var err error
+		id, err = mem.CreateTask(ctx, task)
+		return err
+	})
+	return id, err
+}
+
+func (s *JSONStore) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.ToggleTaskStatus(ctx, id, expectedVersion)
+	})
+}
+
+func (s *JSONStore) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.UpdateTask(ctx, id, expectedVersion, edit)
+	})
+}
+
+func (s *JSONStore) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.DeleteTask(ctx, id, expectedVersion)
+	})
+}
+
+func (s *JSONStore) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.RenameTask(ctx, id, expectedVersion, description)
+	})
+}
+
+func (s *JSONStore) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.SetTaskDue(ctx, id, expectedVersion, due)
+	})
+}
+
+func (s *JSONStore) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	var archived int
+	err := s.mutate(func(mem *MemoryStore) error {
+		var err error
+		archived, err = mem.ArchiveCompleted(ctx, cutoff)
+		return err
+	})
+	return archived, err
+}
+
+func (s *JSONStore) GetArchivedTasks(ctx context.Context) ([]models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s.mem.GetArchivedTasks(ctx)
+}
+
+func (s *JSONStore) GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s.mem.GetTaskHistory(ctx, id)
+}
+
+func (s *JSONStore) TasksAt(ctx context.Context, at time.Time) ([]models.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return s.mem.TasksAt(ctx, at)
+}
+
+func (s *JSONStore) ReplaceTasks(ctx context.Context, tasks []models.Task, meta map[string]string) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.ReplaceTasks(ctx, tasks, meta)
+	})
+}
+
+func (s *JSONStore) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.SetTasksDone(ctx, versions, done)
+	})
+}
+
+func (s *JSONStore) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.DeleteTasks(ctx, versions)
+	})
+}
+
+func (s *JSONStore) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.MoveTasks(ctx, ids, versions, prevID, nextID)
+	})
+}
+
+func (s *JSONStore) GetMeta(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return "", err
+	}
+	return s.mem.GetMeta(ctx, key)
+}
+
+func (s *JSONStore) SetMeta(ctx context.Context, key, value string) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.SetMeta(ctx, key, value)
+	})
+}
+
+func (s *JSONStore) RewriteDescriptions(ctx context.Context, rewrite func(string) (string, error), meta map[string]string) error {
+	return s.mutate(func(mem *MemoryStore) error {
+		return mem.RewriteDescriptions(ctx, rewrite, meta)
+	})
+}
+
+// DataVersion changes whenever the tasks were modified since the last call,
+// by this store or by someone else writing the file.
+func (s *JSONStore) DataVersion(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return 0, err
+	}
+	return s.version, nil
+}
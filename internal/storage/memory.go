@@ -0,0 +1,731 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// timestampLayout matches SQLite's CURRENT_TIMESTAMP so tasks look the same
+// whichever backend they come from.
+const timestampLayout = "2006-01-02 15:04:05"
+
+func init() {
+	Register("memory", func(location string) (Backend, error) {
+		return NewMemoryStore(), nil
+	})
+}
+
+// MemoryStore keeps tasks in memory. It is safe for concurrent use and
+// follows the same rules as the SQLite store, which makes it suitable for
+// tests and demos.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tasks  map[int]*memoryTask
+	nextID int
+	// seq orders tasks updated within the same second, which share an
+	// updated_at timestamp.
+	seq int64
+	// events is the history of every task, oldest first.
+	events []models.TaskEvent
+	// meta holds database settings set with SetMeta.
+	meta map[string]string
+	now  func() time.Time
+	// version counts changes to the tasks, for DataVersion.
+	version int64
+}
+
+type memoryTask struct {
+	task models.Task
+	seq  int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks:  make(map[int]*memoryTask),
+		nextID: 1,
+		now:    time.Now,
+	}
+}
+
+func (m *MemoryStore) Close() {}
+
+// clone returns a copy of the store that can be changed without affecting m.
+func (m *MemoryStore) clone() *MemoryStore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := &MemoryStore{
+		tasks:   make(map[int]*memoryTask, len(m.tasks)),
+		nextID:  m.nextID,
+		seq:     m.seq,
+		events:  slices.Clone(m.events),
+		meta:    maps.Clone(m.meta),
+		now:     m.now,
+		version: m.version,
+	}
+	for id, t := range m.tasks {
+		task := *t
+		c.tasks[id] = &task
+	}
+	return c
+}
+
+func (m *MemoryStore) timestamp() string {
+	return m.now().UTC().Format(timestampLayout)
+}
+
+// record appends an event to the log with the task's state after the
+// change. The caller must hold m.mu.
+func (m *MemoryStore) record(id int, kind models.EventKind, detail string) {
+	m.version++
+	var state *models.Task
+	if t, ok := m.tasks[id]; ok {
+		task := t.task
+		state = &task
+	}
+	m.events = append(m.events, models.TaskEvent{
+		ID:     int64(len(m.events) + 1),
+		TaskID: id,
+		Kind:   kind,
+		Detail: detail,
+		At:     m.timestamp(),
+		State:  state,
+	})
+}
+
+// touch records that t was just modified.
+func (m *MemoryStore) touch(t *memoryTask) {
+	m.seq++
+	t.seq = m.seq
+	t.task.UpdatedAt = m.timestamp()
+}
+
+// GetTasks lists tasks in the order and grouping described by query, the
+// same way the SQLite store does.
+func (m *MemoryStore) GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	query, err := validateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]*memoryTask, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		if listed(query, t.task) {
+			entries = append(entries, t)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if c := compareTasks(query, a.task, b.task); c != 0 {
+			return c < 0
+		}
+		return a.seq > b.seq
+	})
+
+	var tasks []models.Task
+	for _, t := range entries {
+		tasks = append(tasks, t.task)
+	}
+	return tasks, nil
+}
+
+func (m *MemoryStore) AddTask(ctx context.Context, description string) (int64, error) {
+	return m.CreateTask(ctx, models.Task{Description: description})
+}
+
+// CreateTask adds a task with the description, due date and status of
+// task.
+func (m *MemoryStore) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(task.Description) == "" {
+		return 0, fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	if err := validateDue(task.Due); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := &memoryTask{task: models.NewTask(task.Description, m.nextID)}
+	t.task.Version = 1
+	// New tasks go to the top of the list.
+	t.task.Position = m.minPosition() - positionGap
+	m.touch(t)
+	t.task.CreatedAt = t.task.UpdatedAt
+	m.tasks[t.task.ID] = t
+	m.nextID++
+	m.record(t.task.ID, models.EventCreated, task.Description)
+	if task.Due != "" || task.Done {
+		m.edit(t, task)
+	}
+	return int64(t.task.ID), nil
+}
+
+// RenameTask changes a task's description.
+func (m *MemoryStore) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.TrimSpace(description) == "" {
+		return fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.lookup("rename", id, expectedVersion)
+	if err != nil {
+		return err
+	}
+	t.task.Description = description
+	t.task.Version++
+	m.touch(t)
+	m.record(id, models.EventRenamed, description)
+	return nil
+}
+
+func (m *MemoryStore) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.lookup("toggle", id, expectedVersion)
+	if err != nil {
+		return err
+	}
+	m.setDone(t, !t.task.Done)
+	return nil
+}
+
+// setDone updates a task's done flag and completion time. Reopening a task
+// takes it out of the archive. The caller must hold m.mu.
+func (m *MemoryStore) setDone(t *memoryTask, done bool) {
+	changed := done != t.task.Done
+	switch {
+	case !done:
+		t.task.CompletedAt = ""
+		t.task.ArchivedAt = ""
+	case !t.task.Done:
+		t.task.CompletedAt = m.timestamp()
+	}
+	t.task.Done = done
+	t.task.Version++
+	m.touch(t)
+	if changed {
+		kind := models.EventReopened
+		if done {
+			kind = models.EventCompleted
+		}
+		m.record(t.task.ID, kind, "")
+	}
+}
+
+func (m *MemoryStore) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.lookup("delete", id, expectedVersion); err != nil {
+		return err
+	}
+	delete(m.tasks, id)
+	m.record(id, models.EventDeleted, "")
+	return nil
+}
+
+// SetTaskDue sets a task's due date (YYYY-MM-DD), or clears it if due is
+// empty.
+func (m *MemoryStore) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validateDue(due); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.lookup("set due date of", id, expectedVersion)
+	if err != nil {
+		return err
+	}
+	t.task.Due = due
+	t.task.Version++
+	m.touch(t)
+	m.record(id, models.EventDueChanged, due)
+	return nil
+}
+
+// UpdateTask writes the description, due date and status of edit over
+// those of a task.
+func (m *MemoryStore) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.TrimSpace(edit.Description) == "" {
+		return fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	if err := validateDue(edit.Due); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.lookup("update", id, expectedVersion)
+	if err != nil {
+		return err
+	}
+	m.edit(t, edit)
+	return nil
+}
+
+// edit writes the description, due date and status of to over t as one
+// change, recording an event for each field that changed. The caller must
+// hold m.mu.
+func (m *MemoryStore) edit(t *memoryTask, to models.Task) {
+	from := t.task
+	t.task.Description, t.task.Due = to.Description, to.Due
+	if to.Done != from.Done {
+		t.task.Done = to.Done
+		t.task.CompletedAt, t.task.ArchivedAt = "", ""
+		if to.Done {
+			t.task.CompletedAt = m.timestamp()
+		}
+	}
+	t.task.Version++
+	m.touch(t)
+	if to.Description != from.Description {
+		m.record(t.task.ID, models.EventRenamed, to.Description)
+	}
+	if to.Due != from.Due {
+		m.record(t.task.ID, models.EventDueChanged, to.Due)
+	}
+	if to.Done != from.Done {
+		kind := models.EventReopened
+		if to.Done {
+			kind = models.EventCompleted
+		}
+		m.record(t.task.ID, kind, "")
+	}
+}
+
+// SetTasksDone marks every task in versions as done (or open). Either all
+// tasks are updated or, if any check fails, none are.
+func (m *MemoryStore) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	targets, err := m.lookupAll("update", versions)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		m.setDone(t, done)
+	}
+	return nil
+}
+
+// ArchiveCompleted archives every done task completed before cutoff and
+// returns how many were archived.
+func (m *MemoryStore) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit := cutoff.UTC().Format(timestampLayout)
+	archived := 0
+	for _, id := range m.sortedTaskIDs() {
+		t := m.tasks[id]
+		if t.task.Done && t.task.ArchivedAt == "" && t.task.CompletedAt < limit {
+			t.task.ArchivedAt = m.timestamp()
+			t.task.Version++
+			m.record(id, models.EventArchived, "")
+			archived++
+		}
+	}
+	return archived, nil
+}
+
+// GetArchivedTasks lists archived tasks, most recently completed first.
+func (m *MemoryStore) GetArchivedTasks(ctx context.Context) ([]models.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tasks []models.Task
+	for _, t := range m.tasks {
+		if t.task.ArchivedAt != "" {
+			tasks = append(tasks, t.task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].CompletedAt != tasks[j].CompletedAt {
+			return tasks[i].CompletedAt > tasks[j].CompletedAt
+		}
+		return tasks[i].ID > tasks[j].ID
+	})
+	return tasks, nil
+}
+
+// DeleteTasks removes every task in versions, or none if any check fails.
+func (m *MemoryStore) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	targets, err := m.lookupAll("delete", versions)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		delete(m.tasks, t.task.ID)
+		m.record(t.task.ID, models.EventDeleted, "")
+	}
+	return nil
+}
+
+// MoveTasks places the tasks in ids, in that order, between the tasks prevID
+// and nextID (0 meaning the start or end of the list).
+func (m *MemoryStore) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var targets []*memoryTask
+	for _, id := range ids {
+		t, err := m.lookup("move", id, versions[id])
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t)
+	}
+
+	positions, err := m.movePositions(len(ids), prevID, nextID)
+	if err != nil {
+		return err
+	}
+	for i, t := range targets {
+		t.task.Position = positions[i]
+		t.task.Version++
+		m.record(t.task.ID, models.EventMoved, "")
+	}
+	return nil
+}
+
+// movePositions works out n positions between two neighbouring tasks,
+// renumbering every task once if there is no room left between them. The
+// caller must hold m.mu.
+func (m *MemoryStore) movePositions(n int, prevID, nextID int) ([]float64, error) {
+	for attempt := 0; ; attempt++ {
+		prev, err := m.neighbourPosition(prevID)
+		if err != nil {
+			return nil, err
+		}
+		next, err := m.neighbourPosition(nextID)
+		if err != nil {
+			return nil, err
+		}
+		if positions, ok := spacedPositions(prev, next, n); ok {
+			return positions, nil
+		}
+		if attempt > 0 {
+			return nil, fmt.Errorf("no room to move tasks between %d and %d", prevID, nextID)
+		}
+		m.renumber()
+	}
+}
+
+func (m *MemoryStore) neighbourPosition(id int) (*float64, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	t, ok := m.tasks[id]
+	if !ok {
+		return nil, &TaskError{Op: "move next to", ID: id, Err: ErrConflict}
+	}
+	position := t.task.Position
+	return &position, nil
+}
+
+// renumber spreads positions evenly again, keeping the current order. The
+// caller must hold m.mu.
+func (m *MemoryStore) renumber() {
+	entries := make([]*memoryTask, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		entries = append(entries, t)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.task.Position != b.task.Position {
+			return a.task.Position < b.task.Position
+		}
+		return a.task.ID < b.task.ID
+	})
+	for i, t := range entries {
+		t.task.Position = float64(i+1) * positionGap
+	}
+}
+
+// minPosition returns the lowest position in use, or 0 for an empty store.
+// The caller must hold m.mu.
+func (m *MemoryStore) minPosition() float64 {
+	lowest := 0.0
+	for _, t := range m.tasks {
+		lowest = min(lowest, t.task.Position)
+	}
+	return lowest
+}
+
+// GetTaskHistory returns the events recorded for a task, oldest first.
+func (m *MemoryStore) GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []models.TaskEvent
+	for _, e := range m.events {
+		if e.TaskID == id {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// TasksAt rebuilds the task set as it was at the given time from the log.
+func (m *MemoryStore) TasksAt(ctx context.Context, at time.Time) ([]models.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit := at.UTC().Format(timestampLayout)
+	latest := make(map[int]*models.Task)
+	for _, e := range m.events {
+		if e.At > limit {
+			continue
+		}
+		if e.State != nil || e.Kind == models.EventDeleted {
+			latest[e.TaskID] = e.State
+		}
+	}
+	var tasks []models.Task
+	for _, state := range latest {
+		if state != nil {
+			tasks = append(tasks, *state)
+		}
+	}
+	sortForRestore(tasks)
+	return tasks, nil
+}
+
+// ReplaceTasks makes the task set exactly tasks, keeping their IDs, and logs
+// every change.
+func (m *MemoryStore) ReplaceTasks(ctx context.Context, tasks []models.Task, meta map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validateReplacement(tasks); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keep := make(map[int]bool, len(tasks))
+	for _, task := range tasks {
+		keep[task.ID] = true
+	}
+	for _, id := range m.sortedTaskIDs() {
+		if !keep[id] {
+			delete(m.tasks, id)
+			m.record(id, models.EventDeleted, "")
+		}
+	}
+	for _, task := range tasks {
+		t := &memoryTask{task: task}
+		t.task.Version = max(task.Version, 1)
+		if old, ok := m.tasks[task.ID]; ok {
+			task.Version = old.task.Version
+			if task == old.task {
+				continue
+			}
+			// Overwriting bumps the version, as in the SQLite store.
+			t.task.Version = max(old.task.Version, t.task.Version) + 1
+		}
+		m.seq++
+		t.seq = m.seq
+		m.tasks[task.ID] = t
+		m.nextID = max(m.nextID, task.ID+1)
+		m.record(task.ID, models.EventRestored, "")
+	}
+	if len(meta) > 0 {
+		if m.meta == nil {
+			m.meta = make(map[string]string)
+		}
+		maps.Copy(m.meta, meta)
+	}
+	return nil
+}
+
+// sortedTaskIDs returns the IDs of all tasks in ascending order, for loops
+// that must visit tasks deterministically. The caller must hold m.mu.
+func (m *MemoryStore) sortedTaskIDs() []int {
+	ids := make([]int, 0, len(m.tasks))
+	for id := range m.tasks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// GetMeta returns the setting stored under key, or "" if unset.
+func (m *MemoryStore) GetMeta(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.meta[key], nil
+}
+
+// SetMeta stores a setting, replacing any previous value.
+func (m *MemoryStore) SetMeta(ctx context.Context, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.meta == nil {
+		m.meta = make(map[string]string)
+	}
+	m.meta[key] = value
+	return nil
+}
+
+// RewriteDescriptions rewrites copies of the tasks and events first, so a
+// failing rewrite leaves the store as it was.
+func (m *MemoryStore) RewriteDescriptions(ctx context.Context, rewrite func(string) (string, error), meta map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	descriptions := make(map[int]string, len(m.tasks))
+	for id, t := range m.tasks {
+		description, err := rewrite(t.task.Description)
+		if err != nil {
+			return err
+		}
+		descriptions[id] = description
+	}
+	events := slices.Clone(m.events)
+	for i := range events {
+		if err := rewriteEvent(&events[i], rewrite); err != nil {
+			return err
+		}
+	}
+
+	for id, description := range descriptions {
+		t := m.tasks[id]
+		t.task.Description = description
+		t.task.Version++
+		m.touch(t)
+	}
+	m.events = events
+	if m.meta == nil {
+		m.meta = make(map[string]string)
+	}
+	maps.Copy(m.meta, meta)
+	m.version++
+	return nil
+}
+
+// rewriteEvent applies rewrite to the descriptions an event carries: the
+// detail of a creation or rename, and the recorded state.
+func rewriteEvent(e *models.TaskEvent, rewrite func(string) (string, error)) error {
+	if e.Kind == models.EventCreated || e.Kind == models.EventRenamed {
+		detail, err := rewrite(e.Detail)
+		if err != nil {
+			return err
+		}
+		e.Detail = detail
+	}
+	if e.State != nil {
+		state := *e.State
+		description, err := rewrite(state.Description)
+		if err != nil {
+			return err
+		}
+		state.Description = description
+		e.State = &state
+	}
+	return nil
+}
+
+// DataVersion counts the changes made to the tasks, so a background syncer
+// writing to the store is noticed like any other change.
+func (m *MemoryStore) DataVersion(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.version, nil
+}
+
+// lookup finds a task for an update, applying the same not-found and
+// version checks as the SQLite store. The caller must hold m.mu.
+func (m *MemoryStore) lookup(op string, id int, expectedVersion int) (*memoryTask, error) {
+	t, ok := m.tasks[id]
+	if !ok {
+		return nil, &TaskError{Op: op, ID: id, Err: ErrNotFound}
+	}
+	if expectedVersion != 0 && t.task.Version != expectedVersion {
+		return nil, &TaskError{Op: op, ID: id, Err: ErrConflict}
+	}
+	return t, nil
+}
+
+// lookupAll checks every task in versions before any is modified, so bulk
+// operations are all-or-nothing. The caller must hold m.mu.
+func (m *MemoryStore) lookupAll(op string, versions map[int]int) ([]*memoryTask, error) {
+	var targets []*memoryTask
+	for _, id := range sortedIDs(versions) {
+		t, err := m.lookup(op, id, versions[id])
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
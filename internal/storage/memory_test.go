@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// fakeClock returns a clock that advances by step on every reading.
+func fakeClock(start time.Time, step time.Duration) func() time.Time {
+	now := start
+	return func() time.Time {
+		current := now
+		now = now.Add(step)
+		return current
+	}
+}
+
+func descriptions(t *testing.T, b Backend) []string {
+	t.Helper()
+	return queryDescriptions(t, b, models.TaskQuery{})
+}
+
+// queryDescriptions lists the task descriptions in the order given by query.
+func queryDescriptions(t *testing.T, b Backend, query models.TaskQuery) []string {
+	t.Helper()
+	tasks, err := b.GetTasks(ctx, query)
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	var result []string
+	for _, task := range tasks {
+		result = append(result, task.Description)
+	}
+	return result
+}
+
+func assertOrder(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected order %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected order %v, got %v", want, got)
+		}
+	}
+}
+
+// TestMemoryStore_Ordering checks the store orders tasks like the SQLite
+// query: open before done, then by position, with new tasks on top.
+func TestMemoryStore_Ordering(t *testing.T) {
+	store := NewMemoryStore()
+	store.now = fakeClock(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), time.Second)
+
+	first, _ := store.AddTask(ctx, "first")
+	second, _ := store.AddTask(ctx, "second")
+	store.AddTask(ctx, "third")
+
+	assertOrder(t, descriptions(t, store), []string{"third", "second", "first"})
+
+	store.ToggleTaskStatus(ctx, int(first), 0)
+	store.ToggleTaskStatus(ctx, int(second), 0)
+	assertOrder(t, descriptions(t, store), []string{"third", "second", "first"})
+
+	// Reopening a task puts it back in its place among the open tasks.
+	store.ToggleTaskStatus(ctx, int(second), 0)
+	assertOrder(t, descriptions(t, store), []string{"third", "second", "first"})
+	if tasks, _ := store.GetTasks(ctx, models.TaskQuery{}); tasks[2].Description != "first" || !tasks[2].Done {
+		t.Errorf("Expected only 'first' to be done, got %+v", tasks)
+	}
+}
+
+func TestMemoryStore_ReturnsCopies(t *testing.T) {
+	store := NewMemoryStore()
+	store.AddTask(ctx, "original")
+
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	tasks[0].Description = "changed by caller"
+
+	assertOrder(t, descriptions(t, store), []string{"original"})
+}
+
+func TestMemoryStore_SortByUpdated(t *testing.T) {
+	store := NewMemoryStore()
+	store.now = fakeClock(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), time.Second)
+
+	first, _ := store.AddTask(ctx, "first")
+	store.AddTask(ctx, "second")
+	store.ToggleTaskStatus(ctx, int(first), 0)
+
+	query := models.TaskQuery{Sort: models.SortUpdated, Group: models.GroupNone}
+	assertOrder(t, queryDescriptions(t, store, query), []string{"first", "second"})
+}
+
+func TestMemoryStore_GroupByCreatedDay(t *testing.T) {
+	store := NewMemoryStore()
+	store.now = fakeClock(time.Date(2026, 10, 1, 23, 59, 58, 0, time.UTC), time.Second)
+
+	store.AddTask(ctx, "yesterday")
+	store.AddTask(ctx, "also yesterday")
+	store.AddTask(ctx, "today")
+
+	// Newest day first, manual order within each day.
+	query := models.TaskQuery{Group: models.GroupCreatedDay}
+	assertOrder(t, queryDescriptions(t, store, query), []string{"today", "also yesterday", "yesterday"})
+}
+
+func TestMemoryStore_TasksAtReplaysLog(t *testing.T) {
+	store := NewMemoryStore()
+	store.now = fakeClock(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC), time.Minute)
+
+	first, _ := store.AddTask(ctx, "first draft")
+	second, _ := store.AddTask(ctx, "second")
+	store.RenameTask(ctx, int(first), 0, "final")
+	store.DeleteTask(ctx, int(second), 0)
+
+	// Replay up to each logged event in turn.
+	var log []models.TaskEvent
+	for _, id := range []int{int(first), int(second)} {
+		events, _ := store.GetTaskHistory(ctx, id)
+		log = append(log, events...)
+	}
+	sort.Slice(log, func(i, j int) bool { return log[i].ID < log[j].ID })
+	at := func(i int) time.Time {
+		ts, _ := time.Parse(timestampLayout, log[i].At)
+		return ts
+	}
+
+	tests := []struct {
+		at   time.Time
+		want []string
+	}{
+		{at(0).Add(-time.Second), nil},
+		{at(0), []string{"first draft"}},
+		{at(1), []string{"second", "first draft"}},
+		{at(2), []string{"second", "final"}},
+		{at(3), []string{"final"}},
+	}
+	for _, tt := range tests {
+		tasks, err := store.TasksAt(ctx, tt.at)
+		if err != nil {
+			t.Fatalf("TasksAt failed: %v", err)
+		}
+		var got []string
+		for _, task := range tasks {
+			got = append(got, task.Description)
+		}
+		assertOrder(t, got, tt.want)
+	}
+}
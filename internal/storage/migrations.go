@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migrations holds the schema changes applied in order. The index of a
+// migration plus one is the schema version it produces, tracked in SQLite's
+// user_version pragma. Only ever append to this list.
+var migrations = []string{
+	// 1: initial schema. Uses IF NOT EXISTS so databases created before
+	// versioning was introduced are adopted as-is.
+	`
+	CREATE TABLE IF NOT EXISTS tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		description TEXT NOT NULL,
+		done INTEGER DEFAULT 0 CHECK(done in (0,1)),
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TRIGGER IF NOT EXISTS tasks_updated_at_trigger
+	AFTER UPDATE ON tasks
+	BEGIN
+		UPDATE tasks SET updated_at=CURRENT_TIMESTAMP
+		WHERE tasks.id = NEW.id;
+	END;`,
+
+	// 2: row version for optimistic concurrency.
+	`ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+
+	// 3: manual ordering. Existing tasks keep their current order. The
+	// updated_at trigger is narrowed to content changes so that reordering
+	// does not count as an update.
+	`
+	ALTER TABLE tasks ADD COLUMN position REAL NOT NULL DEFAULT 0;
+
+	DROP TRIGGER IF EXISTS tasks_updated_at_trigger;
+
+	UPDATE tasks SET position = (
+		SELECT ordered.rn * 1024 FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY done ASC, updated_at DESC) AS rn FROM tasks
+		) AS ordered WHERE ordered.id = tasks.id
+	);
+
+	CREATE TRIGGER tasks_updated_at_trigger
+	AFTER UPDATE OF description, done ON tasks
+	BEGIN
+		UPDATE tasks SET updated_at=CURRENT_TIMESTAMP
+		WHERE tasks.id = NEW.id;
+	END;`,
+
+	// 4: optional due date, stored as YYYY-MM-DD. Changing it counts as an
+	// update.
+	`
+	ALTER TABLE tasks ADD COLUMN due_at TEXT;
+
+	DROP TRIGGER IF EXISTS tasks_updated_at_trigger;
+
+	CREATE TRIGGER tasks_updated_at_trigger
+	AFTER UPDATE OF description, done, due_at ON tasks
+	BEGIN
+		UPDATE tasks SET updated_at=CURRENT_TIMESTAMP
+		WHERE tasks.id = NEW.id;
+	END;`,
+
+	// 5: completion and archive timestamps. Tasks already done are taken to
+	// have been completed at their last update.
+	`
+	ALTER TABLE tasks ADD COLUMN completed_at TEXT;
+	ALTER TABLE tasks ADD COLUMN archived_at TEXT;
+
+	UPDATE tasks SET completed_at = updated_at WHERE done = 1;`,
+
+	// 6: per-task history. Events outlive their task so deletions are
+	// recorded too. Existing tasks get the events their timestamps imply.
+	`
+	CREATE TABLE task_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		detail TEXT NOT NULL DEFAULT '',
+		at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX task_events_task_id ON task_events (task_id, id);
+
+	INSERT INTO task_events (task_id, kind, detail, at)
+	SELECT id, 'created', description, created_at FROM tasks ORDER BY id;
+
+	INSERT INTO task_events (task_id, kind, at)
+	SELECT id, 'completed', completed_at FROM tasks WHERE done = 1 ORDER BY id;`,
+
+	// 7: turn the history into an append-only log of the whole database.
+	// Each event carries the task's full state after the change (NULL once
+	// deleted), so the task set can be rebuilt as of any time. The latest
+	// event of each existing task is given the task's current state.
+	`
+	ALTER TABLE task_events ADD COLUMN state TEXT;
+
+	UPDATE task_events SET state = (
+		SELECT json_object(
+			'id', id, 'description', description, 'done', json(CASE WHEN done = 1 THEN 'true' ELSE 'false' END),
+			'created_at', created_at, 'updated_at', updated_at, 'version', version, 'position', position,
+			'due', due_at, 'completed_at', completed_at, 'archived_at', archived_at)
+		FROM tasks WHERE tasks.id = task_events.task_id)
+	WHERE id IN (SELECT MAX(id) FROM task_events GROUP BY task_id);
+
+	CREATE INDEX task_events_at ON task_events (at, id);
+
+	CREATE TRIGGER task_events_no_update BEFORE UPDATE ON task_events
+	BEGIN
+		SELECT RAISE(ABORT, 'task_events is append-only');
+	END;
+
+	CREATE TRIGGER task_events_no_delete BEFORE DELETE ON task_events
+	BEGIN
+		SELECT RAISE(ABORT, 'task_events is append-only');
+	END;`,
+
+	// 8: small key/value settings that belong to the database rather than
+	// the user, such as its encryption key.
+	`
+	CREATE TABLE meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`,
+
+	// 9: outgoing webhooks. Calls wait in the outbox until delivered or
+	// given up on, and every attempt is kept in the delivery log.
+	`
+	CREATE TABLE webhook_outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX webhook_outbox_next_attempt_at ON webhook_outbox (next_attempt_at, id);
+
+	CREATE TABLE webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		event TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		status INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`,
+
+	// 10: the delivery ID of each webhook call, so it is sent without
+	// parsing the payload. Calls already waiting take it from theirs.
+	`
+	ALTER TABLE webhook_outbox ADD COLUMN delivery_id TEXT NOT NULL DEFAULT '';
+
+	UPDATE webhook_outbox SET delivery_id = COALESCE(json_extract(payload, '$.id'), '')
+	WHERE json_valid(payload);`,
+
+	// 11: let RewriteDescriptions seal the descriptions in the change log
+	// when encryption is turned on. The detail and state of an event may
+	// only change while the rewrite marker is set in meta, which it only is
+	// inside that transaction.
+	`
+	DROP TRIGGER task_events_no_update;
+
+	CREATE TRIGGER task_events_no_update BEFORE UPDATE ON task_events
+	WHEN NOT EXISTS (SELECT 1 FROM meta WHERE key = 'rewriting_history')
+		OR NEW.id IS NOT OLD.id OR NEW.task_id IS NOT OLD.task_id
+		OR NEW.kind IS NOT OLD.kind OR NEW.at IS NOT OLD.at
+	BEGIN
+		SELECT RAISE(ABORT, 'task_events is append-only');
+	END;`,
+}
+
+// migrate brings the schema up to date, applying each pending migration in
+// its own transaction.
+func migrate(ctx context.Context, db *sql.DB) error {
+	var current int
+	if err := withRetry(ctx, func(ctx context.Context) error {
+		return db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current)
+	}); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		log.Printf("Applying schema migration %d...", version)
+		err := withRetry(ctx, func(ctx context.Context) error {
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			// Another process may have migrated while we waited for the lock.
+			var latest int
+			if err := tx.QueryRowContext(ctx, "PRAGMA user_version").Scan(&latest); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if latest >= version {
+				return tx.Rollback()
+			}
+			if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+				tx.Rollback()
+				return err
+			}
+			return tx.Commit()
+		})
+		if err != nil {
+			return fmt.Errorf("applying schema migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
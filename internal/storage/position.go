@@ -0,0 +1,40 @@
+package storage
+
+// positionGap is the spacing between neighbouring tasks when positions are
+// assigned from scratch. Moves place a task halfway between its new
+// neighbours, so a gap this size allows many moves into the same slot before
+// positions have to be renumbered.
+const positionGap = 1024.0
+
+// spacedPositions returns n increasing positions strictly between prev and
+// next. A nil bound means the edge of the list. ok is false if the bounds are
+// too close together to fit n distinct positions, in which case the caller
+// must renumber the list and try again.
+func spacedPositions(prev, next *float64, n int) (positions []float64, ok bool) {
+	positions = make([]float64, n)
+	switch {
+	case prev == nil && next == nil:
+		for i := range positions {
+			positions[i] = float64(i+1) * positionGap
+		}
+	case prev == nil:
+		for i := range positions {
+			positions[i] = *next - float64(n-i)*positionGap
+		}
+	case next == nil:
+		for i := range positions {
+			positions[i] = *prev + float64(i+1)*positionGap
+		}
+	default:
+		step := (*next - *prev) / float64(n+1)
+		last := *prev
+		for i := range positions {
+			positions[i] = *prev + float64(i+1)*step
+			if positions[i] <= last || positions[i] >= *next {
+				return nil, false
+			}
+			last = positions[i]
+		}
+	}
+	return positions, true
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// dueLayout is the format of task due dates.
+const dueLayout = "2006-01-02"
+
+// validateQuery fills in defaults and rejects unknown modes.
+func validateQuery(q models.TaskQuery) (models.TaskQuery, error) {
+	q = q.WithDefaults()
+	switch q.Sort {
+	case models.SortManual, models.SortCreated, models.SortUpdated, models.SortAlphabetical, models.SortDue:
+	default:
+		return q, fmt.Errorf("%w: unknown sort mode %q", ErrInvalidInput, q.Sort)
+	}
+	switch q.Group {
+	case models.GroupNone, models.GroupStatus, models.GroupCreatedDay:
+	default:
+		return q, fmt.Errorf("%w: unknown group mode %q", ErrInvalidInput, q.Group)
+	}
+	return q, nil
+}
+
+// validateDue checks that due is empty or a YYYY-MM-DD date.
+func validateDue(due string) error {
+	if due == "" {
+		return nil
+	}
+	if _, err := time.Parse(dueLayout, due); err != nil {
+		return fmt.Errorf("%w: due date %q is not in YYYY-MM-DD format", ErrInvalidInput, due)
+	}
+	return nil
+}
+
+// whereClause builds the SQL filter for a validated query. Archived tasks are
+// never listed.
+func whereClause(q models.TaskQuery) string {
+	if q.HideDone {
+		return "archived_at IS NULL AND done = 0"
+	}
+	return "archived_at IS NULL"
+}
+
+// listed reports whether a task passes the query's filter, mirroring
+// whereClause.
+func listed(q models.TaskQuery, t models.Task) bool {
+	return t.ArchivedAt == "" && !(q.HideDone && t.Done)
+}
+
+// orderByClause builds the SQL ORDER BY for a validated query. Groups come
+// first so that each section's tasks are contiguous.
+func orderByClause(q models.TaskQuery) string {
+	var terms []string
+	switch q.Group {
+	case models.GroupStatus:
+		terms = append(terms, "done ASC")
+	case models.GroupCreatedDay:
+		terms = append(terms, "date(created_at) DESC")
+	}
+	switch q.Sort {
+	case models.SortManual:
+		terms = append(terms, "position ASC")
+	case models.SortCreated:
+		terms = append(terms, "created_at DESC", "id DESC")
+	case models.SortUpdated:
+		terms = append(terms, "updated_at DESC", "id DESC")
+	case models.SortAlphabetical:
+		terms = append(terms, "description COLLATE NOCASE ASC", "id ASC")
+	case models.SortDue:
+		terms = append(terms, "due_at IS NULL", "due_at ASC", "position ASC")
+	}
+	return strings.Join(terms, ", ")
+}
+
+// compareTasks orders two tasks the way orderByClause does, for backends
+// that sort in Go. It returns a negative number if a comes first.
+func compareTasks(q models.TaskQuery, a, b models.Task) int {
+	switch q.Group {
+	case models.GroupStatus:
+		if a.Done != b.Done {
+			return boolCompare(a.Done, b.Done)
+		}
+	case models.GroupCreatedDay:
+		if c := strings.Compare(q.Section(b), q.Section(a)); c != 0 {
+			return c
+		}
+	}
+	switch q.Sort {
+	case models.SortManual:
+		return floatCompare(a.Position, b.Position)
+	case models.SortCreated:
+		if c := strings.Compare(b.CreatedAt, a.CreatedAt); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	case models.SortUpdated:
+		if c := strings.Compare(b.UpdatedAt, a.UpdatedAt); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	case models.SortAlphabetical:
+		if c := strings.Compare(strings.ToLower(a.Description), strings.ToLower(b.Description)); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	case models.SortDue:
+		if (a.Due == "") != (b.Due == "") {
+			return boolCompare(a.Due == "", b.Due == "")
+		}
+		if c := strings.Compare(a.Due, b.Due); c != 0 {
+			return c
+		}
+		return floatCompare(a.Position, b.Position)
+	}
+	return 0
+}
+
+// boolCompare orders false before true.
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func floatCompare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// DefaultDSN is the backend used when none is given: the SQLite database in
+// the working directory.
+const DefaultDSN = "sqlite://" + dbFileName
+
+// Backend is the set of operations every storage backend implements.
+type Backend interface {
+	GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error)
+	AddTask(ctx context.Context, description string) (int64, error)
+	// CreateTask adds a task with the description, due date and status of
+	// task in one transaction, where AddTask only takes a description.
+	CreateTask(ctx context.Context, task models.Task) (int64, error)
+	ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error
+	DeleteTask(ctx context.Context, id int, expectedVersion int) error
+	RenameTask(ctx context.Context, id int, expectedVersion int, description string) error
+	SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error
+	// UpdateTask writes the description, due date and status of edit over
+	// those of a task in one transaction, with the same version check as
+	// the single-field updates.
+	UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error
+	SetTasksDone(ctx context.Context, versions map[int]int, done bool) error
+	ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error)
+	GetArchivedTasks(ctx context.Context) ([]models.Task, error)
+	GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error)
+	TasksAt(ctx context.Context, at time.Time) ([]models.Task, error)
+	// ReplaceTasks makes the task set exactly tasks and saves the settings
+	// in meta, if any, in the same transaction, so a sync's own state never
+	// disagrees with the tasks it wrote.
+	ReplaceTasks(ctx context.Context, tasks []models.Task, meta map[string]string) error
+	DeleteTasks(ctx context.Context, versions map[int]int) error
+	MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error
+	// GetMeta and SetMeta keep settings that travel with the data, such as
+	// the wrapped encryption key. GetMeta returns "" for an unset key.
+	GetMeta(ctx context.Context, key string) (string, error)
+	SetMeta(ctx context.Context, key, value string) error
+	// RewriteDescriptions replaces every description stored, in the tasks
+	// and in their history, with what rewrite makes of it and saves the
+	// settings in meta, all in one transaction. It is how encryption is
+	// turned on for tasks already stored; history is otherwise never
+	// changed.
+	RewriteDescriptions(ctx context.Context, rewrite func(string) (string, error), meta map[string]string) error
+	DataVersion(ctx context.Context) (int64, error)
+	Close()
+}
+
+// OpenFunc opens a backend at location, the part of the DSN after "://".
+type OpenFunc func(location string) (Backend, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]OpenFunc)
+)
+
+// Register makes a backend available under scheme. It panics if the scheme
+// is registered twice or open is nil, since both are programming errors.
+func Register(scheme string, open OpenFunc) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if open == nil {
+		panic("storage: Register open func is nil")
+	}
+	if _, dup := backends[scheme]; dup {
+		panic("storage: Register called twice for scheme " + scheme)
+	}
+	backends[scheme] = open
+}
+
+// Schemes returns the sorted names of the registered backends.
+func Schemes() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open opens the backend described by dsn, which has the form
+// "scheme://location", e.g. "sqlite:///home/me/tasks.db", "json://tasks.json"
+// or "memory://".
+func Open(dsn string) (Backend, error) {
+	scheme, location, ok := strings.Cut(dsn, "://")
+	if !ok || scheme == "" {
+		return nil, fmt.Errorf("%w: malformed storage DSN %q, expected scheme://location", ErrInvalidInput, dsn)
+	}
+
+	backendsMu.RLock()
+	open, found := backends[scheme]
+	backendsMu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w: unknown storage backend %q (available: %s)", ErrInvalidInput, scheme, strings.Join(Schemes(), ", "))
+	}
+	return open(location)
+}
+
+// sortedIDs returns the task IDs of a version map in ascending order, so bulk
+// operations touch tasks, and report errors, deterministically.
+func sortedIDs(versions map[int]int) []int {
+	ids := make([]int, 0, len(versions))
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
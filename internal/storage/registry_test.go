@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go-todo/internal/models"
+)
+
+func TestOpen_InvalidDSN(t *testing.T) {
+	for _, dsn := range []string{"", "tasks.db", "://tasks.db", "postgres://localhost/tasks", "sqlite://"} {
+		if _, err := Open(dsn); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for %q, got %v", dsn, err)
+		}
+	}
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected Register to panic on a duplicate scheme")
+		}
+	}()
+	Register("memory", func(string) (Backend, error) { return NewMemoryStore(), nil })
+}
+
+func TestJSONStore_PicksUpExternalChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	first, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatalf("Opening first store: %v", err)
+	}
+	second, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatalf("Opening second store: %v", err)
+	}
+
+	before, _ := first.DataVersion(ctx)
+	if _, err := second.AddTask(ctx, "From elsewhere"); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	after, _ := first.DataVersion(ctx)
+	if after == before {
+		t.Error("Expected data version to change after another store wrote the file")
+	}
+
+	tasks, _ := first.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "From elsewhere" {
+		t.Errorf("Expected external task to be visible, got %+v", tasks)
+	}
+
+	// Our own writes change it too, so a background syncer sharing the
+	// store is noticed by the watcher.
+	if _, err := first.AddTask(ctx, "Local"); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	if own, _ := first.DataVersion(ctx); own == after {
+		t.Errorf("Expected own write to change data version %d", after)
+	}
+}
+
+func TestMemoryStore_DataVersionChangesOnWrite(t *testing.T) {
+	store := NewMemoryStore()
+	before, _ := store.DataVersion(ctx)
+	if _, err := store.AddTask(ctx, "Synced"); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	after, _ := store.DataVersion(ctx)
+	if after == before {
+		t.Errorf("Expected data version to change after a write, still %d", after)
+	}
+
+	if err := store.ReplaceTasks(ctx, nil, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+	if replaced, _ := store.DataVersion(ctx); replaced == after {
+		t.Errorf("Expected data version to change after ReplaceTasks, still %d", replaced)
+	}
+}
+
+func TestJSONStore_ConcurrentWritersKeepEveryChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	const perStore = 20
+	var wg sync.WaitGroup
+	for range 2 {
+		store, err := NewJSONStore(path)
+		if err != nil {
+			t.Fatalf("Opening store: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perStore {
+				if _, err := store.AddTask(ctx, "Task"); err != nil {
+					t.Errorf("AddTask failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	store, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatalf("Reopening store: %v", err)
+	}
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 2*perStore {
+		t.Errorf("Expected %d tasks, got %d", 2*perStore, len(tasks))
+	}
+}
+
+func TestJSONStore_FailedMutationIsDiscarded(t *testing.T) {
+	// No file yet, so nothing would be re-read to undo the change.
+	store, err := NewJSONStore(filepath.Join(t.TempDir(), "tasks.json"))
+	if err != nil {
+		t.Fatalf("Opening store: %v", err)
+	}
+	err = store.mutate(func(mem *MemoryStore) error {
+		if _, err := mem.AddTask(ctx, "Half done"); err != nil {
+			return err
+		}
+		return errors.New("failed after the change")
+	})
+	if err == nil {
+		t.Fatal("Expected the mutation to fail")
+	}
+
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 0 {
+		t.Errorf("Expected the failed change to be discarded, got %+v", tasks)
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// maxRetries is how many times a busy operation is retried after the
+	// busy timeout has already expired once.
+	maxRetries = 5
+	// retryBaseDelay is the delay before the first retry; it doubles on
+	// every subsequent attempt.
+	retryBaseDelay = 10 * time.Millisecond
+)
+
+// isBusy reports whether err is SQLite telling us another connection holds
+// the lock we need.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// withRetry runs op, retrying with exponential backoff for as long as it
+// fails with SQLITE_BUSY or SQLITE_LOCKED, up to maxRetries times. If the
+// database is still busy after that, the error is wrapped with
+// ErrStorageUnavailable. Waiting between attempts stops early if ctx is
+// done.
+func withRetry(ctx context.Context, op func(ctx context.Context) error) error {
+	delay := retryBaseDelay
+	err := op(ctx)
+	for attempt := 1; attempt <= maxRetries && isBusy(err); attempt++ {
+		log.Printf("Database busy, retrying in %v (attempt %d/%d): %v", delay, attempt, maxRetries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+		err = op(ctx)
+	}
+	if isBusy(err) {
+		return fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+	return err
+}
@@ -1,10 +1,14 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"go-todo/internal/models"
 
@@ -13,47 +17,66 @@ import (
 
 const dbFileName = "tasks.db"
 
+// busyTimeoutMillis is how long SQLite waits on a lock held by another
+// connection before giving up with SQLITE_BUSY.
+const busyTimeoutMillis = 5000
+
+func init() {
+	Register("sqlite", func(location string) (Backend, error) {
+		if location == "" {
+			return nil, fmt.Errorf("%w: sqlite backend needs a database path", ErrInvalidInput)
+		}
+		return NewStoreAt(location)
+	})
+}
+
 type Store struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+	// watch is a dedicated connection used to poll PRAGMA data_version.
+	// The pragma is per-connection, so it must not come from the pool.
+	watch *sql.Conn
 }
 
 func NewStore() (*Store, error) {
-	dbPath := filepath.Join(".", dbFileName)
+	return NewStoreAt(filepath.Join(".", dbFileName))
+}
 
-	d, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
+// NewStoreAt opens (creating if needed) the task database at dbPath. The
+// database is put in WAL mode with a busy timeout and immediate write
+// transactions so that several processes can use it at the same time.
+func NewStoreAt(dbPath string) (*Store, error) {
+	dsn := fmt.Sprintf("%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", dbPath, busyTimeoutMillis)
+	d, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := d.Ping(); err != nil {
+	if err := withRetry(context.Background(), d.PingContext); err != nil {
 		d.Close()
-		return nil, fmt.Errorf("failed to connnect to database: %w", err)
-	}
-
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS tasks (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		description TEXT NOT NULL,
-		done INTEGER DEFAULT 0 CHECK(done in (0,1)),
-		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
-		updated_at TEXT DEFAULT CURRENT_TIMESTAMP
-	);
-
-	CREATE TRIGGER IF NOT EXISTS tasks_updated_at_trigger
-	AFTER UPDATE ON tasks
-	BEGIN
-		UPDATE tasks SET updated_at=CURRENT_TIMESTAMP
-		WHERE tasks.id = NEW.id;
-	END;`
-	if _, err = d.Exec(createTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to connnect to database: %w: %w", ErrStorageUnavailable, err)
+	}
+
+	if err := migrate(context.Background(), d); err != nil {
 		d.Close()
-		return nil, fmt.Errorf("failed to create tasks table: %w", err)
+		return nil, err
 	}
 
-	return &Store{db: d}, nil
+	watch, err := d.Conn(context.Background())
+	if err != nil {
+		d.Close()
+		return nil, fmt.Errorf("failed to open watch connection: %w", err)
+	}
+
+	return &Store{db: d, path: dbPath, watch: watch}, nil
 }
 
 func (s *Store) Close() {
+	if s.watch != nil {
+		if err := s.watch.Close(); err != nil {
+			log.Printf("Error closing watch connection: %v\n", err)
+		}
+	}
 	if s.db != nil {
 		if err := s.db.Close(); err != nil {
 			log.Printf("Error closing database: %v\n", err)
@@ -61,8 +84,32 @@ func (s *Store) Close() {
 	}
 }
 
-func (s *Store) GetTasks() ([]models.Task, error) {
-	rows, err := s.db.Query("SELECT id, description, done, created_at, updated_at FROM tasks ORDER BY done ASC, updated_at DESC")
+// GetTasks lists tasks in the order and grouping described by query.
+func (s *Store) GetTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
+	query, err := validateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []models.Task
+	err = withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		tasks, err = s.queryTasks(ctx, query)
+		return err
+	})
+	return tasks, err
+}
+
+func (s *Store) queryTasks(ctx context.Context, query models.TaskQuery) ([]models.Task, error) {
+	return s.selectTasks(ctx, whereClause(query), orderByClause(query))
+}
+
+// selectTasks reads the tasks matching the SQL condition where, in the
+// order given by orderBy.
+func (s *Store) selectTasks(ctx context.Context, where, orderBy string) ([]models.Task, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, description, done, created_at, updated_at, version, position,
+			COALESCE(due_at, ''), COALESCE(completed_at, ''), COALESCE(archived_at, '')
+		FROM tasks WHERE `+where+` ORDER BY `+orderBy)
 	if err != nil {
 		return nil, fmt.Errorf("querying tasks: %w", err)
 	}
@@ -72,7 +119,7 @@ func (s *Store) GetTasks() ([]models.Task, error) {
 	for rows.Next() {
 		var t models.Task
 		var doneInt int
-		if err := rows.Scan(&t.ID, &t.Description, &doneInt, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.Description, &doneInt, &t.CreatedAt, &t.UpdatedAt, &t.Version, &t.Position, &t.Due, &t.CompletedAt, &t.ArchivedAt); err != nil {
 			return nil, fmt.Errorf("scanning task row: %w", err)
 		}
 		t.Done = (doneInt == 1)
@@ -84,46 +131,458 @@ func (s *Store) GetTasks() ([]models.Task, error) {
 	return tasks, nil
 }
 
-func (s *Store) AddTask(description string) (int64, error) {
-	res, err := s.db.Exec("INSERT INTO tasks (description) VALUES (?)", description)
-	if err != nil {
-		return 0, fmt.Errorf("inserting task: %w", err)
+func (s *Store) AddTask(ctx context.Context, description string) (int64, error) {
+	return s.CreateTask(ctx, models.Task{Description: description})
+}
+
+// CreateTask adds a task with the description, due date and status of
+// task. The due date and status are recorded as changes following the
+// creation.
+func (s *Store) CreateTask(ctx context.Context, task models.Task) (int64, error) {
+	if strings.TrimSpace(task.Description) == "" {
+		return 0, fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	if err := validateDue(task.Due); err != nil {
+		return 0, err
 	}
-	id, err := res.LastInsertId()
+
+	var id int64
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// New tasks go to the top of the list.
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO tasks (description, position) VALUES (?, (SELECT COALESCE(MIN(position), 0) - ? FROM tasks))",
+			task.Description, positionGap)
+		if err != nil {
+			return fmt.Errorf("inserting task: %w", err)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("getting last insert id: %w", err)
+		}
+		if err := recordEvent(ctx, tx, int(id), models.EventCreated, task.Description); err != nil {
+			return err
+		}
+		if task.Due == "" && !task.Done {
+			return nil
+		}
+		return applyEdit(ctx, tx, int(id), 0, models.Task{Description: task.Description}, task)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("getting last insert id: %w", err)
+		return 0, err
 	}
 	return id, nil
 }
 
-func (s *Store) ToggleTaskStatus(id int) error {
-	var currentStatus bool
-	err := s.db.QueryRow("SELECT done FROM tasks WHERE id = ?", id).Scan(&currentStatus)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("task with ID %d not found", id)
+// RenameTask changes a task's description, with the same version check as
+// ToggleTaskStatus.
+func (s *Store) RenameTask(ctx context.Context, id int, expectedVersion int, description string) error {
+	if strings.TrimSpace(description) == "" {
+		return fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE tasks SET description = ?, version = version + 1 WHERE id = ? AND (? = 0 OR version = ?)",
+			description, id, expectedVersion, expectedVersion)
+		if err != nil {
+			return fmt.Errorf("renaming task: %w", err)
+		}
+		if err := checkUpdated(ctx, tx, res, "rename", id); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, id, models.EventRenamed, description)
+	})
+}
+
+// ToggleTaskStatus flips the done flag of a task in a single statement,
+// recording when it was completed. Reopening a task also takes it out of the
+// archive. If expectedVersion is non-zero the update only applies when the
+// stored version still matches, otherwise ErrConflict is returned.
+func (s *Store) ToggleTaskStatus(ctx context.Context, id int, expectedVersion int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE tasks SET done = 1 - done, version = version + 1,
+				completed_at = CASE WHEN done = 0 THEN CURRENT_TIMESTAMP END, archived_at = NULL
+			WHERE id = ? AND (? = 0 OR version = ?)`,
+			id, expectedVersion, expectedVersion)
+		if err != nil {
+			return fmt.Errorf("updating task status: %w", err)
+		}
+		if err := checkUpdated(ctx, tx, res, "toggle", id); err != nil {
+			return err
+		}
+		var done bool
+		if err := tx.QueryRowContext(ctx, "SELECT done FROM tasks WHERE id = ?", id).Scan(&done); err != nil {
+			return fmt.Errorf("reading task status: %w", err)
 		}
-		return fmt.Errorf("querying task status for toggle: %w", err)
+		kind := models.EventReopened
+		if done {
+			kind = models.EventCompleted
+		}
+		return recordEvent(ctx, tx, id, kind, "")
+	})
+}
+
+// DeleteTask removes a task. If expectedVersion is non-zero the delete only
+// applies when the stored version still matches, otherwise ErrConflict is
+// returned.
+func (s *Store) DeleteTask(ctx context.Context, id int, expectedVersion int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ? AND (? = 0 OR version = ?)", id, expectedVersion, expectedVersion)
+		if err != nil {
+			return fmt.Errorf("deleting task: %w", err)
+		}
+		if err := checkUpdated(ctx, tx, res, "delete", id); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, id, models.EventDeleted, "")
+	})
+}
+
+// SetTaskDue sets a task's due date (YYYY-MM-DD), or clears it if due is
+// empty, with the same version check as ToggleTaskStatus.
+func (s *Store) SetTaskDue(ctx context.Context, id int, expectedVersion int, due string) error {
+	if err := validateDue(due); err != nil {
+		return err
 	}
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE tasks SET due_at = NULLIF(?, ''), version = version + 1 WHERE id = ? AND (? = 0 OR version = ?)",
+			due, id, expectedVersion, expectedVersion)
+		if err != nil {
+			return fmt.Errorf("updating task due date: %w", err)
+		}
+		if err := checkUpdated(ctx, tx, res, "set due date of", id); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, id, models.EventDueChanged, due)
+	})
+}
+
+// UpdateTask writes the description, due date and status of edit over
+// those of a task, with the same version check as ToggleTaskStatus.
+// Reopening a task also takes it out of the archive.
+func (s *Store) UpdateTask(ctx context.Context, id int, expectedVersion int, edit models.Task) error {
+	if strings.TrimSpace(edit.Description) == "" {
+		return fmt.Errorf("%w: task description cannot be empty", ErrInvalidInput)
+	}
+	if err := validateDue(edit.Due); err != nil {
+		return err
+	}
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var stored models.Task
+		err := tx.QueryRowContext(ctx, "SELECT description, COALESCE(due_at, ''), done FROM tasks WHERE id = ?", id).
+			Scan(&stored.Description, &stored.Due, &stored.Done)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &TaskError{Op: "update", ID: id, Err: ErrNotFound}
+		}
+		if err != nil {
+			return fmt.Errorf("reading task: %w", err)
+		}
+		return applyEdit(ctx, tx, id, expectedVersion, stored, edit)
+	})
+}
 
-	_, err = s.db.Exec("UPDATE tasks SET done = ? WHERE id = ?", !currentStatus, id)
+// applyEdit writes the description, due date and status of to over a task
+// stored as from in a single statement, and records an event for each
+// that changed.
+func applyEdit(ctx context.Context, tx *sql.Tx, id int, expectedVersion int, from, to models.Task) error {
+	res, err := tx.ExecContext(ctx,
+		`UPDATE tasks SET description = ?, due_at = NULLIF(?, ''), done = ?, version = version + 1,
+			completed_at = CASE WHEN ? THEN COALESCE(completed_at, CURRENT_TIMESTAMP) END,
+			archived_at = CASE WHEN ? THEN archived_at END
+		WHERE id = ? AND (? = 0 OR version = ?)`,
+		to.Description, to.Due, to.Done, to.Done, to.Done, id, expectedVersion, expectedVersion)
 	if err != nil {
-		return fmt.Errorf("updating task status: %w", err)
+		return fmt.Errorf("updating task: %w", err)
+	}
+	if err := checkUpdated(ctx, tx, res, "update", id); err != nil {
+		return err
+	}
+	if to.Description != from.Description {
+		if err := recordEvent(ctx, tx, id, models.EventRenamed, to.Description); err != nil {
+			return err
+		}
+	}
+	if to.Due != from.Due {
+		if err := recordEvent(ctx, tx, id, models.EventDueChanged, to.Due); err != nil {
+			return err
+		}
+	}
+	if to.Done != from.Done {
+		kind := models.EventReopened
+		if to.Done {
+			kind = models.EventCompleted
+		}
+		return recordEvent(ctx, tx, id, kind, "")
 	}
 	return nil
 }
 
-func (s *Store) DeleteTask(id int) error {
-	res, err := s.db.Exec("DELETE FROM tasks WHERE id = ?", id)
+// ArchiveCompleted archives every done task completed before cutoff, so it
+// no longer appears in GetTasks, and returns how many were archived.
+func (s *Store) ArchiveCompleted(ctx context.Context, cutoff time.Time) (int, error) {
+	var ids []int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx,
+			"SELECT id FROM tasks WHERE done = 1 AND archived_at IS NULL AND COALESCE(completed_at, '') < ? ORDER BY id",
+			cutoff.UTC().Format(timestampLayout))
+		if err != nil {
+			return fmt.Errorf("finding tasks to archive: %w", err)
+		}
+		ids, err = scanIDs(rows)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			_, err := tx.ExecContext(ctx,
+				"UPDATE tasks SET archived_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ?", id)
+			if err != nil {
+				return fmt.Errorf("archiving task: %w", err)
+			}
+			if err := recordEvent(ctx, tx, id, models.EventArchived, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// GetArchivedTasks lists archived tasks, most recently completed first.
+func (s *Store) GetArchivedTasks(ctx context.Context) ([]models.Task, error) {
+	var tasks []models.Task
+	err := withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		tasks, err = s.selectTasks(ctx, "archived_at IS NOT NULL", "completed_at DESC, id DESC")
+		return err
+	})
+	return tasks, err
+}
+
+// SetTasksDone marks every task in versions as done (or open) in a single
+// transaction. versions maps task IDs to the version the caller expects,
+// with 0 meaning "don't check". If any task is missing or has changed, no
+// task is updated.
+func (s *Store) SetTasksDone(ctx context.Context, versions map[int]int, done bool) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		kind := models.EventReopened
+		if done {
+			kind = models.EventCompleted
+		}
+		for _, id := range sortedIDs(versions) {
+			// Only tasks whose status actually changes get an event.
+			var changed bool
+			err := tx.QueryRowContext(ctx, "SELECT done != ? FROM tasks WHERE id = ?", done, id).Scan(&changed)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("reading task status: %w", err)
+			}
+			res, err := tx.ExecContext(ctx,
+				`UPDATE tasks SET done = ?, version = version + 1,
+					completed_at = CASE WHEN ? = 0 THEN NULL WHEN done = 1 THEN completed_at ELSE CURRENT_TIMESTAMP END,
+					archived_at = CASE WHEN ? = 0 THEN NULL ELSE archived_at END
+				WHERE id = ? AND (? = 0 OR version = ?)`,
+				done, done, done, id, versions[id], versions[id])
+			if err != nil {
+				return fmt.Errorf("updating task status: %w", err)
+			}
+			if err := checkUpdated(ctx, tx, res, "update", id); err != nil {
+				return err
+			}
+			if changed {
+				if err := recordEvent(ctx, tx, id, kind, ""); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteTasks removes every task in versions in a single transaction, with
+// the same version checks as SetTasksDone.
+func (s *Store) DeleteTasks(ctx context.Context, versions map[int]int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, id := range sortedIDs(versions) {
+			res, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ? AND (? = 0 OR version = ?)", id, versions[id], versions[id])
+			if err != nil {
+				return fmt.Errorf("deleting task: %w", err)
+			}
+			if err := checkUpdated(ctx, tx, res, "delete", id); err != nil {
+				return err
+			}
+			if err := recordEvent(ctx, tx, id, models.EventDeleted, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MoveTasks places the tasks in ids, in that order, between the tasks prevID
+// and nextID (0 meaning the start or end of the list). Only the moved rows
+// are rewritten unless the neighbours are too close together, in which case
+// the whole list is renumbered first. versions holds the expected version of
+// each moved task, as for SetTasksDone.
+func (s *Store) MoveTasks(ctx context.Context, ids []int, versions map[int]int, prevID, nextID int) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		positions, err := s.movePositions(ctx, tx, len(ids), prevID, nextID)
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			res, err := tx.ExecContext(ctx,
+				"UPDATE tasks SET position = ?, version = version + 1 WHERE id = ? AND (? = 0 OR version = ?)",
+				positions[i], id, versions[id], versions[id])
+			if err != nil {
+				return fmt.Errorf("moving task: %w", err)
+			}
+			if err := checkUpdated(ctx, tx, res, "move", id); err != nil {
+				return err
+			}
+			if err := recordEvent(ctx, tx, id, models.EventMoved, ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// movePositions works out n positions between two neighbouring tasks,
+// renumbering every task once if there is no room left between them.
+func (s *Store) movePositions(ctx context.Context, tx *sql.Tx, n int, prevID, nextID int) ([]float64, error) {
+	for attempt := 0; ; attempt++ {
+		prev, err := neighbourPosition(ctx, tx, prevID)
+		if err != nil {
+			return nil, err
+		}
+		next, err := neighbourPosition(ctx, tx, nextID)
+		if err != nil {
+			return nil, err
+		}
+		if positions, ok := spacedPositions(prev, next, n); ok {
+			return positions, nil
+		}
+		if attempt > 0 {
+			return nil, fmt.Errorf("no room to move tasks between %d and %d", prevID, nextID)
+		}
+		log.Println("Task positions exhausted, renumbering...")
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tasks SET position = (
+				SELECT ordered.rn * ? FROM (
+					SELECT id, ROW_NUMBER() OVER (ORDER BY position ASC, id ASC) AS rn FROM tasks
+				) AS ordered WHERE ordered.id = tasks.id
+			)`, positionGap)
+		if err != nil {
+			return nil, fmt.Errorf("renumbering positions: %w", err)
+		}
+	}
+}
+
+// neighbourPosition returns the position of task id, or nil for id 0. A
+// missing neighbour means the caller's view of the list is out of date.
+func neighbourPosition(ctx context.Context, tx *sql.Tx, id int) (*float64, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	var position float64
+	err := tx.QueryRowContext(ctx, "SELECT position FROM tasks WHERE id = ?", id).Scan(&position)
+	if err == sql.ErrNoRows {
+		return nil, &TaskError{Op: "move next to", ID: id, Err: ErrConflict}
+	}
 	if err != nil {
-		return fmt.Errorf("deleting task: %w", err)
+		return nil, fmt.Errorf("querying task position: %w", err)
 	}
+	return &position, nil
+}
+
+// checkUpdated turns a version-guarded statement that matched no rows into
+// either ErrNotFound or ErrConflict, depending on whether the task still
+// exists.
+func checkUpdated(ctx context.Context, tx *sql.Tx, res sql.Result, op string, id int) error {
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("checking rows affected by delete: %w", err)
+		return fmt.Errorf("checking rows affected: %w", err)
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("task with ID %d not found for deletion", id)
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = ?)", id).Scan(&exists); err != nil {
+		return fmt.Errorf("checking task existence: %w", err)
+	}
+	if !exists {
+		return &TaskError{Op: op, ID: id, Err: ErrNotFound}
+	}
+	return &TaskError{Op: op, ID: id, Err: ErrConflict}
+}
+
+// DataVersion reports SQLite's data_version for the watch connection. The
+// value changes whenever another connection or process commits to the
+// database, so callers can poll it to detect external modifications.
+func (s *Store) DataVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := withRetry(ctx, func(ctx context.Context) error {
+		return s.watch.QueryRowContext(ctx, "PRAGMA data_version").Scan(&version)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("querying data version: %w", err)
+	}
+	return version, nil
+}
+
+// GetMeta returns the database setting stored under key, or "" if unset.
+func (s *Store) GetMeta(ctx context.Context, key string) (string, error) {
+	var value string
+	err := withRetry(ctx, func(ctx context.Context) error {
+		return s.db.QueryRowContext(ctx, "SELECT value FROM meta WHERE key = ?", key).Scan(&value)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetMeta stores a database setting, replacing any previous value.
+func (s *Store) SetMeta(ctx context.Context, key, value string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return setMeta(ctx, tx, map[string]string{key: value})
+	})
+}
+
+// setMeta saves the settings in meta as part of tx.
+func setMeta(ctx context.Context, tx *sql.Tx, meta map[string]string) error {
+	for key, value := range meta {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO meta (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", key, value)
+		if err != nil {
+			return fmt.Errorf("saving setting %s: %w", key, err)
+		}
 	}
 	return nil
 }
+
+// withTx runs fn inside a write transaction, committing if it succeeds and
+// rolling back otherwise. The whole transaction is retried if SQLite reports
+// the database as busy.
+func (s *Store) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return withRetry(ctx, func(ctx context.Context) error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("beginning transaction: %w", err)
+		}
+		if err := fn(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing transaction: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SQLitePath returns the database file named by a sqlite:// DSN.
+func SQLitePath(dsn string) (string, error) {
+	scheme, location, ok := strings.Cut(dsn, "://")
+	if !ok || scheme != "sqlite" || location == "" {
+		return "", fmt.Errorf("%w: %q is not a sqlite:// database", ErrInvalidInput, dsn)
+	}
+	return location, nil
+}
+
+// Path returns the file the store was opened on.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist yet. It runs alongside other connections and does not block writers
+// for longer than a read transaction would.
+func (s *Store) Backup(ctx context.Context, path string) error {
+	err := withRetry(ctx, func(ctx context.Context) error {
+		_, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, path)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("backing up to %s: %w", path, err)
+	}
+	return nil
+}
+
+// CheckIntegrity opens the database file at path read-only and runs
+// PRAGMA integrity_check on it. A file that is damaged or not a database at
+// all yields ErrCorrupt.
+func CheckIntegrity(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("checking %s: %w", path, err)
+	}
+	d, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer d.Close()
+
+	rows, err := d.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrCorrupt, path, err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return fmt.Errorf("reading integrity check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrCorrupt, path, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrCorrupt, path, strings.Join(problems, "; "))
+	}
+	return nil
+}
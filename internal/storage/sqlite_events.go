@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// taskStateJSON renders a tasks row as the JSON encoding of models.Task. It
+// is stored with every event so the log can be replayed.
+const taskStateJSON = `json_object(
+	'id', id, 'description', description, 'done', json(CASE WHEN done = 1 THEN 'true' ELSE 'false' END),
+	'created_at', created_at, 'updated_at', updated_at, 'version', version, 'position', position,
+	'due', due_at, 'completed_at', completed_at, 'archived_at', archived_at)`
+
+// rewriteMarker is the meta key that lets task_events be updated, set only
+// while RewriteDescriptions runs. It must match migration 11.
+const rewriteMarker = "rewriting_history"
+
+// recordEvent adds an entry to the log as part of tx, so the event is stored
+// if and only if the change it describes is. It must be called after the
+// change, as it captures the task's resulting state.
+func recordEvent(ctx context.Context, tx *sql.Tx, id int, kind models.EventKind, detail string) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO task_events (task_id, kind, detail, state) VALUES (?, ?, ?, (SELECT "+taskStateJSON+" FROM tasks WHERE id = ?))",
+		id, kind, detail, id)
+	if err != nil {
+		return fmt.Errorf("recording task event: %w", err)
+	}
+	return nil
+}
+
+// GetTaskHistory returns the events recorded for a task, oldest first. The
+// history of a deleted task is kept.
+func (s *Store) GetTaskHistory(ctx context.Context, id int) ([]models.TaskEvent, error) {
+	var events []models.TaskEvent
+	err := withRetry(ctx, func(ctx context.Context) error {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, task_id, kind, detail, at, state FROM task_events WHERE task_id = ? ORDER BY id", id)
+		if err != nil {
+			return fmt.Errorf("querying task history: %w", err)
+		}
+		defer rows.Close()
+
+		events = nil
+		for rows.Next() {
+			var e models.TaskEvent
+			var state sql.NullString
+			if err := rows.Scan(&e.ID, &e.TaskID, &e.Kind, &e.Detail, &e.At, &state); err != nil {
+				return fmt.Errorf("scanning task event: %w", err)
+			}
+			if e.State, err = decodeState(state); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return rows.Err()
+	})
+	return events, err
+}
+
+// TasksAt rebuilds the task set as it was at the given time from the log:
+// each task as of its last event up to then, leaving out tasks deleted by
+// then. Only changes logged since the log was introduced can be replayed.
+func (s *Store) TasksAt(ctx context.Context, at time.Time) ([]models.Task, error) {
+	var tasks []models.Task
+	err := withRetry(ctx, func(ctx context.Context) error {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT state FROM task_events WHERE id IN (
+				SELECT MAX(id) FROM task_events
+				WHERE at <= ? AND (state IS NOT NULL OR kind = ?)
+				GROUP BY task_id)
+			AND state IS NOT NULL`,
+			at.UTC().Format(timestampLayout), models.EventDeleted)
+		if err != nil {
+			return fmt.Errorf("replaying task log: %w", err)
+		}
+		defer rows.Close()
+
+		tasks = nil
+		for rows.Next() {
+			var state sql.NullString
+			if err := rows.Scan(&state); err != nil {
+				return fmt.Errorf("scanning task state: %w", err)
+			}
+			task, err := decodeState(state)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, *task)
+		}
+		return rows.Err()
+	})
+	sortForRestore(tasks)
+	return tasks, err
+}
+
+// ReplaceTasks makes the task set exactly tasks, keeping their IDs and
+// timestamps: tasks not in the set are deleted and the others are inserted,
+// or overwritten where they differ. Every change is logged, so a restore
+// can itself be undone; tasks that already match are left alone.
+func (s *Store) ReplaceTasks(ctx context.Context, tasks []models.Task, meta map[string]string) error {
+	if err := validateReplacement(tasks); err != nil {
+		return err
+	}
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id FROM tasks ORDER BY id")
+		if err != nil {
+			return fmt.Errorf("listing tasks: %w", err)
+		}
+		existing, err := scanIDs(rows)
+		if err != nil {
+			return err
+		}
+
+		keep := make(map[int]bool, len(tasks))
+		for _, t := range tasks {
+			keep[t.ID] = true
+		}
+		for _, id := range existing {
+			if keep[id] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?", id); err != nil {
+				return fmt.Errorf("deleting task: %w", err)
+			}
+			if err := recordEvent(ctx, tx, id, models.EventDeleted, ""); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range tasks {
+			// An overwritten task gets a new version so that clients holding
+			// the old one see a conflict rather than silently clobbering it.
+			res, err := tx.ExecContext(ctx,
+				`INSERT INTO tasks (id, description, done, created_at, updated_at, version, position, due_at, completed_at, archived_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
+				ON CONFLICT (id) DO UPDATE SET
+					description = excluded.description, done = excluded.done, created_at = excluded.created_at,
+					version = MAX(tasks.version, excluded.version) + 1, position = excluded.position,
+					due_at = excluded.due_at, completed_at = excluded.completed_at, archived_at = excluded.archived_at
+				WHERE tasks.description IS NOT excluded.description OR tasks.done IS NOT excluded.done
+					OR tasks.created_at IS NOT excluded.created_at OR tasks.updated_at IS NOT excluded.updated_at
+					OR tasks.position IS NOT excluded.position OR tasks.due_at IS NOT excluded.due_at
+					OR tasks.completed_at IS NOT excluded.completed_at OR tasks.archived_at IS NOT excluded.archived_at`,
+				t.ID, t.Description, t.Done, t.CreatedAt, t.UpdatedAt, max(t.Version, 1), t.Position,
+				t.Due, t.CompletedAt, t.ArchivedAt)
+			if err != nil {
+				return fmt.Errorf("restoring task %d: %w", t.ID, err)
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return fmt.Errorf("restoring task %d: %w", t.ID, err)
+			} else if n == 0 {
+				continue
+			}
+			// Set separately, since the update trigger stamps the current
+			// time over any updated_at written together with the content.
+			if _, err := tx.ExecContext(ctx, "UPDATE tasks SET updated_at = ? WHERE id = ?", t.UpdatedAt, t.ID); err != nil {
+				return fmt.Errorf("restoring task %d: %w", t.ID, err)
+			}
+			if err := recordEvent(ctx, tx, t.ID, models.EventRestored, ""); err != nil {
+				return err
+			}
+		}
+		return setMeta(ctx, tx, meta)
+	})
+}
+
+// RewriteDescriptions rewrites the tasks and their log in one transaction,
+// with the log's append-only trigger lifted by the rewrite marker. Webhook
+// calls still waiting in the outbox carry the old descriptions and could not
+// be sent from an encrypted database anyway, so they are dropped. Afterwards
+// the file is vacuumed so the old text does not linger in free pages.
+func (s *Store) RewriteDescriptions(ctx context.Context, rewrite func(string) (string, error), meta map[string]string) error {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO meta (key, value) VALUES (?, '1')", rewriteMarker); err != nil {
+			return fmt.Errorf("marking history rewrite: %w", err)
+		}
+		if err := rewriteTasks(ctx, tx, rewrite); err != nil {
+			return err
+		}
+		if err := rewriteEvents(ctx, tx, rewrite); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM meta WHERE key = ?", rewriteMarker); err != nil {
+			return fmt.Errorf("clearing history rewrite marker: %w", err)
+		}
+		if res, err := tx.ExecContext(ctx, "DELETE FROM webhook_outbox"); err != nil {
+			return fmt.Errorf("clearing webhook outbox: %w", err)
+		} else if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Dropped %d undelivered webhook calls", n)
+		}
+		return setMeta(ctx, tx, meta)
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("descriptions rewritten, but removing the old ones from the file failed: %w", err)
+	}
+	var busy, frames, checkpointed int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &frames, &checkpointed); err != nil {
+		return fmt.Errorf("descriptions rewritten, but removing the old ones from the log file failed: %w", err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("descriptions rewritten, but the log file is in use and may still hold the old ones")
+	}
+	return nil
+}
+
+// rewriteTasks applies rewrite to the description of every task, archived
+// ones included, bumping their versions.
+func rewriteTasks(ctx context.Context, tx *sql.Tx, rewrite func(string) (string, error)) error {
+	rows, err := tx.QueryContext(ctx, "SELECT id, description FROM tasks")
+	if err != nil {
+		return fmt.Errorf("listing tasks: %w", err)
+	}
+	descriptions := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var description string
+		if err := rows.Scan(&id, &description); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning task: %w", err)
+		}
+		descriptions[id] = description
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("listing tasks: %w", err)
+	}
+
+	for id, description := range descriptions {
+		rewritten, err := rewrite(description)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE tasks SET description = ?, version = version + 1 WHERE id = ?", rewritten, id); err != nil {
+			return fmt.Errorf("rewriting task %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// rewriteEvents applies rewrite to the descriptions carried by the log.
+func rewriteEvents(ctx context.Context, tx *sql.Tx, rewrite func(string) (string, error)) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id, kind, detail, state FROM task_events WHERE kind IN (?, ?) OR state IS NOT NULL",
+		models.EventCreated, models.EventRenamed)
+	if err != nil {
+		return fmt.Errorf("querying task log: %w", err)
+	}
+	var events []models.TaskEvent
+	for rows.Next() {
+		var e models.TaskEvent
+		var state sql.NullString
+		if err := rows.Scan(&e.ID, &e.Kind, &e.Detail, &state); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning task event: %w", err)
+		}
+		if e.State, err = decodeState(state); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("querying task log: %w", err)
+	}
+
+	for _, e := range events {
+		if err := rewriteEvent(&e, rewrite); err != nil {
+			return err
+		}
+		var state sql.NullString
+		if e.State != nil {
+			encoded, err := json.Marshal(e.State)
+			if err != nil {
+				return fmt.Errorf("encoding task state: %w", err)
+			}
+			state = sql.NullString{String: string(encoded), Valid: true}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE task_events SET detail = ?, state = ? WHERE id = ?", e.Detail, state, e.ID); err != nil {
+			return fmt.Errorf("rewriting task event %d: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// decodeState parses the task state stored with an event, which is NULL
+// for deletions and for events logged before states were recorded.
+func decodeState(state sql.NullString) (*models.Task, error) {
+	if !state.Valid {
+		return nil, nil
+	}
+	var task models.Task
+	if err := json.Unmarshal([]byte(state.String), &task); err != nil {
+		return nil, fmt.Errorf("decoding task state: %w", err)
+	}
+	return &task, nil
+}
+
+// scanIDs reads a single column of task IDs and closes rows.
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scanning task id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("after iteration task ids: %w", err)
+	}
+	return ids, nil
+}
+
+// validateReplacement checks a task set before it replaces the stored one.
+func validateReplacement(tasks []models.Task) error {
+	seen := make(map[int]bool, len(tasks))
+	for _, t := range tasks {
+		if t.ID <= 0 || seen[t.ID] {
+			return fmt.Errorf("%w: task set has a missing or duplicate ID %d", ErrInvalidInput, t.ID)
+		}
+		seen[t.ID] = true
+	}
+	return nil
+}
+
+// sortForRestore puts a rebuilt task set in the default list order.
+func sortForRestore(tasks []models.Task) {
+	query := models.TaskQuery{}.WithDefaults()
+	sort.Slice(tasks, func(i, j int) bool {
+		if c := compareTasks(query, tasks[i], tasks[j]); c != 0 {
+			return c < 0
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+}
@@ -0,0 +1,415 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"go-todo/internal/models"
+)
+
+var ctx = context.Background()
+
+// TestMain disables logging for all tests
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func newTestStore(t *testing.T, dbPath string) *Store {
+	t.Helper()
+	store, err := NewStoreAt(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestNewStoreAt_UsesWAL(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+
+	var mode string
+	if err := store.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("Querying journal mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("Expected journal mode 'wal', got '%s'", mode)
+	}
+
+	var timeout int
+	if err := store.db.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatalf("Querying busy timeout: %v", err)
+	}
+	if timeout != busyTimeoutMillis {
+		t.Errorf("Expected busy timeout %d, got %d", busyTimeoutMillis, timeout)
+	}
+}
+
+func TestToggleTaskStatus(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+
+	id, err := store.AddTask(ctx, "Toggle me")
+	if err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	if err := store.ToggleTaskStatus(ctx, int(id), 0); err != nil {
+		t.Fatalf("ToggleTaskStatus failed: %v", err)
+	}
+
+	tasks, err := store.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if len(tasks) != 1 || !tasks[0].Done {
+		t.Errorf("Expected one done task, got %+v", tasks)
+	}
+
+	err = store.ToggleTaskStatus(ctx, 9999, 0)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound toggling a missing task, got %v", err)
+	}
+	var taskErr *TaskError
+	if !errors.As(err, &taskErr) || taskErr.ID != 9999 || taskErr.Op != "toggle" {
+		t.Errorf("Expected TaskError for task 9999, got %#v", err)
+	}
+}
+
+func TestAddTask_InvalidInput(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+
+	for _, description := range []string{"", "   "} {
+		if _, err := store.AddTask(ctx, description); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Expected ErrInvalidInput for %q, got %v", description, err)
+		}
+	}
+}
+
+func TestUpdates_VersionConflict(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+
+	id, err := store.AddTask(ctx, "Versioned")
+	if err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Version != 1 {
+		t.Fatalf("Expected new task to have version 1, got %d", tasks[0].Version)
+	}
+
+	if err := store.ToggleTaskStatus(ctx, int(id), 1); err != nil {
+		t.Fatalf("Toggle with current version failed: %v", err)
+	}
+
+	tasks, _ = store.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Version != 2 || !tasks[0].Done {
+		t.Errorf("Expected done task at version 2, got %+v", tasks[0])
+	}
+
+	if err := store.ToggleTaskStatus(ctx, int(id), 1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict toggling with stale version, got %v", err)
+	}
+
+	if err := store.DeleteTask(ctx, int(id), 1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict deleting with stale version, got %v", err)
+	}
+
+	if err := store.DeleteTask(ctx, int(id), 2); err != nil {
+		t.Errorf("Delete with current version failed: %v", err)
+	}
+
+	if err := store.DeleteTask(ctx, int(id), 2); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected not-found error deleting a missing task, got %v", err)
+	}
+}
+
+// TestConcurrentToggles checks that toggles racing on the same task are
+// never lost: an even number of toggles must leave the task open.
+func TestConcurrentToggles(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	first, second := newTestStore(t, dbPath), newTestStore(t, dbPath)
+
+	id, err := first.AddTask(ctx, "Contended")
+	if err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	const toggles = 50
+	var wg sync.WaitGroup
+	for i := 0; i < toggles; i++ {
+		store := first
+		if i%2 == 1 {
+			store = second
+		}
+		wg.Add(1)
+		go func(store *Store) {
+			defer wg.Done()
+			if err := store.ToggleTaskStatus(ctx, int(id), 0); err != nil {
+				t.Errorf("Toggle failed: %v", err)
+			}
+		}(store)
+	}
+	wg.Wait()
+
+	tasks, _ := first.GetTasks(ctx, models.TaskQuery{})
+	if tasks[0].Done {
+		t.Error("Expected task to be open after an even number of toggles")
+	}
+	if tasks[0].Version != toggles+1 {
+		t.Errorf("Expected version %d, got %d", toggles+1, tasks[0].Version)
+	}
+}
+
+func TestMigrate_AdoptsLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	legacy, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Opening legacy database: %v", err)
+	}
+	if _, err := legacy.Exec(migrations[0]); err != nil {
+		t.Fatalf("Creating legacy schema: %v", err)
+	}
+	_, err = legacy.Exec(`INSERT INTO tasks (description, done, updated_at) VALUES
+		('older task', 1, '2026-01-01 09:00:00'),
+		('newer task', 0, '2026-01-02 09:00:00')`)
+	if err != nil {
+		t.Fatalf("Inserting legacy tasks: %v", err)
+	}
+	legacy.Close()
+
+	store := newTestStore(t, dbPath)
+	tasks, err := store.GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("Expected legacy tasks to survive migration, got %+v", tasks)
+	}
+	// The legacy most-recently-updated-first order is kept as the manual order.
+	if tasks[0].Description != "newer task" || tasks[1].Description != "older task" {
+		t.Errorf("Expected legacy order to be preserved, got %+v", tasks)
+	}
+	if tasks[0].UpdatedAt != "2026-01-02 09:00:00" || tasks[0].Version != 1 {
+		t.Errorf("Expected migration not to touch updated_at or version, got %+v", tasks[0])
+	}
+	if tasks[1].CompletedAt != "2026-01-01 09:00:00" {
+		t.Errorf("Expected done legacy task to be completed at its last update, got %+v", tasks[1])
+	}
+	events, err := store.GetTaskHistory(ctx, tasks[1].ID)
+	if err != nil {
+		t.Fatalf("GetTaskHistory failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Kind != models.EventCreated || events[1].Kind != models.EventCompleted || events[1].At != "2026-01-01 09:00:00" {
+		t.Errorf("Expected history implied by the legacy timestamps, got %+v", events)
+	}
+	if events[0].State != nil || events[1].State == nil || events[1].State.Description != "older task" || !events[1].State.Done {
+		t.Errorf("Expected the latest event to carry the current state, got %+v", events)
+	}
+}
+
+func TestTaskEvents_AppendOnly(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+	store.AddTask(ctx, "logged")
+
+	if _, err := store.db.Exec("UPDATE task_events SET kind = 'renamed'"); err == nil {
+		t.Error("Expected updating the log to fail")
+	}
+	if _, err := store.db.Exec("UPDATE task_events SET detail = 'rewritten'"); err == nil {
+		t.Error("Expected rewriting the log outside RewriteDescriptions to fail")
+	}
+	if _, err := store.db.Exec("DELETE FROM task_events"); err == nil {
+		t.Error("Expected deleting from the log to fail")
+	}
+}
+
+func TestTasksAt_PointInTime(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+	// Write a log by hand so the events are minutes apart.
+	_, err := store.db.Exec(`INSERT INTO task_events (task_id, kind, at, state) VALUES
+		(1, 'created', '2026-10-01 09:00:00', '{"id":1,"description":"first draft","version":1}'),
+		(2, 'created', '2026-10-01 09:01:00', '{"id":2,"description":"second","version":1,"position":-1024}'),
+		(1, 'renamed', '2026-10-01 09:02:00', '{"id":1,"description":"final","version":2}'),
+		(2, 'deleted', '2026-10-01 09:03:00', NULL)`)
+	if err != nil {
+		t.Fatalf("Writing log: %v", err)
+	}
+
+	tests := []struct {
+		at   string
+		want []string
+	}{
+		{"2026-10-01 08:59:59", nil},
+		{"2026-10-01 09:00:00", []string{"first draft"}},
+		{"2026-10-01 09:01:30", []string{"second", "first draft"}},
+		{"2026-10-01 09:02:30", []string{"second", "final"}},
+		{"2026-10-01 09:03:00", []string{"final"}},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse(timestampLayout, tt.at)
+		tasks, err := store.TasksAt(ctx, at)
+		if err != nil {
+			t.Fatalf("TasksAt failed: %v", err)
+		}
+		var got []string
+		for _, task := range tasks {
+			got = append(got, task.Description)
+		}
+		assertOrder(t, got, tt.want)
+	}
+}
+
+// TestConcurrentAccess hammers the same database file from several stores,
+// standing in for separate processes, each used by many goroutines.
+func TestConcurrentAccess(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	stores := []*Store{newTestStore(t, dbPath), newTestStore(t, dbPath), newTestStore(t, dbPath)}
+
+	const workers = 8
+	const tasksPerWorker = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(stores)*workers*tasksPerWorker*3)
+	for s, store := range stores {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(store *Store, worker int) {
+				defer wg.Done()
+				for i := 0; i < tasksPerWorker; i++ {
+					id, err := store.AddTask(ctx, fmt.Sprintf("task %d-%d", worker, i))
+					if err != nil {
+						errs <- fmt.Errorf("add: %w", err)
+						continue
+					}
+					if err := store.ToggleTaskStatus(ctx, int(id), 0); err != nil {
+						errs <- fmt.Errorf("toggle: %w", err)
+					}
+					if _, err := store.GetTasks(ctx, models.TaskQuery{}); err != nil {
+						errs <- fmt.Errorf("get: %w", err)
+					}
+				}
+			}(store, s*workers+w)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Concurrent operation failed: %v", err)
+	}
+
+	tasks, err := stores[0].GetTasks(ctx, models.TaskQuery{})
+	if err != nil {
+		t.Fatalf("GetTasks failed: %v", err)
+	}
+	expected := len(stores) * workers * tasksPerWorker
+	if len(tasks) != expected {
+		t.Errorf("Expected %d tasks, got %d", expected, len(tasks))
+	}
+	for _, task := range tasks {
+		if !task.Done {
+			t.Errorf("Expected task %d to be done after a single toggle", task.ID)
+		}
+	}
+}
+
+func TestWithRetry_RetriesBusy(t *testing.T) {
+	attempts := 0
+	err := withRetry(ctx, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("wrapped: %w", sqlite3.Error{Code: sqlite3.ErrBusy})
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("Expected success after retries, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestWithRetry_GivesUp(t *testing.T) {
+	attempts := 0
+	err := withRetry(ctx, func(ctx context.Context) error {
+		attempts++
+		return sqlite3.Error{Code: sqlite3.ErrLocked}
+	})
+
+	if !isBusy(err) {
+		t.Errorf("Expected busy error to be returned, got %v", err)
+	}
+	if !errors.Is(err, ErrStorageUnavailable) {
+		t.Errorf("Expected ErrStorageUnavailable, got %v", err)
+	}
+	if attempts != maxRetries+1 {
+		t.Errorf("Expected %d attempts, got %d", maxRetries+1, attempts)
+	}
+}
+
+func TestWithRetry_OtherErrorsNotRetried(t *testing.T) {
+	attempts := 0
+	err := withRetry(ctx, func(ctx context.Context) error {
+		attempts++
+		return fmt.Errorf("boom")
+	})
+
+	if err == nil || attempts != 1 {
+		t.Errorf("Expected a single failed attempt, got attempts=%d err=%v", attempts, err)
+	}
+}
+
+func TestWebhookOutbox(t *testing.T) {
+	store := newTestStore(t, filepath.Join(t.TempDir(), "tasks.db"))
+	id, err := store.EnqueueWebhook(ctx, models.WebhookMessage{URL: "https://example.com/hook", Event: "task.created", DeliveryID: "d1", Payload: `{}`})
+	if err != nil {
+		t.Fatalf("EnqueueWebhook failed: %v", err)
+	}
+	now := time.Now()
+	due, err := store.DueWebhooks(ctx, now, 10)
+	if err != nil || len(due) != 1 || due[0].ID != id || due[0].DeliveryID != "d1" {
+		t.Fatalf("Expected the message to be due, got %+v, %v", due, err)
+	}
+
+	// A failed attempt puts the message off until the retry time.
+	failed := models.WebhookDelivery{MessageID: id, URL: due[0].URL, Event: due[0].Event, Attempt: 1, Status: 500, Error: "500 Internal Server Error"}
+	if err := store.RecordWebhookDelivery(ctx, failed, now.Add(time.Hour)); err != nil {
+		t.Fatalf("RecordWebhookDelivery failed: %v", err)
+	}
+	if due, _ := store.DueWebhooks(ctx, now, 10); len(due) != 0 {
+		t.Errorf("Expected nothing due before the retry, got %+v", due)
+	}
+	due, _ = store.DueWebhooks(ctx, now.Add(2*time.Hour), 10)
+	if len(due) != 1 || due[0].Attempts != 1 {
+		t.Fatalf("Expected the message due after the retry time with 1 attempt, got %+v", due)
+	}
+
+	// A delivered message leaves the outbox but stays in the log.
+	delivered := models.WebhookDelivery{MessageID: id, URL: due[0].URL, Event: due[0].Event, Attempt: 2, Status: 200}
+	if err := store.RecordWebhookDelivery(ctx, delivered, time.Time{}); err != nil {
+		t.Fatalf("RecordWebhookDelivery failed: %v", err)
+	}
+	if due, _ := store.DueWebhooks(ctx, now.Add(2*time.Hour), 10); len(due) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", due)
+	}
+	log, err := store.WebhookDeliveries(ctx, 10)
+	if err != nil {
+		t.Fatalf("WebhookDeliveries failed: %v", err)
+	}
+	if len(log) != 2 || !log[0].Delivered() || log[1].Delivered() || log[1].Status != 500 {
+		t.Errorf("Expected the failed and the delivered attempt, newest first, got %+v", log)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// webhookLogSize is how many delivery attempts the log keeps.
+const webhookLogSize = 1000
+
+// EnqueueWebhook adds a message to the webhook outbox, due right away, and
+// returns its ID.
+func (s *Store) EnqueueWebhook(ctx context.Context, msg models.WebhookMessage) (int64, error) {
+	var id int64
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"INSERT INTO webhook_outbox (url, event, delivery_id, payload) VALUES (?, ?, ?, ?)",
+			msg.URL, msg.Event, msg.DeliveryID, msg.Payload)
+		if err != nil {
+			return fmt.Errorf("queueing webhook: %w", err)
+		}
+		id, err = res.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+// DueWebhooks returns up to limit messages from the outbox that are due by
+// now, oldest first.
+func (s *Store) DueWebhooks(ctx context.Context, now time.Time, limit int) ([]models.WebhookMessage, error) {
+	var messages []models.WebhookMessage
+	err := withRetry(ctx, func(ctx context.Context) error {
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT id, url, event, delivery_id, payload, attempts, next_attempt_at, created_at FROM webhook_outbox
+			WHERE next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+			now.UTC().Format(timestampLayout), limit)
+		if err != nil {
+			return fmt.Errorf("querying webhook outbox: %w", err)
+		}
+		defer rows.Close()
+
+		messages = nil
+		for rows.Next() {
+			var m models.WebhookMessage
+			if err := rows.Scan(&m.ID, &m.URL, &m.Event, &m.DeliveryID, &m.Payload, &m.Attempts, &m.NextAttemptAt, &m.CreatedAt); err != nil {
+				return fmt.Errorf("scanning webhook message: %w", err)
+			}
+			messages = append(messages, m)
+		}
+		return rows.Err()
+	})
+	return messages, err
+}
+
+// RecordWebhookDelivery logs an attempt to deliver a message. The message
+// is then due again at retryAt, or leaves the outbox if retryAt is zero,
+// because it was delivered or given up on.
+func (s *Store) RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery, retryAt time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO webhook_deliveries (message_id, url, event, attempt, status, error) VALUES (?, ?, ?, ?, ?, ?)",
+			delivery.MessageID, delivery.URL, delivery.Event, delivery.Attempt, delivery.Status, delivery.Error); err != nil {
+			return fmt.Errorf("logging webhook delivery: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM webhook_deliveries WHERE id <= (SELECT MAX(id) FROM webhook_deliveries) - ?", webhookLogSize); err != nil {
+			return fmt.Errorf("pruning webhook delivery log: %w", err)
+		}
+		var err error
+		if retryAt.IsZero() {
+			_, err = tx.ExecContext(ctx, "DELETE FROM webhook_outbox WHERE id = ?", delivery.MessageID)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE webhook_outbox SET attempts = ?, next_attempt_at = ? WHERE id = ?",
+				delivery.Attempt, retryAt.UTC().Format(timestampLayout), delivery.MessageID)
+		}
+		if err != nil {
+			return fmt.Errorf("updating webhook outbox: %w", err)
+		}
+		return nil
+	})
+}
+
+// WebhookDeliveries returns the latest limit entries of the delivery log,
+// newest first.
+func (s *Store) WebhookDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := withRetry(ctx, func(ctx context.Context) error {
+		rows, err := s.db.QueryContext(ctx,
+			"SELECT id, message_id, url, event, attempt, status, error, at FROM webhook_deliveries ORDER BY id DESC LIMIT ?", limit)
+		if err != nil {
+			return fmt.Errorf("querying webhook delivery log: %w", err)
+		}
+		defer rows.Close()
+
+		deliveries = nil
+		for rows.Next() {
+			var d models.WebhookDelivery
+			if err := rows.Scan(&d.ID, &d.MessageID, &d.URL, &d.Event, &d.Attempt, &d.Status, &d.Error, &d.At); err != nil {
+				return fmt.Errorf("scanning webhook delivery: %w", err)
+			}
+			deliveries = append(deliveries, d)
+		}
+		return rows.Err()
+	})
+	return deliveries, err
+}
@@ -0,0 +1,99 @@
+package syncserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client speaks the sync protocol with the server at URL.
+type Client struct {
+	URL   string
+	Token string
+	HTTP  *http.Client
+}
+
+// NewClient returns a client for the server at baseURL.
+func NewClient(baseURL, token string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid sync server URL %q", baseURL)
+	}
+	return &Client{
+		URL:   strings.TrimSuffix(baseURL, "/"),
+		Token: token,
+		HTTP:  &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Pull returns the changes on the server after the revision since. client
+// identifies the store pulling, so the server knows which deletions every
+// store has seen.
+func (c *Client) Pull(ctx context.Context, client string, since int64) (Changes, error) {
+	query := url.Values{"since": {strconv.FormatInt(since, 10)}}
+	if client != "" {
+		query.Set("client", client)
+	}
+	var resp Changes
+	err := c.do(ctx, http.MethodGet, changesPath+"?"+query.Encode(), nil, &resp)
+	return resp, err
+}
+
+// Push sends changes to the server and returns them as it applied them. A
+// push refused because tasks changed on the server first returns a
+// *ConflictError.
+func (c *Client) Push(ctx context.Context, changes []Change) (Changes, error) {
+	var resp Changes
+	err := c.do(ctx, http.MethodPost, changesPath, Changes{Changes: changes}, &resp)
+	return resp, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, reader)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("reading sync server response: %w", err)
+		}
+		return nil
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusConflict:
+		var conflict ConflictResponse
+		if err := json.NewDecoder(resp.Body).Decode(&conflict); err != nil {
+			return fmt.Errorf("reading sync server response: %w", err)
+		}
+		return &ConflictError{Conflicts: conflict.Conflicts}
+	}
+	var failure errorResponse
+	json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&failure)
+	return &StatusError{Status: resp.StatusCode, Message: failure.Error}
+}
@@ -0,0 +1,104 @@
+// Package syncserver hosts a canonical task set over HTTP and syncs the
+// stores of clients with it. Every change on the server gets the next
+// revision number, so a client pulls only what changed since the last
+// revision it saw, its cursor, and pushes its own changes against the
+// revision they were based on. A push based on an outdated revision is
+// refused with a conflict response, and the client merges and retries.
+package syncserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// TokenEnv is the environment variable the token can be given in, so it
+// need not appear on the command line.
+const TokenEnv = "GO_TODO_SYNC_TOKEN"
+
+// Interval is how often a running application syncs with the server.
+const Interval = 30 * time.Second
+
+// changesPath is the protocol's one endpoint: GET pulls changes and POST
+// pushes them.
+const changesPath = "/v1/changes"
+
+// Change is a task as the server holds it at a revision, or its deletion.
+// Pushed changes carry the revision they were based on instead.
+type Change struct {
+	// ID is the task's ID on the server, or 0 for a task new to it.
+	ID  int   `json:"id"`
+	Rev int64 `json:"rev,omitempty"`
+	// BaseRev is the revision of the task the pushed change was made to.
+	BaseRev int64 `json:"base_rev,omitempty"`
+	// Ref is the client's ID for a new task, returned with the ID the
+	// server gave it.
+	Ref     int          `json:"ref,omitempty"`
+	Deleted bool         `json:"deleted,omitempty"`
+	Task    *models.Task `json:"task,omitempty"`
+}
+
+// Changes is the body of a pull response and of a push request and
+// response. Cursor is the latest revision on the server. Reset marks a pull
+// that holds every task because deletions the client had not pulled yet
+// were pruned: tasks it does not hold were deleted.
+type Changes struct {
+	Cursor  int64    `json:"cursor"`
+	Reset   bool     `json:"reset,omitempty"`
+	Changes []Change `json:"changes"`
+}
+
+// ConflictResponse is the body of a push refused because tasks changed on
+// the server since the revisions the push was based on. It holds those
+// tasks as the server has them now.
+type ConflictResponse struct {
+	Conflicts []Change `json:"conflicts"`
+}
+
+// errorResponse is the body of every other failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ErrUnauthorized is returned when the server rejects the client's token.
+var ErrUnauthorized = errors.New("sync server rejected the token")
+
+// ErrUnreachable is returned when the server cannot be contacted, such as
+// while offline. Changes stay in the store until a later sync.
+var ErrUnreachable = errors.New("cannot reach the sync server")
+
+// ConflictError is returned by a push the server refused because some of
+// its tasks changed there first.
+type ConflictError struct {
+	Conflicts []Change
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%d task(s) changed on the sync server since the last pull", len(e.Conflicts))
+}
+
+// StatusError is returned for any other response the client does not
+// expect.
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("sync server: %s", http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("sync server: %s: %s", http.StatusText(e.Status), e.Message)
+}
+
+// remoteName is how conflicts name the other side of a server sync.
+const remoteName = "the sync server"
+
+// content returns a task without the fields that are local to one store.
+func content(t models.Task) models.Task {
+	t.ID, t.Version = 0, 0
+	return t
+}
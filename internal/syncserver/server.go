@@ -0,0 +1,378 @@
+package syncserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// serverMetaKey holds the server's revisions in its store.
+const serverMetaKey = "sync_server"
+
+// maxBodySize bounds a push request.
+const maxBodySize = 10 << 20
+
+// revisions records the revision of every task on the server, and of every
+// deletion, so clients can pull what changed after a cursor.
+type revisions struct {
+	Cursor  int64         `json:"cursor"`
+	Tasks   map[int]int64 `json:"tasks"`
+	Deleted map[int]int64 `json:"deleted"`
+	// Clients holds the cursor each client last pulled from. A deletion
+	// older than all of them has been seen by every client and is pruned.
+	Clients map[string]int64 `json:"clients,omitempty"`
+	// Pruned is the latest revision of a pruned deletion. A client pulling
+	// from before it is sent every task instead.
+	Pruned int64 `json:"pruned,omitempty"`
+	// LastID is the highest task ID ever given out, so new tasks never
+	// reuse the ID of a deleted one, which clients may still know.
+	LastID int `json:"last_id,omitempty"`
+}
+
+// rev returns the current revision of a task or its deletion, and whether
+// the server ever had it.
+func (r *revisions) rev(id int) (int64, bool) {
+	if rev, ok := r.Tasks[id]; ok {
+		return rev, true
+	}
+	rev, ok := r.Deleted[id]
+	return rev, ok
+}
+
+func (r *revisions) clone() *revisions {
+	c := *r
+	c.Tasks, c.Deleted, c.Clients = maps.Clone(r.Tasks), maps.Clone(r.Deleted), maps.Clone(r.Clients)
+	return &c
+}
+
+// prune forgets the deletions every known client has pulled, and reports
+// whether there were any.
+func (r *revisions) prune() bool {
+	if len(r.Clients) == 0 {
+		return false
+	}
+	oldest := slices.Min(slices.Collect(maps.Values(r.Clients)))
+	pruned := false
+	for id, rev := range r.Deleted {
+		if rev <= oldest {
+			delete(r.Deleted, id)
+			r.Pruned = max(r.Pruned, rev)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// Server serves the tasks in Store to clients that present Token. The
+// store must not be written to by anything else while it is served.
+type Server struct {
+	store storage.Backend
+	token string
+
+	// mu serializes requests, so a push sees the revisions it checks.
+	mu   sync.Mutex
+	revs *revisions
+}
+
+// NewServer returns a server for store. Tasks the store holds that the
+// server has no revision for, such as all of them in a new database, are
+// given one.
+func NewServer(ctx context.Context, store storage.Backend, token string) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("the sync server needs a token")
+	}
+	if err := storage.RequirePlaintext(ctx, store, "the sync server"); err != nil {
+		return nil, err
+	}
+	s := &Server{store: store, token: token}
+	value, err := store.GetMeta(ctx, serverMetaKey)
+	if err != nil {
+		return nil, err
+	}
+	revs := &revisions{Tasks: make(map[int]int64), Deleted: make(map[int]int64)}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), revs); err != nil {
+			return nil, fmt.Errorf("reading sync server revisions: %w", err)
+		}
+	}
+	if revs.Tasks == nil {
+		revs.Tasks = make(map[int]int64)
+	}
+	if revs.Deleted == nil {
+		revs.Deleted = make(map[int]int64)
+	}
+	tasks, err := storage.ExportTasks(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[int]bool, len(tasks))
+	for _, task := range tasks {
+		stored[task.ID] = true
+		if _, ok := revs.Tasks[task.ID]; !ok {
+			revs.Cursor++
+			revs.Tasks[task.ID] = revs.Cursor
+			delete(revs.Deleted, task.ID)
+		}
+	}
+	for _, id := range sortedIDs(revs.Tasks) {
+		if !stored[id] {
+			revs.Cursor++
+			delete(revs.Tasks, id)
+			revs.Deleted[id] = revs.Cursor
+		}
+	}
+	for _, ids := range []map[int]int64{revs.Tasks, revs.Deleted} {
+		for id := range ids {
+			revs.LastID = max(revs.LastID, id)
+		}
+	}
+	if err := saveRevisions(ctx, store, revs); err != nil {
+		return nil, err
+	}
+	s.revs = revs
+	return s, nil
+}
+
+// meta returns revs as the setting they are saved under.
+func (r *revisions) meta() (map[string]string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("saving sync server revisions: %w", err)
+	}
+	return map[string]string{serverMetaKey: string(data)}, nil
+}
+
+func saveRevisions(ctx context.Context, store storage.Backend, revs *revisions) error {
+	meta, err := revs.meta()
+	if err != nil {
+		return err
+	}
+	return store.SetMeta(ctx, serverMetaKey, meta[serverMetaKey])
+}
+
+func sortedIDs[V any](m map[int]V) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid token"})
+		return
+	}
+	if r.URL.Path != changesPath {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no such endpoint"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.pull(w, r)
+	case http.MethodPost:
+		s.push(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "use GET or POST"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Sync server: writing response: %v", err)
+	}
+}
+
+func (s *Server) fail(w http.ResponseWriter, err error) {
+	log.Printf("Sync server: %v", err)
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+}
+
+// pull sends every change with a revision after the since parameter, in
+// revision order. The client parameter names the client, so deletions it
+// has pulled can be pruned once every other client has too. A client whose
+// cursor is from before a pruned deletion is sent every task, marked as a
+// reset, and must take tasks missing from it as deleted.
+func (s *Server) pull(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseInt(value, 10, 64); err != nil || since < 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "since must be a revision number"})
+			return
+		}
+	}
+	client := r.URL.Query().Get("client")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx := r.Context()
+	reset := since < s.revs.Pruned
+	if client != "" {
+		if cursor, ok := s.revs.Clients[client]; !ok || cursor != since {
+			revs := s.revs.clone()
+			if revs.Clients == nil {
+				revs.Clients = make(map[string]int64)
+			}
+			revs.Clients[client] = since
+			revs.prune()
+			if err := saveRevisions(ctx, s.store, revs); err != nil {
+				s.fail(w, err)
+				return
+			}
+			s.revs = revs
+		}
+	}
+	tasks, err := storage.ExportTasks(ctx, s.store)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	changes := []Change{}
+	for _, task := range tasks {
+		if rev := s.revs.Tasks[task.ID]; rev > since || reset {
+			task.Version = 0
+			changes = append(changes, Change{ID: task.ID, Rev: rev, Task: &task})
+		}
+	}
+	for id, rev := range s.revs.Deleted {
+		if rev > since {
+			changes = append(changes, Change{ID: id, Rev: rev, Deleted: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Rev < changes[j].Rev })
+	writeJSON(w, http.StatusOK, Changes{Cursor: s.revs.Cursor, Reset: reset, Changes: changes})
+}
+
+// push applies a client's changes, all or none. Changes to tasks whose
+// revision moved past their base are refused with 409 Conflict.
+func (s *Server) push(w http.ResponseWriter, r *http.Request) {
+	var req Changes
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx := r.Context()
+	tasks, err := storage.ExportTasks(ctx, s.store)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	byID := make(map[int]models.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	var conflicts []Change
+	seen := make(map[int]bool)
+	for _, change := range req.Changes {
+		if msg := invalid(change); msg != "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: msg})
+			return
+		}
+		if change.ID == 0 {
+			continue
+		}
+		if seen[change.ID] {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("task %d changed twice", change.ID)})
+			return
+		}
+		seen[change.ID] = true
+		rev, ok := s.revs.rev(change.ID)
+		if !ok && change.ID > s.revs.LastID {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("no task %d", change.ID)})
+			return
+		}
+		// A task whose deletion was pruned is simply deleted: an edit
+		// brings it back, as an edit beats a deletion.
+		if ok && rev != change.BaseRev {
+			current := Change{ID: change.ID, Rev: rev, Deleted: true}
+			if task, ok := byID[change.ID]; ok {
+				task.Version = 0
+				current = Change{ID: change.ID, Rev: rev, Task: &task}
+			}
+			conflicts = append(conflicts, current)
+		}
+	}
+	if len(conflicts) > 0 {
+		writeJSON(w, http.StatusConflict, ConflictResponse{Conflicts: conflicts})
+		return
+	}
+
+	revs := s.revs.clone()
+	applied := make([]Change, 0, len(req.Changes))
+	for _, change := range req.Changes {
+		revs.Cursor++
+		id := change.ID
+		if id == 0 {
+			revs.LastID++
+			id = revs.LastID
+		}
+		if change.Deleted {
+			delete(byID, id)
+			delete(revs.Tasks, id)
+			revs.Deleted[id] = revs.Cursor
+			applied = append(applied, Change{ID: id, Rev: revs.Cursor, Deleted: true})
+			continue
+		}
+		task := content(*change.Task)
+		task.ID = id
+		byID[id] = task
+		revs.Tasks[id] = revs.Cursor
+		delete(revs.Deleted, id)
+		applied = append(applied, Change{ID: id, Rev: revs.Cursor, Ref: change.Ref, Task: &task})
+	}
+
+	merged := make([]models.Task, 0, len(byID))
+	for _, id := range sortedIDs(byID) {
+		merged = append(merged, byID[id])
+	}
+	// The revisions are saved with the tasks, so a crash cannot leave
+	// clients a cursor that does not match them.
+	meta, err := revs.meta()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	if err := s.store.ReplaceTasks(ctx, merged, meta); err != nil {
+		s.fail(w, err)
+		return
+	}
+	s.revs = revs
+	writeJSON(w, http.StatusOK, Changes{Cursor: revs.Cursor, Changes: applied})
+}
+
+// invalid describes what is wrong with a pushed change, or returns "" if
+// nothing is.
+func invalid(change Change) string {
+	switch {
+	case change.ID < 0:
+		return "task IDs are positive"
+	case change.ID == 0 && change.Deleted:
+		return "a new task cannot be deleted"
+	case !change.Deleted && change.Task == nil:
+		return "a changed task needs its fields"
+	case !change.Deleted && strings.TrimSpace(change.Task.Description) == "":
+		return "a task needs a description"
+	}
+	return ""
+}
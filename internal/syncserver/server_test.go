@@ -0,0 +1,212 @@
+package syncserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+var ctx = context.Background()
+
+const token = "secret-token"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newServer serves a store holding descriptions and returns a client for
+// it along with the store.
+func newServer(t *testing.T, descriptions ...string) (*Client, storage.Backend) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	for _, d := range descriptions {
+		store.AddTask(ctx, d)
+	}
+	server, err := NewServer(ctx, store, token)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	client, err := NewClient(ts.URL, token)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return client, store
+}
+
+func TestServer_RequiresToken(t *testing.T) {
+	client, _ := newServer(t)
+	client.Token = "wrong"
+	if _, err := client.Pull(ctx, "", 0); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, client.URL+changesPath, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_PullsAfterCursor(t *testing.T) {
+	client, _ := newServer(t, "a")
+	pulled, err := client.Pull(ctx, "", 0)
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(pulled.Changes) != 1 || pulled.Changes[0].Task.Description != "a" {
+		t.Fatalf("Expected the existing task, got %+v", pulled.Changes)
+	}
+
+	task := models.Task{Description: "b", CreatedAt: "2026-10-01 10:00:00"}
+	pushed, err := client.Push(ctx, []Change{{Ref: 7, Task: &task}})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if len(pushed.Changes) != 1 || pushed.Changes[0].Ref != 7 || pushed.Changes[0].ID != 2 {
+		t.Errorf("Expected the new task as ID 2 with its ref, got %+v", pushed.Changes)
+	}
+
+	later, err := client.Pull(ctx, "", pulled.Cursor)
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(later.Changes) != 1 || later.Changes[0].Task.Description != "b" || later.Cursor != pushed.Cursor {
+		t.Errorf("Expected only the new task, got %+v", later)
+	}
+}
+
+func TestServer_RefusesOutdatedPush(t *testing.T) {
+	client, store := newServer(t, "a")
+	pulled, _ := client.Pull(ctx, "", 0)
+	base := pulled.Changes[0]
+
+	edited := *base.Task
+	edited.Description = "a, edited"
+	if _, err := client.Push(ctx, []Change{{ID: base.ID, BaseRev: base.Rev, Task: &edited}}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	// A second push from the same base lost the race.
+	edited.Description = "a, edited elsewhere"
+	_, err := client.Push(ctx, []Change{{ID: base.ID, BaseRev: base.Rev, Task: &edited}, {ID: base.ID, BaseRev: base.Rev, Deleted: true}})
+	var bad *StatusError
+	if !errors.As(err, &bad) || bad.Status != http.StatusBadRequest {
+		t.Errorf("Expected a task changed twice to be refused, got %v", err)
+	}
+	_, err = client.Push(ctx, []Change{{ID: base.ID, BaseRev: base.Rev, Task: &edited}})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || len(conflict.Conflicts) != 1 || conflict.Conflicts[0].Task.Description != "a, edited" {
+		t.Fatalf("Expected a conflict with the current task, got %v", err)
+	}
+
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "a, edited" {
+		t.Errorf("Expected the refused push to change nothing, got %+v", tasks)
+	}
+}
+
+func TestServer_RecordsDeletions(t *testing.T) {
+	client, _ := newServer(t, "a")
+	pulled, _ := client.Pull(ctx, "", 0)
+	base := pulled.Changes[0]
+	if _, err := client.Push(ctx, []Change{{ID: base.ID, BaseRev: base.Rev, Deleted: true}}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	later, _ := client.Pull(ctx, "", pulled.Cursor)
+	if len(later.Changes) != 1 || !later.Changes[0].Deleted || later.Changes[0].ID != base.ID {
+		t.Errorf("Expected the deletion, got %+v", later.Changes)
+	}
+
+	// A new task does not reuse the deleted task's ID.
+	task := models.Task{Description: "b"}
+	pushed, err := client.Push(ctx, []Change{{Ref: 1, Task: &task}})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if pushed.Changes[0].ID == base.ID {
+		t.Errorf("Expected a new ID, got %d again", base.ID)
+	}
+}
+
+func TestServer_RejectsInvalidPush(t *testing.T) {
+	client, _ := newServer(t)
+	blank := models.Task{Description: " "}
+	for _, change := range []Change{{Task: &blank}, {Ref: 1}, {ID: 5, Task: &models.Task{Description: "x"}}} {
+		_, err := client.Push(ctx, []Change{change})
+		var bad *StatusError
+		if !errors.As(err, &bad) || bad.Status != http.StatusBadRequest {
+			t.Errorf("Expected %+v to be refused, got %v", change, err)
+		}
+	}
+}
+
+func TestServer_PrunesDeletionsEveryClientPulled(t *testing.T) {
+	client, store := newServer(t, "a", "b")
+	pulled, _ := client.Pull(ctx, "laptop", 0)
+	client.Pull(ctx, "desktop", 0)
+	base := pulled.Changes[0]
+	pushed, err := client.Push(ctx, []Change{{ID: base.ID, BaseRev: base.Rev, Deleted: true}})
+	if err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	deletions := func() int {
+		value, _ := store.GetMeta(ctx, serverMetaKey)
+		var revs revisions
+		if err := json.Unmarshal([]byte(value), &revs); err != nil {
+			t.Fatalf("Reading revisions: %v", err)
+		}
+		return len(revs.Deleted)
+	}
+	client.Pull(ctx, "laptop", pushed.Cursor)
+	if n := deletions(); n != 1 {
+		t.Errorf("Expected the deletion kept while the desktop has not pulled it, got %d", n)
+	}
+	client.Pull(ctx, "desktop", pushed.Cursor)
+	if n := deletions(); n != 0 {
+		t.Errorf("Expected the deletion pruned once every client pulled it, got %d", n)
+	}
+
+	// A client still behind the pruned deletion gets every task.
+	behind, err := client.Pull(ctx, "", pulled.Cursor)
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if !behind.Reset || len(behind.Changes) != 1 || behind.Changes[0].ID == base.ID {
+		t.Errorf("Expected a reset holding only the other task, got %+v", behind)
+	}
+
+	// Its edit of the pruned task brings it back under the same ID.
+	task := models.Task{Description: "edited"}
+	if _, err := client.Push(ctx, []Change{{ID: base.ID, BaseRev: base.Rev, Task: &task}}); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	tasks, _ := store.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 2 || findTask(tasks, base.ID).Description != "edited" {
+		t.Errorf("Expected the edit to bring the task back, got %+v", tasks)
+	}
+}
+
+func findTask(tasks []models.Task, id int) models.Task {
+	for _, task := range tasks {
+		if task.ID == id {
+			return task
+		}
+	}
+	return models.Task{}
+}
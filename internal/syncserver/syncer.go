@@ -0,0 +1,371 @@
+package syncserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// clientMetaKey holds a client store's sync state.
+const clientMetaKey = "server_sync"
+
+// maxAttempts is how often a sync is tried when it races with a change on
+// the server or in the store.
+const maxAttempts = 3
+
+// errStoreChanged is returned when the store changed while a sync was
+// merging, so the merged tasks could not be written without losing that
+// change.
+var errStoreChanged = errors.New("tasks changed during the sync")
+
+// syncedTask is a task as the server had it when last synced.
+type syncedTask struct {
+	Rev     int64       `json:"rev"`
+	Deleted bool        `json:"deleted,omitempty"`
+	Task    models.Task `json:"task"`
+}
+
+// clientState is what a client store remembers between syncs.
+type clientState struct {
+	// URL is the server the state belongs to. Syncing with another server
+	// starts over.
+	URL    string `json:"url"`
+	Cursor int64  `json:"cursor"`
+	// Client is the random ID the store pulls under.
+	Client string `json:"client"`
+	// IDs maps the ID of each task on the server to its ID in the store.
+	IDs    map[int]int        `json:"ids"`
+	Synced map[int]syncedTask `json:"synced"`
+}
+
+// Syncer syncs a store with a sync server.
+type Syncer struct {
+	Client *Client
+	Store  storage.Backend
+}
+
+// NewSyncer returns a syncer for store and the server client talks to.
+func NewSyncer(client *Client, store storage.Backend) *Syncer {
+	return &Syncer{Client: client, Store: store}
+}
+
+func (s *Syncer) load(ctx context.Context) (*clientState, error) {
+	value, err := s.Store.GetMeta(ctx, clientMetaKey)
+	if err != nil {
+		return nil, err
+	}
+	st := &clientState{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), st); err != nil {
+			return nil, fmt.Errorf("reading sync state: %w", err)
+		}
+	}
+	if st.URL != s.Client.URL {
+		st = &clientState{URL: s.Client.URL}
+	}
+	if st.Client == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return nil, fmt.Errorf("creating client ID: %w", err)
+		}
+		st.Client = hex.EncodeToString(id)
+	}
+	if st.IDs == nil {
+		st.IDs = make(map[int]int)
+	}
+	if st.Synced == nil {
+		st.Synced = make(map[int]syncedTask)
+	}
+	return st, nil
+}
+
+// meta returns st as the setting it is saved under.
+func (st *clientState) meta() (map[string]string, error) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, fmt.Errorf("saving sync state: %w", err)
+	}
+	return map[string]string{clientMetaKey: string(data)}, nil
+}
+
+func (s *Syncer) save(ctx context.Context, st *clientState) error {
+	meta, err := st.meta()
+	if err != nil {
+		return err
+	}
+	return s.Store.SetMeta(ctx, clientMetaKey, meta[clientMetaKey])
+}
+
+// Sync pulls the changes made on the server since the last sync, merges
+// them into the store and pushes the store's own changes. The conflicts
+// returned were resolved by keeping the later edit. A sync that races with
+// another client's push or with an edit to the store is retried.
+func (s *Syncer) Sync(ctx context.Context) ([]models.Conflict, error) {
+	if err := storage.RequirePlaintext(ctx, s.Store, "server sync"); err != nil {
+		return nil, err
+	}
+	var conflicts []models.Conflict
+	for attempt := 1; ; attempt++ {
+		found, err := s.sync(ctx)
+		conflicts = append(conflicts, found...)
+		var conflict *ConflictError
+		if attempt < maxAttempts && (errors.As(err, &conflict) || errors.Is(err, errStoreChanged)) {
+			continue
+		}
+		return conflicts, err
+	}
+}
+
+// changes are the store's changes since the last sync, keyed by server ID.
+type changes struct {
+	edited  map[int]models.Task
+	deleted map[int]bool
+	added   []models.Task
+}
+
+// localChanges compares tasks with what the server had at the last sync.
+func localChanges(st *clientState, tasks []models.Task) changes {
+	local := changes{edited: make(map[int]models.Task), deleted: make(map[int]bool)}
+	serverIDs := make(map[int]int, len(st.IDs))
+	for serverID, id := range st.IDs {
+		serverIDs[id] = serverID
+	}
+	present := make(map[int]bool, len(tasks))
+	for _, task := range tasks {
+		serverID, ok := serverIDs[task.ID]
+		if !ok {
+			local.added = append(local.added, task)
+			continue
+		}
+		present[serverID] = true
+		if synced := st.Synced[serverID]; synced.Deleted || content(task) != synced.Task {
+			local.edited[serverID] = task
+		}
+	}
+	for serverID := range st.IDs {
+		if !present[serverID] {
+			local.deleted[serverID] = true
+		}
+	}
+	return local
+}
+
+func (s *Syncer) sync(ctx context.Context) ([]models.Conflict, error) {
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pulled, err := s.Client.Pull(ctx, st.Client, st.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if pulled.Reset {
+		pulled.Changes = append(pulled.Changes, missing(st, pulled)...)
+	}
+	local := localChanges(st, tasks)
+
+	byID := make(map[int]models.Task, len(tasks))
+	next := 0
+	for _, task := range tasks {
+		byID[task.ID] = task
+		next = max(next, task.ID)
+	}
+	for _, id := range st.IDs {
+		next = max(next, id)
+	}
+	// take writes a task from the server into the store.
+	take := func(serverID int, task models.Task) {
+		id, ok := st.IDs[serverID]
+		if !ok {
+			next++
+			id = next
+			st.IDs[serverID] = id
+		}
+		task.ID, task.Version = id, byID[id].Version
+		byID[id] = task
+	}
+
+	var conflicts []models.Conflict
+	changed := false
+	for _, change := range pulled.Changes {
+		if synced, ok := st.Synced[change.ID]; ok && synced.Rev >= change.Rev {
+			// Our own push coming back.
+			continue
+		}
+		edit, edited := local.edited[change.ID]
+		switch {
+		case change.Deleted && edited:
+			// An edit beats a deletion: it is pushed, bringing the task back.
+			conflicts = append(conflicts, models.Conflict{Kept: edit, Remote: remoteName})
+			st.Synced[change.ID] = syncedTask{Rev: change.Rev, Deleted: true}
+		case change.Deleted:
+			if id, ok := st.IDs[change.ID]; ok {
+				delete(byID, id)
+				changed = true
+			}
+			delete(local.deleted, change.ID)
+			delete(st.IDs, change.ID)
+			delete(st.Synced, change.ID)
+		default:
+			remote := content(*change.Task)
+			st.Synced[change.ID] = syncedTask{Rev: change.Rev, Task: remote}
+			switch {
+			case edited && content(edit) == remote:
+				delete(local.edited, change.ID)
+			case edited && edit.UpdatedAt > remote.UpdatedAt:
+				conflicts = append(conflicts, models.Conflict{Kept: edit, Lost: remote, Remote: remoteName})
+			default:
+				if edited {
+					conflicts = append(conflicts, models.Conflict{Kept: remote, Lost: edit, Remote: remoteName})
+					delete(local.edited, change.ID)
+				} else if local.deleted[change.ID] {
+					conflicts = append(conflicts, models.Conflict{Kept: remote, Remote: remoteName})
+					delete(local.deleted, change.ID)
+				}
+				take(change.ID, remote)
+				changed = true
+			}
+		}
+	}
+	st.Cursor = pulled.Cursor
+
+	if changed {
+		// The merge started from tasks; writing it over an edit made since
+		// would lose that edit, so try again instead.
+		now, err := storage.ExportTasks(ctx, s.Store)
+		if err != nil {
+			return conflicts, err
+		}
+		if !unchanged(tasks, now) {
+			return conflicts, errStoreChanged
+		}
+		merged := make([]models.Task, 0, len(byID))
+		for _, id := range sortedIDs(byID) {
+			merged = append(merged, byID[id])
+		}
+		// The state is saved with the tasks, so a crash cannot leave the
+		// cursor past changes the store never got.
+		meta, err := st.meta()
+		if err != nil {
+			return conflicts, err
+		}
+		if err := s.Store.ReplaceTasks(ctx, merged, meta); err != nil {
+			return conflicts, fmt.Errorf("saving merged tasks: %w", err)
+		}
+	} else if err := s.save(ctx, st); err != nil {
+		return conflicts, err
+	}
+	return conflicts, s.push(ctx, st, local)
+}
+
+// missing returns deletions for the tasks the store got from the server
+// that a reset pull does not hold, which were deleted there.
+func missing(st *clientState, pulled Changes) []Change {
+	held := make(map[int]bool, len(pulled.Changes))
+	for _, change := range pulled.Changes {
+		held[change.ID] = true
+	}
+	var deleted []Change
+	for _, serverID := range sortedIDs(st.IDs) {
+		if !held[serverID] {
+			deleted = append(deleted, Change{ID: serverID, Rev: pulled.Cursor, Deleted: true})
+		}
+	}
+	return deleted
+}
+
+// unchanged reports whether two reads of the store hold the same tasks at
+// the same versions.
+func unchanged(before, after []models.Task) bool {
+	if len(before) != len(after) {
+		return false
+	}
+	versions := make(map[int]int, len(before))
+	for _, task := range before {
+		versions[task.ID] = task.Version
+	}
+	for _, task := range after {
+		if version, ok := versions[task.ID]; !ok || version != task.Version {
+			return false
+		}
+	}
+	return true
+}
+
+// push sends the store's changes to the server and records them as synced.
+func (s *Syncer) push(ctx context.Context, st *clientState, local changes) error {
+	var out []Change
+	for _, serverID := range sortedIDs(local.edited) {
+		task := content(local.edited[serverID])
+		out = append(out, Change{ID: serverID, BaseRev: st.Synced[serverID].Rev, Task: &task})
+	}
+	for _, serverID := range sortedIDs(local.deleted) {
+		out = append(out, Change{ID: serverID, BaseRev: st.Synced[serverID].Rev, Deleted: true})
+	}
+	sort.Slice(local.added, func(i, j int) bool { return local.added[i].ID < local.added[j].ID })
+	for _, task := range local.added {
+		fields := content(task)
+		out = append(out, Change{Ref: task.ID, Task: &fields})
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	applied, err := s.Client.Push(ctx, out)
+	if err != nil {
+		return err
+	}
+	for _, change := range applied.Changes {
+		if change.Ref != 0 {
+			st.IDs[change.ID] = change.Ref
+		}
+		if change.Deleted {
+			delete(st.IDs, change.ID)
+			delete(st.Synced, change.ID)
+			continue
+		}
+		st.Synced[change.ID] = syncedTask{Rev: change.Rev, Task: content(*change.Task)}
+	}
+	return s.save(ctx, st)
+}
+
+// Run syncs every interval until ctx is cancelled, and once more on the
+// way out so no change stays behind.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the final sync needs its own deadline.
+			final, cancel := context.WithTimeout(context.Background(), interval)
+			s.logSync(final)
+			cancel()
+			return
+		case <-ticker.C:
+			s.logSync(ctx)
+		}
+	}
+}
+
+func (s *Syncer) logSync(ctx context.Context) {
+	conflicts, err := s.Sync(ctx)
+	for _, c := range conflicts {
+		log.Printf("Server sync: %s", c)
+	}
+	if err != nil {
+		log.Printf("Server sync: %v", err)
+	}
+}
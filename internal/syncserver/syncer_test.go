@@ -0,0 +1,251 @@
+package syncserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"go-todo/internal/models"
+	"go-todo/internal/storage"
+)
+
+// newMachine returns a syncer with an empty store of its own for the server
+// client talks to.
+func newMachine(client *Client) *Syncer {
+	return NewSyncer(client, storage.NewMemoryStore())
+}
+
+func mustSync(t *testing.T, s *Syncer) []models.Conflict {
+	t.Helper()
+	conflicts, err := s.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	return conflicts
+}
+
+func assertTasks(t *testing.T, s *Syncer, want ...string) {
+	t.Helper()
+	tasks, err := storage.ExportTasks(ctx, s.Store)
+	if err != nil {
+		t.Fatalf("Reading tasks: %v", err)
+	}
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.Description)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+			return
+		}
+	}
+}
+
+func findID(t *testing.T, s *Syncer, description string) int {
+	t.Helper()
+	tasks, _ := storage.ExportTasks(ctx, s.Store)
+	for _, task := range tasks {
+		if task.Description == description {
+			return task.ID
+		}
+	}
+	t.Fatalf("Task %q not found", description)
+	return 0
+}
+
+// edit overwrites a task with the given description and updated_at, so
+// tests control which edit is later.
+func edit(t *testing.T, s *Syncer, description, newDescription, updatedAt string) {
+	t.Helper()
+	tasks, _ := storage.ExportTasks(ctx, s.Store)
+	for i := range tasks {
+		if tasks[i].Description == description {
+			tasks[i].Description = newDescription
+			tasks[i].UpdatedAt = updatedAt
+		}
+	}
+	if err := s.Store.ReplaceTasks(ctx, tasks, nil); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+}
+
+func TestSync_SharesChanges(t *testing.T) {
+	client, _ := newServer(t)
+	laptop, desktop := newMachine(client), newMachine(client)
+
+	laptop.Store.AddTask(ctx, "Write report")
+	laptop.Store.AddTask(ctx, "Buy milk")
+	desktop.Store.AddTask(ctx, "From desktop")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+	assertTasks(t, laptop, "Write report", "Buy milk", "From desktop")
+	assertTasks(t, desktop, "Write report", "Buy milk", "From desktop")
+
+	desktop.Store.RenameTask(ctx, findID(t, desktop, "Write report"), 0, "Write the report")
+	desktop.Store.DeleteTask(ctx, findID(t, desktop, "Buy milk"), 0)
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+	assertTasks(t, laptop, "Write the report", "From desktop")
+
+	// Syncing with nothing new changes nothing.
+	before, _ := storage.ExportTasks(ctx, laptop.Store)
+	mustSync(t, laptop)
+	if after, _ := storage.ExportTasks(ctx, laptop.Store); !unchanged(before, after) {
+		t.Error("Expected a sync without changes to leave the store alone")
+	}
+}
+
+func TestSync_LaterEditWins(t *testing.T) {
+	client, _ := newServer(t)
+	laptop, desktop := newMachine(client), newMachine(client)
+	laptop.Store.AddTask(ctx, "Call ACME")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	edit(t, laptop, "Call ACME", "Call ACME on Tuesday", "2026-10-01 11:00:00")
+	edit(t, desktop, "Call ACME", "Call ACME on Monday", "2026-10-01 10:00:00")
+	mustSync(t, desktop)
+	conflicts := mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	assertTasks(t, laptop, "Call ACME on Tuesday")
+	assertTasks(t, desktop, "Call ACME on Tuesday")
+	if len(conflicts) != 1 || conflicts[0].Lost.Description != "Call ACME on Monday" {
+		t.Errorf("Expected one conflict losing Monday, got %+v", conflicts)
+	}
+}
+
+func TestSync_EditBeatsDelete(t *testing.T) {
+	client, _ := newServer(t)
+	laptop, desktop := newMachine(client), newMachine(client)
+	laptop.Store.AddTask(ctx, "Keep me")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	laptop.Store.DeleteTask(ctx, findID(t, laptop, "Keep me"), 0)
+	desktop.Store.RenameTask(ctx, findID(t, desktop, "Keep me"), 0, "Keep me, edited")
+	mustSync(t, laptop)
+	if conflicts := mustSync(t, desktop); len(conflicts) != 1 {
+		t.Errorf("Expected a delete/edit conflict, got %+v", conflicts)
+	}
+	mustSync(t, laptop)
+	assertTasks(t, laptop, "Keep me, edited")
+
+	// The other way round, the server's edit brings the task back.
+	laptop.Store.RenameTask(ctx, findID(t, laptop, "Keep me, edited"), 0, "Edited again")
+	desktop.Store.DeleteTask(ctx, findID(t, desktop, "Keep me, edited"), 0)
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	assertTasks(t, desktop, "Edited again")
+}
+
+func TestSync_RetriesAfterLosingARace(t *testing.T) {
+	store := storage.NewMemoryStore()
+	server, err := NewServer(ctx, store, token)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	var desktop *Syncer
+	raced := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The desktop pushes between the laptop's pull and push.
+		if r.Method == http.MethodPost && !raced {
+			raced = true
+			if _, err := desktop.Sync(ctx); err != nil {
+				t.Errorf("Sync on desktop failed: %v", err)
+			}
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	client, _ := NewClient(ts.URL, token)
+	laptop := newMachine(client)
+	desktop = newMachine(client)
+	laptop.Store.AddTask(ctx, "Shared")
+	raced = true
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+
+	edit(t, laptop, "Shared", "Shared, from laptop", "2026-10-01 11:00:00")
+	edit(t, desktop, "Shared", "Shared, from desktop", "2026-10-01 10:00:00")
+	raced = false
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	assertTasks(t, laptop, "Shared, from laptop")
+	assertTasks(t, desktop, "Shared, from laptop")
+}
+
+func TestSync_RejectsEncryptedStore(t *testing.T) {
+	client, _ := newServer(t)
+	store, err := storage.EnableEncryption(ctx, storage.NewMemoryStore(), "secret")
+	if err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	if _, err := NewSyncer(client, store).Sync(ctx); err == nil {
+		t.Error("Expected an encrypted store to be refused")
+	}
+}
+
+func TestSync_StartsOverWithAnotherServer(t *testing.T) {
+	first, _ := newServer(t)
+	second, secondStore := newServer(t)
+	laptop := newMachine(first)
+	laptop.Store.AddTask(ctx, "a")
+	mustSync(t, laptop)
+
+	laptop.Client = second
+	mustSync(t, laptop)
+	tasks, _ := secondStore.GetTasks(ctx, models.TaskQuery{})
+	if len(tasks) != 1 || tasks[0].Description != "a" {
+		t.Errorf("Expected the task pushed to the new server, got %+v", tasks)
+	}
+}
+
+func TestSync_Offline(t *testing.T) {
+	client, _ := newServer(t)
+	laptop := newMachine(client)
+	laptop.Store.AddTask(ctx, "a")
+	client.URL = "http://127.0.0.1:1"
+	if _, err := laptop.Sync(ctx); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable, got %v", err)
+	}
+	assertTasks(t, laptop, "a")
+}
+
+func TestSync_CatchesUpAfterDeletionsArePruned(t *testing.T) {
+	client, _ := newServer(t)
+	laptop, desktop := newMachine(client), newMachine(client)
+	laptop.Store.AddTask(ctx, "a")
+	laptop.Store.AddTask(ctx, "b")
+	mustSync(t, laptop)
+	mustSync(t, desktop)
+	mustSync(t, laptop)
+	tasks, _ := storage.ExportTasks(ctx, laptop.Store)
+	state, _ := laptop.Store.GetMeta(ctx, clientMetaKey)
+
+	desktop.Store.DeleteTask(ctx, findID(t, desktop, "a"), 0)
+	// A client's cursor passes the deletion with the first pull that got
+	// it, and the server sees that with the next one.
+	for range 3 {
+		mustSync(t, desktop)
+		mustSync(t, laptop)
+	}
+
+	// The laptop is restored from a backup taken before the deletion,
+	// which the server has since forgotten.
+	if err := laptop.Store.ReplaceTasks(ctx, tasks, map[string]string{clientMetaKey: state}); err != nil {
+		t.Fatalf("ReplaceTasks failed: %v", err)
+	}
+	mustSync(t, laptop)
+	assertTasks(t, laptop, "b")
+}
@@ -0,0 +1,82 @@
+package ui
+
+// Action is something the user can do from the main page. Every action is
+// bound to its keys, offered in the command palette and listed in the help
+// panel, so the registry below is the one place a new action has to be
+// added.
+type Action struct {
+	// Name identifies the action, e.g. "delete".
+	Name string
+	// Label describes it in the command palette and the help panel.
+	Label string
+	// Keys are the key sequences that run it, such as "d", "Ctrl+P" or
+	// "gg", in the form parseKeys reads. The config file can replace them.
+	Keys []string
+	// Global actions work wherever the focus is on the main page; the
+	// others only in the task list.
+	Global bool
+	// When, if set, reports whether the action applies right now. When it
+	// doesn't, its keys are passed on as if it were not bound.
+	When func(ui *UI) bool
+	Run  func(ui *UI)
+}
+
+// defaultActions returns the registry of everything the user can do, in
+// the order the command palette lists it, with the default keys.
+func defaultActions() []Action {
+	return []Action{
+		{Name: "toggle", Label: "Toggle done", Keys: []string{"Enter"}, Run: func(ui *UI) { ui.controller.HandleToggleTask() }},
+		{Name: "delete", Label: "Delete task", Keys: []string{"d"}, Run: func(ui *UI) {
+			index := ui.list.GetCurrentItem()
+			ui.controller.HandleDeleteTask()
+			if row, ok := ui.nearestTaskRow(index-1, -1); ok {
+				ui.list.SetCurrentItem(row)
+			}
+		}},
+		{Name: "rename", Label: "Rename task", Keys: []string{"e"}, Run: func(ui *UI) { ui.controller.HandleRenameTask() }},
+		{Name: "copy", Label: "Copy task text", Keys: []string{"c"}, Run: func(ui *UI) { ui.controller.HandleCopyText() }},
+		{Name: "set-due", Label: "Set due date", Keys: []string{"u"}, Run: func(ui *UI) { ui.controller.HandleSetDue() }},
+		{Name: "cursor-down", Label: "Cursor down", Keys: []string{"j"}, Run: func(ui *UI) {
+			if row, ok := ui.nearestTaskRow(ui.list.GetCurrentItem()+1, 1); ok {
+				ui.list.SetCurrentItem(row)
+			}
+		}},
+		{Name: "cursor-up", Label: "Cursor up", Keys: []string{"k"}, Run: func(ui *UI) {
+			if row, ok := ui.nearestTaskRow(ui.list.GetCurrentItem()-1, -1); ok {
+				ui.list.SetCurrentItem(row)
+			}
+		}},
+		{Name: "move-down", Label: "Move task down", Keys: []string{"J"}, Run: func(ui *UI) { ui.controller.HandleMoveDown() }},
+		{Name: "move-up", Label: "Move task up", Keys: []string{"K"}, Run: func(ui *UI) { ui.controller.HandleMoveUp() }},
+		{Name: "sort", Label: "Choose sort order", Keys: []string{"s"}, Run: func(ui *UI) { ui.controller.HandleChooseSort() }},
+		{Name: "group", Label: "Choose grouping", Keys: []string{"g"}, Run: func(ui *UI) { ui.controller.HandleChooseGroup() }},
+		{Name: "hide-done", Label: "Hide/show done tasks", Keys: []string{"H"}, Run: func(ui *UI) { ui.controller.HandleToggleHideDone() }},
+		{Name: "archive", Label: "Archive completed tasks", Keys: []string{"X"}, Run: func(ui *UI) { ui.controller.HandleArchiveCompleted() }},
+		{Name: "show-archive", Label: "Browse archive", Keys: []string{"A"}, Run: func(ui *UI) { ui.controller.HandleShowArchive() }},
+		{Name: "mark", Label: "Mark/unmark task", Keys: []string{"Space"}, Run: func(ui *UI) {
+			index := ui.list.GetCurrentItem()
+			ui.toggleMark(index)
+			if row, ok := ui.nearestTaskRow(index+1, 1); ok {
+				ui.list.SetCurrentItem(row)
+			}
+		}},
+		{Name: "mark-range", Label: "Mark range", Keys: []string{"V"}, Run: func(ui *UI) { ui.markRange(ui.list.GetCurrentItem()) }},
+		{Name: "mark-all", Label: "Mark all", Keys: []string{"*"}, Run: func(ui *UI) { ui.markAll() }},
+		{Name: "clear-marks", Label: "Clear marks", Keys: []string{"Esc"},
+			When: func(ui *UI) bool { return len(ui.marked) > 0 },
+			Run:  func(ui *UI) { ui.ClearMarks() }},
+		{Name: "run-command", Label: "Run custom command", Keys: []string{":"}, Run: func(ui *UI) { ui.controller.HandleRunCommand() }},
+		{Name: "palette", Label: "Command palette", Keys: []string{"Ctrl+P"}, Global: true, Run: func(ui *UI) { ui.showPalette() }},
+		{Name: "switch-focus", Label: "Switch between list and input", Keys: []string{"Tab", "Backtab"}, Global: true, Run: func(ui *UI) {
+			if ui.input.HasFocus() {
+				ui.FocusList()
+			} else {
+				ui.FocusInput()
+			}
+		}},
+		{Name: "cancel", Label: "Cancel pending operation", Keys: []string{"Esc"}, Global: true,
+			When: func(ui *UI) bool { return ui.busy > 0 },
+			Run:  func(ui *UI) { ui.controller.HandleCancel() }},
+		{Name: "quit", Label: "Quit", Keys: []string{"q"}, Global: true, Run: func(ui *UI) { ui.controller.HandleQuit() }},
+	}
+}
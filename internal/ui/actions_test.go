@@ -0,0 +1,49 @@
+package ui
+
+import "testing"
+
+func TestDefaultActions_AreUniquelyNamedAndBound(t *testing.T) {
+	names := make(map[string]bool)
+	for _, action := range defaultActions() {
+		if names[action.Name] {
+			t.Errorf("Expected unique action names, %q is repeated", action.Name)
+		}
+		names[action.Name] = true
+		if action.Label == "" || action.Run == nil || len(action.Keys) == 0 {
+			t.Errorf("Expected %q to have a label, a key and a Run func", action.Name)
+		}
+	}
+	if _, err := bindActions(defaultActions(), nil); err != nil {
+		t.Errorf("Expected the default keys to be valid, got %v", err)
+	}
+}
+
+func TestMatchActions(t *testing.T) {
+	all := defaultActions()
+	if got := matchActions(all, ""); len(got) != len(all) || got[0].Name != all[0].Name {
+		t.Errorf("Expected every action in order for an empty query, got %d", len(got))
+	}
+	if got := matchActions(all, "due"); len(got) == 0 || got[0].Name != "set-due" {
+		t.Errorf("Expected set-due first for \"due\", got %+v", got)
+	}
+	if got := matchActions(all, "ARCH"); len(got) != 2 || got[0].Name != "archive" || got[1].Name != "show-archive" {
+		t.Errorf("Expected the archive actions for \"ARCH\", got %+v", got)
+	}
+	if got := matchActions(all, "mv dn"); len(got) == 0 || got[0].Name != "move-down" {
+		t.Errorf("Expected move-down first for \"mv dn\", got %+v", got)
+	}
+	if got := matchActions(all, "zzz"); len(got) != 0 {
+		t.Errorf("Expected no match for \"zzz\", got %+v", got)
+	}
+}
+
+func TestMatchActions_FindsCustomCommands(t *testing.T) {
+	all := append(defaultActions(), commandActions([]string{"Standup checklist", "Finish release tasks"})...)
+	got := matchActions(all, "standup")
+	if len(got) == 0 || got[0].Name != "command:Standup checklist" || got[0].Label != "Run: Standup checklist" {
+		t.Errorf("Expected the standup command first for \"standup\", got %+v", got)
+	}
+	if got := matchActions(all, "release"); len(got) == 0 || got[0].Name != "command:Finish release tasks" {
+		t.Errorf("Expected the release command first for \"release\", got %+v", got)
+	}
+}
@@ -0,0 +1,288 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// namedKeys maps the lower-cased names of special keys to how keyName
+// writes them.
+var namedKeys = func() map[string]string {
+	names := map[string]string{"space": "Space"}
+	for key, name := range tcell.KeyNames {
+		if strings.HasPrefix(name, "Ctrl-") || key == tcell.KeyBackspace2 {
+			continue
+		}
+		names[strings.ToLower(name)] = name
+	}
+	return names
+}()
+
+// keyName names the key pressed in event the way parseKeys does: the
+// character for printable keys, "Space", tcell's name for special keys
+// such as "Enter" or "Backtab", and "Ctrl+", "Alt+" or "Shift+" before any
+// modifiers, e.g. "Ctrl+P" or "Alt+j".
+func keyName(event *tcell.EventKey) string {
+	key, mods := event.Key(), event.Modifiers()
+	var name string
+	switch {
+	case key == tcell.KeyRune:
+		name = string(event.Rune())
+		if event.Rune() == ' ' {
+			name = "Space"
+		}
+		// Shift is already in the character.
+		mods &^= tcell.ModShift
+	case key >= tcell.KeyCtrlA && key <= tcell.KeyCtrlZ && key != tcell.KeyBackspace && key != tcell.KeyTab && key != tcell.KeyEnter:
+		name = string(rune('A' + key - tcell.KeyCtrlA))
+		mods |= tcell.ModCtrl
+	case key == tcell.KeyBackspace2:
+		name = "Backspace"
+	default:
+		var ok bool
+		if name, ok = tcell.KeyNames[key]; !ok {
+			return ""
+		}
+	}
+	return modifierPrefix(mods) + name
+}
+
+// modifierPrefix writes mods the way key names start, e.g. "Ctrl+Alt+".
+func modifierPrefix(mods tcell.ModMask) string {
+	var b strings.Builder
+	for _, mod := range []struct {
+		mask tcell.ModMask
+		name string
+	}{{tcell.ModCtrl, "Ctrl+"}, {tcell.ModAlt, "Alt+"}, {tcell.ModShift, "Shift+"}} {
+		if mods&mod.mask != 0 {
+			b.WriteString(mod.name)
+		}
+	}
+	return b.String()
+}
+
+// parseKeys reads a key sequence such as "d", "Ctrl+P", "gg" or
+// "Ctrl+X s" and returns its keys as keyName names them. Keys are separated
+// by spaces, except that a run of characters that is not a key name, like
+// "gg", is one key per character. Names and modifiers are not case
+// sensitive, but the characters are: "J" is Shift+j.
+func parseKeys(spec string) ([]string, error) {
+	var keys []string
+	for _, token := range strings.Fields(spec) {
+		if _, named := namedKeys[strings.ToLower(token)]; named || (strings.Contains(token, "+") && len(token) > 1) {
+			key, err := parseKey(token)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			continue
+		}
+		for _, r := range token {
+			keys = append(keys, string(r))
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty key sequence")
+	}
+	return keys, nil
+}
+
+// parseKey reads a single key with any modifiers, e.g. "ctrl+p" or "Tab".
+func parseKey(token string) (string, error) {
+	var mods tcell.ModMask
+	base := token
+	// A "+" at the end is the key itself, as in "Alt++".
+	for i := strings.Index(base, "+"); i > 0 && i < len(base)-1; i = strings.Index(base, "+") {
+		switch strings.ToLower(base[:i]) {
+		case "ctrl":
+			mods |= tcell.ModCtrl
+		case "alt":
+			mods |= tcell.ModAlt
+		case "shift":
+			mods |= tcell.ModShift
+		default:
+			return "", fmt.Errorf("unknown modifier %q in %q", base[:i], token)
+		}
+		base = base[i+1:]
+	}
+
+	if r := []rune(base); len(r) == 1 {
+		name := base
+		switch {
+		case mods&tcell.ModCtrl != 0:
+			upper := unicode.ToUpper(r[0])
+			if upper < 'A' || upper > 'Z' {
+				return "", fmt.Errorf("%q: Ctrl only combines with letters", token)
+			}
+			if upper == 'H' || upper == 'I' || upper == 'M' {
+				return "", fmt.Errorf("%q can't be told apart from Backspace, Tab or Enter", token)
+			}
+			name = string(upper)
+		case mods&tcell.ModShift != 0:
+			name = string(unicode.ToUpper(r[0]))
+		}
+		// Shift is in the character, as keyName reports it.
+		return modifierPrefix(mods&^tcell.ModShift) + name, nil
+	}
+
+	name, ok := namedKeys[strings.ToLower(base)]
+	if !ok {
+		return "", fmt.Errorf("unknown key %q", token)
+	}
+	if name == "Tab" && mods&tcell.ModShift != 0 {
+		name, mods = "Backtab", mods&^tcell.ModShift
+	}
+	return modifierPrefix(mods) + name, nil
+}
+
+// formatKeys writes a key sequence back the way parseKeys reads it, as
+// "gg" rather than "g g" where that is unambiguous.
+func formatKeys(keys []string) string {
+	compact := true
+	for _, key := range keys {
+		if len([]rune(key)) != 1 {
+			compact = false
+		}
+	}
+	if compact && len(keys) > 1 {
+		if _, named := namedKeys[strings.ToLower(strings.Join(keys, ""))]; !named {
+			return strings.Join(keys, "")
+		}
+	}
+	return strings.Join(keys, " ")
+}
+
+// bindActions applies the user's key bindings, a map from action name to
+// key sequences, over the defaults in actions. Actions left out keep their
+// keys, and an empty list unbinds one. The keys of the returned actions are
+// written the way formatKeys writes them.
+//
+// A sequence may not be bound to two actions, nor start another sequence,
+// since the shorter one would always run first. Only actions that apply
+// some of the time, such as Esc clearing marks, may share keys with each
+// other.
+func bindActions(actions []Action, bindings map[string][]string) ([]Action, error) {
+	actions = slices.Clone(actions)
+	var errs []error
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := slices.IndexFunc(actions, func(a Action) bool { return a.Name == name })
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("unknown action %q", name))
+			continue
+		}
+		actions[i].Keys = bindings[name]
+	}
+
+	type bound struct {
+		keys   []string
+		action Action
+	}
+	var all []bound
+	for i, action := range actions {
+		formatted := make([]string, 0, len(action.Keys))
+		for _, spec := range action.Keys {
+			keys, err := parseKeys(spec)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", action.Name, err))
+				continue
+			}
+			formatted = append(formatted, formatKeys(keys))
+			all = append(all, bound{keys, action})
+		}
+		actions[i].Keys = formatted
+	}
+
+	for i, a := range all {
+		for _, b := range all[i+1:] {
+			if a.action.Name == b.action.Name || (a.action.When != nil && b.action.When != nil) {
+				continue
+			}
+			short, long := a, b
+			if len(short.keys) > len(long.keys) {
+				short, long = long, short
+			}
+			switch {
+			case slices.Equal(short.keys, long.keys):
+				errs = append(errs, fmt.Errorf("%s is bound to both %s and %s", formatKeys(short.keys), a.action.Name, b.action.Name))
+			case slices.Equal(short.keys, long.keys[:len(short.keys)]):
+				errs = append(errs, fmt.Errorf("%s (%s) starts %s (%s), which could never be typed", formatKeys(short.keys), short.action.Name, formatKeys(long.keys), long.action.Name))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return actions, nil
+}
+
+// keymap runs the actions bound to the keys the user presses, collecting
+// the keys of a sequence such as "gg" until it is complete.
+type keymap struct {
+	bindings []binding
+	// pending holds the keys typed so far of an unfinished sequence.
+	pending []string
+}
+
+type binding struct {
+	keys   []string
+	action Action
+}
+
+// newKeymap binds the keys of actions, which must have been checked by
+// bindActions. Global actions take precedence where keys are shared.
+func newKeymap(actions []Action) *keymap {
+	m := &keymap{}
+	for _, global := range []bool{true, false} {
+		for _, action := range actions {
+			if action.Global != global {
+				continue
+			}
+			for _, spec := range action.Keys {
+				keys, _ := parseKeys(spec)
+				m.bindings = append(m.bindings, binding{keys, action})
+			}
+		}
+	}
+	return m
+}
+
+// press handles a key press, running the action it completes, if any. It
+// reports whether the key was used; unused keys are left to the focused
+// widget. inList says whether the task list has focus, which actions other
+// than global ones need. A key that breaks off a sequence starts a new one.
+func (m *keymap) press(ui *UI, key string, inList bool) bool {
+	seq := append(slices.Clip(m.pending), key)
+	m.pending = nil
+	prefix := false
+	for _, b := range m.bindings {
+		if (!b.action.Global && !inList) || (b.action.When != nil && !b.action.When(ui)) {
+			continue
+		}
+		if slices.Equal(b.keys, seq) {
+			b.action.Run(ui)
+			return true
+		}
+		if len(b.keys) > len(seq) && slices.Equal(b.keys[:len(seq)], seq) {
+			prefix = true
+		}
+	}
+	if prefix {
+		m.pending = seq
+		return true
+	}
+	if len(seq) > 1 {
+		return m.press(ui, key, inList)
+	}
+	return false
+}
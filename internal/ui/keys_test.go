@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestKeyName(t *testing.T) {
+	for want, event := range map[string]*tcell.EventKey{
+		"d":         tcell.NewEventKey(tcell.KeyRune, 'd', tcell.ModNone),
+		"J":         tcell.NewEventKey(tcell.KeyRune, 'J', tcell.ModShift),
+		"Space":     tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone),
+		"Alt+j":     tcell.NewEventKey(tcell.KeyRune, 'j', tcell.ModAlt),
+		"Enter":     tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone),
+		"Esc":       tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone),
+		"Backtab":   tcell.NewEventKey(tcell.KeyBacktab, 0, tcell.ModNone),
+		"Ctrl+P":    tcell.NewEventKey(tcell.KeyCtrlP, 0, tcell.ModCtrl),
+		"Shift+Up":  tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModShift),
+		"Backspace": tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone),
+	} {
+		if got := keyName(event); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	for spec, want := range map[string]string{
+		"d":            "d",
+		"gg":           "g g",
+		"ctrl+p":       "Ctrl+P",
+		"Ctrl+X s":     "Ctrl+X s",
+		"shift+j":      "J",
+		"Alt+Shift+j":  "Alt+J",
+		"shift+tab":    "Backtab",
+		"esc":          "Esc",
+		"Up":           "Up",
+		"u p":          "u p",
+		"space":        "Space",
+		"Alt++":        "Alt++",
+		"F5 F5":        "F5 F5",
+		"Shift+Down d": "Shift+Down d",
+	} {
+		keys, err := parseKeys(spec)
+		if err != nil {
+			t.Errorf("Parsing %q failed: %v", spec, err)
+			continue
+		}
+		if got := strings.Join(keys, " "); got != want {
+			t.Errorf("Expected %q to parse as %q, got %q", spec, want, got)
+		}
+	}
+	for _, spec := range []string{"", "Hyper+x", "Ctrl+1", "Ctrl+M", "Ctrl+Nope"} {
+		if _, err := parseKeys(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestFormatKeys(t *testing.T) {
+	for want, keys := range map[string][]string{
+		"gg":       {"g", "g"},
+		"u p":      {"u", "p"},
+		"Ctrl+X s": {"Ctrl+X", "s"},
+		"J":        {"J"},
+	} {
+		if got := formatKeys(keys); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestBindActions(t *testing.T) {
+	actions, err := bindActions(defaultActions(), map[string][]string{
+		"delete":      {"dd", "Delete"},
+		"cursor-down": {"j", "Down"},
+		"quit":        {"Ctrl+Q"},
+		"copy":        {},
+		"group":       {"G"},
+	})
+	if err != nil {
+		t.Fatalf("Expected the bindings to be valid, got %v", err)
+	}
+	for _, action := range actions {
+		var want string
+		switch action.Name {
+		case "delete":
+			want = "dd, Delete"
+		case "quit":
+			want = "Ctrl+Q"
+		case "copy":
+			want = ""
+		case "sort":
+			want = "s"
+		default:
+			continue
+		}
+		if got := strings.Join(action.Keys, ", "); got != want {
+			t.Errorf("Expected %s bound to %q, got %q", action.Name, want, got)
+		}
+	}
+
+	for name, bindings := range map[string]map[string][]string{
+		"unknown action":  {"explode": {"x"}},
+		"invalid key":     {"delete": {"Hyper+d"}},
+		"same key":        {"delete": {"e"}},
+		"prefix":          {"delete": {"dd"}, "rename": {"d"}},
+		"global shadows":  {"group": {"qg"}},
+		"conditional too": {"clear-marks": {"q"}},
+	} {
+		if _, err := bindActions(defaultActions(), bindings); err == nil {
+			t.Errorf("Expected the %s bindings to be rejected", name)
+		}
+	}
+}
+
+func TestKeymap_Sequences(t *testing.T) {
+	var ran []string
+	action := func(name, keys string, global bool) Action {
+		return Action{Name: name, Label: name, Keys: []string{keys}, Global: global,
+			Run: func(*UI) { ran = append(ran, name) }}
+	}
+	actions, err := bindActions([]Action{
+		action("top", "gg", false),
+		action("delete", "dd", false),
+		action("down", "j", false),
+		action("save", "Ctrl+X s", true),
+	}, nil)
+	if err != nil {
+		t.Fatalf("bindActions failed: %v", err)
+	}
+	m := newKeymap(actions)
+	press := func(inList bool, keys ...string) []bool {
+		var used []bool
+		for _, key := range keys {
+			used = append(used, m.press(nil, key, inList))
+		}
+		return used
+	}
+
+	press(true, "g", "g", "d", "j", "d", "d", "x")
+	if got := strings.Join(ran, " "); got != "top down delete" {
+		t.Errorf("Expected top, down and delete to run, got %q", got)
+	}
+	ran = nil
+	if used := press(false, "j", "Ctrl+X", "s"); used[0] || !used[1] || !used[2] {
+		t.Errorf("Expected only the global sequence outside the list, got %v", used)
+	}
+	if got := strings.Join(ran, " "); got != "save" {
+		t.Errorf("Expected save to run, got %q", got)
+	}
+}
@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// paletteWidth and paletteHeight size the command palette.
+const (
+	paletteWidth  = 64
+	paletteHeight = 20
+)
+
+// showPalette opens the command palette: a search field above the actions
+// and custom commands, narrowed down as the user types. Enter runs the
+// highlighted one on the selected task; Esc closes the palette.
+func (ui *UI) showPalette() {
+	search := tview.NewInputField().SetLabel("> ").SetFieldWidth(0)
+	results := tview.NewList().ShowSecondaryText(false)
+
+	all := append(slices.Clone(ui.actions), commandActions(ui.controller.CommandNames())...)
+	var shown []Action
+	fill := func(query string) {
+		shown = matchActions(all, query)
+		results.Clear()
+		for _, action := range shown {
+			results.AddItem(paletteItem(action), "", 0, nil)
+		}
+	}
+	fill("")
+	search.SetChangedFunc(fill)
+
+	closePalette := func() {
+		ui.pages.RemovePage("palette")
+		ui.FocusList()
+	}
+	search.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp:
+			results.SetCurrentItem(max(results.GetCurrentItem()-1, 0))
+			return nil
+		case tcell.KeyDown:
+			results.SetCurrentItem(min(results.GetCurrentItem()+1, len(shown)-1))
+			return nil
+		case tcell.KeyEnter:
+			if len(shown) == 0 {
+				return nil
+			}
+			action := shown[results.GetCurrentItem()]
+			closePalette()
+			action.Run(ui)
+			return nil
+		case tcell.KeyEscape:
+			closePalette()
+			return nil
+		}
+		return event
+	})
+
+	frame := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(search, 1, 0, true).
+		AddItem(results, 0, 1, false)
+	frame.SetBorder(true).SetTitle("Commands - type to search, Esc to close")
+	ui.pages.AddPage("palette", centered(frame, paletteWidth, paletteHeight), true, true)
+	ui.app.SetFocus(search)
+}
+
+// commandActions returns a palette entry for each custom command in names.
+// They have no keys: the run-command action picks from them all.
+func commandActions(names []string) []Action {
+	actions := make([]Action, len(names))
+	for i, name := range names {
+		actions[i] = Action{
+			Name:  "command:" + name,
+			Label: "Run: " + name,
+			Run:   func(ui *UI) { ui.controller.HandleRunNamedCommand(name) },
+		}
+	}
+	return actions
+}
+
+// paletteItem is the row for action in the palette: its label with its
+// keys on the right.
+func paletteItem(action Action) string {
+	keys := strings.Join(action.Keys, ", ")
+	padding := max(paletteWidth-4-len(action.Label)-len(keys), 1)
+	return fmt.Sprintf("%s%s[gray]%s[-]", tview.Escape(action.Label), strings.Repeat(" ", padding), tview.Escape(keys))
+}
+
+// matchActions returns the actions whose labels fuzzily match query, best
+// match first. An empty query matches every action, in registry order.
+func matchActions(all []Action, query string) []Action {
+	type match struct {
+		action Action
+		score  int
+	}
+	var matches []match
+	for _, action := range all {
+		if score, ok := fuzzyScore(query, action.Label); ok {
+			matches = append(matches, match{action, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	result := make([]Action, len(matches))
+	for i, m := range matches {
+		result[i] = m.action
+	}
+	return result
+}
+
+// fuzzyScore reports whether the characters of query appear in text in
+// order, ignoring case and spaces in query, and scores the match: runs of
+// consecutive characters and characters starting a word score higher, so
+// "due" ranks "Set due date" above labels that merely contain a d, u and e.
+func fuzzyScore(query, text string) (int, bool) {
+	target := []rune(strings.ToLower(text))
+	score, pos, prev := 0, 0, -2
+	for _, r := range strings.ToLower(query) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		for pos < len(target) && target[pos] != r {
+			pos++
+		}
+		if pos == len(target) {
+			return 0, false
+		}
+		score++
+		if pos == prev+1 {
+			score += 3
+		}
+		if pos == 0 || !unicode.IsLetter(target[pos-1]) {
+			score += 2
+		}
+		prev = pos
+		pos++
+	}
+	return score, true
+}
@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ErrCancelled is returned by PromptPassphrase when the user quits instead
+// of unlocking.
+var ErrCancelled = errors.New("cancelled")
+
+// PromptPassphrase shows a passphrase page for the encrypted database name
+// before the main UI starts. Each passphrase entered is passed to unlock
+// until one works; Esc or Ctrl+C gives up with ErrCancelled.
+func PromptPassphrase(name string, unlock func(passphrase string) error) error {
+	app := tview.NewApplication()
+	message := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter).
+		SetText("Enter to unlock, Esc to quit")
+	field := tview.NewInputField().
+		SetLabel("Passphrase: ").
+		SetMaskCharacter('*').
+		SetFieldWidth(0)
+
+	result := ErrCancelled
+	field.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			err := unlock(field.GetText())
+			if err == nil {
+				result = nil
+				app.Stop()
+				return
+			}
+			field.SetText("")
+			message.SetText(fmt.Sprintf("[red]%s[-], try again", tview.Escape(err.Error())))
+		case tcell.KeyEscape:
+			app.Stop()
+		}
+	})
+
+	page := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(field, 1, 0, true).
+		AddItem(message, 1, 0, false)
+	page.SetBorder(true).SetTitle(fmt.Sprintf(" %s is encrypted ", name))
+
+	if err := app.SetRoot(centered(page, max(len(name)+20, 50), 4), true).Run(); err != nil {
+		return err
+	}
+	return result
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"go-todo/internal/models"
 
@@ -16,9 +17,43 @@ type UI struct {
 	list    *tview.List
 	input   *tview.InputField
 	details *tview.TextView
+	status  *tview.TextView
 	pages   *tview.Pages
 	flex    *tview.Flex
 
+	// stopped is closed once the application has stopped, after which
+	// queued updates are dropped.
+	stopped chan struct{}
+
+	// busy counts ShowBusy calls not yet matched by HideBusy. Only touched on
+	// the UI goroutine.
+	busy int
+
+	// tasks is the list as last displayed, in display order.
+	tasks []models.Task
+	// rows maps each list row to its index in tasks, or -1 for a section
+	// header.
+	rows []int
+	// view is the current sort and grouping, used for section headers.
+	view models.TaskQuery
+	// marked holds the IDs of tasks selected for a bulk operation.
+	marked map[int]bool
+	// markAnchor is the list index where the last range selection started.
+	markAnchor int
+	// dragFrom is the ID of the task under the mouse when the left button
+	// was pressed, or 0 if no drag is in progress.
+	dragFrom int
+	// selectedID is the task last reported to the controller as selected.
+	selectedID int
+	// refreshing is set while RefreshList rebuilds the list, so the
+	// intermediate selections it passes through are not reported.
+	refreshing bool
+
+	// actions are everything the user can do, with the keys bound to them,
+	// and keys runs them as those keys are pressed.
+	actions []Action
+	keys    *keymap
+
 	controller AppController
 }
 
@@ -28,21 +63,47 @@ type AppController interface {
 	HandleDeleteTask()
 	HandleQuit()
 	HandleCopyText()
+	HandleCancel()
+	HandleMoveUp()
+	HandleMoveDown()
+	HandleMoveTaskTo(taskID, targetID int)
+	HandleChooseSort()
+	HandleChooseGroup()
+	HandleSetDue()
+	HandleToggleHideDone()
+	HandleArchiveCompleted()
+	HandleShowArchive()
+	HandleReopenArchived(taskID int)
+	HandleSelectTask(taskID int)
+	HandleRenameTask()
+	HandleRunCommand()
+	HandleRunNamedCommand(name string)
+	CommandNames() []string
 }
 
-const helpText = `[yellow]Controls:
-[green]Tab:[white] Cycle Focus | [green]Enter (in list):[white] Toggle Done | [green]d (in list):[white] Delete | [green]c (in list):[white] Copy
-[green]Enter (in input):[white] Add Task | [green]Esc (in input):[white] Focus List | [green]q:[white] Quit`
+// busyDelay is how long an operation must run before the busy indicator is
+// shown, so that quick store calls don't make the status line flicker.
+const busyDelay = 150 * time.Millisecond
 
 func NewUI(controller AppController) *UI {
 	ui := &UI{
 		app:        tview.NewApplication(),
 		controller: controller,
+		marked:     make(map[int]bool),
+		stopped:    make(chan struct{}),
 	}
+	// The defaults are known to be valid.
+	ui.actions, _ = bindActions(defaultActions(), nil)
+	ui.keys = newKeymap(ui.actions)
 
 	ui.list = tview.NewList().ShowSecondaryText(false)
 	ui.list.SetBorder(true).SetTitle("To-Do List")
 	ui.list.SetSelectedFocusOnly(true)
+	ui.list.SetChangedFunc(func(int, string, string, rune) {
+		if !ui.refreshing {
+			ui.notifySelection()
+		}
+	})
 
 	ui.input = tview.NewInputField().SetLabel("New Task: ").SetFieldWidth(0)
 	ui.input.SetBorder(true)
@@ -51,11 +112,14 @@ func NewUI(controller AppController) *UI {
 		ui.app.Draw()
 	})
 	ui.details.SetBorder(true).SetTitle("Help / Info")
-	fmt.Fprint(ui.details, helpText)
+	fmt.Fprint(ui.details, ui.helpText())
+
+	ui.status = tview.NewTextView().SetDynamicColors(true)
 
 	leftPanel := tview.NewFlex().SetDirection(tview.FlexRow).AddItem(ui.list, 0, 1, true).AddItem(ui.input, 3, 0, false)
 
-	ui.flex = tview.NewFlex().AddItem(leftPanel, 0, 2, true).AddItem(ui.details, 0, 1, false)
+	panels := tview.NewFlex().AddItem(leftPanel, 0, 2, true).AddItem(ui.details, 0, 1, false)
+	ui.flex = tview.NewFlex().SetDirection(tview.FlexRow).AddItem(panels, 0, 1, true).AddItem(ui.status, 1, 0, false)
 
 	ui.pages = tview.NewPages().AddPage("main", ui.flex, true, true)
 
@@ -65,6 +129,7 @@ func NewUI(controller AppController) *UI {
 }
 
 func (ui *UI) Run() error {
+	defer close(ui.stopped)
 	ui.app.SetRoot(ui.pages, true).EnableMouse(true)
 	return ui.app.Run()
 }
@@ -73,32 +138,183 @@ func (ui *UI) Stop() {
 	ui.app.Stop()
 }
 
+// QueueUpdate runs f on the UI goroutine and redraws afterwards. It is safe
+// to call from any goroutine. Once the UI has stopped, f is dropped: tview
+// waits for its event loop to run queued updates, which it never will, so
+// the wait happens on a helper goroutine the caller doesn't block on.
+func (ui *UI) QueueUpdate(f func()) {
+	select {
+	case <-ui.stopped:
+		return
+	default:
+	}
+	ran := make(chan struct{})
+	go func() {
+		ui.app.QueueUpdateDraw(f)
+		close(ran)
+	}()
+	select {
+	case <-ran:
+	case <-ui.stopped:
+	}
+}
+
+// ShowBusy shows a "working" indicator in the status line. The indicator
+// only appears if the operation is still running after busyDelay. Must be
+// called on the UI goroutine.
+func (ui *UI) ShowBusy(message string) {
+	ui.busy++
+	time.AfterFunc(busyDelay, func() {
+		ui.QueueUpdate(func() {
+			if ui.busy > 0 {
+				ui.status.SetText(fmt.Sprintf("[yellow]%s…[white] (Esc to cancel)", message))
+			}
+		})
+	})
+}
+
+// HideBusy clears the status line once every ShowBusy has been matched.
+// Must be called on the UI goroutine.
+func (ui *UI) HideBusy() {
+	if ui.busy > 0 {
+		ui.busy--
+	}
+	if ui.busy == 0 {
+		ui.status.Clear()
+	}
+}
+
+// SetView sets the sort and grouping the list is displayed with. It takes
+// effect on the next RefreshList.
+func (ui *UI) SetView(query models.TaskQuery) {
+	ui.view = query.WithDefaults()
+	ui.redrawMarks()
+}
+
 func (ui *UI) RefreshList(tasks []models.Task) {
 	currentSelection := ui.list.GetCurrentItem()
+	selectedID, hadSelection := ui.GetSelectedTaskID()
+	ui.refreshing = true
+	defer func() {
+		ui.refreshing = false
+		ui.notifySelection()
+	}()
 	ui.list.Clear()
+	ui.tasks = tasks
+	ui.rows = nil
+	ui.pruneMarks()
 
+	if len(tasks) == 0 && ui.view.HideDone {
+		ui.list.AddItem("No open tasks.", "", 0, nil)
+		return
+	}
 	if len(tasks) == 0 {
 		ui.list.AddItem(
 			"No tasks yet!", "Press Tab then Enter in input field to add one.", 0, nil)
 		return
 	}
 
-	for _, task := range tasks {
-		prefix := "[ ] "
-		if task.Done {
-			prefix = "[lime][✔][white] "
+	section := ""
+	for index, task := range tasks {
+		// Start a new section whenever the group key changes; tasks arrive
+		// already grouped.
+		if ui.view.Group != models.GroupNone {
+			if key := ui.view.Section(task); index == 0 || key != section {
+				section = key
+				ui.list.AddItem(fmt.Sprintf("[yellow::b]%s[-::-]", key), "", 0, nil)
+				ui.rows = append(ui.rows, -1)
+			}
 		}
-		mainText := fmt.Sprintf("%s%s", prefix, task.Description)
-		ui.list.AddItem(mainText, strconv.Itoa(task.ID), 0, func() {
+		ui.list.AddItem(ui.itemText(task), strconv.Itoa(task.ID), 0, func() {
 			ui.controller.HandleToggleTask()
 		})
+		ui.rows = append(ui.rows, index)
+	}
+
+	// Keep the cursor on the same task if it still exists, so a reload that
+	// reorders the list does not move the selection to a different task.
+	if hadSelection {
+		for index := 0; index < ui.list.GetItemCount(); index++ {
+			if _, idStr := ui.list.GetItemText(index); idStr == strconv.Itoa(selectedID) {
+				ui.list.SetCurrentItem(index)
+				return
+			}
+		}
 	}
 
-	if currentSelection >= 0 && currentSelection < ui.list.GetItemCount() {
-		ui.list.SetCurrentItem(currentSelection)
-	} else if ui.list.GetItemCount() > 0 {
-		ui.list.SetCurrentItem(0)
+	if currentSelection < 0 || currentSelection >= ui.list.GetItemCount() {
+		currentSelection = 0
+	}
+	if row, ok := ui.nearestTaskRow(currentSelection, 1); ok {
+		ui.list.SetCurrentItem(row)
+	} else if row, ok := ui.nearestTaskRow(currentSelection, -1); ok {
+		ui.list.SetCurrentItem(row)
+	}
+}
+
+// notifySelection tells the controller when the cursor has moved to a
+// different task.
+func (ui *UI) notifySelection() {
+	id, _ := ui.GetSelectedTaskID()
+	if id != ui.selectedID {
+		ui.selectedID = id
+		ui.controller.HandleSelectTask(id)
+	}
+}
+
+// ShowTaskHistory lists a task's history under the help text in the details
+// pane, or shows just the help text if events is empty.
+func (ui *UI) ShowTaskHistory(task models.Task, events []models.TaskEvent) {
+	var b strings.Builder
+	b.WriteString(ui.helpText())
+	if len(events) > 0 {
+		name := fmt.Sprintf("task %d", events[0].TaskID)
+		if task.Description != "" {
+			name = strconv.Quote(task.Description)
+		}
+		fmt.Fprintf(&b, "\n\n[yellow]History of %s:[white]", tview.Escape(name))
+		for _, e := range events {
+			fmt.Fprintf(&b, "\n[gray]%s[white] %s", e.At, tview.Escape(e.Summary()))
+		}
 	}
+	ui.details.SetText(b.String())
+}
+
+// taskAt returns the task shown in list row index, if the row is a task
+// rather than a section header.
+func (ui *UI) taskAt(index int) (models.Task, bool) {
+	if index < 0 || index >= len(ui.rows) || ui.rows[index] < 0 {
+		return models.Task{}, false
+	}
+	return ui.tasks[ui.rows[index]], true
+}
+
+// nearestTaskRow returns the first row from index onwards in direction step
+// (1 or -1) that shows a task rather than a section header.
+func (ui *UI) nearestTaskRow(index, step int) (int, bool) {
+	for i := index; i >= 0 && i < len(ui.rows); i += step {
+		if ui.rows[i] >= 0 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// itemText renders a task as a list row, with a marker if it is marked for
+// a bulk operation.
+func (ui *UI) itemText(task models.Task) string {
+	prefix := "[ ] "
+	if task.Done {
+		prefix = "[lime][✔][white] "
+	}
+	if ui.marked[task.ID] {
+		prefix = "[yellow]●[white] " + prefix
+	}
+	text := fmt.Sprintf("%s%s", prefix, tview.Escape(task.Description))
+	if task.Due != "" {
+		text += fmt.Sprintf(" [gray](due %s)[white]", task.Due)
+	}
+	return text
 }
 
 func (ui *UI) GetSelectedTaskID() (int, bool) {
@@ -117,16 +333,112 @@ func (ui *UI) GetSelectedTaskID() (int, bool) {
 	return taskID, true
 }
 
-func (ui *UI) GetSelectedTaskText() (string, bool) {
-	if ui.list.GetItemCount() == 0 {
-		return "", false
+// taskIDAt returns the ID of the task shown at screen row y, or 0 if there
+// is none.
+func (ui *UI) taskIDAt(y int) int {
+	_, rectY, _, height := ui.list.GetInnerRect()
+	if y < rectY || y >= rectY+height {
+		return 0
 	}
-	index := ui.list.GetCurrentItem()
-	if index < 0 {
-		return "", false
+	offset, _ := ui.list.GetOffset()
+	task, ok := ui.taskAt(y - rectY + offset)
+	if !ok {
+		return 0
+	}
+	return task.ID
+}
+
+// GetMarkedTaskIDs returns the IDs of the marked tasks in display order.
+func (ui *UI) GetMarkedTaskIDs() []int {
+	var ids []int
+	for _, task := range ui.tasks {
+		if ui.marked[task.ID] {
+			ids = append(ids, task.ID)
+		}
+	}
+	return ids
+}
+
+func (ui *UI) ClearMarks() {
+	ui.marked = make(map[int]bool)
+	ui.redrawMarks()
+}
+
+// toggleMark marks or unmarks the task in row index.
+func (ui *UI) toggleMark(index int) {
+	task, ok := ui.taskAt(index)
+	if !ok {
+		return
+	}
+	id := task.ID
+	if ui.marked[id] {
+		delete(ui.marked, id)
+	} else {
+		ui.marked[id] = true
+	}
+	ui.markAnchor = index
+	ui.redrawMarks()
+}
+
+// markRange marks every task between the last marked row and index.
+func (ui *UI) markRange(index int) {
+	if _, ok := ui.taskAt(index); !ok {
+		return
+	}
+	from, to := min(ui.markAnchor, index), max(ui.markAnchor, index)
+	for i := from; i <= to; i++ {
+		if task, ok := ui.taskAt(i); ok {
+			ui.marked[task.ID] = true
+		}
+	}
+	ui.redrawMarks()
+}
+
+// markAll marks every visible task, or clears the marks if all are already
+// marked.
+func (ui *UI) markAll() {
+	if len(ui.marked) == len(ui.tasks) {
+		ui.ClearMarks()
+		return
+	}
+	for _, task := range ui.tasks {
+		ui.marked[task.ID] = true
+	}
+	ui.redrawMarks()
+}
+
+// pruneMarks drops marks on tasks that are no longer displayed.
+func (ui *UI) pruneMarks() {
+	visible := make(map[int]bool, len(ui.tasks))
+	for _, task := range ui.tasks {
+		visible[task.ID] = true
+	}
+	for id := range ui.marked {
+		if !visible[id] {
+			delete(ui.marked, id)
+		}
 	}
-	mainText, _ := ui.list.GetItemText(index)
-	return mainText, true
+}
+
+// redrawMarks re-renders the rows in place after marks change, and the
+// title, which shows the mark count and any non-default sort.
+func (ui *UI) redrawMarks() {
+	for index := range ui.rows {
+		if task, ok := ui.taskAt(index); ok && index < ui.list.GetItemCount() {
+			ui.list.SetItemText(index, ui.itemText(task), strconv.Itoa(task.ID))
+		}
+	}
+	title := "To-Do List"
+	if ui.view.Sort != "" && ui.view.Sort != models.SortManual {
+		title = fmt.Sprintf("%s (by %s)", title, ui.view.Sort)
+	}
+	if ui.view.HideDone {
+		title += " (done hidden)"
+	}
+	if len(ui.marked) > 0 {
+		title = fmt.Sprintf("%s (%d marked)", title, len(ui.marked))
+	}
+	ui.list.SetTitle(title)
 }
 
 func (ui *UI) GetInputText() string {
@@ -147,7 +459,7 @@ func (ui *UI) FocusInput() {
 
 func (ui *UI) ShowConfirmation(message string, onConfirm func()) {
 	modal := tview.NewModal().
-		SetText(message).
+		SetText(tview.Escape(message)).
 		AddButtons([]string{"Confirm", "Cancel"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			ui.pages.RemovePage("confirmModal")
@@ -159,13 +471,116 @@ func (ui *UI) ShowConfirmation(message string, onConfirm func()) {
 	ui.pages.AddPage("confirmModal", modal, true, true)
 }
 
+// ShowInfo tells the user something that needs no decision.
+func (ui *UI) ShowInfo(message string) {
+	modal := tview.NewModal().
+		SetText(tview.Escape(message)).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			ui.pages.RemovePage("infoModal")
+			ui.FocusList()
+		})
+	ui.pages.AddPage("infoModal", modal, false, true)
+}
+
+// ShowArchive opens a page listing archived tasks under their completion
+// dates, most recent first. Enter reopens the highlighted task; Esc goes
+// back to the task list.
+func (ui *UI) ShowArchive(tasks []models.Task) {
+	archive := tview.NewList().ShowSecondaryText(false)
+	archive.SetBorder(true).SetTitle(fmt.Sprintf("Archive (%s) - Enter to reopen, Esc to close", pluralTasks(len(tasks))))
+	if len(tasks) == 0 {
+		archive.AddItem("Nothing archived yet.", "", 0, nil)
+	}
+	day := ""
+	for _, task := range tasks {
+		if completed := dayOf(task.CompletedAt); completed != day {
+			day = completed
+			archive.AddItem(fmt.Sprintf("[yellow::b]Completed %s[-::-]", day), "", 0, nil)
+		}
+		id := task.ID
+		archive.AddItem("  "+tview.Escape(task.Description), "", 0, func() {
+			ui.controller.HandleReopenArchived(id)
+		})
+	}
+	archive.SetDoneFunc(func() {
+		ui.pages.RemovePage("archive")
+		ui.FocusList()
+	})
+	ui.pages.AddPage("archive", archive, true, true)
+}
+
+// dayOf returns the date part of a timestamp.
+func dayOf(timestamp string) string {
+	if len(timestamp) < len("2006-01-02") {
+		return "unknown date"
+	}
+	return timestamp[:len("2006-01-02")]
+}
+
+func pluralTasks(n int) string {
+	if n == 1 {
+		return "1 task"
+	}
+	return fmt.Sprintf("%d tasks", n)
+}
+
+// ShowMenu shows a list of options with current preselected and calls
+// onSelect with the index of the one chosen. Esc closes the menu without
+// choosing.
+func (ui *UI) ShowMenu(title string, options []string, current int, onSelect func(index int)) {
+	menu := tview.NewList().ShowSecondaryText(false)
+	menu.SetBorder(true).SetTitle(title)
+	width := len(title) + 4
+	for i, option := range options {
+		menu.AddItem(tview.Escape(option), "", 0, func() {
+			ui.pages.RemovePage("menu")
+			ui.FocusList()
+			onSelect(i)
+		})
+		width = max(width, len(option)+4)
+	}
+	menu.SetCurrentItem(current)
+	menu.SetDoneFunc(func() {
+		ui.pages.RemovePage("menu")
+		ui.FocusList()
+	})
+	ui.pages.AddPage("menu", centered(menu, width, len(options)+2), true, true)
+}
+
+// PromptInput asks for a line of text, prefilled with initial, and calls
+// onSubmit with it on Enter. Esc closes the prompt without submitting.
+func (ui *UI) PromptInput(title, initial string, onSubmit func(text string)) {
+	field := tview.NewInputField().SetText(initial).SetFieldWidth(0)
+	field.SetBorder(true).SetTitle(title)
+	field.SetDoneFunc(func(key tcell.Key) {
+		ui.pages.RemovePage("prompt")
+		ui.FocusList()
+		if key == tcell.KeyEnter {
+			onSubmit(strings.TrimSpace(field.GetText()))
+		}
+	})
+	ui.pages.AddPage("prompt", centered(field, max(len(title)+4, 40), 3), true, true)
+}
+
+// centered places p in the middle of the screen at the given size.
+func centered(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+}
+
 func (ui *UI) GetItemCount() int {
 	return ui.list.GetItemCount()
 }
 
 func (ui *UI) ShowError(message string) {
 	modal := tview.NewModal().
-		SetText(fmt.Sprintf("[red]Error:\n%s", message)).
+		SetText(fmt.Sprintf("[red]Error:\n%s", tview.Escape(message))).
 		AddButtons([]string{"OK"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			ui.pages.RemovePage("errorModal")
@@ -179,40 +594,61 @@ func (ui *UI) ShowError(message string) {
 	ui.pages.AddPage("errorModal", modal, false, true)
 }
 
+// BindKeys replaces the default keys of the actions named in bindings with
+// the given key sequences, and updates the help panel. If any binding is
+// invalid or conflicts with another, the keys are left as they were.
+func (ui *UI) BindKeys(bindings map[string][]string) error {
+	actions, err := bindActions(defaultActions(), bindings)
+	if err != nil {
+		return err
+	}
+	ui.actions = actions
+	ui.keys = newKeymap(actions)
+	ui.details.SetText(ui.helpText())
+	return nil
+}
+
+// helpText lists the keys of every bound action, and those of the input
+// field.
+func (ui *UI) helpText() string {
+	var b strings.Builder
+	b.WriteString("[yellow]Controls:")
+	n := 0
+	for _, action := range ui.actions {
+		if len(action.Keys) == 0 {
+			continue
+		}
+		keys := strings.Join(action.Keys, ", ")
+		if !action.Global {
+			keys += " (in list)"
+		}
+		sep := " | "
+		if n%3 == 0 {
+			sep = "\n"
+		}
+		fmt.Fprintf(&b, "%s[green]%s:[white] %s", sep, tview.Escape(keys), tview.Escape(action.Label))
+		n++
+	}
+	b.WriteString("\n[green]Drag (mouse):[white] Move | [green]Enter (in input):[white] Add task | [green]Esc (in input):[white] Focus list")
+	return b.String()
+}
+
 func (ui *UI) setupKeybindings() {
-	// List-specific keybindings
-	ui.list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyEnter: // Already handled by list.SetSelectedFunc
-			ui.controller.HandleToggleTask()
-			return nil
-		case tcell.KeyRune:
-			switch event.Rune() {
-			case 'd':
-				index := ui.list.GetCurrentItem()
-				ui.controller.HandleDeleteTask()
-				if index > 0 {
-					ui.list.SetCurrentItem(index - 1)
-				}
-				return nil
-			case 'j':
-				index := ui.list.GetCurrentItem()
-				if index < ui.list.GetItemCount()-1 {
-					ui.list.SetCurrentItem(index + 1)
+	// Dragging a task with the mouse moves it to where it is dropped.
+	ui.list.SetMouseCapture(func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+		_, y := event.Position()
+		switch action {
+		case tview.MouseLeftDown:
+			ui.dragFrom = ui.taskIDAt(y)
+		case tview.MouseLeftUp:
+			if ui.dragFrom != 0 {
+				if target := ui.taskIDAt(y); target != 0 && target != ui.dragFrom {
+					ui.controller.HandleMoveTaskTo(ui.dragFrom, target)
 				}
-				return nil
-			case 'k':
-				index := ui.list.GetCurrentItem()
-				if index > 0 {
-					ui.list.SetCurrentItem(index - 1)
-				}
-				return nil
-			case 'c':
-				ui.controller.HandleCopyText()
-				return nil
 			}
+			ui.dragFrom = 0
 		}
-		return event
+		return action, event
 	})
 
 	// Input field keybindings
@@ -225,34 +661,14 @@ func (ui *UI) setupKeybindings() {
 		}
 	})
 
-	// Global application keybindings
+	// Keys bound to actions
 	ui.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		// Check if a modal is active. If so, let the modal handle input.
 		if name, _ := ui.pages.GetFrontPage(); name != "main" {
 			return event // Pass event to modal
 		}
-
-		switch event.Key() {
-		case tcell.KeyTab:
-			if ui.input.HasFocus() {
-				ui.FocusList()
-			} else {
-				ui.FocusInput()
-			}
+		if ui.keys.press(ui, keyName(event), ui.list.HasFocus()) {
 			return nil
-		case tcell.KeyBacktab: // Shift+Tab
-			if ui.input.HasFocus() {
-				ui.FocusList()
-			} else {
-				ui.FocusInput()
-			}
-			return nil
-		case tcell.KeyRune:
-			switch event.Rune() {
-			case 'q':
-				ui.controller.HandleQuit()
-				return nil
-			}
 		}
 		return event
 	})
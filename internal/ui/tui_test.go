@@ -0,0 +1,47 @@
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestQueueUpdate_DropsUpdatesAfterStop(t *testing.T) {
+	ui := NewUI(nil)
+	screen := tcell.NewSimulationScreen("")
+	ui.app.SetScreen(screen)
+	running := make(chan error)
+	go func() { running <- ui.Run() }()
+
+	ran := false
+	ui.QueueUpdate(func() { ran = true })
+	if !ran {
+		t.Fatal("Expected the update to run while the UI runs")
+	}
+	ui.QueueUpdate(ui.Stop)
+	<-running
+
+	returned := make(chan struct{})
+	go func() {
+		ui.QueueUpdate(func() { t.Error("Expected no update to run after stop") })
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Expected QueueUpdate to return after stop")
+	}
+}
+
+func TestItemText_EscapesDescription(t *testing.T) {
+	ui := NewUI(nil)
+
+	text := ui.itemText(models.Task{ID: 1, Description: "Buy [red] paint"})
+
+	if want := "[ ] Buy [red[] paint"; text != want {
+		t.Errorf("Expected %q, got %q", want, text)
+	}
+}
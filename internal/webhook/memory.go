@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// timestampLayout is the layout of outbox timestamps, which are in UTC.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// memoryLogSize is how many delivery attempts a MemoryOutbox keeps.
+const memoryLogSize = 1000
+
+// MemoryOutbox is an Outbox for stores that cannot keep one. Messages still
+// waiting are lost when the application exits.
+type MemoryOutbox struct {
+	mu         sync.Mutex
+	messages   map[int64]models.WebhookMessage
+	deliveries []models.WebhookDelivery
+	nextID     int64
+	logged     int64
+	// now tells the time. Tests replace it.
+	now func() time.Time
+}
+
+// NewMemoryOutbox returns an empty outbox.
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{messages: make(map[int64]models.WebhookMessage), now: time.Now}
+}
+
+func (o *MemoryOutbox) EnqueueWebhook(ctx context.Context, msg models.WebhookMessage) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nextID++
+	msg.ID = o.nextID
+	msg.Attempts = 0
+	msg.CreatedAt = o.now().UTC().Format(timestampLayout)
+	msg.NextAttemptAt = msg.CreatedAt
+	o.messages[msg.ID] = msg
+	return msg.ID, nil
+}
+
+func (o *MemoryOutbox) DueWebhooks(ctx context.Context, now time.Time, limit int) ([]models.WebhookMessage, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	cutoff := now.UTC().Format(timestampLayout)
+	var due []models.WebhookMessage
+	for _, msg := range o.messages {
+		if msg.NextAttemptAt <= cutoff {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].NextAttemptAt != due[j].NextAttemptAt {
+			return due[i].NextAttemptAt < due[j].NextAttemptAt
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (o *MemoryOutbox) RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery, retryAt time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.logged++
+	delivery.ID = o.logged
+	delivery.At = o.now().UTC().Format(timestampLayout)
+	o.deliveries = append(o.deliveries, delivery)
+	if len(o.deliveries) > memoryLogSize {
+		o.deliveries = o.deliveries[len(o.deliveries)-memoryLogSize:]
+	}
+	if retryAt.IsZero() {
+		delete(o.messages, delivery.MessageID)
+		return nil
+	}
+	if msg, ok := o.messages[delivery.MessageID]; ok {
+		msg.Attempts = delivery.Attempt
+		msg.NextAttemptAt = retryAt.UTC().Format(timestampLayout)
+		o.messages[msg.ID] = msg
+	}
+	return nil
+}
+
+func (o *MemoryOutbox) WebhookDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var latest []models.WebhookDelivery
+	for i := len(o.deliveries) - 1; i >= 0 && len(latest) < limit; i-- {
+		latest = append(latest, o.deliveries[i])
+	}
+	return latest, nil
+}
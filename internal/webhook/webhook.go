@@ -0,0 +1,339 @@
+// Package webhook sends task changes to outgoing webhooks, such as a team
+// chat bot. Each change is written to an outbox first and delivered from
+// there, so calls survive a receiver that is down, and one that keeps
+// failing is retried with exponential backoff. Every attempt is kept in a
+// delivery log.
+//
+// A change is queued once it is saved, not in the same transaction, so one
+// saved just before the application is killed may never be sent: changes
+// are sent at most once. A queued call is retried until the receiver
+// accepts it, so it may arrive more than once; receivers tell repeats
+// apart by the delivery ID.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+// Headers sent with every call. The timestamp is when the call was made,
+// in Unix seconds. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the hook's
+// secret, so a receiver that checks the timestamp is recent cannot be
+// replayed an old call.
+const (
+	EventHeader     = "X-Go-Todo-Event"
+	DeliveryHeader  = "X-Go-Todo-Delivery"
+	TimestampHeader = "X-Go-Todo-Timestamp"
+	SignatureHeader = "X-Go-Todo-Signature"
+)
+
+// MaxSkew is how far the timestamp of a call may be from the receiver's
+// clock for Verify to accept it.
+const MaxSkew = 5 * time.Minute
+
+// ErrInvalidSignature is returned by Verify for a call that was not signed
+// with the secret, or not recently.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Events are the event names hooks can subscribe to.
+var Events = []string{"task.created", "task.completed", "task.reopened", "task.deleted"}
+
+const (
+	// PollInterval is how often the outbox is checked for messages due
+	// for a retry.
+	PollInterval = 5 * time.Second
+	// BaseDelay is the wait before the first retry; each further retry
+	// waits twice as long, up to MaxDelay.
+	BaseDelay = 10 * time.Second
+	MaxDelay  = time.Hour
+	// MaxAttempts is how often a message is tried before it is given up.
+	MaxAttempts = 10
+	// timeout bounds a single call.
+	timeout = 10 * time.Second
+	// batchSize is how many due messages are read at a time.
+	batchSize = 50
+)
+
+// Hook is an outgoing webhook, as set in the config.
+type Hook struct {
+	URL string `json:"url"`
+	// Secret signs the payloads. Without one, calls are not signed.
+	Secret string `json:"secret,omitempty"`
+	// Events limits the hook to these events; all are sent if empty.
+	Events []string `json:"events,omitempty"`
+}
+
+// wants reports whether the hook subscribes to event.
+func (h Hook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body of a call.
+type Payload struct {
+	// ID identifies the change, and stays the same across retries, so
+	// receivers can ignore a call they already handled.
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	OccurredAt string      `json:"occurred_at"`
+	Task       models.Task `json:"task"`
+}
+
+// Outbox keeps messages until they are delivered, and the log of delivery
+// attempts. *storage.Store keeps them in the database; MemoryOutbox only
+// while the application runs.
+type Outbox interface {
+	EnqueueWebhook(ctx context.Context, msg models.WebhookMessage) (int64, error)
+	DueWebhooks(ctx context.Context, now time.Time, limit int) ([]models.WebhookMessage, error)
+	RecordWebhookDelivery(ctx context.Context, delivery models.WebhookDelivery, retryAt time.Time) error
+	WebhookDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error)
+}
+
+// Sign returns the signature of a call made at timestamp with body for the
+// given secret, as sent in SignatureHeader.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a call received at
+// now, for receivers written in Go.
+func Verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: no timestamp", ErrInvalidSignature)
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)).Abs(); skew > MaxSkew {
+		return fmt.Errorf("%w: timestamp is %s off", ErrInvalidSignature, skew.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Backoff returns how long to wait before retrying a message that failed
+// for the given number of attempts.
+func Backoff(attempts int) time.Duration {
+	delay := BaseDelay
+	for i := 1; i < attempts && delay < MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxDelay)
+}
+
+// Dispatcher queues the changes it is told about for the hooks that want
+// them, and delivers them. It is a controller.Listener.
+type Dispatcher struct {
+	Hooks  []Hook
+	Outbox Outbox
+	HTTP   *http.Client
+	// wake tells Run that a message was queued.
+	wake chan struct{}
+	// now tells the time. Tests replace it.
+	now func() time.Time
+}
+
+// New returns a dispatcher for hooks that keeps its messages in outbox.
+func New(hooks []Hook, outbox Outbox) (*Dispatcher, error) {
+	for _, hook := range hooks {
+		u, err := url.Parse(hook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q", hook.URL)
+		}
+		for _, event := range hook.Events {
+			if !known(event) {
+				return nil, fmt.Errorf("webhook %s: unknown event %q", hook.URL, event)
+			}
+		}
+	}
+	return &Dispatcher{
+		Hooks:  hooks,
+		Outbox: outbox,
+		HTTP:   &http.Client{Timeout: timeout},
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+	}, nil
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskChanged queues a message about the change for every hook that wants
+// it. Failing to queue is only logged, as the change itself was saved, and
+// the change is not sent.
+func (d *Dispatcher) TaskChanged(ctx context.Context, kind models.EventKind, task models.Task) {
+	event := "task." + string(kind)
+	if !known(event) {
+		return
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Webhooks: %v", err)
+		return
+	}
+	deliveryID := hex.EncodeToString(id)
+	body, err := json.Marshal(Payload{
+		ID:         deliveryID,
+		Event:      event,
+		OccurredAt: d.now().UTC().Format(time.RFC3339),
+		Task:       task,
+	})
+	if err != nil {
+		log.Printf("Webhooks: encoding %s: %v", event, err)
+		return
+	}
+	queued := false
+	for _, hook := range d.Hooks {
+		if !hook.wants(event) {
+			continue
+		}
+		msg := models.WebhookMessage{URL: hook.URL, Event: event, DeliveryID: deliveryID, Payload: string(body)}
+		if _, err := d.Outbox.EnqueueWebhook(ctx, msg); err != nil {
+			log.Printf("Webhooks: queueing %s for %s: %v", event, hook.URL, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// hook returns the configured hook for url.
+func (d *Dispatcher) hook(url string) (Hook, bool) {
+	for _, hook := range d.Hooks {
+		if hook.URL == url {
+			return hook, true
+		}
+	}
+	return Hook{}, false
+}
+
+// Deliver tries every message that is due, and returns once none is left.
+func (d *Dispatcher) Deliver(ctx context.Context) error {
+	for {
+		due, err := d.Outbox.DueWebhooks(ctx, d.now(), batchSize)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		for _, msg := range due {
+			if err := d.deliver(ctx, msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// deliver tries a message once and records the outcome.
+func (d *Dispatcher) deliver(ctx context.Context, msg models.WebhookMessage) error {
+	delivery := models.WebhookDelivery{MessageID: msg.ID, URL: msg.URL, Event: msg.Event, Attempt: msg.Attempts + 1}
+	var retryAt time.Time
+	hook, ok := d.hook(msg.URL)
+	if !ok {
+		// Dropped from the config while the message waited.
+		delivery.Error = "webhook is no longer configured"
+	} else {
+		delivery.Status, delivery.Error = d.send(ctx, hook, msg)
+		if ctx.Err() != nil {
+			// Shutting down: leave the message for the next start.
+			return ctx.Err()
+		}
+		switch {
+		case delivery.Delivered():
+		case delivery.Attempt >= MaxAttempts:
+			delivery.Error += fmt.Sprintf("; gave up after %d attempts", delivery.Attempt)
+		default:
+			retryAt = d.now().Add(Backoff(delivery.Attempt))
+		}
+	}
+	if !delivery.Delivered() {
+		log.Printf("Webhooks: %s to %s failed: %s", msg.Event, msg.URL, delivery.Error)
+	}
+	return d.Outbox.RecordWebhookDelivery(ctx, delivery, retryAt)
+}
+
+// send makes the call and returns the response status and, if it failed,
+// why.
+func (d *Dispatcher) send(ctx context.Context, hook Hook, msg models.WebhookMessage) (int, string) {
+	body := []byte(msg.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-todo-webhook")
+	req.Header.Set(EventHeader, msg.Event)
+	req.Header.Set(DeliveryHeader, msg.DeliveryID)
+	timestamp := d.now().Unix()
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+	}
+	resp, err := d.HTTP.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// Run delivers messages as they are queued and retries failed ones when
+// they are due, until ctx is cancelled. Messages left over are delivered
+// the next time it runs.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.Deliver(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
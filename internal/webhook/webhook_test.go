@@ -0,0 +1,196 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go-todo/internal/models"
+)
+
+var ctx = context.Background()
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// receiver is a webhook endpoint that fails the first failures calls.
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	calls    []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	r.calls = append(r.calls, req)
+	r.bodies = append(r.bodies, body)
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clock is a settable time shared by a dispatcher and its outbox.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newDispatcher(t *testing.T, hooks ...Hook) (*Dispatcher, *MemoryOutbox, *clock) {
+	t.Helper()
+	outbox := NewMemoryOutbox()
+	d, err := New(hooks, outbox)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	c := &clock{t: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	d.now, outbox.now = c.now, c.now
+	return d, outbox, c
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	rec := &receiver{}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+	d, outbox, _ := newDispatcher(t, Hook{URL: ts.URL, Secret: "shh"})
+
+	task := models.Task{ID: 7, Description: "Ship it", Done: true, CompletedAt: "2026-10-01 12:00:00"}
+	d.TaskChanged(ctx, models.EventCompleted, task)
+	if err := d.Deliver(ctx); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+
+	if len(rec.calls) != 1 {
+		t.Fatalf("Expected one call, got %d", len(rec.calls))
+	}
+	req, body := rec.calls[0], rec.bodies[0]
+	if err := Verify("shh", req.Header, body, d.now()); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	if err := Verify("shh", req.Header, body, d.now().Add(MaxSkew+time.Second)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected a replayed call to be refused, got %v", err)
+	}
+	replayed := req.Header.Clone()
+	replayed.Set(TimestampHeader, strconv.FormatInt(d.now().Add(time.Hour).Unix(), 10))
+	if err := Verify("shh", replayed, body, d.now().Add(time.Hour)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected a call with a changed timestamp to be refused, got %v", err)
+	}
+	if got := req.Header.Get(EventHeader); got != "task.completed" {
+		t.Errorf("Expected event header task.completed, got %q", got)
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Decoding payload: %v", err)
+	}
+	if payload.Event != "task.completed" || payload.Task != task || payload.ID != req.Header.Get(DeliveryHeader) {
+		t.Errorf("Expected the completed task in the payload, got %+v", payload)
+	}
+	log, _ := outbox.WebhookDeliveries(ctx, 10)
+	if len(log) != 1 || !log[0].Delivered() || log[0].Status != http.StatusNoContent {
+		t.Errorf("Expected one successful delivery logged, got %+v", log)
+	}
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	rec := &receiver{failures: 2}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+	d, outbox, c := newDispatcher(t, Hook{URL: ts.URL})
+
+	d.TaskChanged(ctx, models.EventCreated, models.Task{ID: 1, Description: "a"})
+	d.Deliver(ctx)
+	if len(rec.calls) != 1 {
+		t.Fatalf("Expected one call, got %d", len(rec.calls))
+	}
+	// Not due again until the backoff has passed.
+	c.t = c.t.Add(BaseDelay - time.Second)
+	d.Deliver(ctx)
+	if len(rec.calls) != 1 {
+		t.Errorf("Expected no retry before %v, got %d calls", BaseDelay, len(rec.calls))
+	}
+	c.t = c.t.Add(time.Second)
+	d.Deliver(ctx)
+	c.t = c.t.Add(2 * BaseDelay)
+	d.Deliver(ctx)
+	if len(rec.calls) != 3 {
+		t.Fatalf("Expected three calls, got %d", len(rec.calls))
+	}
+	if string(rec.bodies[0]) != string(rec.bodies[2]) {
+		t.Error("Expected retries to send the same payload")
+	}
+	log, _ := outbox.WebhookDeliveries(ctx, 10)
+	if len(log) != 3 || !log[0].Delivered() || log[0].Attempt != 3 || log[2].Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected two failures and a success logged, got %+v", log)
+	}
+	if due, _ := outbox.DueWebhooks(ctx, c.t.Add(MaxDelay), 10); len(due) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", due)
+	}
+}
+
+func TestDispatcher_GivesUp(t *testing.T) {
+	rec := &receiver{failures: MaxAttempts + 1}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+	d, outbox, c := newDispatcher(t, Hook{URL: ts.URL})
+
+	d.TaskChanged(ctx, models.EventDeleted, models.Task{ID: 1, Description: "a"})
+	for i := 0; i < MaxAttempts+2; i++ {
+		d.Deliver(ctx)
+		c.t = c.t.Add(MaxDelay)
+	}
+	if len(rec.calls) != MaxAttempts {
+		t.Errorf("Expected %d calls, got %d", MaxAttempts, len(rec.calls))
+	}
+	if due, _ := outbox.DueWebhooks(ctx, c.t, 10); len(due) != 0 {
+		t.Errorf("Expected the message to be given up, got %+v", due)
+	}
+}
+
+func TestDispatcher_FiltersEvents(t *testing.T) {
+	rec := &receiver{}
+	ts := httptest.NewServer(rec)
+	defer ts.Close()
+	d, _, _ := newDispatcher(t, Hook{URL: ts.URL, Events: []string{"task.completed"}})
+
+	d.TaskChanged(ctx, models.EventCreated, models.Task{ID: 1, Description: "a"})
+	d.TaskChanged(ctx, models.EventCompleted, models.Task{ID: 1, Description: "a", Done: true})
+	d.TaskChanged(ctx, models.EventRenamed, models.Task{ID: 1, Description: "b", Done: true})
+	d.Deliver(ctx)
+	if len(rec.calls) != 1 || rec.calls[0].Header.Get(EventHeader) != "task.completed" {
+		t.Errorf("Expected only the completion, got %d calls", len(rec.calls))
+	}
+	if rec.calls[0].Header.Get(SignatureHeader) != "" {
+		t.Error("Expected no signature without a secret")
+	}
+}
+
+func TestNew_RejectsInvalidHooks(t *testing.T) {
+	for _, hook := range []Hook{{URL: "ftp://example.com"}, {URL: ""}, {URL: "https://example.com", Events: []string{"task.exploded"}}} {
+		if _, err := New([]Hook{hook}, NewMemoryOutbox()); err == nil {
+			t.Errorf("Expected %+v to be rejected", hook)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: BaseDelay, 2: 2 * BaseDelay, 3: 4 * BaseDelay, 20: MaxDelay} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Expected backoff %v after %d attempts, got %v", want, attempts, got)
+		}
+	}
+}
@@ -1,15 +1,47 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
+	"go-todo/internal/backup"
+	"go-todo/internal/caldav"
+	"go-todo/internal/cli"
+	"go-todo/internal/config"
 	"go-todo/internal/controller"
+	"go-todo/internal/crdt"
+	"go-todo/internal/gitsync"
+	"go-todo/internal/hooks"
+	"go-todo/internal/models"
+	"go-todo/internal/scripting"
 	"go-todo/internal/storage"
+	"go-todo/internal/syncserver"
 	"go-todo/internal/ui"
+	"go-todo/internal/webhook"
 )
 
 func main() {
+	// Subcommands such as restore run without the TUI.
+	if len(os.Args) > 1 {
+		if cmd, ok := cli.Lookup(os.Args[1]); ok {
+			if err := cmd(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "go-todo %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	dsn := flag.String("db", storage.DefaultDSN, "storage backend as scheme://location, e.g. sqlite:///path/tasks.db, json:///path/tasks.json or memory://")
+	configPath := flag.String("config", "", "path to the config file (default: go-todo/config.json in the user config directory)")
+	flag.Parse()
+
 	logFile, err := os.OpenFile("todo_app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Fatalf("Failed to open log file: %v", err)
@@ -21,25 +53,110 @@ func main() {
 	log.Println("Application starting...")
 
 	// 1. Init Database Store
-	store, err := storage.NewStore()
+	store, err := storage.Open(*dsn)
 	if err != nil {
 		log.Fatalf("Failed to initialise data store: %v", err)
 	}
 	defer store.Close()
-	log.Println("Database store initialised.")
+	log.Printf("Data store %s initialised.", *dsn)
+
+	// 2. Unlock an encrypted store. Backups below copy the encrypted data as is.
+	rawStore := store
+	encrypted, err := storage.IsEncrypted(context.Background(), store)
+	if err != nil {
+		log.Fatalf("Failed to read data store: %v", err)
+	}
+	if encrypted {
+		err := ui.PromptPassphrase(*dsn, func(passphrase string) error {
+			unlocked, err := storage.Unlock(context.Background(), rawStore, passphrase)
+			if err != nil {
+				return err
+			}
+			store = unlocked
+			return nil
+		})
+		if errors.Is(err, ui.ErrCancelled) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("Failed to unlock data store: %v", err)
+		}
+		log.Println("Data store unlocked.")
+	}
+
+	// 3. Load preferences
+	if *configPath == "" {
+		if *configPath, err = config.DefaultPath(); err != nil {
+			log.Printf("Preferences will not be saved: %v", err)
+		}
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Printf("Using default preferences: %v", err)
+		cfg = &config.Config{}
+	}
+
+	// 4. Start rotating backups (SQLite only)
+	if sqliteStore, ok := rawStore.(*storage.Store); ok {
+		stop := startBackups(sqliteStore, cfg.BackupPolicy())
+		defer stop()
+	}
 
-	// 2. Initialise Controller
+	// 5. Initialise Controller
 	appController := controller.NewAppController(store)
+	appController.SetConfig(cfg, *configPath)
+	if *configPath != "" {
+		runner := hooks.New(filepath.Join(filepath.Dir(*configPath), hooks.DirName))
+		appController.SetHooks(runner)
+		appController.AddListener(runner)
+		stopHooks := runInBackground(runner.Run)
+		defer stopHooks()
+
+		scripts, err := scripting.Load(filepath.Join(filepath.Dir(*configPath), scripting.DirName))
+		if err != nil {
+			log.Printf("Error loading scripts: %v", err)
+			appController.Notify(fmt.Sprintf("Custom commands are off: %v", err))
+		} else {
+			appController.SetCommands(scripts)
+		}
+	}
+	if len(cfg.Webhooks) > 0 {
+		stop := startWebhooks(rawStore, cfg.Webhooks, appController)
+		defer stop()
+	}
 
-	// 3. Initialise UI
+	// 6. Sync through git, a shared folder, a sync server or a CalDAV
+	// server, if set up, and keep syncing changes
+	switch {
+	case cfg.SyncTargets() > 1:
+		appController.Notify("Sync is off: set only one of sync_repo, sync_folder, sync_server and caldav_url in the config.")
+	case cfg.SyncRepo != "":
+		stop := startSync(store, cfg.SyncRepo, appController)
+		defer stop()
+	case cfg.SyncFolder != "":
+		stop := startFolderSync(store, cfg.SyncFolder, *configPath, appController)
+		defer stop()
+	case cfg.SyncServer != "":
+		stop := startServerSync(store, cfg, appController)
+		defer stop()
+	case cfg.CalDAVURL != "":
+		stop := startCalDAVSync(store, cfg, appController)
+		defer stop()
+	}
+
+	// 7. Initialise UI
 	appUI := ui.NewUI(appController)
+	if err := appUI.BindKeys(cfg.Keys); err != nil {
+		log.Printf("Invalid key bindings: %v", err)
+		appController.Notify(fmt.Sprintf("The key bindings in the config are invalid, so the default keys are used:\n%v", err))
+	}
 	log.Println("UI initialised.")
 
-	// 4. Set UI for the controller
+	// 8. Set UI for the controller
 	appController.SetUI(appUI)
 	log.Println("UI set for controller.")
 
-	// 5. Start the application via the controller
+	// 9. Start the application via the controller
 	log.Println("Starting application controller...")
 	if err := appController.Start(); err != nil {
 		log.Fatalf("Application failed to start: %v", err)
@@ -47,3 +164,170 @@ func main() {
 
 	log.Println("Application stopped.")
 }
+
+// startBackups snapshots the database now and every backup.Interval in the
+// background. The returned func stops it and waits for a running snapshot
+// to finish, so the store can be closed safely afterwards.
+func startBackups(store *storage.Store, policy backup.Policy) func() {
+	return runInBackground(func(ctx context.Context) {
+		backup.For(store.Path(), policy).Run(ctx, store, backup.Interval)
+	})
+}
+
+// runInBackground starts run in a goroutine. The returned func cancels the
+// context passed to run and waits for it to return.
+func runInBackground(run func(ctx context.Context)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// startSync merges the tasks with the git working copy at repo and then
+// keeps syncing in the background. Conflicts and failures at startup are
+// passed to the controller to show once the UI is up. The returned func
+// stops the background sync after a last one.
+func startSync(store storage.Backend, repo string, c *controller.AppController) func() {
+	syncer, err := gitsync.New(repo, store)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		var conflicts []models.Conflict
+		conflicts, err = syncer.Sync(ctx)
+		cancel()
+		for _, conflict := range conflicts {
+			c.Notify(conflict.String())
+		}
+	}
+	if err != nil {
+		log.Printf("Sync failed: %v", err)
+		c.Notify(fmt.Sprintf("Sync failed: %v", err))
+		return func() {}
+	}
+
+	return runInBackground(func(ctx context.Context) { syncer.Run(ctx, gitsync.Interval) })
+}
+
+// startFolderSync merges the tasks with the changes in a shared folder and
+// then records changes to it in the background, as the replica whose ID is
+// kept beside the config file. Failures are passed to the controller to show
+// once the UI is up. The returned func stops the background recording after
+// a last one.
+func startFolderSync(store storage.Backend, folder, configPath string, c *controller.AppController) func() {
+	var syncer *crdt.Syncer
+	var replica string
+	err := errors.New("no config directory to keep the replica ID in")
+	if configPath != "" {
+		replica, err = crdt.ReplicaID(filepath.Join(filepath.Dir(configPath), crdt.ReplicaFile))
+	}
+	if err == nil {
+		syncer, err = crdt.New(folder, store, replica)
+	}
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err = syncer.Sync(ctx)
+		cancel()
+	}
+	if err != nil {
+		log.Printf("Folder sync failed: %v", err)
+		c.Notify(fmt.Sprintf("Folder sync failed: %v", err))
+		return func() {}
+	}
+
+	return runInBackground(func(ctx context.Context) { syncer.Run(ctx, crdt.Interval) })
+}
+
+// startServerSync syncs the tasks with the sync server set in cfg and then
+// keeps pulling and pushing changes in the background; the list reloads
+// when pulled changes land in the store. Conflicts and failures at startup
+// are passed to the controller to show once the UI is up. The returned func
+// stops the background sync after a last one.
+func startServerSync(store storage.Backend, cfg *config.Config, c *controller.AppController) func() {
+	token := cfg.SyncToken
+	if token == "" {
+		token = os.Getenv(syncserver.TokenEnv)
+	}
+	var syncer *syncserver.Syncer
+	client, err := syncserver.NewClient(cfg.SyncServer, token)
+	if err == nil {
+		syncer = syncserver.NewSyncer(client, store)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		var conflicts []models.Conflict
+		conflicts, err = syncer.Sync(ctx)
+		cancel()
+		for _, conflict := range conflicts {
+			c.Notify(conflict.String())
+		}
+	}
+	if err != nil {
+		log.Printf("Server sync failed: %v", err)
+		c.Notify(fmt.Sprintf("Server sync failed: %v", err))
+		// An unreachable server may come back; anything else needs the
+		// setup fixed first.
+		if !errors.Is(err, syncserver.ErrUnreachable) {
+			return func() {}
+		}
+	}
+
+	return runInBackground(func(ctx context.Context) { syncer.Run(ctx, syncserver.Interval) })
+}
+
+// startCalDAVSync syncs the tasks with the CalDAV collection set in cfg and
+// then keeps syncing in the background; the list reloads when changes from
+// the server land in the store. Conflicts and failures at startup are
+// passed to the controller to show once the UI is up. The returned func
+// stops the background sync after a last one.
+func startCalDAVSync(store storage.Backend, cfg *config.Config, c *controller.AppController) func() {
+	password := cfg.CalDAVPassword
+	if password == "" {
+		password = os.Getenv(caldav.PasswordEnv)
+	}
+	client, err := caldav.NewClient(cfg.CalDAVURL, cfg.CalDAVUser, password)
+	if err != nil {
+		c.Notify(fmt.Sprintf("CalDAV sync failed: %v", err))
+		return func() {}
+	}
+	syncer := caldav.NewSyncer(client, store)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	conflicts, err := syncer.Sync(ctx)
+	cancel()
+	for _, conflict := range conflicts {
+		c.Notify(conflict.String())
+	}
+	if err != nil {
+		// The server may only be out of reach for now, so keep trying.
+		log.Printf("CalDAV sync failed: %v", err)
+		c.Notify(fmt.Sprintf("CalDAV sync failed: %v", err))
+	}
+
+	return runInBackground(func(ctx context.Context) { syncer.Run(ctx, caldav.Interval) })
+}
+
+// startWebhooks sends the changes made in the application to hooks, keeping
+// calls in the database's outbox until they are delivered; stores without
+// one keep them in memory. The returned func stops delivering, leaving what
+// is not delivered yet for the next start.
+func startWebhooks(store storage.Backend, hooks []webhook.Hook, c *controller.AppController) func() {
+	if err := storage.RequirePlaintext(context.Background(), store, "webhooks"); err != nil {
+		c.Notify(fmt.Sprintf("Webhooks are off: %v", err))
+		return func() {}
+	}
+	outbox, ok := store.(webhook.Outbox)
+	if !ok {
+		log.Println("Webhook calls are kept in memory: the store has no outbox.")
+		outbox = webhook.NewMemoryOutbox()
+	}
+	dispatcher, err := webhook.New(hooks, outbox)
+	if err != nil {
+		c.Notify(fmt.Sprintf("Webhooks are off: %v", err))
+		return func() {}
+	}
+	c.AddListener(dispatcher)
+
+	return runInBackground(func(ctx context.Context) { dispatcher.Run(ctx) })
+}